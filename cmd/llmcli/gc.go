@@ -0,0 +1,25 @@
+package main
+
+import (
+	"flag"
+	"log"
+
+	"github.com/lengrongfu/LLMDistribution/pkg/filestorage"
+)
+
+// runGC removes the blobs of a local cache that no snapshot references
+func runGC(args []string) {
+	fs := flag.NewFlagSet("gc", flag.ExitOnError)
+	baseDir := fs.String("base-dir", "/tmp/LLMDistribution", "Base directory the models are stored in")
+	fs.Parse(args)
+
+	storage, err := filestorage.NewStorage(*baseDir)
+	if err != nil {
+		log.Fatalf("Failed to open storage: %v", err)
+	}
+	result, err := storage.CollectGarbage()
+	if err != nil {
+		log.Fatalf("Failed to collect garbage: %v", err)
+	}
+	log.Printf("Removed %d unreferenced blobs, reclaimed %d bytes", result.Removed, result.Bytes)
+}
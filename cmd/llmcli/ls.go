@@ -0,0 +1,86 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/lengrongfu/LLMDistribution/pkg/filestorage"
+)
+
+// runLs lists the models of a local cache with their revisions and sizes
+func runLs(args []string) {
+	fs := flag.NewFlagSet("ls", flag.ExitOnError)
+	baseDir := fs.String("base-dir", "/tmp/LLMDistribution", "Base directory the models are stored in")
+	asJSON := fs.Bool("json", false, "Print the listing as JSON")
+	fs.Parse(args)
+
+	storage, err := filestorage.NewStorage(*baseDir)
+	if err != nil {
+		log.Fatalf("Failed to open storage: %v", err)
+	}
+	models, err := storage.InspectModels()
+	if err != nil {
+		log.Fatalf("Failed to list models: %v", err)
+	}
+
+	if *asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(models); err != nil {
+			log.Fatalf("Failed to write listing: %v", err)
+		}
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "MODEL\tREFS\tSNAPSHOTS\tSIZE")
+	for _, m := range models {
+		refs := make([]string, 0, len(m.Refs))
+		for ref, sha := range m.Refs {
+			refs = append(refs, ref+"="+shortSha(sha))
+		}
+		sort.Strings(refs)
+		snapshots := make([]string, 0, len(m.Snapshots))
+		for _, sha := range m.Snapshots {
+			snapshots = append(snapshots, shortSha(sha))
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", m.ID, orDash(strings.Join(refs, ",")), orDash(strings.Join(snapshots, ",")), formatSize(m.Size))
+	}
+	w.Flush()
+}
+
+// shortSha abbreviates a commit like git does
+func shortSha(sha string) string {
+	if len(sha) > 7 {
+		return sha[:7]
+	}
+	return sha
+}
+
+// orDash fills an empty column
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// formatSize prints a byte count in binary units
+func formatSize(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(size)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,36 @@
+package main
+
+import "testing"
+
+func TestFormatSize(t *testing.T) {
+	tests := []struct {
+		size int64
+		want string
+	}{
+		{0, "0 B"},
+		{1023, "1023 B"},
+		{1024, "1.0 KiB"},
+		{1536, "1.5 KiB"},
+		{5 << 30, "5.0 GiB"},
+	}
+	for _, tt := range tests {
+		if got := formatSize(tt.size); got != tt.want {
+			t.Errorf("formatSize(%d) = %q, want %q", tt.size, got, tt.want)
+		}
+	}
+}
+
+func TestShortSha(t *testing.T) {
+	tests := []struct {
+		sha  string
+		want string
+	}{
+		{"0123456789abcdef0123456789abcdef01234567", "0123456"},
+		{"abc", "abc"},
+	}
+	for _, tt := range tests {
+		if got := shortSha(tt.sha); got != tt.want {
+			t.Errorf("shortSha(%q) = %q, want %q", tt.sha, got, tt.want)
+		}
+	}
+}
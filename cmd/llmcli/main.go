@@ -9,10 +9,12 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"path"
 	"path/filepath"
 	"strings"
 	"time"
 
+	"github.com/lengrongfu/LLMDistribution/pkg/utils"
 	"github.com/lengrongfu/hf-hub/api"
 )
 
@@ -35,18 +37,45 @@ type SiblingFile struct {
 	RFilename string `json:"rfilename"`
 }
 
-// convertModelIDToHFPath converts a model ID like "Qwen/Qwen2-0.5B-Instruct" to the
-// Hugging Face cache path format like "models--Qwen--Qwen2-0.5B-Instruct"
-func convertModelIDToHFPath(modelID string) string {
-	// Replace slashes with double dashes
-	return "models--" + strings.ReplaceAll(modelID, "/", "--")
-}
-
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "mirror":
+			runMirror(os.Args[2:])
+			return
+		case "gc":
+			runGC(os.Args[2:])
+			return
+		case "ls":
+			runLs(os.Args[2:])
+			return
+		case "push":
+			runPush(os.Args[2:])
+			return
+		}
+	}
+
 	// Parse command line flags
 	baseDir := flag.String("base-dir", "/tmp/LLMDistribution", "Base directory for storing models")
 	revision := flag.String("revision", "main", "Model revision/version to download")
+	indexFormat := flag.String("index-format", "hf", "Model index format to write (hf, manifest, none)")
+	include := flag.String("include", "", "Comma-separated glob patterns of files to download (default: all files)")
+	exclude := flag.String("exclude", "", "Comma-separated glob patterns of files to skip, takes precedence over -include")
+	token := flag.String("token", "", "Hugging Face access token for gated and private models (empty: $HF_TOKEN)")
 	flag.Parse()
+	// the token is read from the environment unless given, so it stays out of the process list
+	if *token == "" {
+		*token = os.Getenv("HF_TOKEN")
+	}
+	if *token != "" {
+		log.Printf("Using Hugging Face token %s", maskToken(*token))
+	}
+
+	switch *indexFormat {
+	case "hf", "manifest", "none":
+	default:
+		log.Fatalf("Invalid index format %q, must be one of hf, manifest, none", *indexFormat)
+	}
 
 	// Get the model ID from the command line arguments
 	args := flag.Args()
@@ -60,7 +89,7 @@ func main() {
 	log.Printf("Set HF_HOME environment variable to %s", *baseDir)
 
 	// Convert model ID to Hugging Face cache path format
-	hfModelPath := convertModelIDToHFPath(modelID)
+	hfModelPath := utils.ConvertModelIDToHFPath(modelID)
 
 	// Create the model directory path following Hugging Face structure
 	modelDir := filepath.Join(*baseDir, "hub", hfModelPath)
@@ -70,54 +99,150 @@ func main() {
 
 	// Download the model files from Hugging Face
 	log.Printf("Downloading model %s to %s", modelID, modelDir)
-	if err := downloadModelFiles(modelID, *revision); err != nil {
+	filter, err := newFileFilter(*include, *exclude)
+	if err != nil {
+		log.Fatalf("Invalid file filter: %v", err)
+	}
+	if err := downloadModelFiles(modelID, *revision, filter, *token); err != nil {
 		log.Fatalf("Failed to download model files: %v", err)
 	}
 
-	// Get the model index information directly from the Hugging Face API
-	log.Printf("Getting model index information for %s from Hugging Face API", modelID)
-	indexInfo, err := getModelIndex(modelID, *revision)
-	if err != nil {
-		log.Printf("Warning: Failed to get model index from Hugging Face API: %v", err)
-		// Create a basic model index if we couldn't get it from the API
-		log.Printf("Creating basic model index based on downloaded files")
-		indexInfo = createBasicModelIndex(modelID, modelDir)
-	}
+	switch *indexFormat {
+	case "hf":
+		// Get the model index information directly from the Hugging Face API
+		log.Printf("Getting model index information for %s from Hugging Face API", modelID)
+		indexInfo, err := getModelIndex(modelID, *revision, *token)
+		if err != nil {
+			log.Printf("Warning: Failed to get model index from Hugging Face API: %v", err)
+			// Create a basic model index if we couldn't get it from the API
+			log.Printf("Creating basic model index based on downloaded files")
+			indexInfo = createBasicModelIndex(modelID, modelDir)
+		}
 
-	// Save the model index information to a .modeindex file
-	indexPath := filepath.Join(modelDir, ".modeindex")
-	if err := saveModelIndex(indexInfo, indexPath); err != nil {
-		log.Fatalf("Failed to save model index: %v", err)
+		// Save the model index information to a .modeindex file
+		indexPath := filepath.Join(modelDir, ".modeindex")
+		if err := saveModelIndex(indexInfo, indexPath); err != nil {
+			log.Fatalf("Failed to save model index: %v", err)
+		}
+	case "manifest":
+		// Save a plain list of downloaded files and their sizes
+		manifestPath := filepath.Join(modelDir, ".manifest")
+		if err := saveManifest(modelDir, *revision, manifestPath); err != nil {
+			log.Fatalf("Failed to save manifest: %v", err)
+		}
 	}
 
 	log.Printf("Successfully downloaded model %s to %s", modelID, modelDir)
 }
 
-// downloadModelFiles downloads all files for a model from Hugging Face
-func downloadModelFiles(modelID, revision string) error {
+// fileFilter selects the repository files to download by glob patterns
+type fileFilter struct {
+	include []string
+	exclude []string
+}
+
+// newFileFilter parses comma-separated include and exclude glob patterns
+func newFileFilter(include, exclude string) (fileFilter, error) {
+	filter := fileFilter{
+		include: splitPatterns(include),
+		exclude: splitPatterns(exclude),
+	}
+	for _, pattern := range append(filter.include, filter.exclude...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fileFilter{}, fmt.Errorf("bad pattern %q: %w", pattern, err)
+		}
+	}
+	return filter, nil
+}
+
+// splitPatterns splits a comma-separated pattern list, dropping empty entries
+func splitPatterns(list string) []string {
+	var patterns []string
+	for _, pattern := range strings.Split(list, ",") {
+		if pattern = strings.TrimSpace(pattern); pattern != "" {
+			patterns = append(patterns, pattern)
+		}
+	}
+	return patterns
+}
+
+// matches reports whether a file should be downloaded, exclude patterns win over include patterns
+func (f fileFilter) matches(rfilename string) bool {
+	if matchAny(f.exclude, rfilename) {
+		return false
+	}
+	return len(f.include) == 0 || matchAny(f.include, rfilename)
+}
+
+// matchAny matches rfilename against the patterns, a pattern without a slash
+// also matches the base name so "*.json" selects files in subdirectories
+func matchAny(patterns []string, rfilename string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, rfilename); ok {
+			return true
+		}
+		if !strings.Contains(pattern, "/") {
+			if ok, _ := path.Match(pattern, path.Base(rfilename)); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// maskToken hides all but the last four characters of an access token for logging
+func maskToken(token string) string {
+	if len(token) <= 8 {
+		return "****"
+	}
+	return "****" + token[len(token)-4:]
+}
+
+// newHubClient creates a Hugging Face client sending token with its requests, the
+// token stored in the Hugging Face cache is used when token is empty
+func newHubClient(token string) (*api.Api, error) {
+	builder, err := api.NewApiBuilder()
+	if err != nil {
+		return nil, err
+	}
+	if token != "" {
+		builder = builder.WithToken(token)
+	}
+	return builder.Build(), nil
+}
+
+// downloadModelFiles downloads the files of a model selected by filter from Hugging Face,
+// authenticated with token for gated and private models
+func downloadModelFiles(modelID, revision string, filter fileFilter, token string) error {
 	// Create a new Hugging Face client
-	client, err := api.NewApi()
+	client, err := newHubClient(token)
 	if err != nil {
 		return fmt.Errorf("failed to create Hugging Face client: %w", err)
 	}
 
 	// Get the model
-	model := client.Model(modelID)
+	repo := api.NewModelRepo(modelID)
+	model := client.Repo(repo)
 
-	// Get model info to get the list of files
-	info, err := model.Info()
+	// Get model info to get the list of files, the info request of the client does
+	// not send the token so gated models are listed with getModelIndex
+	info, err := getModelIndex(modelID, repo.Revision(), token)
 	if err != nil {
 		return fmt.Errorf("failed to get model info: %w", err)
 	}
 
 	// Download each file from the siblings list
 	for _, sibling := range info.Siblings {
-		filename := sibling.Rfilename
+		filename := sibling.RFilename
 
 		// Skip directories or files we don't want to download
 		if strings.HasSuffix(filename, "/") {
 			continue
 		}
+		if !filter.matches(filename) {
+			log.Printf("Skipping %s", filename)
+			continue
+		}
 
 		log.Printf("Downloading %s", filename)
 		// Use the Get method which will download the file to the HF_HOME cache directory
@@ -132,10 +257,20 @@ func downloadModelFiles(modelID, revision string) error {
 	return nil
 }
 
-// getModelIndex gets model index information directly from the Hugging Face API
-func getModelIndex(modelID, version string) (ModelIndexInfo, error) {
+// hubEndpoint returns the Hugging Face endpoint, $HF_ENDPOINT like the downloads of
+// the Hugging Face client
+func hubEndpoint() string {
+	if endpoint := os.Getenv("HF_ENDPOINT"); endpoint != "" {
+		return strings.TrimSuffix(endpoint, "/")
+	}
+	return "https://huggingface.co"
+}
+
+// getModelIndex gets model index information directly from the Hugging Face API,
+// authenticated with token when it is set
+func getModelIndex(modelID, version, token string) (ModelIndexInfo, error) {
 	// Create the URL to the Hugging Face API
-	url := fmt.Sprintf("https://huggingface.co/api/models/%s/revision/%s", modelID, version)
+	url := fmt.Sprintf("%s/api/models/%s/revision/%s", hubEndpoint(), modelID, version)
 
 	// Create the context with timeout
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
@@ -146,6 +281,9 @@ func getModelIndex(modelID, version string) (ModelIndexInfo, error) {
 	if err != nil {
 		return ModelIndexInfo{}, fmt.Errorf("failed to create request: %w", err)
 	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
 
 	// Send the request
 	client := &http.Client{}
@@ -305,3 +443,41 @@ func saveModelIndex(indexInfo ModelIndexInfo, filePath string) error {
 
 	return nil
 }
+
+// saveManifest writes a newline-delimited list of "<filename>\t<size>" entries for
+// the files of a revision's snapshot
+func saveManifest(modelDir, revision, filePath string) error {
+	snapshotDir := filepath.Join(modelDir, "snapshots")
+	if sha, err := os.ReadFile(filepath.Join(modelDir, "refs", revision)); err == nil {
+		snapshotDir = filepath.Join(snapshotDir, strings.TrimSpace(string(sha)))
+	}
+
+	var manifest strings.Builder
+	err := filepath.Walk(snapshotDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		relPath, err := filepath.Rel(snapshotDir, path)
+		if err != nil {
+			return err
+		}
+		// Resolve symlinks to the blob to report the real file size
+		target, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(&manifest, "%s\t%d\n", filepath.ToSlash(relPath), target.Size())
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to walk snapshot directory: %w", err)
+	}
+
+	if err := os.WriteFile(filePath, []byte(manifest.String()), 0644); err != nil {
+		return fmt.Errorf("failed to write manifest file: %w", err)
+	}
+	return nil
+}
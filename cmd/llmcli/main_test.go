@@ -0,0 +1,151 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSaveManifest(t *testing.T) {
+	const commit = "0123456789abcdef0123456789abcdef01234567"
+	modelDir := t.TempDir()
+	blob := filepath.Join(modelDir, "blobs", "abc")
+	snapshot := filepath.Join(modelDir, "snapshots", commit)
+	for _, dir := range []string{filepath.Dir(blob), filepath.Join(snapshot, "sub"), filepath.Join(modelDir, "refs")} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(blob, []byte("12345"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(blob, filepath.Join(snapshot, "model.bin")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(snapshot, "sub", "config.json"), []byte("{}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(modelDir, "refs", "main"), []byte(commit+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	manifestPath := filepath.Join(modelDir, ".manifest")
+	if err := saveManifest(modelDir, "main", manifestPath); err != nil {
+		t.Fatalf("saveManifest: %v", err)
+	}
+	data, err := os.ReadFile(manifestPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "model.bin\t5\nsub/config.json\t2\n"; string(data) != want {
+		t.Errorf("manifest = %q, want %q", data, want)
+	}
+}
+
+func TestFileFilter(t *testing.T) {
+	tests := []struct {
+		name    string
+		include string
+		exclude string
+		file    string
+		want    bool
+	}{
+		{"no patterns", "", "", "model.safetensors", true},
+		{"included", "*.json", "", "config.json", true},
+		{"not included", "*.json", "", "model.safetensors", false},
+		{"base name in subdirectory", "*.json", "", "sub/config.json", true},
+		{"pattern with directory", "onnx/*", "", "onnx/model.onnx", true},
+		{"directory pattern only matches the path", "onnx/*", "", "model.onnx", false},
+		{"excluded", "", "*.bin", "pytorch_model.bin", false},
+		{"exclude wins", "*.bin,*.json", "pytorch_*", "pytorch_model.bin", false},
+		{"pattern list with spaces", " *.txt , *.json ", "", "config.json", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filter, err := newFileFilter(tt.include, tt.exclude)
+			if err != nil {
+				t.Fatalf("newFileFilter: %v", err)
+			}
+			if got := filter.matches(tt.file); got != tt.want {
+				t.Errorf("matches(%q) = %v, want %v", tt.file, got, tt.want)
+			}
+		})
+	}
+
+	if _, err := newFileFilter("[", ""); err == nil {
+		t.Error("newFileFilter accepted a malformed pattern")
+	}
+}
+
+func TestMaskToken(t *testing.T) {
+	tests := []struct {
+		token string
+		want  string
+	}{
+		{"short", "****"},
+		{"hf_12345", "****"},
+		{"hf_abcdefghijkl", "****ijkl"},
+	}
+	for _, tt := range tests {
+		if got := maskToken(tt.token); got != tt.want {
+			t.Errorf("maskToken(%q) = %q, want %q", tt.token, got, tt.want)
+		}
+	}
+}
+
+func TestHubEndpoint(t *testing.T) {
+	tests := []struct {
+		env  string
+		want string
+	}{
+		{"", "https://huggingface.co"},
+		{"https://hf-mirror.com/", "https://hf-mirror.com"},
+		{"http://127.0.0.1:8081", "http://127.0.0.1:8081"},
+	}
+	for _, tt := range tests {
+		t.Setenv("HF_ENDPOINT", tt.env)
+		if got := hubEndpoint(); got != tt.want {
+			t.Errorf("hubEndpoint with HF_ENDPOINT=%q = %q, want %q", tt.env, got, tt.want)
+		}
+	}
+}
+
+func TestGetModelIndexSendsToken(t *testing.T) {
+	hub := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/models/org/gated/revision/main" {
+			http.NotFound(w, r)
+			return
+		}
+		if r.Header.Get("Authorization") != "Bearer hf_secret" {
+			http.Error(w, "gated model", http.StatusUnauthorized)
+			return
+		}
+		io.WriteString(w, `{"id":"org/gated","sha":"abc","siblings":[{"rfilename":"config.json"}]}`)
+	}))
+	defer hub.Close()
+	t.Setenv("HF_ENDPOINT", hub.URL)
+
+	tests := []struct {
+		name    string
+		token   string
+		wantErr bool
+	}{
+		{"with token", "hf_secret", false},
+		{"without token", "", true},
+		{"wrong token", "hf_other", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			info, err := getModelIndex("org/gated", "main", tt.token)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("getModelIndex error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && (info.SHA != "abc" || len(info.Siblings) != 1 || info.Siblings[0].RFilename != "config.json") {
+				t.Errorf("index = %+v", info)
+			}
+		})
+	}
+}
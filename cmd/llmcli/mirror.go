@@ -0,0 +1,45 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"os"
+
+	"github.com/lengrongfu/LLMDistribution/pkg/client"
+)
+
+// runMirror copies a model from one llmdistribution server to another
+func runMirror(args []string) {
+	fs := flag.NewFlagSet("mirror", flag.ExitOnError)
+	from := fs.String("from", "", "URL of the source llmdistribution server")
+	to := fs.String("to", "", "URL of the destination llmdistribution server")
+	revision := fs.String("revision", "main", "Model revision/version to mirror")
+	fromToken := fs.String("from-token", "", "Token of the source server for private models")
+	toToken := fs.String("to-token", "", "Admin token of the destination server, required for uploads (empty: $LLMD_TOKEN)")
+	fs.Parse(args)
+
+	if *from == "" || *to == "" {
+		log.Fatal("Both -from and -to are required")
+	}
+	if fs.NArg() < 1 {
+		log.Fatal("Model ID is required")
+	}
+	modelID := fs.Arg(0)
+
+	if *toToken == "" {
+		*toToken = os.Getenv("LLMD_TOKEN")
+	}
+
+	src := client.NewClient(*from)
+	src.WithToken(*fromToken)
+	dst := client.NewClient(*to)
+	dst.WithToken(*toToken)
+	log.Printf("Mirroring model %s@%s from %s to %s", modelID, *revision, *from, *to)
+	result, err := dst.SyncModel(context.Background(), src, modelID, *revision)
+	if err != nil {
+		log.Fatalf("Failed to mirror model: %v", err)
+	}
+	log.Printf("Successfully mirrored model %s: %d files copied, %d already present",
+		modelID, len(result.Copied), len(result.Skipped))
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"os"
+
+	"github.com/lengrongfu/LLMDistribution/pkg/client"
+)
+
+// runPush uploads a model from a local Hugging Face cache or directory to an
+// llmdistribution server
+func runPush(args []string) {
+	fs := flag.NewFlagSet("push", flag.ExitOnError)
+	server := fs.String("server", "", "URL of the llmdistribution server to push to")
+	path := fs.String("path", "", "Local Hugging Face cache, model directory or directory of model files")
+	revision := fs.String("revision", "main", "Revision of the local model to push")
+	token := fs.String("token", "", "Admin token of the server, required for uploads (empty: $LLMD_TOKEN)")
+	fs.Parse(args)
+	// flags may also follow the model ID
+	modelID := fs.Arg(0)
+	if fs.NArg() > 1 {
+		fs.Parse(fs.Args()[1:])
+	}
+
+	if *server == "" || *path == "" {
+		log.Fatal("Both -server and -path are required")
+	}
+	if modelID == "" {
+		log.Fatal("Model ID is required")
+	}
+
+	if *token == "" {
+		*token = os.Getenv("LLMD_TOKEN")
+	}
+
+	c := client.NewClient(*server)
+	c.WithToken(*token)
+	log.Printf("Pushing model %s@%s from %s to %s", modelID, *revision, *path, *server)
+	result, err := c.PushModel(context.Background(), modelID, *revision, *path)
+	if err != nil {
+		log.Fatalf("Failed to push model: %v", err)
+	}
+	log.Printf("Successfully pushed model %s from %s: %d files, %s",
+		modelID, result.Snapshot, result.Files, formatSize(result.Bytes))
+}
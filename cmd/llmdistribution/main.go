@@ -2,61 +2,153 @@ package main
 
 import (
 	"context"
+	"errors"
 	"flag"
-	"log"
+	"fmt"
+	"log/slog"
+	"net/http"
 	"os"
 	"os/signal"
 	"path/filepath"
+	"strings"
 	"syscall"
 	"time"
 
-	"github.com/lengrongfu/LLMDistribution/pkg/api"
+	"github.com/lengrongfu/LLMDistribution/pkg/git"
 	"github.com/lengrongfu/LLMDistribution/pkg/server"
+	"github.com/lengrongfu/LLMDistribution/pkg/utils"
 )
 
 func main() {
 	// Create base directories for storage
 	homeDir, err := os.UserHomeDir()
 	if err != nil {
-		log.Fatalf("Failed to get user home directory: %v", err)
+		slog.Error("failed to get user home directory", "error", err)
+		os.Exit(1)
 	}
-	// Parse command line flags
-	host := flag.String("host", "0.0.0.0", "Server host")
-	port := flag.Int("port", 8081, "Server port")
-	gitBaseDir := flag.String("git-base-dir", filepath.Join(homeDir, ".llm-distribution", "git"), "Git base directory")
-	fileBaseDir := flag.String("file-base-dir", "/tmp/LLMDistribution", "File base directory")
-	fallbackProxy := flag.Bool("fallback-proxy", true, "Fallback to proxy if file not found")
-	proxyBaseURL := flag.String("proxy-base-url", "https://huggingface.co", "Proxy base URL")
-	enableProxy := flag.Bool("enable-proxy", false, "Enable proxy")
-	storageType := flag.Int("storage-type", 1, "Storage type (0: Git, 1: File, 2: Proxy)")
+	// Parse command line flags, they override values loaded from the config file
+	var config server.Config
+	configPath := flag.String("config", "", "Path to a YAML or JSON config file")
+	flag.StringVar(&config.Host, "host", "0.0.0.0", "Server host")
+	flag.IntVar(&config.Port, "port", 8081, "Server port")
+	flag.StringVar(&config.GitBaseDir, "git-base-dir", filepath.Join(homeDir, ".llm-distribution", "git"), "Git base directory")
+	flag.StringVar(&config.FileBaseDir, "file-base-dir", "/tmp/LLMDistribution", "File base directory")
+	flag.StringVar(&config.Layout, "layout", string(utils.LayoutHF), "Layout of the cached files of a model (hf: models--org--name, flat: org/name)")
+	flag.StringVar(&config.RepoType, "repo-type", string(utils.RepoModel), "Type of the served repositories, naming their cache directories (model: models--org--name, dataset: datasets--org--name, space: spaces--org--name)")
+	flag.StringVar(&config.BlobDir, "blob-dir", "", "Directory to keep the cached blobs in, separate from the snapshots (empty: in the model directories)")
+	flag.StringVar(&config.GitCommitTemplate, "git-commit-template", git.DefaultCommitTemplate, "Commit message of files stored in git, {filename}, {modelID} and {count} are replaced")
+	flag.StringVar(&config.DefaultRevision, "default-revision", "main", "Revision used when a request names none, resolved to the latest snapshot when the model has no such ref")
+	flag.BoolVar(&config.FallbackProxy, "fallback-proxy", true, "Fallback to proxy if file not found")
+	flag.StringVar(&config.ProxyBaseURL, "proxy-base-url", "https://huggingface.co", "Proxy base URL, a comma-separated list of upstreams is tried in order when an upstream fails")
+	flag.BoolVar(&config.EnableProxy, "enable-proxy", false, "Enable proxy")
+	flag.IntVar((*int)(&config.StorageType), "storage-type", 1, "Storage type (0: Git, 1: File, 2: OSS)")
+	flag.StringVar(&config.OSSEndpoint, "oss-endpoint", "", "OSS endpoint of the bucket of OSS storage, e.g. oss-cn-hangzhou.aliyuncs.com")
+	flag.StringVar(&config.OSSBucket, "oss-bucket", "", "OSS bucket of OSS storage")
+	flag.StringVar(&config.OSSPrefix, "oss-prefix", "hub", "Key prefix the models are stored below in the OSS bucket")
+	flag.StringVar(&config.OSSAccessKeyID, "oss-access-key-id", "", "AccessKey ID of OSS storage (empty: $OSS_ACCESS_KEY_ID)")
+	flag.StringVar(&config.OSSAccessKeySecret, "oss-access-key-secret", "", "AccessKey secret of OSS storage (empty: $OSS_ACCESS_KEY_SECRET)")
+	flag.BoolVar(&config.RedirectOnMiss, "redirect-on-miss", false, "Redirect cache misses to the upstream and fill the cache in the background")
+	flag.BoolVar(&config.RewriteLocation, "rewrite-location", false, "Point upstream CDN redirects back at this server, for clients that can not reach the CDN")
+	flag.BoolVar(&config.KeepOldSnapshots, "keep-old-snapshots", true, "Keep old snapshots when a proxied ref moves to a new sha")
+	flag.BoolVar(&config.SharedBlobs, "shared-blobs", false, "Deduplicate identical blobs across models in a shared blob directory")
+	flag.BoolVar(&config.StrictBlobs, "strict-blobs", false, "Refuse to overwrite a cached blob with content that differs for the same etag")
+	flag.DurationVar(&config.AccessFlushInterval, "access-flush-interval", time.Minute, "How often the last access of each served model is written to disk (0: no access tracking)")
+	flag.Int64Var(&config.SparseCacheMinSize, "sparse-cache-min-size", 0, "Cache only the requested ranges of files of at least this size in bytes (0: disabled)")
+	flag.DurationVar(&config.IndexCacheTTL, "index-cache-ttl", 30*time.Second, "How long a model index built from a snapshot is reused (0: disabled)")
+	flag.BoolVar(&config.MergeIndex, "merge-index", false, "Add local files missing from a cached upstream model index to the served index")
+	flag.BoolVar(&config.StreamIndex, "stream-index", false, "Stream model indexes built from a snapshot instead of building them in memory, for repositories with very many files")
+	flag.BoolVar(&config.OpenAIModels, "openai-models", false, "Serve the cached models at the OpenAI compatible /v1/models listing")
+	flag.BoolVar(&config.WebDAV, "webdav", false, "Serve the models of the storage over WebDAV at /dav")
+	flag.StringVar(&config.WebDAVWriteToken, "webdav-write-token", "", "Token allowing WebDAV clients to upload and delete files (empty: read-only)")
+	flag.Int64Var(&config.MmapMaxFileSize, "mmap-max-file-size", 0, "Serve files up to this size in bytes from memory-mapped regions (0: disabled)")
+	flag.IntVar(&config.MmapCacheEntries, "mmap-cache-entries", 128, "Maximum number of memory-mapped files")
+	flag.DurationVar(&config.UpstreamTimeout, "upstream-timeout", 60*time.Second, "Timeout for upstream requests and response headers")
+	flag.IntVar(&config.MaxIdleConns, "max-idle-conns", 100, "Maximum idle connections to the upstream")
+	flag.DurationVar(&config.IdleConnTimeout, "idle-conn-timeout", 90*time.Second, "How long idle upstream connections are kept")
+	flag.DurationVar(&config.APICacheTTL, "api-cache-ttl", 10*time.Minute, "How long proxied API responses are served from the cache (0: disabled)")
+	flag.DurationVar(&config.APICacheMaxStale, "api-cache-max-stale", 24*time.Hour, "How long expired API responses are still served while the upstream is unavailable (0: never)")
+	config.APICachePaths = []string{"/api/models"}
+	flag.Var((*stringList)(&config.APICachePaths), "api-cache-paths", "Comma-separated upstream API path prefixes to cache")
+	flag.IntVar(&config.MaxConcurrentPerModel, "max-concurrent-per-model", 0, "Maximum concurrent downloads per model (0: unlimited)")
+	flag.Int64Var(&config.PerIPBytes, "per-ip-daily-bytes", 0, "Maximum bytes downloaded by a client IP per quota window (0: unlimited)")
+	flag.DurationVar(&config.PerIPQuotaWindow, "per-ip-quota-window", 24*time.Hour, "Period after which a client's download quota resets")
+	flag.Float64Var(&config.PerIPRequestRate, "per-ip-request-rate", 0, "Maximum requests per second of a client IP to the file and index routes (0: unlimited)")
+	flag.IntVar(&config.PerIPBurst, "per-ip-burst", 0, "Requests a client IP may send at once above its request rate (0: the rate rounded up)")
+	flag.IntVar(&config.PerIPMaxConcurrent, "per-ip-max-concurrent", 0, "Maximum requests of a client IP in flight to the file and index routes (0: unlimited)")
+	flag.Int64Var(&config.RateLimit, "rate-limit", 0, "Maximum bytes per second of each file download and proxied response (0: unlimited)")
+	flag.Int64Var(&config.MaxUploadBytes, "max-upload-bytes", 50<<30, "Maximum size of an uploaded file in bytes (0: unlimited)")
+	flag.StringVar(&config.OTLPEndpoint, "otlp-endpoint", "", "OTLP/HTTP collector URL to export traces to (empty: disabled)")
+	flag.StringVar(&config.DownloadWebhook, "download-webhook", "", "URL to POST a JSON event to for every completed download (empty: disabled)")
+	flag.StringVar(&config.AccessLog, "access-log", "", "File to append one JSON object per request to (empty: disabled)")
+	flag.Int64Var(&config.AccessLogMaxSize, "access-log-max-size", 0, "Rotate the access log to <access-log>.1 before it grows beyond this many bytes (0: append only)")
+	flag.DurationVar(&config.BlobReverifyAge, "blob-reverify-age", 0, "Re-hash cached blobs older than this before serving them, e.g. 720h (0: disabled)")
+	flag.DurationVar(&config.IndexRefreshInterval, "index-refresh-interval", 0, "Regenerate .modeindex files of snapshots changed out of band this often, e.g. 10m (0: disabled)")
+	flag.DurationVar(&config.BlobCompressAfter, "blob-compress-after", 0, "Compress cached blobs not read for this long with zstd, e.g. 720h (0: disabled)")
+	config.CORSOrigins = []string{"*"}
+	flag.Var((*stringList)(&config.CORSOrigins), "cors-origins", "Comma-separated origins allowed to make cross-origin requests (*: any origin)")
+	flag.Var((*stringList)(&config.CORSMethods), "cors-methods", "Comma-separated methods allowed in cross-origin requests (empty: GET, HEAD and POST)")
+	flag.Var((*stringList)(&config.CORSHeaders), "cors-headers", "Comma-separated request headers allowed in cross-origin requests")
+	flag.StringVar(&config.AdminToken, "admin-token", "", "Bearer token authorizing uploads and administrative operations (empty: disabled)")
+	flag.StringVar(&config.ACLFile, "acl-file", "", "YAML file listing private models and the tokens allowed to access them")
+	logLevel := flag.String("log-level", "info", "Log level (debug, info, warn, error)")
 	flag.Usage = func() {
-		log.Println("Usage: llmdistribution [options]")
+		fmt.Fprintln(flag.CommandLine.Output(), "Usage: llmdistribution [options]")
 		flag.PrintDefaults()
 	}
 	flag.Parse()
 
-	// Create the server configuration
-	config := server.Config{
-		Host:          *host,
-		Port:          *port,
-		StorageType:   api.StorageType(*storageType),
-		GitBaseDir:    *gitBaseDir,
-		FileBaseDir:   *fileBaseDir,
-		ProxyBaseURL:  *proxyBaseURL,
-		EnableProxy:   *enableProxy,
-		FallbackProxy: *fallbackProxy,
+	// Configure the structured logger
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(*logLevel)); err != nil {
+		slog.Error("invalid log level", "level", *logLevel, "error", err)
+		os.Exit(1)
+	}
+	slog.SetDefault(slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: level})))
+
+	// Load the config file, keeping the values of explicitly set flags
+	if *configPath != "" {
+		explicit := make(map[string]string)
+		flag.Visit(func(f *flag.Flag) {
+			explicit[f.Name] = f.Value.String()
+		})
+		if err := server.LoadConfigFile(*configPath, &config); err != nil {
+			slog.Error("failed to load config file", "path", *configPath, "error", err)
+			os.Exit(1)
+		}
+		for name, value := range explicit {
+			if err := flag.Set(name, value); err != nil {
+				slog.Error("failed to apply flag", "flag", name, "error", err)
+				os.Exit(1)
+			}
+		}
+	}
+	// the OSS AccessKey pair is read from the environment unless configured, so the
+	// secret does not show up in the usage or the process list
+	if config.OSSAccessKeyID == "" {
+		config.OSSAccessKeyID = os.Getenv("OSS_ACCESS_KEY_ID")
+	}
+	if config.OSSAccessKeySecret == "" {
+		config.OSSAccessKeySecret = os.Getenv("OSS_ACCESS_KEY_SECRET")
+	}
+	if err := config.Validate(); err != nil {
+		slog.Error("invalid configuration", "error", err)
+		os.Exit(1)
 	}
 
 	// Create the server
 	srv, err := server.NewServer(config)
 	if err != nil {
-		log.Fatalf("Failed to create server: %v", err)
+		slog.Error("failed to create server", "error", err)
+		os.Exit(1)
 	}
 
 	// Start the server in a goroutine
 	go func() {
-		if err := srv.Start(); err != nil {
-			log.Fatalf("Failed to start server: %v", err)
+		// Start returns ErrServerClosed once Shutdown begins, the process then exits
+		// after Shutdown drained the in-flight requests and background cache writes
+		if err := srv.Start(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("failed to start server", "error", err)
+			os.Exit(1)
 		}
 	}()
 
@@ -65,7 +157,7 @@ func main() {
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 	<-quit
 
-	log.Println("Shutting down server...")
+	slog.Info("shutting down server")
 
 	// Create a deadline to wait for
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
@@ -73,8 +165,21 @@ func main() {
 
 	// Shut down the server
 	if err := srv.Shutdown(ctx); err != nil {
-		log.Fatalf("Server forced to shutdown: %v", err)
+		slog.Error("server forced to shutdown", "error", err)
+		os.Exit(1)
 	}
 
-	log.Println("Server exiting")
+	slog.Info("server exiting")
+}
+
+// stringList is a comma-separated list flag
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = strings.Split(value, ",")
+	return nil
 }
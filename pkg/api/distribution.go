@@ -1,8 +1,11 @@
 package api
 
 import (
+	"errors"
+	"fmt"
 	"io"
 	"os"
+	"strings"
 
 	"github.com/lengrongfu/LLMDistribution/pkg/api/model"
 )
@@ -15,8 +18,32 @@ const (
 	GitStorage StorageType = iota
 	// FileStorage represents file storage
 	FileStorage
+	// OSSStorage represents Aliyun OSS object storage
+	OSSStorage
 )
 
+// ErrUnsupportedOperation is returned by a Distribution for operations its storage type cannot perform
+var ErrUnsupportedOperation = errors.New("unsupported operation")
+
+// ErrUploadOffsetMismatch is returned when a resumed upload does not start where the partial upload ended
+var ErrUploadOffsetMismatch = errors.New("upload offset mismatch")
+
+// ErrBlobCorrupt is returned when the content of a cached blob does not match its etag
+var ErrBlobCorrupt = errors.New("blob content does not match etag")
+
+// RevisionNotFoundError is returned when a model is cached but not at the requested revision
+type RevisionNotFoundError struct {
+	ModelID  string
+	Revision string
+	// Available lists the cached refs and snapshot commits of the model
+	Available []string
+}
+
+func (e *RevisionNotFoundError) Error() string {
+	return fmt.Sprintf("revision %s of model %s is not cached, available revisions: %s",
+		e.Revision, e.ModelID, strings.Join(e.Available, ", "))
+}
+
 // StorageBackend represents a storage backend
 type StorageBackend interface {
 	// StoreFile stores a file and returns the path to the stored file
@@ -48,3 +75,115 @@ type Distribution interface {
 	// RepoSha gets the SHA for a repository
 	RepoSha(modelID, version string) string
 }
+
+// ResumableUploader is implemented by distributions that can resume interrupted uploads
+type ResumableUploader interface {
+	// UploadOffset returns the number of bytes already received for an interrupted upload
+	UploadOffset(modelID, filename string) (int64, error)
+	// StoreFileAt writes content at offset of a partial upload and reports whether
+	// the upload is complete after total bytes have been received
+	StoreFileAt(modelID, filename string, offset, total int64, content io.Reader) (string, bool, error)
+	// DiscardUpload removes the partial upload of a file
+	DiscardUpload(modelID, filename string) error
+}
+
+// SnapshotChecker is implemented by distributions that can verify cached snapshots
+type SnapshotChecker interface {
+	// CheckModel verifies that the snapshot files of a model resolve to their blobs,
+	// in deep mode the blob content is also compared with its etag
+	CheckModel(modelID string, deep bool) ([]model.FileCheck, error)
+}
+
+// ModelDeleter is implemented by distributions that can remove a cached model
+type ModelDeleter interface {
+	// DeleteModel removes all snapshots, refs and blobs of a model that are not
+	// referenced by another model
+	DeleteModel(modelID string) error
+}
+
+// TreeLister is implemented by distributions that can list the directories of a snapshot
+type TreeLister interface {
+	// ListTree lists the files and directories below dir of a snapshot, the whole
+	// subtree when recursive is set
+	ListTree(modelID, sha, dir string, recursive bool) ([]model.TreeEntry, error)
+}
+
+// GarbageCollector is implemented by distributions that can remove unreferenced blobs
+type GarbageCollector interface {
+	// CollectGarbage removes the blobs no snapshot links to
+	CollectGarbage() (model.GCResult, error)
+}
+
+// Reindexer is implemented by distributions that can regenerate the model index of a model
+type Reindexer interface {
+	// Reindex regenerates the model index of a model from the snapshot of its default
+	// revision, picking up files added to the snapshot out of band
+	Reindex(modelID string) (model.ReindexResult, error)
+}
+
+// EvictionPlanner is implemented by distributions that can report which models an
+// eviction would remove
+type EvictionPlanner interface {
+	// EvictionPreview lists the models, least recently accessed first, that would
+	// be evicted to shrink the storage to targetBytes without removing anything
+	EvictionPreview(targetBytes int64) (model.EvictionPreview, error)
+}
+
+// SnapshotPinner is implemented by distributions that protect snapshots in use from eviction
+type SnapshotPinner interface {
+	// PinSnapshot keeps the snapshot sha of a model from being evicted until it is
+	// unpinned as often as it was pinned
+	PinSnapshot(modelID, sha string)
+	// UnpinSnapshot releases a pin taken with PinSnapshot
+	UnpinSnapshot(modelID, sha string)
+	// SnapshotPinned reports whether the snapshot sha of a model is pinned
+	SnapshotPinned(modelID, sha string) bool
+}
+
+// FileVerifier is implemented by distributions that re-verify cached blobs before serving
+type FileVerifier interface {
+	// VerifyFile checks the blob of a file against its etag when it is due for
+	// re-verification, returning ErrBlobCorrupt on a mismatch
+	VerifyFile(modelID, sha, filename string) error
+}
+
+// SnapshotWriter is implemented by distributions that can add files to a cached snapshot
+type SnapshotWriter interface {
+	// AddToSnapshot stores content as a new blob linked as filename into the existing
+	// snapshot sha and returns the etag of the blob
+	AddToSnapshot(modelID, sha, filename string, content io.Reader) (string, error)
+}
+
+// SnapshotUploader is implemented by distributions that can store uploaded files in the
+// snapshots served by the resolve route
+type SnapshotUploader interface {
+	// StoreSnapshotFile stores content as filename in the snapshot of revision, a
+	// commit sha or a ref, and returns the commit and the etag of the stored file
+	StoreSnapshotFile(modelID, revision, filename string, content io.Reader) (string, string, error)
+}
+
+// HealthChecker is implemented by distributions that can report whether their storage is usable
+type HealthChecker interface {
+	// CheckHealth returns an error describing why the storage can not be used
+	CheckHealth() error
+}
+
+// RevisionLister is implemented by distributions that can list the cached revisions of a model
+type RevisionLister interface {
+	// Revisions lists the cached refs and snapshot commits of a model
+	Revisions(modelID string) ([]string, error)
+}
+
+// IndexStreamer is implemented by distributions that can write a model index without
+// holding all of its siblings in memory
+type IndexStreamer interface {
+	// StreamRepoInfo writes the model index of a version to w as JSON. It writes
+	// nothing when it fails to resolve the version.
+	StreamRepoInfo(modelID, version string, w io.Writer) error
+}
+
+// ModelLister is implemented by distributions that can list the models they hold
+type ModelLister interface {
+	// ListModels lists the models in the storage sorted by ID
+	ListModels() ([]model.CachedModel, error)
+}
@@ -0,0 +1,303 @@
+// Package memstore provides an in-memory api.Distribution for exercising the server
+// without touching the filesystem or git.
+package memstore
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lengrongfu/LLMDistribution/pkg/api"
+	"github.com/lengrongfu/LLMDistribution/pkg/api/model"
+	"github.com/lengrongfu/LLMDistribution/pkg/utils"
+)
+
+// defaultRevision is the branch every stored file is committed to
+const defaultRevision = "main"
+
+// Distribution keeps the files of every model in memory. Every stored file creates a
+// new commit holding the files of the previous one, and "main" points to the newest
+// commit.
+type Distribution struct {
+	mu     sync.RWMutex
+	models map[string]*memModel
+}
+
+type memModel struct {
+	refs    map[string]string
+	commits map[string]*commit
+	updated time.Time
+}
+
+type commit struct {
+	files   map[string]*file
+	created time.Time
+}
+
+type file struct {
+	content []byte
+	etag    string
+	modTime time.Time
+}
+
+var (
+	_ api.Distribution   = (*Distribution)(nil)
+	_ api.ModelLister    = (*Distribution)(nil)
+	_ api.ModelDeleter   = (*Distribution)(nil)
+	_ api.RevisionLister = (*Distribution)(nil)
+)
+
+// New creates an empty in-memory distribution
+func New() *Distribution {
+	return &Distribution{models: make(map[string]*memModel)}
+}
+
+// StoreFile commits content as filename of a model and returns its repository path
+func (d *Distribution) StoreFile(modelID, filename string, content io.Reader) (string, error) {
+	data, err := io.ReadAll(content)
+	if err != nil {
+		return "", fmt.Errorf("failed to read content: %w", err)
+	}
+	sum := sha256.Sum256(data)
+	etag, err := utils.ComputeEtag(filename, bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return "", err
+	}
+	now := time.Now().UTC()
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	m, ok := d.models[modelID]
+	if !ok {
+		m = &memModel{refs: make(map[string]string), commits: make(map[string]*commit)}
+		d.models[modelID] = m
+	}
+	parent := m.refs[defaultRevision]
+	next := &commit{files: make(map[string]*file), created: now}
+	if prev, ok := m.commits[parent]; ok {
+		for name, f := range prev.files {
+			next.files[name] = f
+		}
+	}
+	next.files[filename] = &file{content: data, etag: etag, modTime: now}
+
+	h := sha1.New()
+	fmt.Fprintf(h, "%s\x00%s\x00%x\x00%d", parent, filename, sum, now.UnixNano())
+	sha := hex.EncodeToString(h.Sum(nil))
+	m.commits[sha] = next
+	m.refs[defaultRevision] = sha
+	m.updated = now
+	return modelID + "/" + filename, nil
+}
+
+// ListFiles lists the files of the newest commit of a model
+func (d *Distribution) ListFiles(modelID string) ([]string, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	c, err := d.commit(modelID, defaultRevision)
+	if err != nil {
+		return nil, err
+	}
+	files := make([]string, 0, len(c.files))
+	for name := range c.files {
+		files = append(files, name)
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// GetStorageInfo returns the total size of the files of the newest commit of a model
+func (d *Distribution) GetStorageInfo(modelID string) (int64, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	c, err := d.commit(modelID, defaultRevision)
+	if err != nil {
+		return 0, err
+	}
+	var total int64
+	for _, f := range c.files {
+		total += int64(len(f.content))
+	}
+	return total, nil
+}
+
+// FileEtag returns the SHA-256 of a file, "" when it does not exist
+func (d *Distribution) FileEtag(modelID, sha, filename string) string {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	f, err := d.file(modelID, sha, filename)
+	if err != nil {
+		return ""
+	}
+	return f.etag
+}
+
+// FileExists checks if a file exists in a commit
+func (d *Distribution) FileExists(modelID, sha, filename string) (os.FileInfo, bool) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	f, err := d.file(modelID, sha, filename)
+	if err != nil {
+		return nil, false
+	}
+	return fileInfo{name: filename, file: f}, true
+}
+
+// GetFile returns the content of a file in a commit
+func (d *Distribution) GetFile(modelID, sha, filename string) (io.ReadSeeker, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	f, err := d.file(modelID, sha, filename)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.NewReader(f.content), nil
+}
+
+// RepoInfo builds the model index of a revision
+func (d *Distribution) RepoInfo(modelID, version string) (model.ModelIndexInfo, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	sha := d.resolve(modelID, version)
+	c, err := d.commit(modelID, sha)
+	if err != nil {
+		return model.ModelIndexInfo{}, err
+	}
+	info := model.ModelIndexInfo{
+		ID:           modelID,
+		ModelID:      modelID,
+		Author:       strings.Split(modelID, "/")[0],
+		SHA:          sha,
+		LastModified: c.created,
+		CreatedAt:    c.created,
+		Siblings:     make([]model.SiblingFile, 0, len(c.files)),
+	}
+	for name, f := range c.files {
+		size := int64(len(f.content))
+		sibling := model.SiblingFile{RFilename: name, BlobID: f.etag, Size: size}
+		if len(f.etag) == 64 {
+			sibling.LFS = &model.LFSInfo{SHA256: f.etag, Size: size}
+		}
+		info.Siblings = append(info.Siblings, sibling)
+		info.UsedStorage += size
+	}
+	sort.Slice(info.Siblings, func(i, j int) bool {
+		return info.Siblings[i].RFilename < info.Siblings[j].RFilename
+	})
+	return info, nil
+}
+
+// RepoSha resolves a branch or commit of a model to its commit, "" when the revision
+// does not exist
+func (d *Distribution) RepoSha(modelID, version string) string {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.resolve(modelID, version)
+}
+
+// ListModels lists the models sorted by ID
+func (d *Distribution) ListModels() ([]model.CachedModel, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	models := make([]model.CachedModel, 0, len(d.models))
+	for id, m := range d.models {
+		models = append(models, model.CachedModel{ID: id, LastModified: m.updated})
+	}
+	sort.Slice(models, func(i, j int) bool { return models[i].ID < models[j].ID })
+	return models, nil
+}
+
+// Revisions lists the branches and commits of a model
+func (d *Distribution) Revisions(modelID string) ([]string, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	m, ok := d.models[modelID]
+	if !ok {
+		return nil, fmt.Errorf("model not found: %s", modelID)
+	}
+	revisions := make([]string, 0, len(m.refs)+len(m.commits))
+	for ref := range m.refs {
+		revisions = append(revisions, ref)
+	}
+	for sha := range m.commits {
+		revisions = append(revisions, sha)
+	}
+	sort.Strings(revisions)
+	return revisions, nil
+}
+
+// DeleteModel removes a model and all its commits
+func (d *Distribution) DeleteModel(modelID string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if _, ok := d.models[modelID]; !ok {
+		return fmt.Errorf("model not found: %s: %w", modelID, fs.ErrNotExist)
+	}
+	delete(d.models, modelID)
+	return nil
+}
+
+// resolve returns the commit a branch or commit of a model points to, "" when the
+// revision does not exist. An empty version selects "main".
+func (d *Distribution) resolve(modelID, version string) string {
+	m, ok := d.models[modelID]
+	if !ok {
+		return ""
+	}
+	if version == "" {
+		version = defaultRevision
+	}
+	if sha, ok := m.refs[version]; ok {
+		return sha
+	}
+	if _, ok := m.commits[version]; ok {
+		return version
+	}
+	return ""
+}
+
+func (d *Distribution) commit(modelID, revision string) (*commit, error) {
+	m, ok := d.models[modelID]
+	if !ok {
+		return nil, fmt.Errorf("model not found: %s: %w", modelID, fs.ErrNotExist)
+	}
+	c, ok := m.commits[d.resolve(modelID, revision)]
+	if !ok {
+		return nil, &api.RevisionNotFoundError{ModelID: modelID, Revision: revision}
+	}
+	return c, nil
+}
+
+func (d *Distribution) file(modelID, sha, filename string) (*file, error) {
+	c, err := d.commit(modelID, sha)
+	if err != nil {
+		return nil, err
+	}
+	f, ok := c.files[filename]
+	if !ok {
+		return nil, fmt.Errorf("file not found: %s: %w", filename, fs.ErrNotExist)
+	}
+	return f, nil
+}
+
+// fileInfo describes a file held in memory
+type fileInfo struct {
+	name string
+	file *file
+}
+
+func (i fileInfo) Name() string       { return i.name[strings.LastIndex(i.name, "/")+1:] }
+func (i fileInfo) Size() int64        { return int64(len(i.file.content)) }
+func (i fileInfo) Mode() fs.FileMode  { return 0444 }
+func (i fileInfo) ModTime() time.Time { return i.file.modTime }
+func (i fileInfo) IsDir() bool        { return false }
+func (i fileInfo) Sys() any           { return nil }
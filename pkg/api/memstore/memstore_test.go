@@ -0,0 +1,104 @@
+package memstore
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"strings"
+	"testing"
+
+	"github.com/lengrongfu/LLMDistribution/pkg/api"
+)
+
+func TestDistribution(t *testing.T) {
+	d := New()
+	if _, err := d.StoreFile("acme/m", "config.json", strings.NewReader("v1")); err != nil {
+		t.Fatal(err)
+	}
+	first := d.RepoSha("acme/m", "main")
+	if _, err := d.StoreFile("acme/m", "config.json", strings.NewReader("v2")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.StoreFile("acme/m", "sub/model.bin", strings.NewReader("weights")); err != nil {
+		t.Fatal(err)
+	}
+	head := d.RepoSha("acme/m", "")
+	if first == "" || head == "" || first == head {
+		t.Fatalf("commits %q and %q", first, head)
+	}
+
+	tests := []struct {
+		name     string
+		revision string
+		filename string
+		want     string
+		// wantErr reports whether the error of a missing file is the expected one
+		wantErr func(error) bool
+	}{
+		{name: "branch", revision: "main", filename: "config.json", want: "v2"},
+		{name: "old commit", revision: first, filename: "config.json", want: "v1"},
+		{name: "nested file", revision: head, filename: "sub/model.bin", want: "weights"},
+		{name: "file added later", revision: first, filename: "sub/model.bin", wantErr: func(err error) bool { return errors.Is(err, fs.ErrNotExist) }},
+		{name: "unknown revision", revision: "dev", filename: "config.json", wantErr: func(err error) bool {
+			var notFound *api.RevisionNotFoundError
+			return errors.As(err, &notFound)
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := d.GetFile("acme/m", tt.revision, tt.filename)
+			if tt.wantErr != nil {
+				if !tt.wantErr(err) {
+					t.Fatalf("unexpected error %v", err)
+				}
+				if _, ok := d.FileExists("acme/m", tt.revision, tt.filename); ok {
+					t.Error("FileExists = true for a missing file")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			data, _ := io.ReadAll(r)
+			if string(data) != tt.want {
+				t.Errorf("content = %q, want %q", data, tt.want)
+			}
+			info, ok := d.FileExists("acme/m", tt.revision, tt.filename)
+			if !ok || info.Size() != int64(len(tt.want)) {
+				t.Errorf("FileExists = %v, %v", info, ok)
+			}
+			if d.FileEtag("acme/m", tt.revision, tt.filename) == "" {
+				t.Error("FileEtag is empty")
+			}
+		})
+	}
+
+	index, err := d.RepoInfo("acme/m", "main")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if index.SHA != head || len(index.Siblings) != 2 || index.UsedStorage != int64(len("v2")+len("weights")) {
+		t.Errorf("index = %+v", index)
+	}
+	for _, sibling := range index.Siblings {
+		// only LFS files, whose etag is their SHA-256, carry LFS info
+		if (sibling.LFS != nil) != (sibling.RFilename == "sub/model.bin") || sibling.BlobID == "" {
+			t.Errorf("sibling = %+v", sibling)
+		}
+	}
+	if files, _ := d.ListFiles("acme/m"); strings.Join(files, ",") != "config.json,sub/model.bin" {
+		t.Errorf("files = %v", files)
+	}
+	if revisions, _ := d.Revisions("acme/m"); len(revisions) != 4 {
+		t.Errorf("revisions = %v, want main and three commits", revisions)
+	}
+	if err := d.DeleteModel("acme/m"); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.DeleteModel("acme/m"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("second DeleteModel error = %v, want fs.ErrNotExist", err)
+	}
+	if models, _ := d.ListModels(); len(models) != 0 {
+		t.Errorf("models = %v after delete", models)
+	}
+}
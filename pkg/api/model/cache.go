@@ -0,0 +1,16 @@
+package model
+
+import "time"
+
+// CacheStats are the cumulative cache counters since Since and the current size of
+// the cached files
+type CacheStats struct {
+	// Hits are file requests answered from the cache, Misses those answered by the upstream
+	Hits   int64 `json:"hits"`
+	Misses int64 `json:"misses"`
+	// UpstreamBytes were downloaded from the upstream, ServedBytes sent from the cache
+	UpstreamBytes int64     `json:"upstreamBytes"`
+	ServedBytes   int64     `json:"servedBytes"`
+	CacheSize     int64     `json:"cacheSize"`
+	Since         time.Time `json:"since"`
+}
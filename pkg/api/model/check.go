@@ -0,0 +1,18 @@
+package model
+
+// File check statuses reported by a snapshot verification
+const (
+	FileCheckOK       = "ok"
+	FileCheckDangling = "dangling"
+	FileCheckCorrupt  = "corrupt"
+	FileCheckError    = "error"
+)
+
+// FileCheck is the verification result of a single snapshot file
+type FileCheck struct {
+	SHA      string `json:"sha"`
+	Filename string `json:"filename"`
+	Etag     string `json:"etag,omitempty"`
+	Status   string `json:"status"`
+	Message  string `json:"message,omitempty"`
+}
@@ -0,0 +1,18 @@
+package model
+
+import "time"
+
+// EvictionPreview lists the models that would be evicted, least recently accessed
+// first, to shrink the cache to the target size
+type EvictionPreview struct {
+	TargetBytes int64               `json:"targetBytes"`
+	TotalBytes  int64               `json:"totalBytes"`
+	Models      []EvictionCandidate `json:"models"`
+}
+
+// EvictionCandidate is a model that would be evicted
+type EvictionCandidate struct {
+	ID         string    `json:"id"`
+	Size       int64     `json:"size"`
+	LastAccess time.Time `json:"lastAccess"`
+}
@@ -0,0 +1,33 @@
+package model
+
+import "encoding/json"
+
+// GatedMode is how access to a gated model is approved, "auto" or "manual". Open
+// models have an empty mode, which is encoded as false like the Hugging Face API does.
+type GatedMode string
+
+// MarshalJSON encodes an empty mode as false
+func (g GatedMode) MarshalJSON() ([]byte, error) {
+	if g == "" {
+		return []byte("false"), nil
+	}
+	return json.Marshal(string(g))
+}
+
+// UnmarshalJSON accepts a boolean or an approval mode
+func (g *GatedMode) UnmarshalJSON(data []byte) error {
+	var gated bool
+	if err := json.Unmarshal(data, &gated); err == nil {
+		*g = ""
+		if gated {
+			*g = "auto"
+		}
+		return nil
+	}
+	var mode string
+	if err := json.Unmarshal(data, &mode); err != nil {
+		return err
+	}
+	*g = GatedMode(mode)
+	return nil
+}
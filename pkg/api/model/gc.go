@@ -0,0 +1,21 @@
+package model
+
+// GCResult reports the blobs removed by a garbage collection
+type GCResult struct {
+	Removed int   `json:"removed"`
+	Bytes   int64 `json:"bytes"`
+}
+
+// ReindexResult describes the model index regenerated from a snapshot
+type ReindexResult struct {
+	ID    string `json:"id"`
+	SHA   string `json:"sha"`
+	Files int    `json:"files"`
+	Size  int64  `json:"size"`
+}
+
+// CompressResult reports the blobs compressed by a pass over the cold blobs
+type CompressResult struct {
+	Compressed int   `json:"compressed"`
+	Bytes      int64 `json:"bytes"`
+}
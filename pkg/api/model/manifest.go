@@ -0,0 +1,18 @@
+package model
+
+// ModelManifest lists every file needed to fully cache a model revision
+type ModelManifest struct {
+	ID    string          `json:"id"`
+	SHA   string          `json:"sha"`
+	Files []ManifestEntry `json:"files"`
+}
+
+// ManifestEntry is a file of a model manifest and the URL it can be downloaded from,
+// the local resolve URL for cached files and the upstream URL otherwise
+type ManifestEntry struct {
+	Filename string `json:"filename"`
+	Etag     string `json:"etag,omitempty"`
+	Size     int64  `json:"size"`
+	URL      string `json:"url"`
+	Cached   bool   `json:"cached"`
+}
@@ -6,18 +6,53 @@ import (
 
 // SiblingFile represents a file in the model repository
 type SiblingFile struct {
-	RFilename string `json:"rfilename"`
+	RFilename string   `json:"rfilename"`
+	BlobID    string   `json:"blobId,omitempty"`
+	Size      int64    `json:"size,omitempty"`
+	LFS       *LFSInfo `json:"lfs,omitempty"`
+}
+
+// LFSInfo describes the LFS object backing a sibling file
+type LFSInfo struct {
+	SHA256 string `json:"sha256"`
+	Size   int64  `json:"size"`
 }
 
 // ModelIndexInfo represents model index information
 type ModelIndexInfo struct {
-	ID           string        `json:"id"`
-	ModelID      string        `json:"modelId"`
-	Author       string        `json:"author"`
-	SHA          string        `json:"sha"`
-	LastModified time.Time     `json:"lastModified"`
-	Disabled     bool          `json:"disabled"`
-	CreatedAt    time.Time     `json:"createdAt"`
-	UsedStorage  int64         `json:"usedStorage"`
-	Siblings     []SiblingFile `json:"siblings"`
+	ID           string           `json:"id"`
+	ModelID      string           `json:"modelId"`
+	Author       string           `json:"author"`
+	SHA          string           `json:"sha"`
+	LastModified time.Time        `json:"lastModified"`
+	Private      bool             `json:"private"`
+	Gated        GatedMode        `json:"gated"`
+	Disabled     bool             `json:"disabled"`
+	CreatedAt    time.Time        `json:"createdAt"`
+	Config       *ModelConfig     `json:"config,omitempty"`
+	Safetensors  *SafetensorsInfo `json:"safetensors,omitempty"`
+	UsedStorage  int64            `json:"usedStorage"`
+	Siblings     []SiblingFile    `json:"siblings"`
+}
+
+// ModelConfig is the architecture of a model from its config.json and tokenizer_config.json
+type ModelConfig struct {
+	Architectures   []string         `json:"architectures,omitempty"`
+	ModelType       string           `json:"model_type,omitempty"`
+	TokenizerConfig *TokenizerConfig `json:"tokenizer_config,omitempty"`
+}
+
+// TokenizerConfig holds the special tokens and chat template of a tokenizer
+type TokenizerConfig struct {
+	BosToken     string `json:"bos_token,omitempty"`
+	EosToken     string `json:"eos_token,omitempty"`
+	PadToken     string `json:"pad_token,omitempty"`
+	UnkToken     string `json:"unk_token,omitempty"`
+	ChatTemplate string `json:"chat_template,omitempty"`
+}
+
+// SafetensorsInfo counts the parameters of the safetensors weights of a model by dtype
+type SafetensorsInfo struct {
+	Parameters map[string]int64 `json:"parameters"`
+	Total      int64            `json:"total"`
 }
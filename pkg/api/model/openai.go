@@ -0,0 +1,33 @@
+package model
+
+import "time"
+
+// CachedModel is a model held by a storage
+type CachedModel struct {
+	ID           string    `json:"id"`
+	LastModified time.Time `json:"lastModified"`
+}
+
+// CachedModelInfo describes a model of a local cache, Refs maps its refs like "main"
+// to the commits they point to
+type CachedModelInfo struct {
+	ID           string            `json:"id"`
+	Refs         map[string]string `json:"refs"`
+	Snapshots    []string          `json:"snapshots"`
+	Size         int64             `json:"size"`
+	LastModified time.Time         `json:"lastModified"`
+}
+
+// OpenAIModelList is the response of the OpenAI compatible /v1/models listing
+type OpenAIModelList struct {
+	Object string        `json:"object"`
+	Data   []OpenAIModel `json:"data"`
+}
+
+// OpenAIModel describes a model in the OpenAI models schema
+type OpenAIModel struct {
+	ID      string `json:"id"`
+	Object  string `json:"object"`
+	Created int64  `json:"created"`
+	OwnedBy string `json:"owned_by"`
+}
@@ -0,0 +1,15 @@
+package model
+
+// ModelRefs lists the branches and tags of a model, Snapshots lists the cached commits
+type ModelRefs struct {
+	Branches  []GitRef `json:"branches"`
+	Tags      []GitRef `json:"tags"`
+	Snapshots []string `json:"snapshots"`
+}
+
+// GitRef is a branch or tag of a model and the commit it points to
+type GitRef struct {
+	Name         string `json:"name"`
+	Ref          string `json:"ref"`
+	TargetCommit string `json:"targetCommit"`
+}
@@ -0,0 +1,9 @@
+package model
+
+// ModelCacheStatus reports which files of a model revision are cached locally
+type ModelCacheStatus struct {
+	ID      string   `json:"id"`
+	SHA     string   `json:"sha"`
+	Cached  []string `json:"cached"`
+	Missing []string `json:"missing"`
+}
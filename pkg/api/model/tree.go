@@ -0,0 +1,16 @@
+package model
+
+// Tree entry types, matching the Hugging Face tree API
+const (
+	TreeEntryFile      = "file"
+	TreeEntryDirectory = "directory"
+)
+
+// TreeEntry is a file or directory of a model snapshot
+type TreeEntry struct {
+	Type string   `json:"type"`
+	Oid  string   `json:"oid,omitempty"`
+	Size int64    `json:"size"`
+	Path string   `json:"path"`
+	LFS  *LFSInfo `json:"lfs,omitempty"`
+}
@@ -6,8 +6,10 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	neturl "net/url"
 	"os"
 	"path/filepath"
+	"sync"
 	"time"
 )
 
@@ -17,6 +19,8 @@ type Client struct {
 	baseURL string
 	// HTTP client
 	httpClient *http.Client
+	// token is sent as bearer token, authorizing uploads and access to private models
+	token string
 }
 
 // NewClient creates a new client for the LLM Distribution system
@@ -27,19 +31,38 @@ func NewClient(baseURL string) *Client {
 	}
 }
 
+// WithToken sets the token sent as bearer token with every request, the admin token
+// of the server for uploads or a token of its ACL for private models
+func (c *Client) WithToken(token string) {
+	c.token = token
+}
+
+// do sends a request to the server with the bearer token of the client
+func (c *Client) do(req *http.Request) (*http.Response, error) {
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	return c.httpClient.Do(req)
+}
+
 // UploadModelFile uploads a model file to the LLM Distribution server
 func (c *Client) UploadModelFile(modelID, filename string, content io.Reader) (string, error) {
+	return c.uploadModelFile(context.Background(), modelID, filename, content)
+}
+
+// uploadModelFile uploads a model file within ctx
+func (c *Client) uploadModelFile(ctx context.Context, modelID, filename string, content io.Reader) (string, error) {
 	// Create the URL
-	url := fmt.Sprintf("%s/api/models/%s?path=%s", c.baseURL, modelID, filename)
+	url := fmt.Sprintf("%s/api/models/%s?path=%s", c.baseURL, modelID, neturl.QueryEscape(filename))
 
 	// Create the request
-	req, err := http.NewRequest("PUT", url, content)
+	req, err := http.NewRequestWithContext(ctx, "PUT", url, content)
 	if err != nil {
 		return "", fmt.Errorf("failed to create request: %w", err)
 	}
 
 	// Send the request
-	resp, err := c.httpClient.Do(req)
+	resp, err := c.do(req)
 	if err != nil {
 		return "", fmt.Errorf("failed to send request: %w", err)
 	}
@@ -75,13 +98,109 @@ func (c *Client) UploadModelFileFromPath(modelID, filename, filePath string) (st
 	return c.UploadModelFile(modelID, filename, file)
 }
 
+// uploadConcurrency is the number of files UploadDirectory uploads in parallel
+const uploadConcurrency = 4
+
+// UploadDirectory uploads every file below localDir as a file of the model, keeping
+// the path relative to localDir as the file name. Files are uploaded concurrently,
+// the first error cancels the remaining uploads.
+func (c *Client) UploadDirectory(ctx context.Context, modelID, localDir string) error {
+	files, err := listFiles(localDir)
+	if err != nil {
+		return err
+	}
+	return c.uploadFiles(ctx, modelID, localDir, files)
+}
+
+// listFiles lists the files below localDir, skipping .git directories
+func listFiles(localDir string) ([]string, error) {
+	var files []string
+	err := filepath.WalkDir(localDir, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if d.Name() == ".git" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		files = append(files, path)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to walk directory: %w", err)
+	}
+	return files, nil
+}
+
+// uploadFiles uploads files below localDir concurrently as files of the model, the
+// first error cancels the remaining uploads
+func (c *Client) uploadFiles(ctx context.Context, modelID, localDir string, files []string) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg       sync.WaitGroup
+		once     sync.Once
+		firstErr error
+		sem      = make(chan struct{}, uploadConcurrency)
+	)
+	for _, path := range files {
+		relPath, err := filepath.Rel(localDir, path)
+		if err != nil {
+			return fmt.Errorf("failed to get relative path: %w", err)
+		}
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		wg.Add(1)
+		go func(path, filename string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			if err := c.uploadFileFromPath(ctx, modelID, filename, path); err != nil {
+				once.Do(func() {
+					firstErr = fmt.Errorf("failed to upload %s: %w", filename, err)
+					cancel()
+				})
+			}
+		}(path, filepath.ToSlash(relPath))
+	}
+	wg.Wait()
+
+	if firstErr != nil {
+		return firstErr
+	}
+	return ctx.Err()
+}
+
+// uploadFileFromPath uploads a local file within ctx
+func (c *Client) uploadFileFromPath(ctx context.Context, modelID, filename, filePath string) error {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return fmt.Errorf("failed to open file: %w", err)
+	}
+	defer file.Close()
+
+	_, err = c.uploadModelFile(ctx, modelID, filename, file)
+	return err
+}
+
 // DownloadModelFile downloads a model file from the LLM Distribution server
 func (c *Client) DownloadModelFile(modelID, revision, filename string) ([]byte, error) {
 	// Create the URL
 	url := fmt.Sprintf("%s/api/models/%s/%s/%s", c.baseURL, modelID, revision, filename)
 
 	// Send the request
-	resp, err := c.httpClient.Get(url)
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	resp, err := c.do(req)
 	if err != nil {
 		return nil, fmt.Errorf("failed to send request: %w", err)
 	}
@@ -128,6 +247,8 @@ func (c *Client) DownloadModelFileToPath(modelID, revision, filename, filePath s
 // SiblingFile represents a file in the model repository
 type SiblingFile struct {
 	RFilename string `json:"rfilename"`
+	BlobID    string `json:"blobId,omitempty"`
+	Size      int64  `json:"size,omitempty"`
 }
 
 // ModelIndexInfo represents model index information
@@ -146,7 +267,7 @@ type ModelIndexInfo struct {
 // GetModelIndex gets model index information from the LLM Distribution server
 func (c *Client) GetModelIndex(ctx context.Context, modelID, version string) (*ModelIndexInfo, error) {
 	// Create the URL
-	url := fmt.Sprintf("%s/api/models/%s/info/%s", c.baseURL, modelID, version)
+	url := fmt.Sprintf("%s/api/models/%s/revision/%s", c.baseURL, modelID, version)
 
 	// Create the request
 	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
@@ -155,7 +276,7 @@ func (c *Client) GetModelIndex(ctx context.Context, modelID, version string) (*M
 	}
 
 	// Send the request
-	resp, err := c.httpClient.Do(req)
+	resp, err := c.do(req)
 	if err != nil {
 		return nil, fmt.Errorf("failed to send request: %w", err)
 	}
@@ -175,3 +296,49 @@ func (c *Client) GetModelIndex(ctx context.Context, modelID, version string) (*M
 
 	return &indexInfo, nil
 }
+
+// GitRef represents a branch or tag of a model repository
+type GitRef struct {
+	Name         string `json:"name"`
+	Ref          string `json:"ref"`
+	TargetCommit string `json:"targetCommit"`
+}
+
+// ModelRefs lists the branches and tags of a model repository
+type ModelRefs struct {
+	Branches []GitRef `json:"branches"`
+	Tags     []GitRef `json:"tags"`
+}
+
+// ListRefs lists the branches and tags of a model with the commit sha they point to
+func (c *Client) ListRefs(ctx context.Context, modelID string) (*ModelRefs, error) {
+	// Create the URL
+	url := fmt.Sprintf("%s/api/models/%s/refs", c.baseURL, modelID)
+
+	// Create the request
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	// Send the request
+	resp, err := c.do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	// Check the response
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("failed to list refs: %s", string(body))
+	}
+
+	// Parse the response
+	var refs ModelRefs
+	if err := json.NewDecoder(resp.Body).Decode(&refs); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+
+	return &refs, nil
+}
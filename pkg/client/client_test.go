@@ -0,0 +1,173 @@
+package client
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestUploadModelFileSendsToken(t *testing.T) {
+	tests := []struct {
+		name      string
+		token     string
+		wantError bool
+	}{
+		{"admin token", "secret", false},
+		{"no token", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var body string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Header.Get("Authorization") != "Bearer secret" {
+					w.WriteHeader(http.StatusUnauthorized)
+					return
+				}
+				if r.Method != "PUT" || r.URL.Path != "/api/models/org/m" || r.URL.Query().Get("path") != "sub/config.json" {
+					t.Errorf("request %s %s", r.Method, r.URL)
+				}
+				data, _ := io.ReadAll(r.Body)
+				body = string(data)
+				io.WriteString(w, `{"path":"/data/org/m/sub/config.json"}`)
+			}))
+			defer server.Close()
+
+			c := NewClient(server.URL)
+			c.WithToken(tt.token)
+			path, err := c.UploadModelFile("org/m", "sub/config.json", strings.NewReader("{}"))
+			if tt.wantError {
+				if err == nil {
+					t.Fatal("upload without token succeeded")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("UploadModelFile: %v", err)
+			}
+			if path != "/data/org/m/sub/config.json" || body != "{}" {
+				t.Errorf("path %q, uploaded %q", path, body)
+			}
+		})
+	}
+}
+
+func TestListRefs(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/models/org/m/refs":
+			io.WriteString(w, `{"branches":[{"name":"main","ref":"refs/heads/main","targetCommit":"abc"}],"tags":[{"name":"v1","ref":"refs/tags/v1","targetCommit":"def"}],"converts":[]}`)
+		default:
+			http.Error(w, "repository not found", http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+	c := NewClient(server.URL)
+
+	tests := []struct {
+		name    string
+		modelID string
+		want    ModelRefs
+		wantErr bool
+	}{
+		{"branches and tags", "org/m", ModelRefs{
+			Branches: []GitRef{{Name: "main", Ref: "refs/heads/main", TargetCommit: "abc"}},
+			Tags:     []GitRef{{Name: "v1", Ref: "refs/tags/v1", TargetCommit: "def"}},
+		}, false},
+		{"missing model", "org/missing", ModelRefs{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			refs, err := c.ListRefs(context.Background(), tt.modelID)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("ListRefs = %+v, want an error", refs)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ListRefs: %v", err)
+			}
+			if !reflect.DeepEqual(*refs, tt.want) {
+				t.Errorf("refs = %+v, want %+v", *refs, tt.want)
+			}
+		})
+	}
+}
+
+// uploadServer records the files uploaded to it, failing the uploads of fail
+func uploadServer(t *testing.T, fail string) (*httptest.Server, map[string]string, *sync.Mutex) {
+	t.Helper()
+	var mu sync.Mutex
+	uploaded := make(map[string]string)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := r.URL.Query().Get("path")
+		if name == fail {
+			http.Error(w, "disk full", http.StatusInternalServerError)
+			return
+		}
+		data, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		uploaded[r.URL.Path+"/"+name] = string(data)
+		mu.Unlock()
+		io.WriteString(w, `{"path":"stored"}`)
+	}))
+	t.Cleanup(server.Close)
+	return server, uploaded, &mu
+}
+
+func TestUploadDirectory(t *testing.T) {
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"config.json":     "{}",
+		"sub/weights.bin": "weights",
+		".git/HEAD":       "ref: refs/heads/main",
+	} {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name    string
+		fail    string
+		want    map[string]string
+		wantErr string
+	}{
+		{"all files", "", map[string]string{
+			"/api/models/org/m/config.json":     "{}",
+			"/api/models/org/m/sub/weights.bin": "weights",
+		}, ""},
+		{"failed upload", "sub/weights.bin", nil, "failed to upload sub/weights.bin"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, uploaded, mu := uploadServer(t, tt.fail)
+			err := NewClient(server.URL).UploadDirectory(context.Background(), "org/m", dir)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("UploadDirectory = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("UploadDirectory: %v", err)
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			if !reflect.DeepEqual(uploaded, tt.want) {
+				t.Errorf("uploaded %v, want %v", uploaded, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,129 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/lengrongfu/LLMDistribution/pkg/utils"
+)
+
+// DownloadModel downloads every file of a model revision into a Hugging Face style
+// cache below destDir, the models--org--name directory with its blobs, snapshots and
+// refs, and returns the snapshot path. Blobs already in the cache are not downloaded
+// again, so the cache can be completed by calling DownloadModel again.
+func (c *Client) DownloadModel(ctx context.Context, modelID, revision, destDir string) (string, error) {
+	index, err := c.GetModelIndex(ctx, modelID, revision)
+	if err != nil {
+		return "", err
+	}
+	sha := index.SHA
+	if sha == "" {
+		sha = revision
+	}
+	if !validPathElement(sha) {
+		return "", fmt.Errorf("%w: commit %q", utils.ErrInvalidPath, sha)
+	}
+
+	modelDir := filepath.Join(destDir, utils.ConvertModelIDToHFPath(modelID))
+	blobsDir := filepath.Join(modelDir, "blobs")
+	snapshotDir := filepath.Join(modelDir, "snapshots", sha)
+	for _, dir := range []string{blobsDir, snapshotDir, filepath.Join(modelDir, "refs")} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return "", fmt.Errorf("failed to create directory: %w", err)
+		}
+	}
+	if revision != sha {
+		refPath := filepath.Join(modelDir, "refs", filepath.FromSlash(revision))
+		if err := os.MkdirAll(filepath.Dir(refPath), 0755); err != nil {
+			return "", fmt.Errorf("failed to create directory: %w", err)
+		}
+		if err := os.WriteFile(refPath, []byte(sha), 0644); err != nil {
+			return "", fmt.Errorf("failed to write ref: %w", err)
+		}
+	}
+
+	for _, sibling := range index.Siblings {
+		if err := c.downloadSibling(ctx, modelID, sha, sibling, blobsDir, snapshotDir); err != nil {
+			return "", fmt.Errorf("failed to download %s: %w", sibling.RFilename, err)
+		}
+	}
+	return snapshotDir, nil
+}
+
+// downloadSibling downloads a file into its blob and links it into the snapshot
+func (c *Client) downloadSibling(ctx context.Context, modelID, sha string, sibling SiblingFile, blobsDir, snapshotDir string) error {
+	// the index comes from the server, its names must not lead outside of the cache
+	name, err := utils.CleanRepoPath(sibling.RFilename)
+	if err != nil {
+		return err
+	}
+	etag := sibling.BlobID
+	if etag == "" {
+		if etag, err = c.fileEtag(ctx, modelID, sha, sibling.RFilename); err != nil {
+			return err
+		}
+	}
+	if etag == "" {
+		return fmt.Errorf("server reported no etag")
+	}
+	if !validPathElement(etag) {
+		return fmt.Errorf("%w: etag %q", utils.ErrInvalidPath, etag)
+	}
+
+	blobPath := filepath.Join(blobsDir, etag)
+	if _, err := os.Stat(blobPath); os.IsNotExist(err) {
+		if err := c.downloadBlob(ctx, modelID, sha, sibling.RFilename, blobPath); err != nil {
+			return err
+		}
+	}
+
+	linkPath := filepath.Join(snapshotDir, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(linkPath), 0755); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+	target, err := filepath.Rel(filepath.Dir(linkPath), blobPath)
+	if err != nil {
+		return err
+	}
+	os.Remove(linkPath)
+	if err := os.Symlink(target, linkPath); err != nil {
+		return fmt.Errorf("failed to create symlink: %w", err)
+	}
+	return nil
+}
+
+// validPathElement reports whether name, a commit or an etag sent by the server, can
+// be used as a single file name
+func validPathElement(name string) bool {
+	return name != "" && name != "." && name != ".." && !strings.ContainsAny(name, "/\\\x00")
+}
+
+// downloadBlob writes a file to blobPath, through an .incomplete file so an
+// interrupted download never leaves a truncated blob
+func (c *Client) downloadBlob(ctx context.Context, modelID, sha, filename, blobPath string) error {
+	body, err := c.openModelFile(ctx, modelID, sha, filename)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	tmpPath := blobPath + ".incomplete"
+	file, err := os.Create(tmpPath)
+	if err != nil {
+		return fmt.Errorf("failed to create file: %w", err)
+	}
+	if _, err := io.Copy(file, body); err != nil {
+		file.Close()
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to write file: %w", err)
+	}
+	if err := file.Close(); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to write file: %w", err)
+	}
+	return os.Rename(tmpPath, blobPath)
+}
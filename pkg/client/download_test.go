@@ -0,0 +1,100 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/lengrongfu/LLMDistribution/pkg/utils"
+)
+
+// modelServer serves org/m at main with the index siblings, files are served with
+// their name as content and README.md reports its etag only in a HEAD
+func modelServer(t *testing.T, sha, siblings string) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/models/org/m/revision/main" {
+			fmt.Fprintf(w, `{"id":"org/m","sha":%q,"siblings":[%s]}`, sha, siblings)
+			return
+		}
+		name := r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:]
+		w.Header().Set("ETag", `"etag-`+name+`"`)
+		if r.Method == "GET" {
+			io.WriteString(w, "content of "+name)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestDownloadModel(t *testing.T) {
+	const sha = "0123456789abcdef0123456789abcdef01234567"
+	server := modelServer(t, sha, `{"rfilename":"config.json","blobId":"aaa"},{"rfilename":"sub/model.bin","blobId":"bbb"},{"rfilename":"README.md"}`)
+	dest := t.TempDir()
+
+	snapshot, err := NewClient(server.URL).DownloadModel(context.Background(), "org/m", "main", dest)
+	if err != nil {
+		t.Fatalf("DownloadModel: %v", err)
+	}
+	modelDir := filepath.Join(dest, "models--org--m")
+	if snapshot != filepath.Join(modelDir, "snapshots", sha) {
+		t.Errorf("snapshot = %s", snapshot)
+	}
+	tests := []struct {
+		name string
+		blob string
+	}{
+		{"config.json", "aaa"},
+		{"sub/model.bin", "bbb"},
+		{"README.md", "etag-README.md"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(snapshot, filepath.FromSlash(tt.name))
+			data, err := os.ReadFile(path)
+			if err != nil || string(data) != "content of "+filepath.Base(tt.name) {
+				t.Fatalf("read %s = %q, %v", tt.name, data, err)
+			}
+			target, err := filepath.EvalSymlinks(path)
+			if err != nil || target != filepath.Join(modelDir, "blobs", tt.blob) {
+				t.Errorf("%s links to %s, %v, want blob %s", tt.name, target, err, tt.blob)
+			}
+		})
+	}
+	if ref, err := utils.ReadRef(filepath.Join(modelDir, "refs", "main")); err != nil || ref != sha {
+		t.Errorf("refs/main = %q, %v, want %s", ref, err, sha)
+	}
+}
+
+func TestDownloadModelRejectsTraversal(t *testing.T) {
+	tests := []struct {
+		name     string
+		sha      string
+		siblings string
+	}{
+		{"file name", "abc", `{"rfilename":"../../escaped","blobId":"aaa"}`},
+		{"absolute file name", "abc", `{"rfilename":"/tmp/escaped","blobId":"aaa"}`},
+		{"etag", "abc", `{"rfilename":"config.json","blobId":"../../escaped"}`},
+		{"commit", "../../escaped", `{"rfilename":"config.json","blobId":"aaa"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := modelServer(t, tt.sha, tt.siblings)
+			dest := filepath.Join(t.TempDir(), "cache")
+			_, err := NewClient(server.URL).DownloadModel(context.Background(), "org/m", "main", dest)
+			if !errors.Is(err, utils.ErrInvalidPath) {
+				t.Fatalf("DownloadModel() error = %v, want ErrInvalidPath", err)
+			}
+			if _, err := os.Stat(filepath.Join(filepath.Dir(dest), "escaped")); !os.IsNotExist(err) {
+				t.Errorf("file written outside of the cache")
+			}
+		})
+	}
+}
@@ -0,0 +1,79 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/lengrongfu/LLMDistribution/pkg/utils"
+)
+
+// PushResult summarizes the files uploaded by PushModel
+type PushResult struct {
+	// Snapshot is the local directory the files were uploaded from
+	Snapshot string
+	Files    int
+	Bytes    int64
+}
+
+// PushModel uploads the files of a local model to the server, keeping their paths
+// relative to the snapshot. localDir is a Hugging Face cache like the one DownloadModel
+// writes, its hub directory or the models--org--name directory, in which case the
+// snapshot of revision is uploaded, or a plain directory of model files.
+func (c *Client) PushModel(ctx context.Context, modelID, revision, localDir string) (*PushResult, error) {
+	snapshotDir, err := localSnapshot(modelID, revision, localDir)
+	if err != nil {
+		return nil, err
+	}
+	files, err := listFiles(snapshotDir)
+	if err != nil {
+		return nil, err
+	}
+	result := &PushResult{Snapshot: snapshotDir, Files: len(files)}
+	for _, file := range files {
+		// snapshot files link to their blobs, the size is that of the blob
+		info, err := os.Stat(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to stat %s: %w", file, err)
+		}
+		result.Bytes += info.Size()
+	}
+	if err := c.uploadFiles(ctx, modelID, snapshotDir, files); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// localSnapshot finds the snapshot directory of revision of a model below localDir,
+// localDir itself when it is not a Hugging Face cache of the model
+func localSnapshot(modelID, revision, localDir string) (string, error) {
+	hfPath := utils.ConvertModelIDToHFPath(modelID)
+	for _, modelDir := range []string{
+		filepath.Join(localDir, "hub", hfPath),
+		filepath.Join(localDir, hfPath),
+		localDir,
+	} {
+		if info, err := os.Stat(filepath.Join(modelDir, "snapshots")); err != nil || !info.IsDir() {
+			continue
+		}
+		sha := revision
+		if _, err := os.Stat(filepath.Join(modelDir, "snapshots", sha)); err != nil {
+			ref, err := os.ReadFile(filepath.Join(modelDir, "refs", filepath.FromSlash(revision)))
+			if err != nil {
+				return "", fmt.Errorf("revision %s of %s not found in %s", revision, modelID, modelDir)
+			}
+			sha = strings.TrimSpace(string(ref))
+		}
+		snapshotDir := filepath.Join(modelDir, "snapshots", sha)
+		if info, err := os.Stat(snapshotDir); err != nil || !info.IsDir() {
+			return "", fmt.Errorf("snapshot %s of %s not found in %s", sha, modelID, modelDir)
+		}
+		return snapshotDir, nil
+	}
+	if info, err := os.Stat(localDir); err != nil || !info.IsDir() {
+		return "", fmt.Errorf("%s is not a directory", localDir)
+	}
+	return localDir, nil
+}
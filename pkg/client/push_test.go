@@ -0,0 +1,112 @@
+package client
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// testSnapshot is the commit of the snapshot in the cache of writeHFCache
+const testSnapshot = "0123456789abcdef0123456789abcdef01234567"
+
+// writeHFCache writes a Hugging Face cache of org/m below dir, its snapshot files
+// linking to blobs like the ones huggingface_hub writes
+func writeHFCache(t *testing.T, dir string) string {
+	t.Helper()
+	modelDir := filepath.Join(dir, "hub", "models--org--m")
+	for name, content := range map[string]string{
+		"blobs/aaa": "{}",
+		"blobs/bbb": "weights",
+		"refs/main": testSnapshot + "\n",
+		"refs/pr/1": testSnapshot,
+	} {
+		path := filepath.Join(modelDir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	snapshot := filepath.Join(modelDir, "snapshots", testSnapshot)
+	for name, blob := range map[string]string{"config.json": "aaa", "sub/weights.bin": "bbb"} {
+		path := filepath.Join(snapshot, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		rel, _ := filepath.Rel(filepath.Dir(path), filepath.Join(modelDir, "blobs", blob))
+		if err := os.Symlink(rel, path); err != nil {
+			t.Skipf("symlinks not supported: %v", err)
+		}
+	}
+	return snapshot
+}
+
+func TestPushModel(t *testing.T) {
+	cache := t.TempDir()
+	snapshot := writeHFCache(t, cache)
+	plain := t.TempDir()
+	if err := os.WriteFile(filepath.Join(plain, "config.json"), []byte("{}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	notDir := filepath.Join(plain, "config.json")
+
+	cached := map[string]string{
+		"/api/models/org/m/config.json":     "{}",
+		"/api/models/org/m/sub/weights.bin": "weights",
+	}
+	tests := []struct {
+		name         string
+		localDir     string
+		revision     string
+		wantSnapshot string
+		want         map[string]string
+		wantBytes    int64
+		wantErr      string
+	}{
+		{"cache directory", cache, "main", snapshot, cached, 9, ""},
+		{"hub directory", filepath.Join(cache, "hub"), "main", snapshot, cached, 9, ""},
+		{"model directory", filepath.Join(cache, "hub", "models--org--m"), "main", snapshot, cached, 9, ""},
+		{"nested ref", cache, "pr/1", snapshot, cached, 9, ""},
+		{"commit", cache, testSnapshot, snapshot, cached, 9, ""},
+		{"plain directory", plain, "main", plain, map[string]string{"/api/models/org/m/config.json": "{}"}, 2, ""},
+		{"unknown revision", cache, "dev", "", nil, 0, "revision dev of org/m not found"},
+		{"not a directory", notDir, "main", "", nil, 0, "is not a directory"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, uploaded, mu := uploadServer(t, "")
+			result, err := NewClient(server.URL).PushModel(context.Background(), "org/m", tt.revision, tt.localDir)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("PushModel = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("PushModel: %v", err)
+			}
+			if result.Snapshot != tt.wantSnapshot || result.Files != len(tt.want) || result.Bytes != tt.wantBytes {
+				t.Errorf("result %+v, want snapshot %s with %d files of %d bytes", result, tt.wantSnapshot, len(tt.want), tt.wantBytes)
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			if !reflect.DeepEqual(uploaded, tt.want) {
+				t.Errorf("uploaded %v, want %v", uploaded, tt.want)
+			}
+		})
+	}
+}
+
+func TestPushModelFailedUpload(t *testing.T) {
+	cache := t.TempDir()
+	writeHFCache(t, cache)
+	server, _, _ := uploadServer(t, "sub/weights.bin")
+	_, err := NewClient(server.URL).PushModel(context.Background(), "org/m", "main", cache)
+	if err == nil || !strings.Contains(err.Error(), "failed to upload sub/weights.bin") {
+		t.Fatalf("PushModel = %v, want the failed upload", err)
+	}
+}
@@ -0,0 +1,110 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// SyncResult reports the files copied and skipped by SyncModel
+type SyncResult struct {
+	Copied  []string `json:"copied"`
+	Skipped []string `json:"skipped"`
+}
+
+// SyncModel copies a model revision from the src server to the server of c. Files
+// the destination already serves with the same etag are skipped.
+func (c *Client) SyncModel(ctx context.Context, src *Client, modelID, revision string) (*SyncResult, error) {
+	index, err := src.GetModelIndex(ctx, modelID, revision)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get source model index: %w", err)
+	}
+
+	result := &SyncResult{}
+	for _, sibling := range index.Siblings {
+		if sibling.BlobID != "" {
+			etag, err := c.fileEtag(ctx, modelID, revision, sibling.RFilename)
+			if err != nil {
+				return result, err
+			}
+			if etag == sibling.BlobID {
+				result.Skipped = append(result.Skipped, sibling.RFilename)
+				continue
+			}
+		}
+		if err := c.copyFile(ctx, src, modelID, revision, sibling.RFilename); err != nil {
+			return result, fmt.Errorf("failed to copy %s: %w", sibling.RFilename, err)
+		}
+		result.Copied = append(result.Copied, sibling.RFilename)
+	}
+	return result, nil
+}
+
+// copyFile streams a file from the src server into an upload to c
+func (c *Client) copyFile(ctx context.Context, src *Client, modelID, revision, filename string) error {
+	body, err := src.openModelFile(ctx, modelID, revision, filename)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	_, err = c.uploadModelFile(ctx, modelID, filename, body)
+	return err
+}
+
+// openModelFile starts downloading a file of a model revision from the resolve endpoint
+func (c *Client) openModelFile(ctx context.Context, modelID, revision, filename string) (io.ReadCloser, error) {
+	// Create the URL
+	url := fmt.Sprintf("%s/%s/resolve/%s/%s", c.baseURL, modelID, revision, filename)
+
+	// Create the request
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	// Send the request
+	resp, err := c.do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+
+	// Check the response
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("failed to download file: %s", string(body))
+	}
+
+	return resp.Body, nil
+}
+
+// fileEtag returns the etag the server reports for a file, or "" when it does not have the file
+func (c *Client) fileEtag(ctx context.Context, modelID, revision, filename string) (string, error) {
+	// Create the URL
+	url := fmt.Sprintf("%s/%s/resolve/%s/%s", c.baseURL, modelID, revision, filename)
+
+	// Create the request
+	req, err := http.NewRequestWithContext(ctx, "HEAD", url, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to create request: %w", err)
+	}
+
+	// Send the request
+	resp, err := c.do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to send request: %w", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", nil
+	}
+	etag := resp.Header.Get("X-Linked-Etag")
+	if etag == "" {
+		etag = resp.Header.Get("ETag")
+	}
+	return strings.Trim(strings.TrimPrefix(etag, "W/"), `"`), nil
+}
@@ -0,0 +1,61 @@
+package client
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSyncModel(t *testing.T) {
+	src := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/models/org/m/revision/main":
+			io.WriteString(w, `{"id":"org/m","siblings":[{"rfilename":"config.json","blobId":"aaa"},{"rfilename":"model.bin","blobId":"bbb"},{"rfilename":"README.md"}]}`)
+		default:
+			name := strings.TrimPrefix(r.URL.Path, "/org/m/resolve/main/")
+			io.WriteString(w, "content of "+name)
+		}
+	}))
+	defer src.Close()
+	// the destination already serves config.json with the etag of the source
+	dst, uploaded, mu := uploadServer(t, "")
+	dstMux := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "HEAD" {
+			if r.URL.Path == "/org/m/resolve/main/config.json" {
+				w.Header().Set("ETag", `"aaa"`)
+				return
+			}
+			if r.URL.Path == "/org/m/resolve/main/model.bin" {
+				w.Header().Set("X-Linked-Etag", `"old"`)
+				return
+			}
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		dst.Config.Handler.ServeHTTP(w, r)
+	})
+	dstServer := httptest.NewServer(dstMux)
+	defer dstServer.Close()
+
+	result, err := NewClient(dstServer.URL).SyncModel(context.Background(), NewClient(src.URL), "org/m", "main")
+	if err != nil {
+		t.Fatalf("SyncModel: %v", err)
+	}
+	want := &SyncResult{Copied: []string{"model.bin", "README.md"}, Skipped: []string{"config.json"}}
+	if !reflect.DeepEqual(result, want) {
+		t.Errorf("result = %+v, want %+v", result, want)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	wantUploads := map[string]string{
+		"/api/models/org/m/model.bin": "content of model.bin",
+		"/api/models/org/m/README.md": "content of README.md",
+	}
+	if !reflect.DeepEqual(uploaded, wantUploads) {
+		t.Errorf("uploaded %v, want %v", uploaded, wantUploads)
+	}
+}
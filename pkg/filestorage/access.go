@@ -0,0 +1,182 @@
+package filestorage
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// accessFile is the file below the base directory the access times are flushed to
+const accessFile = ".access-times.json"
+
+// accessTracker records the last time each model was served in memory and flushes
+// the times to disk periodically, so serving a file never writes to disk
+type accessTracker struct {
+	path string
+	now  func() time.Time
+	mu   sync.Mutex
+	// times is the last access of each model
+	times map[string]time.Time
+	dirty bool
+	stop  chan struct{}
+	done  chan struct{}
+}
+
+// newAccessTracker loads the access times flushed to path by a previous run
+func newAccessTracker(path string) (*accessTracker, error) {
+	t := &accessTracker{
+		path:  path,
+		now:   time.Now,
+		times: make(map[string]time.Time),
+	}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return t, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read access times: %w", err)
+	}
+	if err := json.Unmarshal(data, &t.times); err != nil {
+		return nil, fmt.Errorf("failed to parse access times %s: %w", path, err)
+	}
+	return t, nil
+}
+
+// touch records an access of a model
+func (t *accessTracker) touch(modelID string) {
+	now := t.now()
+	t.mu.Lock()
+	if now.After(t.times[modelID]) {
+		t.times[modelID] = now
+		t.dirty = true
+	}
+	t.mu.Unlock()
+}
+
+// lastAccess returns the recorded last access of a model
+func (t *accessTracker) lastAccess(modelID string) (time.Time, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	last, ok := t.times[modelID]
+	return last, ok
+}
+
+// forget drops the access time of a removed model
+func (t *accessTracker) forget(modelID string) {
+	t.mu.Lock()
+	if _, ok := t.times[modelID]; ok {
+		delete(t.times, modelID)
+		t.dirty = true
+	}
+	t.mu.Unlock()
+}
+
+// flush writes the access times to disk when they changed since the last flush. The
+// file is replaced atomically so a crash leaves the previous times intact.
+func (t *accessTracker) flush() error {
+	t.mu.Lock()
+	if !t.dirty {
+		t.mu.Unlock()
+		return nil
+	}
+	data, err := json.Marshal(t.times)
+	t.dirty = false
+	t.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(t.path), 0755); err != nil {
+		return err
+	}
+	tmp := t.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err == nil {
+		err = os.Rename(tmp, t.path)
+	}
+	if err != nil {
+		t.mu.Lock()
+		t.dirty = true
+		t.mu.Unlock()
+		return fmt.Errorf("failed to write access times: %w", err)
+	}
+	return nil
+}
+
+// start flushes the access times every interval until close is called
+func (t *accessTracker) start(interval time.Duration) {
+	t.stop = make(chan struct{})
+	t.done = make(chan struct{})
+	go func() {
+		defer close(t.done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := t.flush(); err != nil {
+					slog.Error("failed to flush access times", "error", err)
+				}
+			case <-t.stop:
+				return
+			}
+		}
+	}()
+}
+
+// close stops the periodic flush and writes the pending access times
+func (t *accessTracker) close() error {
+	if t.stop != nil {
+		close(t.stop)
+		<-t.done
+		t.stop = nil
+	}
+	return t.flush()
+}
+
+// WithAccessTracking records the last access of every served model in memory and
+// flushes the times to disk every interval, they are reloaded on the next start. An
+// interval <= 0 disables tracking.
+func (s *Storage) WithAccessTracking(interval time.Duration) error {
+	if s.access != nil {
+		if err := s.access.close(); err != nil {
+			return err
+		}
+		s.access = nil
+	}
+	if interval <= 0 {
+		return nil
+	}
+	tracker, err := newAccessTracker(filepath.Join(s.baseDir, accessFile))
+	if err != nil {
+		return err
+	}
+	tracker.start(interval)
+	s.access = tracker
+	return nil
+}
+
+// Close writes the pending access times to disk and stops access tracking and blob
+// compression
+func (s *Storage) Close() error {
+	if s.compress != nil {
+		s.compress.close()
+	}
+	if s.refresh != nil {
+		s.refresh.close()
+	}
+	if s.access == nil {
+		return nil
+	}
+	return s.access.close()
+}
+
+// LastAccess returns the last time a file of a model was served, when tracked
+func (s *Storage) LastAccess(modelID string) (time.Time, bool) {
+	if s.access == nil {
+		return time.Time{}, false
+	}
+	return s.access.lastAccess(modelID)
+}
@@ -0,0 +1,102 @@
+package filestorage
+
+import (
+	"io"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestAccessTrackerTouch(t *testing.T) {
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name  string
+		times []time.Time
+		want  time.Time
+	}{
+		{"single access", []time.Time{base}, base},
+		{"later access", []time.Time{base, base.Add(time.Minute)}, base.Add(time.Minute)},
+		{"out of order access", []time.Time{base.Add(time.Minute), base}, base.Add(time.Minute)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tracker, err := newAccessTracker(filepath.Join(t.TempDir(), accessFile))
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, at := range tt.times {
+				tracker.now = func() time.Time { return at }
+				tracker.touch("org/m")
+			}
+			if got, ok := tracker.lastAccess("org/m"); !ok || !got.Equal(tt.want) {
+				t.Errorf("lastAccess = %v, %v, want %v", got, ok, tt.want)
+			}
+		})
+	}
+}
+
+func TestAccessTrackingSurvivesRestart(t *testing.T) {
+	dir := t.TempDir()
+	s, err := NewStorage(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.WithAccessTracking(time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	models := []string{"org/a", "org/b"}
+	shas := make(map[string]string)
+	for _, modelID := range models {
+		sha, _, err := s.StoreSnapshotFile(modelID, "main", "config.json", strings.NewReader("{}"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		shas[modelID] = sha
+	}
+
+	start := time.Now()
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		modelID := models[i%len(models)]
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			f, err := s.GetFile(modelID, shas[modelID], "config.json")
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if closer, ok := f.(io.Closer); ok {
+				closer.Close()
+			}
+		}()
+	}
+	wg.Wait()
+	want := make(map[string]time.Time)
+	for _, modelID := range models {
+		last, ok := s.LastAccess(modelID)
+		if !ok || last.Before(start) {
+			t.Fatalf("LastAccess(%s) = %v, %v, want after %v", modelID, last, ok, start)
+		}
+		want[modelID] = last
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	restarted, err := NewStorage(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := restarted.WithAccessTracking(time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	defer restarted.Close()
+	for _, modelID := range models {
+		if last, ok := restarted.LastAccess(modelID); !ok || !last.Equal(want[modelID]) {
+			t.Errorf("LastAccess(%s) after restart = %v, %v, want %v", modelID, last, ok, want[modelID])
+		}
+	}
+}
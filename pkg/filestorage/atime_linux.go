@@ -0,0 +1,19 @@
+//go:build linux
+
+package filestorage
+
+import (
+	"os"
+	"syscall"
+	"time"
+)
+
+// accessTime returns the last access time of a file, the modification time when the
+// file system does not provide it
+func accessTime(info os.FileInfo) time.Time {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return info.ModTime()
+	}
+	return time.Unix(stat.Atim.Sec, stat.Atim.Nsec)
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+
+package filestorage
+
+import (
+	"os"
+	"time"
+)
+
+// accessTime falls back to the modification time where the access time is not read
+func accessTime(info os.FileInfo) time.Time {
+	return info.ModTime()
+}
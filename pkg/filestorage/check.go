@@ -0,0 +1,112 @@
+package filestorage
+
+import (
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+
+	"github.com/lengrongfu/LLMDistribution/pkg/api/model"
+	"github.com/lengrongfu/LLMDistribution/pkg/utils"
+)
+
+// CheckModel verifies that every file of every snapshot of a model resolves to its
+// blob. In deep mode the blob content is also hashed and compared with its etag.
+// Files are checked in parallel.
+func (s *Storage) CheckModel(modelID string, deep bool) ([]model.FileCheck, error) {
+	snapshotsDir := s.layout.SnapshotPath(modelID, "", "")
+	if _, err := os.Stat(snapshotsDir); err != nil {
+		return nil, fmt.Errorf("model not found: %s", modelID)
+	}
+
+	var checks []model.FileCheck
+	err := filepath.WalkDir(snapshotsDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(snapshotsDir, path)
+		if err != nil {
+			return err
+		}
+		sha, filename, _ := strings.Cut(filepath.ToSlash(rel), "/")
+		checks = append(checks, model.FileCheck{SHA: sha, Filename: filename})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to walk snapshots: %w", err)
+	}
+
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for i := 0; i < runtime.NumCPU(); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				s.checkFile(snapshotsDir, &checks[i], deep)
+			}
+		}()
+	}
+	for i := range checks {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+	return checks, nil
+}
+
+// checkFile fills in the status of a single snapshot file
+func (s *Storage) checkFile(snapshotsDir string, check *model.FileCheck, deep bool) {
+	path := filepath.Join(snapshotsDir, check.SHA, filepath.FromSlash(check.Filename))
+	check.Status = model.FileCheckOK
+	if target, err := os.Readlink(path); err == nil {
+		check.Etag = blobEtag(target)
+	}
+	info, err := statBlob(path)
+	if os.IsNotExist(err) {
+		check.Status = model.FileCheckDangling
+		check.Message = "blob is missing"
+		return
+	}
+	if err != nil {
+		check.Status = model.FileCheckError
+		check.Message = err.Error()
+		return
+	}
+	if !deep || check.Etag == "" {
+		return
+	}
+	sum, err := hashBlob(path, info.Size(), check.Etag)
+	if err != nil {
+		check.Status = model.FileCheckError
+		check.Message = err.Error()
+		return
+	}
+	if sum != check.Etag {
+		check.Status = model.FileCheckCorrupt
+		check.Message = fmt.Sprintf("content hash %s does not match etag", sum)
+	}
+}
+
+// hashBlob hashes a blob the way its etag was computed: sha256 for LFS files and the
+// git blob sha1 for regular files
+func hashBlob(path string, size int64, etag string) (string, error) {
+	f, err := openBlob(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := utils.EtagHash(etag, size)
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
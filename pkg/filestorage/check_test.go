@@ -0,0 +1,76 @@
+package filestorage
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/lengrongfu/LLMDistribution/pkg/api/model"
+)
+
+func TestCheckModel(t *testing.T) {
+	s := newTestStorage(t)
+	var sha string
+	for _, name := range []string{"ok.json", "dangling.json", "corrupt.json"} {
+		commit, _, err := s.StoreSnapshotFile("acme/m", "main", name, strings.NewReader(`{"name":"`+name+`"}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		sha = commit
+	}
+	blob := func(name string) string {
+		path, err := filepath.EvalSymlinks(s.layout.SnapshotPath("acme/m", sha, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	if err := os.WriteFile(blob("corrupt.json"), []byte(`{"name":"CORRUPT.json"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(blob("dangling.json")); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		deep bool
+		want map[string]string
+	}{
+		{"shallow", false, map[string]string{
+			"ok.json":       model.FileCheckOK,
+			"dangling.json": model.FileCheckDangling,
+			"corrupt.json":  model.FileCheckOK,
+		}},
+		{"deep", true, map[string]string{
+			"ok.json":       model.FileCheckOK,
+			"dangling.json": model.FileCheckDangling,
+			"corrupt.json":  model.FileCheckCorrupt,
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checks, err := s.CheckModel("acme/m", tt.deep)
+			if err != nil {
+				t.Fatalf("CheckModel: %v", err)
+			}
+			got := make(map[string]string)
+			for _, check := range checks {
+				if check.SHA != sha {
+					t.Errorf("check of %s has sha %s, want %s", check.Filename, check.SHA, sha)
+				}
+				got[check.Filename] = check.Status
+			}
+			for name, want := range tt.want {
+				if got[name] != want {
+					t.Errorf("%s: status %q, want %q", name, got[name], want)
+				}
+			}
+		})
+	}
+
+	if _, err := s.CheckModel("acme/missing", false); err == nil {
+		t.Error("CheckModel of a missing model succeeded")
+	}
+}
@@ -0,0 +1,253 @@
+package filestorage
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/lengrongfu/LLMDistribution/pkg/api/model"
+	"github.com/lengrongfu/LLMDistribution/pkg/utils"
+)
+
+// compressedSuffix is appended to the name of a blob stored zstd-compressed
+const compressedSuffix = utils.CompressedSuffix
+
+// minCompressSize is the size below which a blob is not worth compressing
+const minCompressSize = 64 << 10
+
+// blobCompressor compresses blobs that have not been read for longer than after
+type blobCompressor struct {
+	after time.Duration
+	now   func() time.Time
+	stop  chan struct{}
+	done  chan struct{}
+}
+
+// WithBlobCompression zstd-compresses blobs that have not been read for longer than
+// after, checking at most every hour. Compressed blobs are decompressed while they
+// are read, so cold models take less space at the cost of slower downloads. An
+// after <= 0 disables compression, blobs already compressed stay readable.
+func (s *Storage) WithBlobCompression(after time.Duration) {
+	if s.compress != nil {
+		s.compress.close()
+		s.compress = nil
+	}
+	if after <= 0 {
+		return
+	}
+	s.compress = &blobCompressor{after: after, now: time.Now}
+	s.compress.start(s, min(after, time.Hour))
+}
+
+// start compresses cold blobs every interval until close is called
+func (c *blobCompressor) start(s *Storage, interval time.Duration) {
+	c.stop = make(chan struct{})
+	c.done = make(chan struct{})
+	go func() {
+		defer close(c.done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				result, err := s.CompressColdBlobs()
+				if err != nil {
+					slog.Error("failed to compress cold blobs", "error", err)
+				} else if result.Compressed > 0 {
+					slog.Info("compressed cold blobs", "count", result.Compressed, "saved_bytes", result.Bytes)
+				}
+			case <-c.stop:
+				return
+			}
+		}
+	}()
+}
+
+// close stops the periodic compression
+func (c *blobCompressor) close() {
+	if c.stop != nil {
+		close(c.stop)
+		<-c.done
+		c.stop = nil
+	}
+}
+
+// blobLink is a snapshot file linking to a blob
+type blobLink struct {
+	modelID string
+	path    string
+	// target is the link target as written in the link
+	target string
+}
+
+// CompressColdBlobs compresses the blobs that no snapshot served within the
+// compression window links to and relinks their snapshot files to the compressed
+// blobs. Blobs of models with a pinned snapshot are left alone.
+func (s *Storage) CompressColdBlobs() (model.CompressResult, error) {
+	var result model.CompressResult
+	c := s.compress
+	if c == nil {
+		return result, nil
+	}
+	links, err := s.blobLinks()
+	if err != nil {
+		return result, fmt.Errorf("failed to scan snapshots: %w", err)
+	}
+	blobs := make([]string, 0, len(links))
+	for blob := range links {
+		blobs = append(blobs, blob)
+	}
+	sort.Strings(blobs)
+
+	cutoff := c.now().Add(-c.after)
+	for _, blob := range blobs {
+		if strings.HasSuffix(blob, compressedSuffix) || !s.coldBlob(links[blob], cutoff) {
+			continue
+		}
+		info, err := os.Stat(blob)
+		if err != nil || !info.Mode().IsRegular() || info.Size() < minCompressSize {
+			continue
+		}
+		if accessTime(info).After(cutoff) || info.ModTime().After(cutoff) {
+			continue
+		}
+		compressed, err := utils.CompressBlob(blob)
+		if err != nil {
+			return result, fmt.Errorf("failed to compress blob %s: %w", blob, err)
+		}
+		for _, link := range links[blob] {
+			if err := relink(link.path, link.target+compressedSuffix); err != nil {
+				return result, fmt.Errorf("failed to relink %s: %w", link.path, err)
+			}
+		}
+		if err := os.Remove(blob); err != nil {
+			return result, fmt.Errorf("failed to remove blob %s: %w", blob, err)
+		}
+		result.Compressed++
+		result.Bytes += info.Size() - compressed
+	}
+	return result, nil
+}
+
+// coldBlob reports whether none of the models linking to a blob was served after cutoff
+func (s *Storage) coldBlob(links []blobLink, cutoff time.Time) bool {
+	for _, link := range links {
+		if s.pinned(link.modelID) {
+			return false
+		}
+		if last, ok := s.LastAccess(link.modelID); ok && last.After(cutoff) {
+			return false
+		}
+	}
+	return true
+}
+
+// blobLinks maps the absolute path of every blob a snapshot links to to its links
+func (s *Storage) blobLinks() (map[string][]blobLink, error) {
+	modelDirs, err := filepath.Glob(s.layout.ModelDirPattern())
+	if err != nil {
+		return nil, err
+	}
+	links := make(map[string][]blobLink)
+	for _, modelDir := range modelDirs {
+		modelID, ok := s.layout.ModelID(modelDir)
+		if !ok {
+			continue
+		}
+		err := filepath.WalkDir(filepath.Join(modelDir, "snapshots"), func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.Type()&fs.ModeSymlink == 0 {
+				return nil
+			}
+			target, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			blob := target
+			if !filepath.IsAbs(blob) {
+				blob = filepath.Join(filepath.Dir(path), blob)
+			}
+			if blob, err = filepath.Abs(blob); err != nil {
+				return err
+			}
+			links[blob] = append(links[blob], blobLink{modelID: modelID, path: path, target: target})
+			return nil
+		})
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+	return links, nil
+}
+
+// relink atomically points the link at path to target
+func relink(path, target string) error {
+	tmp := path + ".relink"
+	os.Remove(tmp)
+	if err := os.Symlink(target, tmp); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// compressed reports whether a snapshot file, or a blob path, is a compressed blob
+func compressed(path string) bool {
+	if strings.HasSuffix(path, compressedSuffix) {
+		return true
+	}
+	target, err := os.Readlink(path)
+	return err == nil && strings.HasSuffix(target, compressedSuffix)
+}
+
+// blobEtag returns the etag of a blob from the name of its file
+func blobEtag(blob string) string {
+	return strings.TrimSuffix(filepath.Base(blob), compressedSuffix)
+}
+
+// statBlob stats a snapshot file or a blob, compressed blobs report the size of
+// their content
+func statBlob(path string) (os.FileInfo, error) {
+	info, err := os.Stat(path)
+	if err != nil || !compressed(path) {
+		return info, err
+	}
+	size, err := utils.CompressedSize(path)
+	if err != nil {
+		return nil, err
+	}
+	return compressedFileInfo{FileInfo: info, size: size}, nil
+}
+
+// openBlob opens a snapshot file or a blob for reading, decompressing compressed blobs
+func openBlob(path string) (io.ReadSeekCloser, error) {
+	if compressed(path) {
+		return utils.OpenCompressed(path)
+	}
+	return os.Open(path)
+}
+
+// readBlob reads a whole snapshot file or blob, decompressing compressed blobs
+func readBlob(path string) ([]byte, error) {
+	f, err := openBlob(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return io.ReadAll(f)
+}
+
+// compressedFileInfo is the file info of a compressed blob with the size of its content
+type compressedFileInfo struct {
+	os.FileInfo
+	size int64
+}
+
+func (i compressedFileInfo) Size() int64 { return i.size }
@@ -0,0 +1,72 @@
+package filestorage
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCompressColdBlobs(t *testing.T) {
+	large := strings.Repeat("compressible weights ", minCompressSize/10)
+	tests := []struct {
+		name           string
+		content        string
+		pin            bool
+		age            time.Duration
+		wantCompressed int
+	}{
+		{"cold blob", large, false, 2 * time.Hour, 1},
+		{"recently read", large, false, time.Minute, 0},
+		{"pinned model", large, true, 2 * time.Hour, 0},
+		{"small blob", "tiny", false, 2 * time.Hour, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestStorage(t)
+			s.WithBlobCompression(time.Hour)
+			defer s.WithBlobCompression(0)
+			commit, etag, err := s.StoreSnapshotFile("acme/m", "main", "model.bin", strings.NewReader(tt.content))
+			if err != nil {
+				t.Fatal(err)
+			}
+			setAccessTime(t, s.layout.ModelDir("acme/m"), time.Now().Add(-tt.age))
+			if tt.pin {
+				s.PinSnapshot("acme/m", commit)
+				defer s.UnpinSnapshot("acme/m", commit)
+			}
+
+			result, err := s.CompressColdBlobs()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.Compressed != tt.wantCompressed {
+				t.Fatalf("compressed %d blobs, want %d", result.Compressed, tt.wantCompressed)
+			}
+			_, err = os.Stat(s.layout.BlobPath("acme/m", etag) + compressedSuffix)
+			if compressed := err == nil; compressed != (tt.wantCompressed > 0) {
+				t.Errorf("compressed blob exists = %v", compressed)
+			}
+			if tt.wantCompressed > 0 && result.Bytes <= 0 {
+				t.Errorf("saved %d bytes", result.Bytes)
+			}
+
+			// the file reads the same either way
+			r, err := s.GetFile("acme/m", commit, "model.bin")
+			if err != nil {
+				t.Fatal(err)
+			}
+			data, _ := io.ReadAll(r)
+			r.(io.Closer).Close()
+			if !bytes.Equal(data, []byte(tt.content)) {
+				t.Errorf("read %d bytes, want the %d stored", len(data), len(tt.content))
+			}
+			info, ok := s.FileExists("acme/m", commit, "model.bin")
+			if !ok || info.Size() != int64(len(tt.content)) {
+				t.Errorf("FileExists size = %v, want %d", info, len(tt.content))
+			}
+		})
+	}
+}
@@ -0,0 +1,102 @@
+package filestorage
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/lengrongfu/LLMDistribution/pkg/utils"
+)
+
+// DeleteModel removes a cached model. Blobs in the shared blob directory are only
+// removed once no snapshot of another model links to them anymore. The model ID must
+// have the form org/name, so only the directories of that repository are removed.
+func (s *Storage) DeleteModel(modelID string) error {
+	if !utils.ValidModelID(modelID) || strings.Count(modelID, "/") != 1 {
+		return fmt.Errorf("%w: model %q, expected org/name", utils.ErrInvalidPath, modelID)
+	}
+	modelDir := s.layout.ModelDir(modelID)
+	if _, err := os.Stat(modelDir); os.IsNotExist(err) {
+		return fmt.Errorf("model not found: %s", modelID)
+	}
+
+	used, err := s.sharedBlobRefs(modelDir)
+	if err != nil {
+		return fmt.Errorf("failed to scan model snapshots: %w", err)
+	}
+	if err := os.RemoveAll(modelDir); err != nil {
+		return fmt.Errorf("failed to delete model: %w", err)
+	}
+	// the blobs are outside the model directory with a separate blob directory
+	if err := os.RemoveAll(filepath.Dir(s.layout.BlobPath(modelID, ""))); err != nil {
+		return fmt.Errorf("failed to delete model blobs: %w", err)
+	}
+	s.forgetIndex(modelID)
+	if s.access != nil {
+		s.access.forget(modelID)
+	}
+	if len(used) == 0 {
+		return nil
+	}
+
+	// the reference count of a shared blob is the number of snapshot links to it,
+	// derived from the remaining models rather than stored next to the blob
+	remaining, err := s.sharedBlobRefs(s.baseDir)
+	if err != nil {
+		return fmt.Errorf("failed to scan shared blob references: %w", err)
+	}
+	for etag := range used {
+		if remaining[etag] > 0 {
+			continue
+		}
+		// a compression interrupted before removing the original leaves the blob
+		// stored under both names, either one keeps the blob in use
+		etag = strings.TrimSuffix(etag, utils.CompressedSuffix)
+		if remaining[etag] > 0 || remaining[etag+utils.CompressedSuffix] > 0 {
+			continue
+		}
+		for _, name := range []string{etag, etag + utils.CompressedSuffix} {
+			if err := os.Remove(s.layout.SharedBlobPath(name)); err != nil && !os.IsNotExist(err) {
+				return fmt.Errorf("failed to delete shared blob %s: %w", name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// sharedBlobRefs counts the snapshot links below root that point into the shared blob directory
+func (s *Storage) sharedBlobRefs(root string) (map[string]int, error) {
+	// the proxy creates absolute links, so compare against the absolute directory
+	sharedDir, err := filepath.Abs(s.layout.SharedBlobPath(""))
+	if err != nil {
+		return nil, err
+	}
+	refs := make(map[string]int)
+	err = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() && d.Name() == utils.SharedBlobsDir {
+			return filepath.SkipDir
+		}
+		if d.Type()&fs.ModeSymlink == 0 {
+			return nil
+		}
+		target, err := os.Readlink(path)
+		if err != nil {
+			return err
+		}
+		if !filepath.IsAbs(target) {
+			if target, err = filepath.Abs(filepath.Join(filepath.Dir(path), target)); err != nil {
+				return err
+			}
+		}
+		if filepath.Dir(filepath.Clean(target)) == sharedDir {
+			refs[filepath.Base(target)]++
+		}
+		return nil
+	})
+	return refs, err
+}
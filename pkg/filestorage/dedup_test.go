@@ -0,0 +1,125 @@
+package filestorage
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/lengrongfu/LLMDistribution/pkg/utils"
+)
+
+func TestDeleteModelOnlyRemovesTheRepository(t *testing.T) {
+	for _, layout := range []utils.LayoutStrategy{utils.LayoutHF, utils.LayoutFlat} {
+		t.Run(string(layout), func(t *testing.T) {
+			s := newTestStorage(t)
+			s.WithLayout(layout)
+			if err := s.WithBlobDir(filepath.Join(t.TempDir(), "blobs")); err != nil {
+				t.Fatal(err)
+			}
+			for _, modelID := range []string{"org/a", "org/b"} {
+				if _, _, err := s.StoreSnapshotFile(modelID, "main", "config.json", strings.NewReader(modelID)); err != nil {
+					t.Fatalf("StoreSnapshotFile(%s): %v", modelID, err)
+				}
+			}
+
+			for _, modelID := range []string{"org", "", "org/a/..", "../org/a", "org/a/b"} {
+				if err := s.DeleteModel(modelID); !errors.Is(err, utils.ErrInvalidPath) {
+					t.Errorf("DeleteModel(%q) = %v, want ErrInvalidPath", modelID, err)
+				}
+			}
+			if err := s.DeleteModel("org/a"); err != nil {
+				t.Fatalf("DeleteModel(org/a): %v", err)
+			}
+			if _, err := os.Stat(s.layout.ModelDir("org/a")); !os.IsNotExist(err) {
+				t.Errorf("org/a was not removed: %v", err)
+			}
+			if _, err := os.Stat(s.layout.BlobPath("org/a", "")); !os.IsNotExist(err) {
+				t.Errorf("blobs of org/a were not removed: %v", err)
+			}
+			sha, err := s.getRepoSha("org/b", "main")
+			if err != nil {
+				t.Fatal(err)
+			}
+			content, err := os.ReadFile(s.layout.SnapshotPath("org/b", sha, "config.json"))
+			if err != nil || string(content) != "org/b" {
+				t.Errorf("org/b was affected: %q, %v", content, err)
+			}
+		})
+	}
+}
+
+func TestDeleteModelReleasesSharedBlobs(t *testing.T) {
+	const (
+		sha  = "0123456789abcdef0123456789abcdef01234567"
+		etag = "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+	)
+	content := strings.Repeat("shared weights ", 8<<10)
+	tests := []struct {
+		name       string
+		compressed bool
+		// keepOriginal leaves the uncompressed blob behind, as an interrupted
+		// compression does
+		keepOriginal bool
+	}{
+		{"uncompressed blob", false, false},
+		{"compressed blob", true, false},
+		{"interrupted compression", true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestStorage(t)
+			blob := s.layout.SharedBlobPath(etag)
+			if err := os.MkdirAll(filepath.Dir(blob), 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(blob, []byte(content), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if tt.compressed {
+				if _, err := utils.CompressBlob(blob); err != nil {
+					t.Fatal(err)
+				}
+				if !tt.keepOriginal {
+					if err := os.Remove(blob); err != nil {
+						t.Fatal(err)
+					}
+				}
+				blob += utils.CompressedSuffix
+			}
+			for _, modelID := range []string{"org/a", "org/b"} {
+				link := s.layout.SnapshotPath(modelID, sha, "model.safetensors")
+				if err := os.MkdirAll(filepath.Dir(link), 0755); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.Symlink(blob, link); err != nil {
+					t.Fatal(err)
+				}
+			}
+			// the blob is stored once for both models
+			want := 1
+			if tt.keepOriginal {
+				want = 2
+			}
+			if entries, err := os.ReadDir(filepath.Dir(blob)); err != nil || len(entries) != want {
+				t.Fatalf("shared blob directory holds %d files, %v, want %d", len(entries), err, want)
+			}
+
+			if err := s.DeleteModel("org/a"); err != nil {
+				t.Fatalf("DeleteModel(org/a): %v", err)
+			}
+			got, err := readBlob(s.layout.SnapshotPath("org/b", sha, "model.safetensors"))
+			if err != nil || string(got) != content {
+				t.Fatalf("org/b lost the shared blob: %v", err)
+			}
+
+			if err := s.DeleteModel("org/b"); err != nil {
+				t.Fatalf("DeleteModel(org/b): %v", err)
+			}
+			if entries, _ := os.ReadDir(filepath.Dir(blob)); len(entries) != 0 {
+				t.Errorf("shared blobs %v left after deleting every model", entries)
+			}
+		})
+	}
+}
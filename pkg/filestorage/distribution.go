@@ -1,12 +1,14 @@
 package filestorage
 
 import (
+	"encoding/json"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
 
 	"github.com/lengrongfu/LLMDistribution/pkg/api/model"
+	"github.com/lengrongfu/LLMDistribution/pkg/utils"
 )
 
 // Distribution implements the api.Distribution interface for file storage
@@ -31,6 +33,21 @@ func (d *Distribution) StoreFile(modelID, filename string, content io.Reader) (s
 	return d.Storage.StoreFile(modelID, filename, content)
 }
 
+// UploadOffset returns the number of bytes already received for an interrupted upload
+func (d *Distribution) UploadOffset(modelID, filename string) (int64, error) {
+	return d.Storage.UploadOffset(modelID, filename)
+}
+
+// StoreFileAt resumes an upload at offset, completing it once total bytes are received
+func (d *Distribution) StoreFileAt(modelID, filename string, offset, total int64, content io.Reader) (string, bool, error) {
+	return d.Storage.StoreFileAt(modelID, filename, offset, total, content)
+}
+
+// DiscardUpload removes the partial file of an upload
+func (d *Distribution) DiscardUpload(modelID, filename string) error {
+	return d.Storage.DiscardUpload(modelID, filename)
+}
+
 // GetFile retrieves a file from file storage
 func (d *Distribution) GetFile(modelID, sha, filename string) (io.ReadSeeker, error) {
 	return d.Storage.GetFile(modelID, sha, filename)
@@ -84,22 +101,128 @@ func (d *Distribution) RepoInfo(modelID, version string) (model.ModelIndexInfo,
 	for i, sibling := range mode.Siblings {
 		siblings[i] = model.SiblingFile{
 			RFilename: sibling.Rfilename,
+			BlobID:    sibling.BlobID,
+			Size:      sibling.Size,
+		}
+		if sibling.LFS != nil {
+			siblings[i].LFS = &model.LFSInfo{
+				SHA256: sibling.LFS.SHA256,
+				Size:   sibling.LFS.Size,
+			}
 		}
 	}
 
+	config, safetensors := modelConfigInfo(mode)
 	return model.ModelIndexInfo{
 		ID:           mode.ID,
 		ModelID:      mode.ModelID,
 		Author:       mode.Author,
 		SHA:          mode.SHA,
 		LastModified: mode.LastModified,
+		Private:      mode.Private,
+		Gated:        mode.Gated,
 		Disabled:     mode.Disabled,
 		CreatedAt:    mode.CreatedAt,
+		Config:       config,
+		Safetensors:  safetensors,
 		UsedStorage:  mode.UsedStorage,
 		Siblings:     siblings,
 	}, nil
 }
 
+// StreamRepoInfo writes the model index of a version to w as JSON. Indexes built from
+// the snapshot are streamed while the snapshot is walked.
+func (d *Distribution) StreamRepoInfo(modelID, version string, w io.Writer) error {
+	if !d.Storage.hasModelIndexFile(modelID) {
+		return d.Storage.StreamModelIndex(modelID, version, w)
+	}
+	info, err := d.RepoInfo(modelID, version)
+	if err != nil {
+		return err
+	}
+	return json.NewEncoder(w).Encode(info)
+}
+
+// ListModels lists the cached models
+func (d *Distribution) ListModels() ([]model.CachedModel, error) {
+	return d.Storage.ListModels()
+}
+
+// CheckModel verifies the snapshot files of a model against their blobs
+func (d *Distribution) CheckModel(modelID string, deep bool) ([]model.FileCheck, error) {
+	return d.Storage.CheckModel(modelID, deep)
+}
+
+// ListTree lists the files and directories below dir of a snapshot
+func (d *Distribution) ListTree(modelID, sha, dir string, recursive bool) ([]model.TreeEntry, error) {
+	return d.Storage.ListTree(modelID, sha, dir, recursive)
+}
+
+// CollectGarbage removes blobs no snapshot links to
+func (d *Distribution) CollectGarbage() (model.GCResult, error) {
+	return d.Storage.CollectGarbage()
+}
+
+// Reindex regenerates the model index of a model from its snapshot
+func (d *Distribution) Reindex(modelID string) (model.ReindexResult, error) {
+	return d.Storage.Reindex(modelID)
+}
+
+// Close flushes the access times of the storage
+func (d *Distribution) Close() error {
+	return d.Storage.Close()
+}
+
+// EvictionPreview lists the models that would be evicted to shrink the cache to targetBytes
+func (d *Distribution) EvictionPreview(targetBytes int64) (model.EvictionPreview, error) {
+	return d.Storage.EvictionPreview(targetBytes)
+}
+
+// PinSnapshot protects a snapshot from eviction while it is served
+func (d *Distribution) PinSnapshot(modelID, sha string) {
+	d.Storage.PinSnapshot(modelID, sha)
+}
+
+// UnpinSnapshot releases a pin taken with PinSnapshot
+func (d *Distribution) UnpinSnapshot(modelID, sha string) {
+	d.Storage.UnpinSnapshot(modelID, sha)
+}
+
+// SnapshotPinned reports whether a snapshot is being served
+func (d *Distribution) SnapshotPinned(modelID, sha string) bool {
+	return d.Storage.SnapshotPinned(modelID, sha)
+}
+
+// VerifyFile re-verifies the blob of a file that is older than the re-verification age
+func (d *Distribution) VerifyFile(modelID, sha, filename string) error {
+	return d.Storage.VerifyFile(modelID, sha, filename)
+}
+
+// StoreSnapshotFile stores an uploaded file in the snapshot of a revision
+func (d *Distribution) StoreSnapshotFile(modelID, revision, filename string, content io.Reader) (string, string, error) {
+	return d.Storage.StoreSnapshotFile(modelID, revision, filename, content)
+}
+
+// AddToSnapshot adds a file to an existing snapshot
+func (d *Distribution) AddToSnapshot(modelID, sha, filename string, content io.Reader) (string, error) {
+	return d.Storage.AddToSnapshot(modelID, sha, filename, content)
+}
+
+// CheckHealth verifies that the storage directory is usable
+func (d *Distribution) CheckHealth() error {
+	return utils.CheckWritableDir(d.Storage.baseDir)
+}
+
+// Revisions lists the cached refs and snapshot commits of a model
+func (d *Distribution) Revisions(modelID string) ([]string, error) {
+	return d.Storage.Revisions(modelID)
+}
+
+// DeleteModel removes a cached model, keeping shared blobs still used by other models
+func (d *Distribution) DeleteModel(modelID string) error {
+	return d.Storage.DeleteModel(modelID)
+}
+
 func (d *Distribution) FileEtag(modelID, sha, filename string) string {
 	return d.Storage.FileEtag(modelID, sha, filename)
 }
@@ -0,0 +1,99 @@
+package filestorage
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/lengrongfu/LLMDistribution/pkg/api/model"
+)
+
+// EvictionPreview lists the models that would be evicted, least recently accessed
+// first, until the cache fits in targetBytes. Nothing is removed. The size of a model
+// is the size of the files in its model directory, shared blobs are not counted as
+// they are only freed once no model links to them. Models with a pinned snapshot are
+// never evicted.
+func (s *Storage) EvictionPreview(targetBytes int64) (model.EvictionPreview, error) {
+	preview := model.EvictionPreview{TargetBytes: targetBytes, Models: []model.EvictionCandidate{}}
+	models, err := s.ListModels()
+	if err != nil {
+		return preview, err
+	}
+	candidates := make([]model.EvictionCandidate, 0, len(models))
+	for _, m := range models {
+		size, lastAccess, err := s.modelUsage(m.ID)
+		if err != nil {
+			return preview, err
+		}
+		// served files are tracked even where the file system does not update atimes
+		if tracked, ok := s.LastAccess(m.ID); ok && tracked.After(lastAccess) {
+			lastAccess = tracked
+		}
+		candidates = append(candidates, model.EvictionCandidate{ID: m.ID, Size: size, LastAccess: lastAccess})
+		preview.TotalBytes += size
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].LastAccess.Before(candidates[j].LastAccess)
+	})
+
+	remaining := preview.TotalBytes
+	for _, c := range candidates {
+		if remaining <= targetBytes {
+			break
+		}
+		if s.pinned(c.ID) {
+			continue
+		}
+		preview.Models = append(preview.Models, c)
+		remaining -= c.Size
+	}
+	return preview, nil
+}
+
+// modelUsage returns the bytes a model directory, and its blobs directory when the
+// blobs are kept separately, hold and the last time one of its files, or a blob its
+// snapshots link to, was accessed
+func (s *Storage) modelUsage(modelID string) (int64, time.Time, error) {
+	var (
+		size       int64
+		lastAccess time.Time
+	)
+	dirs := []string{s.layout.ModelDir(modelID)}
+	if s.blobDir != "" {
+		dirs = append(dirs, s.layout.BlobPath(modelID, ""))
+	}
+	for i, dir := range dirs {
+		err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				// a model without blobs has no separate blobs directory
+				if i > 0 && path == dir && os.IsNotExist(err) {
+					return filepath.SkipDir
+				}
+				return err
+			}
+			if d.IsDir() {
+				return nil
+			}
+			if d.Type().IsRegular() {
+				if info, err := d.Info(); err == nil {
+					size += info.Size()
+				}
+			}
+			// follow snapshot links to read the access time of the blob
+			info, err := os.Stat(path)
+			if err != nil {
+				return nil
+			}
+			if atime := accessTime(info); atime.After(lastAccess) {
+				lastAccess = atime
+			}
+			return nil
+		})
+		if err != nil {
+			return size, lastAccess, err
+		}
+	}
+	return size, lastAccess, nil
+}
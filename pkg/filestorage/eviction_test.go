@@ -0,0 +1,83 @@
+package filestorage
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEvictionPreview(t *testing.T) {
+	s := newTestStorage(t)
+	now := time.Now()
+	sizes := map[string]int{"org/oldest": 100, "org/middle": 200, "org/newest": 300}
+	for i, modelID := range []string{"org/oldest", "org/middle", "org/newest"} {
+		if _, _, err := s.StoreSnapshotFile(modelID, "main", "model.bin", strings.NewReader(strings.Repeat("x", sizes[modelID]))); err != nil {
+			t.Fatal(err)
+		}
+		setAccessTime(t, s.layout.ModelDir(modelID), now.Add(time.Duration(i-3)*time.Hour))
+	}
+	full, err := s.EvictionPreview(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	total := full.TotalBytes
+
+	tests := []struct {
+		name   string
+		target int64
+		// pinned is a model with a snapshot in use
+		pinned string
+		want   []string
+	}{
+		{"below target", total, "", nil},
+		{"one model over", total - 1, "", []string{"org/oldest"}},
+		{"empty cache", 0, "", []string{"org/oldest", "org/middle", "org/newest"}},
+		{"pinned model kept", total - 1, "org/oldest", []string{"org/middle"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.pinned != "" {
+				s.PinSnapshot(tt.pinned, "main")
+				defer s.UnpinSnapshot(tt.pinned, "main")
+			}
+			preview, err := s.EvictionPreview(tt.target)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var ids []string
+			for _, candidate := range preview.Models {
+				ids = append(ids, candidate.ID)
+			}
+			if strings.Join(ids, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("models = %v, want %v", ids, tt.want)
+			}
+			if preview.TotalBytes != total || preview.TargetBytes != tt.target {
+				t.Errorf("total %d, target %d, want %d, %d", preview.TotalBytes, preview.TargetBytes, total, tt.target)
+			}
+		})
+	}
+	// a preview never removes anything
+	for modelID := range sizes {
+		if _, err := os.Stat(s.layout.ModelDir(modelID)); err != nil {
+			t.Errorf("%s removed: %v", modelID, err)
+		}
+	}
+}
+
+// setAccessTime sets the access time of every file below dir, and of the blobs its
+// links point to, to at
+func setAccessTime(t *testing.T, dir string, at time.Time) {
+	t.Helper()
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		return os.Chtimes(path, at, at)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,99 @@
+package filestorage
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/lengrongfu/LLMDistribution/pkg/api/model"
+)
+
+// gcGracePeriod is how long a blob no snapshot links to is kept after it was written.
+// Blobs are renamed into place, and compressed blobs written, before the snapshot
+// links to them, so a young blob may just not be linked yet.
+const gcGracePeriod = time.Hour
+
+// CollectGarbage removes the blobs of all models, and the shared blobs, that no
+// snapshot links to. Blobs still being written (".incomplete") and blobs written
+// within gcGracePeriod are kept.
+func (s *Storage) CollectGarbage() (model.GCResult, error) {
+	var result model.GCResult
+	referenced, err := s.linkedBlobs()
+	if err != nil {
+		return result, fmt.Errorf("failed to scan snapshots: %w", err)
+	}
+
+	blobDirs, err := filepath.Glob(s.layout.BlobDirPattern())
+	if err != nil {
+		return result, err
+	}
+	blobDirs = append(blobDirs, s.layout.SharedBlobPath(""))
+	for _, dir := range blobDirs {
+		entries, err := os.ReadDir(dir)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return result, fmt.Errorf("failed to read blob directory: %w", err)
+		}
+		for _, entry := range entries {
+			if entry.IsDir() || strings.HasSuffix(entry.Name(), ".incomplete") {
+				continue
+			}
+			blobPath, err := filepath.Abs(filepath.Join(dir, entry.Name()))
+			if err != nil {
+				return result, err
+			}
+			if referenced[blobPath] {
+				continue
+			}
+			info, err := entry.Info()
+			if err != nil || time.Since(info.ModTime()) < gcGracePeriod {
+				continue
+			}
+			if err := os.Remove(blobPath); err != nil {
+				return result, fmt.Errorf("failed to remove blob %s: %w", blobPath, err)
+			}
+			result.Removed++
+			result.Bytes += info.Size()
+		}
+	}
+	return result, nil
+}
+
+// linkedBlobs returns the absolute paths of all blobs a snapshot links to
+func (s *Storage) linkedBlobs() (map[string]bool, error) {
+	snapshotDirs, err := filepath.Glob(filepath.Join(s.layout.ModelDirPattern(), "snapshots"))
+	if err != nil {
+		return nil, err
+	}
+	linked := make(map[string]bool)
+	for _, dir := range snapshotDirs {
+		err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.Type()&fs.ModeSymlink == 0 {
+				return nil
+			}
+			target, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			if !filepath.IsAbs(target) {
+				target = filepath.Join(filepath.Dir(path), target)
+			}
+			if target, err = filepath.Abs(target); err != nil {
+				return err
+			}
+			linked[target] = true
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return linked, nil
+}
@@ -0,0 +1,64 @@
+package filestorage
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCollectGarbageKeepsYoungBlobs(t *testing.T) {
+	s := newTestStorage(t)
+	old := time.Now().Add(-2 * gcGracePeriod)
+
+	tests := []struct {
+		name    string
+		blob    string
+		linked  bool
+		modTime time.Time
+		removed bool
+	}{
+		{"old unlinked blob", "old", false, old, true},
+		{"young unlinked blob", "young", false, time.Now(), false},
+		{"young compressed blob", "young" + compressedSuffix, false, time.Now(), false},
+		{"old linked blob", "linked", true, old, false},
+		{"incomplete blob", "partial.incomplete", false, old, false},
+	}
+	for _, tt := range tests {
+		blob := s.layout.BlobPath("org/m", tt.blob)
+		if err := os.MkdirAll(filepath.Dir(blob), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(blob, []byte(tt.blob), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(blob, tt.modTime, tt.modTime); err != nil {
+			t.Fatal(err)
+		}
+		if tt.linked {
+			link := s.layout.SnapshotPath("org/m", "abc", tt.blob)
+			if err := os.MkdirAll(filepath.Dir(link), 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.Symlink(blob, link); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	result, err := s.CollectGarbage()
+	if err != nil {
+		t.Fatalf("CollectGarbage: %v", err)
+	}
+	if result.Removed != 1 {
+		t.Fatalf("removed %d blobs, want 1", result.Removed)
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := os.Stat(s.layout.BlobPath("org/m", tt.blob))
+			if removed := os.IsNotExist(err); removed != tt.removed {
+				t.Fatalf("removed = %v, want %v", removed, tt.removed)
+			}
+		})
+	}
+}
@@ -0,0 +1,40 @@
+package filestorage
+
+import (
+	"os"
+
+	"github.com/lengrongfu/LLMDistribution/pkg/api/model"
+)
+
+// WithIndexMerge lists the files of the local snapshot that a cached upstream
+// .modeindex is missing, like files uploaded after the index was fetched, in the
+// served model index
+func (s *Storage) WithIndexMerge(enabled bool) {
+	s.mergeIndex = enabled
+}
+
+// mergeLocalSiblings appends the files of the snapshot of the index commit that the
+// index does not list. Siblings of the index keep their upstream metadata.
+func (s *Storage) mergeLocalSiblings(modelID string, index *Model) error {
+	snapshotDir := s.layout.SnapshotPath(modelID, index.SHA, "")
+	if info, err := os.Stat(snapshotDir); err != nil || !info.IsDir() || index.SHA == "" {
+		// nothing of this commit is cached yet
+		return nil
+	}
+	listed := make(map[string]bool, len(index.Siblings))
+	for _, sibling := range index.Siblings {
+		listed[sibling.Rfilename] = true
+	}
+	return walkSnapshot(snapshotDir, snapshotDir, true, func(entry model.TreeEntry) error {
+		if entry.Type != model.TreeEntryFile || listed[entry.Path] {
+			return nil
+		}
+		if entry.Oid == "" {
+			index.Siblings = append(index.Siblings, Sibling{Rfilename: entry.Path, Size: entry.Size})
+		} else {
+			index.Siblings = append(index.Siblings, newSibling(entry.Path, entry.Oid, entry.Size))
+		}
+		index.UsedStorage += entry.Size
+		return nil
+	})
+}
@@ -0,0 +1,65 @@
+package filestorage
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestIndexMerge(t *testing.T) {
+	tests := []struct {
+		name      string
+		merge     bool
+		indexSHA  string
+		wantFiles []string
+	}{
+		{"disabled", false, "", []string{"config.json"}},
+		{"adds uploaded files", true, "", []string{"config.json", "extra/notes.txt"}},
+		{"other commit not cached", true, "0123456789abcdef0123456789abcdef01234567", []string{"config.json"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestStorage(t)
+			s.WithIndexMerge(tt.merge)
+			commit, _, err := s.StoreSnapshotFile("acme/m", "main", "config.json", strings.NewReader("{}"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, _, err := s.StoreSnapshotFile("acme/m", commit, "extra/notes.txt", strings.NewReader("notes")); err != nil {
+				t.Fatal(err)
+			}
+			sha := commit
+			if tt.indexSHA != "" {
+				sha = tt.indexSHA
+			}
+			index := Model{ID: "acme/m", SHA: sha, Siblings: []Sibling{{Rfilename: "config.json", Size: 2}}}
+			data, err := json.Marshal(index)
+			if err != nil {
+				t.Fatal(err)
+			}
+			indexPath := s.layout.IndexPath("acme/m")
+			if err := os.MkdirAll(filepath.Dir(indexPath), 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(indexPath, data, 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := s.RepoInfo("acme/m", "main")
+			if err != nil {
+				t.Fatal(err)
+			}
+			var files []string
+			for _, sibling := range got.Siblings {
+				files = append(files, sibling.Rfilename)
+			}
+			sort.Strings(files)
+			if strings.Join(files, ",") != strings.Join(tt.wantFiles, ",") {
+				t.Errorf("siblings = %v, want %v", files, tt.wantFiles)
+			}
+		})
+	}
+}
@@ -0,0 +1,135 @@
+package filestorage
+
+import (
+	"encoding/json"
+	"log/slog"
+	"path/filepath"
+
+	"github.com/lengrongfu/LLMDistribution/pkg/api/model"
+	"github.com/lengrongfu/LLMDistribution/pkg/utils"
+)
+
+// readModelMetadata fills the config, tokenizer config and safetensors parameter
+// counts of an index built from a snapshot. Missing or malformed files leave the
+// fields empty.
+func readModelMetadata(snapshotDir string, index *Model) {
+	if data, err := readBlob(filepath.Join(snapshotDir, "config.json")); err == nil {
+		var config struct {
+			Architectures []string `json:"architectures"`
+			ModelType     string   `json:"model_type"`
+		}
+		if json.Unmarshal(data, &config) == nil {
+			index.Config.Architectures = config.Architectures
+			index.Config.ModelType = config.ModelType
+		}
+	}
+	if data, err := readBlob(filepath.Join(snapshotDir, "tokenizer_config.json")); err == nil {
+		var tokenizer map[string]json.RawMessage
+		if json.Unmarshal(data, &tokenizer) == nil {
+			config := &index.Config.TokenizerConfig
+			if token, ok := tokenString(tokenizer["bos_token"]); ok {
+				config.BosToken = &token
+			}
+			if token, ok := tokenString(tokenizer["unk_token"]); ok {
+				config.UnkToken = &token
+			}
+			config.EosToken, _ = tokenString(tokenizer["eos_token"])
+			config.PadToken, _ = tokenString(tokenizer["pad_token"])
+			config.ChatTemplate = chatTemplate(tokenizer["chat_template"])
+		}
+	}
+
+	weights, _ := filepath.Glob(filepath.Join(snapshotDir, "*.safetensors"))
+	for _, path := range weights {
+		f, err := openBlob(path)
+		if err != nil {
+			continue
+		}
+		info, err := utils.ParseSafetensorsHeader(f)
+		f.Close()
+		if err != nil {
+			slog.Warn("failed to read safetensors header", "path", path, "error", err)
+			continue
+		}
+		if index.Safetensors.Parameters == nil {
+			index.Safetensors.Parameters = make(Parameters)
+		}
+		for dtype, n := range info.Parameters {
+			index.Safetensors.Parameters[dtype] += n
+		}
+		index.Safetensors.Total += info.Total
+	}
+}
+
+// tokenString returns a special token of a tokenizer config, which is either the
+// token itself or an object holding it as "content"
+func tokenString(raw json.RawMessage) (string, bool) {
+	var token string
+	if json.Unmarshal(raw, &token) == nil {
+		return token, true
+	}
+	var added struct {
+		Content *string `json:"content"`
+	}
+	if json.Unmarshal(raw, &added) == nil && added.Content != nil {
+		return *added.Content, true
+	}
+	return "", false
+}
+
+// chatTemplate returns the chat template of a tokenizer config, the "default" one
+// when the config lists several named templates
+func chatTemplate(raw json.RawMessage) string {
+	var template string
+	if json.Unmarshal(raw, &template) == nil {
+		return template
+	}
+	var named []struct {
+		Name     string `json:"name"`
+		Template string `json:"template"`
+	}
+	if json.Unmarshal(raw, &named) != nil || len(named) == 0 {
+		return ""
+	}
+	for _, t := range named {
+		if t.Name == "default" {
+			return t.Template
+		}
+	}
+	return named[0].Template
+}
+
+// modelConfigInfo converts the config and safetensors of an index to the API model,
+// nil when they are unknown
+func modelConfigInfo(index *Model) (*model.ModelConfig, *model.SafetensorsInfo) {
+	var config *model.ModelConfig
+	if index.Config.ModelType != "" || len(index.Config.Architectures) > 0 {
+		tokenizer := index.Config.TokenizerConfig
+		config = &model.ModelConfig{
+			Architectures: index.Config.Architectures,
+			ModelType:     index.Config.ModelType,
+		}
+		info := model.TokenizerConfig{
+			EosToken:     tokenizer.EosToken,
+			PadToken:     tokenizer.PadToken,
+			ChatTemplate: tokenizer.ChatTemplate,
+		}
+		if tokenizer.BosToken != nil {
+			info.BosToken = *tokenizer.BosToken
+		}
+		if tokenizer.UnkToken != nil {
+			info.UnkToken = *tokenizer.UnkToken
+		}
+		if info != (model.TokenizerConfig{}) {
+			config.TokenizerConfig = &info
+		}
+	}
+	var safetensors *model.SafetensorsInfo
+	if index.Safetensors.Total > 0 {
+		safetensors = &model.SafetensorsInfo{
+			Parameters: index.Safetensors.Parameters,
+			Total:      index.Safetensors.Total,
+		}
+	}
+	return config, safetensors
+}
@@ -0,0 +1,95 @@
+package filestorage
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// safetensorsFile encodes a safetensors file holding only the header
+func safetensorsFile(header string) []byte {
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, uint64(len(header)))
+	buf.WriteString(header)
+	return buf.Bytes()
+}
+
+func TestReadModelMetadata(t *testing.T) {
+	tests := []struct {
+		name  string
+		files map[string]string
+		check func(t *testing.T, index *Model)
+	}{
+		{
+			name:  "config",
+			files: map[string]string{"config.json": `{"architectures":["LlamaForCausalLM"],"model_type":"llama"}`},
+			check: func(t *testing.T, index *Model) {
+				if index.Config.ModelType != "llama" || len(index.Config.Architectures) != 1 || index.Config.Architectures[0] != "LlamaForCausalLM" {
+					t.Errorf("config = %+v", index.Config)
+				}
+			},
+		},
+		{
+			name: "tokenizer tokens as strings and objects",
+			files: map[string]string{"tokenizer_config.json": `{"bos_token":"<s>","eos_token":{"content":"</s>"},` +
+				`"unk_token":{"content":"<unk>","lstrip":false},"pad_token":null,"chat_template":"{{ messages }}"}`},
+			check: func(t *testing.T, index *Model) {
+				tok := index.Config.TokenizerConfig
+				if tok.BosToken == nil || *tok.BosToken != "<s>" || tok.UnkToken == nil || *tok.UnkToken != "<unk>" {
+					t.Errorf("bos/unk = %v/%v", tok.BosToken, tok.UnkToken)
+				}
+				if tok.EosToken != "</s>" || tok.PadToken != "" || tok.ChatTemplate != "{{ messages }}" {
+					t.Errorf("tokenizer = %+v", tok)
+				}
+			},
+		},
+		{
+			name:  "named chat templates",
+			files: map[string]string{"tokenizer_config.json": `{"chat_template":[{"name":"tool_use","template":"tools"},{"name":"default","template":"chat"}]}`},
+			check: func(t *testing.T, index *Model) {
+				if got := index.Config.TokenizerConfig.ChatTemplate; got != "chat" {
+					t.Errorf("chat template = %q, want the default one", got)
+				}
+			},
+		},
+		{
+			name: "safetensors shards",
+			files: map[string]string{
+				"model-00001.safetensors": string(safetensorsFile(`{"__metadata__":{"format":"pt"},"a":{"dtype":"BF16","shape":[2,3],"data_offsets":[0,12]}}`)),
+				"model-00002.safetensors": string(safetensorsFile(`{"b":{"dtype":"bf16","shape":[4],"data_offsets":[0,8]},"c":{"dtype":"F32","shape":[5],"data_offsets":[8,28]}}`)),
+			},
+			check: func(t *testing.T, index *Model) {
+				if index.Safetensors.Total != 15 || index.Safetensors.Parameters["BF16"] != 10 || index.Safetensors.Parameters["F32"] != 5 {
+					t.Errorf("safetensors = %+v", index.Safetensors)
+				}
+			},
+		},
+		{
+			name: "malformed files",
+			files: map[string]string{
+				"config.json":       "{",
+				"model.safetensors": "short",
+			},
+			check: func(t *testing.T, index *Model) {
+				if index.Config.ModelType != "" || index.Safetensors.Total != 0 {
+					t.Errorf("index = %+v", index)
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for name, content := range tt.files {
+				if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			var index Model
+			readModelMetadata(dir, &index)
+			tt.check(t, &index)
+		})
+	}
+}
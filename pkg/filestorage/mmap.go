@@ -0,0 +1,128 @@
+package filestorage
+
+import (
+	"bytes"
+	"container/list"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// mmapCache keeps small blobs memory-mapped so hot files are served without re-reading
+// them from disk. Mappings are evicted least recently used and only unmapped once no
+// reader references them anymore.
+type mmapCache struct {
+	mu          sync.Mutex
+	maxFileSize int64
+	maxEntries  int
+	entries     map[string]*mmapEntry
+	lru         *list.List
+}
+
+// mmapEntry is a memory-mapped file shared by concurrent readers
+type mmapEntry struct {
+	path    string
+	data    []byte
+	size    int64
+	modTime time.Time
+	refs    int
+	evicted bool
+	elem    *list.Element
+}
+
+// mmapReader reads from a mapping and releases it on Close
+type mmapReader struct {
+	*bytes.Reader
+	cache *mmapCache
+	entry *mmapEntry
+	once  sync.Once
+}
+
+func (r *mmapReader) Close() error {
+	r.once.Do(func() {
+		r.cache.release(r.entry)
+	})
+	return nil
+}
+
+func newMmapCache(maxFileSize int64, maxEntries int) *mmapCache {
+	if maxEntries <= 0 {
+		maxEntries = 128
+	}
+	return &mmapCache{
+		maxFileSize: maxFileSize,
+		maxEntries:  maxEntries,
+		entries:     make(map[string]*mmapEntry),
+		lru:         list.New(),
+	}
+}
+
+// eligible reports whether a file is small enough to be memory-mapped
+func (c *mmapCache) eligible(info os.FileInfo) bool {
+	return info.Size() > 0 && info.Size() <= c.maxFileSize
+}
+
+// open returns a reader over the mapping of path, mapping it if needed
+func (c *mmapCache) open(path string, info os.FileInfo) (*mmapReader, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[path]
+	if ok && (entry.size != info.Size() || !entry.modTime.Equal(info.ModTime())) {
+		// the file changed since it was mapped
+		c.evict(entry)
+		ok = false
+	}
+	if !ok {
+		data, err := mmapFile(path, info.Size())
+		if err != nil {
+			return nil, fmt.Errorf("failed to mmap file: %w", err)
+		}
+		entry = &mmapEntry{
+			path:    path,
+			data:    data,
+			size:    info.Size(),
+			modTime: info.ModTime(),
+		}
+		entry.elem = c.lru.PushFront(entry)
+		c.entries[path] = entry
+		for c.lru.Len() > c.maxEntries {
+			c.evict(c.lru.Back().Value.(*mmapEntry))
+		}
+	} else {
+		c.lru.MoveToFront(entry.elem)
+	}
+
+	entry.refs++
+	return &mmapReader{
+		Reader: bytes.NewReader(entry.data),
+		cache:  c,
+		entry:  entry,
+	}, nil
+}
+
+// release drops a reader reference, unmapping evicted entries once unused
+func (c *mmapCache) release(entry *mmapEntry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry.refs--
+	if entry.evicted && entry.refs == 0 {
+		munmapFile(entry.data)
+		entry.data = nil
+	}
+}
+
+// evict removes an entry from the cache, the caller must hold c.mu
+func (c *mmapCache) evict(entry *mmapEntry) {
+	if entry.evicted {
+		return
+	}
+	entry.evicted = true
+	c.lru.Remove(entry.elem)
+	delete(c.entries, entry.path)
+	if entry.refs == 0 {
+		munmapFile(entry.data)
+		entry.data = nil
+	}
+}
@@ -0,0 +1,104 @@
+//go:build !windows
+
+package filestorage
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeTestFile writes content to name below dir and returns its path and info
+func writeTestFile(t *testing.T, dir, name, content string) (string, os.FileInfo) {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return path, info
+}
+
+func TestMmapCacheEligible(t *testing.T) {
+	c := newMmapCache(4, 0)
+	dir := t.TempDir()
+	tests := []struct {
+		name    string
+		content string
+		want    bool
+	}{
+		{"empty", "", false},
+		{"small", "abc", true},
+		{"limit", "abcd", true},
+		{"too large", "abcde", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, info := writeTestFile(t, dir, tt.name, tt.content)
+			if got := c.eligible(info); got != tt.want {
+				t.Errorf("eligible = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMmapCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	c := newMmapCache(1024, 1)
+	dir := t.TempDir()
+	pathA, infoA := writeTestFile(t, dir, "a", "first")
+	pathB, infoB := writeTestFile(t, dir, "b", "second")
+
+	readerA, err := c.open(pathA, infoA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	readerB, err := c.open(pathB, infoB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer readerB.Close()
+	if _, ok := c.entries[pathA]; ok {
+		t.Error("a is still cached after b was mapped")
+	}
+	// the evicted mapping stays readable until its reader is closed
+	if data, err := io.ReadAll(readerA); err != nil || string(data) != "first" {
+		t.Errorf("read evicted mapping = %q, %v", data, err)
+	}
+	readerA.Close()
+	if readerA.entry.data != nil {
+		t.Error("evicted mapping was not unmapped after close")
+	}
+}
+
+func TestMmapCacheRemapsChangedFile(t *testing.T) {
+	c := newMmapCache(1024, 0)
+	dir := t.TempDir()
+	path, info := writeTestFile(t, dir, "f", "old")
+	r, err := c.open(path, info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Close()
+	again, err := c.open(path, info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	again.Close()
+	if again.entry != r.entry {
+		t.Error("unchanged file was mapped again")
+	}
+
+	_, info = writeTestFile(t, dir, "f", "newer")
+	changed, err := c.open(path, info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer changed.Close()
+	if data, _ := io.ReadAll(changed); string(data) != "newer" {
+		t.Errorf("content = %q, want the changed file", data)
+	}
+}
@@ -0,0 +1,25 @@
+//go:build !windows
+
+package filestorage
+
+import (
+	"os"
+	"syscall"
+)
+
+// mmapFile maps size bytes of the file at path read-only into memory
+func mmapFile(path string, size int64) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return syscall.Mmap(int(f.Fd()), 0, int(size), syscall.PROT_READ, syscall.MAP_SHARED)
+}
+
+// munmapFile releases a mapping created by mmapFile
+func munmapFile(data []byte) {
+	if data != nil {
+		syscall.Munmap(data)
+	}
+}
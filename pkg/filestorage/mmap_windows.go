@@ -0,0 +1,13 @@
+//go:build windows
+
+package filestorage
+
+import "errors"
+
+// mmapFile is not supported on windows, callers fall back to regular reads
+func mmapFile(path string, size int64) ([]byte, error) {
+	return nil, errors.New("mmap is not supported on windows")
+}
+
+// munmapFile releases a mapping created by mmapFile
+func munmapFile(data []byte) {}
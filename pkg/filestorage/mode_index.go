@@ -1,6 +1,12 @@
 package filestorage
 
-import "time"
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lengrongfu/LLMDistribution/pkg/api/model"
+)
 
 // Storage represents a file storage system
 type Model struct {
@@ -16,7 +22,7 @@ type Model struct {
 	Author           string           `json:"author"`
 	SHA              string           `json:"sha"`
 	LastModified     time.Time        `json:"lastModified"`
-	Gated            bool             `json:"gated"`
+	Gated            model.GatedMode  `json:"gated"`
 	Disabled         bool             `json:"disabled"`
 	WidgetData       []WidgetData     `json:"widgetData"`
 	ModelIndex       interface{}      `json:"model-index"` // 根据实际情况可能需要定义具体类型
@@ -30,6 +36,26 @@ type Model struct {
 	UsedStorage      int64            `json:"usedStorage"`
 }
 
+// validate checks that a model index read from a .modeindex file describes a revision
+// and its files
+func (m *Model) validate() error {
+	if m.ID == "" {
+		return errors.New("missing id")
+	}
+	if m.SHA == "" {
+		return errors.New("missing sha")
+	}
+	if len(m.Siblings) == 0 {
+		return errors.New("no siblings")
+	}
+	for i, sibling := range m.Siblings {
+		if sibling.Rfilename == "" {
+			return fmt.Errorf("sibling %d has no rfilename", i)
+		}
+	}
+	return nil
+}
+
 type WidgetData struct {
 	Text string `json:"text"`
 }
@@ -63,7 +89,29 @@ type TransformersInfo struct {
 }
 
 type Sibling struct {
-	Rfilename string `json:"rfilename"`
+	Rfilename string   `json:"rfilename"`
+	BlobID    string   `json:"blobId,omitempty"`
+	Size      int64    `json:"size,omitempty"`
+	LFS       *LFSInfo `json:"lfs,omitempty"`
+}
+
+type LFSInfo struct {
+	SHA256 string `json:"sha256"`
+	Size   int64  `json:"size"`
+}
+
+// newSibling describes a cached file from its blob etag, which is the sha256 of LFS
+// files and the git blob sha1 of regular files
+func newSibling(filename, etag string, size int64) Sibling {
+	sibling := Sibling{
+		Rfilename: filename,
+		BlobID:    etag,
+		Size:      size,
+	}
+	if len(etag) == 64 {
+		sibling.LFS = &LFSInfo{SHA256: etag, Size: size}
+	}
+	return sibling
 }
 
 type Safetensors struct {
@@ -71,6 +119,5 @@ type Safetensors struct {
 	Total      int64      `json:"total"`
 }
 
-type Parameters struct {
-	BF16 int64 `json:"BF16"`
-}
+// Parameters counts the parameters of the safetensors weights by dtype, like "BF16"
+type Parameters map[string]int64
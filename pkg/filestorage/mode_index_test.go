@@ -0,0 +1,143 @@
+package filestorage
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/lengrongfu/LLMDistribution/pkg/api"
+)
+
+func TestNewSibling(t *testing.T) {
+	const (
+		sha1   = "0123456789abcdef0123456789abcdef01234567"
+		sha256 = "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+	)
+	tests := []struct {
+		name    string
+		etag    string
+		wantLFS bool
+	}{
+		{"git blob", sha1, false},
+		{"LFS object", sha256, true},
+		{"no etag", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sibling := newSibling("model.bin", tt.etag, 42)
+			if sibling.Rfilename != "model.bin" || sibling.BlobID != tt.etag || sibling.Size != 42 {
+				t.Errorf("sibling = %+v", sibling)
+			}
+			if (sibling.LFS != nil) != tt.wantLFS {
+				t.Fatalf("LFS = %+v, want LFS %v", sibling.LFS, tt.wantLFS)
+			}
+			if tt.wantLFS && (sibling.LFS.SHA256 != tt.etag || sibling.LFS.Size != 42) {
+				t.Errorf("LFS = %+v", sibling.LFS)
+			}
+		})
+	}
+}
+
+func TestBuildModelIndexSiblingMetadata(t *testing.T) {
+	s := newTestStorage(t)
+	_, etag, err := s.StoreSnapshotFile("acme/m", "main", "config.json", strings.NewReader(`{"a":1}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	index, err := s.buildModelIndex("acme/m", "main")
+	if err != nil {
+		t.Fatalf("buildModelIndex: %v", err)
+	}
+	if len(index.Siblings) != 1 {
+		t.Fatalf("siblings = %+v", index.Siblings)
+	}
+	if sibling := index.Siblings[0]; sibling.Size != 7 || sibling.BlobID != etag {
+		t.Errorf("sibling = %+v, want size 7 and blob ID %s", sibling, etag)
+	}
+}
+
+func TestRepoInfoRebuildsInvalidIndex(t *testing.T) {
+	tests := []struct {
+		name    string
+		index   string
+		wantSHA string
+	}{
+		{"valid index", `{"id":"acme/m","sha":"upstream","siblings":[{"rfilename":"config.json"}]}`, "upstream"},
+		{"malformed json", `{"id":`, ""},
+		{"missing id", `{"sha":"upstream","siblings":[{"rfilename":"config.json"}]}`, ""},
+		{"missing sha", `{"id":"acme/m","siblings":[{"rfilename":"config.json"}]}`, ""},
+		{"no siblings", `{"id":"acme/m","sha":"upstream","siblings":[]}`, ""},
+		{"sibling without name", `{"id":"acme/m","sha":"upstream","siblings":[{"size":1}]}`, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestStorage(t)
+			commit, _, err := s.StoreSnapshotFile("acme/m", "main", "config.json", strings.NewReader("{}"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(s.layout.IndexPath("acme/m"), []byte(tt.index), 0644); err != nil {
+				t.Fatal(err)
+			}
+			index, err := s.RepoInfo("acme/m", "main")
+			if err != nil {
+				t.Fatalf("RepoInfo: %v", err)
+			}
+			// an invalid index is replaced by the one built from the snapshot
+			wantSHA := tt.wantSHA
+			if wantSHA == "" {
+				wantSHA = commit
+			}
+			if index.SHA != wantSHA || len(index.Siblings) != 1 || index.Siblings[0].Rfilename != "config.json" {
+				t.Errorf("index = %+v, want sha %s with config.json", index, wantSHA)
+			}
+		})
+	}
+}
+
+func TestRepoInfoStoredIndexRevision(t *testing.T) {
+	s := newTestStorage(t)
+	const other = "0123456789abcdef0123456789abcdef01234567"
+	commit, _, err := s.StoreSnapshotFile("acme/m", "main", "config.json", strings.NewReader("{}"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := s.StoreSnapshotFile("acme/m", other, "other.json", strings.NewReader("{}")); err != nil {
+		t.Fatal(err)
+	}
+	index := `{"id":"acme/m","sha":"` + commit + `","siblings":[{"rfilename":"config.json"},{"rfilename":"stored.json"}]}`
+	if err := os.WriteFile(s.layout.IndexPath("acme/m"), []byte(index), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		version   string
+		wantSHA   string
+		wantFiles int
+		wantErr   bool
+	}{
+		{"revision of the stored index", "main", commit, 2, false},
+		{"other cached snapshot", other, other, 1, false},
+		{"uncached revision", "v2", "", 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := s.RepoInfo("acme/m", tt.version)
+			if tt.wantErr {
+				var revErr *api.RevisionNotFoundError
+				if !errors.As(err, &revErr) {
+					t.Fatalf("RepoInfo = %v, want a RevisionNotFoundError", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("RepoInfo: %v", err)
+			}
+			if got.SHA != tt.wantSHA || len(got.Siblings) != tt.wantFiles {
+				t.Errorf("index = sha %s with %d files, want %s with %d", got.SHA, len(got.Siblings), tt.wantSHA, tt.wantFiles)
+			}
+		})
+	}
+}
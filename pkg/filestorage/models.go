@@ -0,0 +1,64 @@
+package filestorage
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/lengrongfu/LLMDistribution/pkg/api/model"
+)
+
+// ListModels lists the models of the cache, a model is a model directory of the
+// layout. The modification time of the directory is reported as LastModified.
+func (s *Storage) ListModels() ([]model.CachedModel, error) {
+	dirs, err := filepath.Glob(s.layout.ModelDirPattern())
+	if err != nil {
+		return nil, err
+	}
+	var models []model.CachedModel
+	for _, dir := range dirs {
+		id, ok := s.layout.ModelID(dir)
+		if !ok {
+			continue
+		}
+		info, err := os.Stat(dir)
+		if err != nil || !info.IsDir() {
+			continue
+		}
+		models = append(models, model.CachedModel{ID: id, LastModified: info.ModTime()})
+	}
+	sort.Slice(models, func(i, j int) bool { return models[i].ID < models[j].ID })
+	return models, nil
+}
+
+// InspectModels lists the models of the cache with their refs, the commits of their
+// snapshots and the bytes they use on disk
+func (s *Storage) InspectModels() ([]model.CachedModelInfo, error) {
+	models, err := s.ListModels()
+	if err != nil {
+		return nil, err
+	}
+	infos := make([]model.CachedModelInfo, 0, len(models))
+	for _, m := range models {
+		refs, err := s.refs(m.ID)
+		if err != nil {
+			return nil, err
+		}
+		snapshots, err := s.snapshots(m.ID)
+		if err != nil {
+			return nil, err
+		}
+		size, _, err := s.modelUsage(m.ID)
+		if err != nil {
+			return nil, err
+		}
+		infos = append(infos, model.CachedModelInfo{
+			ID:           m.ID,
+			Refs:         refs,
+			Snapshots:    snapshots,
+			Size:         size,
+			LastModified: m.LastModified,
+		})
+	}
+	return infos, nil
+}
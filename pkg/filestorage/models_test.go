@@ -0,0 +1,54 @@
+package filestorage
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestInspectModels(t *testing.T) {
+	s := newTestStorage(t)
+	mainCommit, _, err := s.StoreSnapshotFile("acme/a", "main", "model.bin", strings.NewReader(strings.Repeat("x", 100)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	prCommit, _, err := s.StoreSnapshotFile("acme/a", "refs/pr/1", "model.bin", strings.NewReader(strings.Repeat("y", 50)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := s.StoreSnapshotFile("acme/b", "main", "config.json", strings.NewReader("{}")); err != nil {
+		t.Fatal(err)
+	}
+
+	models, err := s.InspectModels()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		id        string
+		refs      map[string]string
+		snapshots int
+		minSize   int64
+	}{
+		{"acme/a", map[string]string{"main": mainCommit, "refs/pr/1": prCommit}, 2, 150},
+		{"acme/b", nil, 1, 2},
+	}
+	if len(models) != len(tests) {
+		t.Fatalf("got %d models, want %d: %+v", len(models), len(tests), models)
+	}
+	for i, tt := range tests {
+		t.Run(tt.id, func(t *testing.T) {
+			got := models[i]
+			if got.ID != tt.id || len(got.Snapshots) != tt.snapshots || got.Size < tt.minSize {
+				t.Errorf("model = %+v", got)
+			}
+			for ref, sha := range tt.refs {
+				if got.Refs[ref] != sha {
+					t.Errorf("ref %s = %q, want %q", ref, got.Refs[ref], sha)
+				}
+			}
+			if _, ok := got.Refs["main"]; !ok {
+				t.Errorf("refs %v miss main", got.Refs)
+			}
+		})
+	}
+}
@@ -0,0 +1,52 @@
+package filestorage
+
+import "sync"
+
+// snapshotPins counts the transfers in progress from each snapshot of each model
+type snapshotPins struct {
+	mu     sync.Mutex
+	counts map[string]map[string]int
+}
+
+func newSnapshotPins() *snapshotPins {
+	return &snapshotPins{counts: make(map[string]map[string]int)}
+}
+
+// PinSnapshot protects the snapshot sha of a model from eviction until every pin has
+// been released with UnpinSnapshot
+func (s *Storage) PinSnapshot(modelID, sha string) {
+	s.pins.mu.Lock()
+	defer s.pins.mu.Unlock()
+	if s.pins.counts[modelID] == nil {
+		s.pins.counts[modelID] = make(map[string]int)
+	}
+	s.pins.counts[modelID][sha]++
+}
+
+// UnpinSnapshot releases a pin taken with PinSnapshot
+func (s *Storage) UnpinSnapshot(modelID, sha string) {
+	s.pins.mu.Lock()
+	defer s.pins.mu.Unlock()
+	shas := s.pins.counts[modelID]
+	if shas[sha]--; shas[sha] > 0 {
+		return
+	}
+	delete(shas, sha)
+	if len(shas) == 0 {
+		delete(s.pins.counts, modelID)
+	}
+}
+
+// SnapshotPinned reports whether the snapshot sha of a model is pinned
+func (s *Storage) SnapshotPinned(modelID, sha string) bool {
+	s.pins.mu.Lock()
+	defer s.pins.mu.Unlock()
+	return s.pins.counts[modelID][sha] > 0
+}
+
+// pinned reports whether a snapshot of a model is pinned
+func (s *Storage) pinned(modelID string) bool {
+	s.pins.mu.Lock()
+	defer s.pins.mu.Unlock()
+	return len(s.pins.counts[modelID]) > 0
+}
@@ -0,0 +1,29 @@
+package filestorage
+
+import "testing"
+
+func TestSnapshotPinned(t *testing.T) {
+	s := newTestStorage(t)
+	s.PinSnapshot("org/m", "a")
+	s.PinSnapshot("org/m", "a")
+	s.UnpinSnapshot("org/m", "a")
+
+	tests := []struct {
+		modelID string
+		sha     string
+		pinned  bool
+	}{
+		{"org/m", "a", true},
+		{"org/m", "b", false},
+		{"org/other", "a", false},
+	}
+	for _, tt := range tests {
+		if got := s.SnapshotPinned(tt.modelID, tt.sha); got != tt.pinned {
+			t.Errorf("SnapshotPinned(%s, %s) = %v, want %v", tt.modelID, tt.sha, got, tt.pinned)
+		}
+	}
+	s.UnpinSnapshot("org/m", "a")
+	if s.SnapshotPinned("org/m", "a") {
+		t.Error("snapshot still pinned after releasing every pin")
+	}
+}
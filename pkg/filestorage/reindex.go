@@ -0,0 +1,183 @@
+package filestorage
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/lengrongfu/LLMDistribution/pkg/api/model"
+)
+
+// indexRefresher regenerates stale .modeindex files every interval
+type indexRefresher struct {
+	stop chan struct{}
+	done chan struct{}
+}
+
+// WithIndexRefresh regenerates, every interval, the .modeindex files of models whose
+// snapshot changed after the index was written, like files copied into the snapshot
+// with rsync. An interval <= 0 disables the refresh.
+func (s *Storage) WithIndexRefresh(interval time.Duration) {
+	if s.refresh != nil {
+		s.refresh.close()
+		s.refresh = nil
+	}
+	if interval <= 0 {
+		return
+	}
+	s.refresh = &indexRefresher{}
+	s.refresh.start(s, interval)
+}
+
+// start refreshes stale model indexes every interval until close is called
+func (r *indexRefresher) start(s *Storage, interval time.Duration) {
+	r.stop = make(chan struct{})
+	r.done = make(chan struct{})
+	go func() {
+		defer close(r.done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				refreshed, err := s.RefreshIndexes()
+				if err != nil {
+					slog.Error("failed to refresh model indexes", "error", err)
+				} else if refreshed > 0 {
+					slog.Info("refreshed stale model indexes", "count", refreshed)
+				}
+			case <-r.stop:
+				return
+			}
+		}
+	}()
+}
+
+// close stops the periodic refresh
+func (r *indexRefresher) close() {
+	if r.stop != nil {
+		close(r.stop)
+		<-r.done
+		r.stop = nil
+	}
+}
+
+// RefreshIndexes regenerates the stale .modeindex files and returns how many were
+// regenerated. An index is stale when the default revision moved to another snapshot
+// or a directory of its snapshot was modified after the index was written.
+func (s *Storage) RefreshIndexes() (int, error) {
+	modelDirs, err := filepath.Glob(s.layout.ModelDirPattern())
+	if err != nil {
+		return 0, err
+	}
+	refreshed := 0
+	for _, modelDir := range modelDirs {
+		modelID, ok := s.layout.ModelID(modelDir)
+		if !ok || !s.indexStale(modelID) {
+			continue
+		}
+		if _, err := s.Reindex(modelID); err != nil {
+			slog.Error("failed to refresh model index", "model", modelID, "error", err)
+			continue
+		}
+		refreshed++
+	}
+	return refreshed, nil
+}
+
+// indexStale reports whether the .modeindex file of a model no longer describes the
+// snapshot of its default revision. Models without an index are built on request and
+// are never stale.
+func (s *Storage) indexStale(modelID string) bool {
+	indexPath := s.layout.IndexPath(modelID)
+	info, err := os.Stat(indexPath)
+	if err != nil {
+		return false
+	}
+	sha, err := s.getRepoSha(modelID, "")
+	if err != nil {
+		return false
+	}
+	var index struct {
+		SHA string `json:"sha"`
+	}
+	if data, err := os.ReadFile(indexPath); err != nil || json.Unmarshal(data, &index) != nil || index.SHA != sha {
+		return true
+	}
+	stale := false
+	filepath.WalkDir(s.layout.SnapshotPath(modelID, sha, ""), func(path string, d fs.DirEntry, err error) error {
+		if err != nil || !d.IsDir() {
+			return nil
+		}
+		// adding or removing a file modifies the directory holding it
+		if dirInfo, err := d.Info(); err == nil && dirInfo.ModTime().After(info.ModTime()) {
+			stale = true
+			return filepath.SkipAll
+		}
+		return nil
+	})
+	return stale
+}
+
+// Reindex regenerates the .modeindex file of a model from the snapshot of its default
+// revision. The metadata of an existing index, like tags and the card data fetched
+// from the upstream, is kept while the files are replaced by those of the snapshot.
+func (s *Storage) Reindex(modelID string) (model.ReindexResult, error) {
+	if _, err := os.Stat(s.layout.ModelDir(modelID)); err != nil {
+		return model.ReindexResult{}, fmt.Errorf("model not found: %s: %w", modelID, os.ErrNotExist)
+	}
+	s.reindexMu.Lock()
+	defer s.reindexMu.Unlock()
+
+	built, err := s.buildModelIndex(modelID, "")
+	if err != nil {
+		return model.ReindexResult{}, err
+	}
+	index := built
+	indexPath := s.layout.IndexPath(modelID)
+	if data, err := os.ReadFile(indexPath); err == nil {
+		var existing Model
+		if json.Unmarshal(data, &existing) == nil && existing.ID != "" {
+			existing.SHA = built.SHA
+			existing.Siblings = built.Siblings
+			existing.UsedStorage = built.UsedStorage
+			existing.LastModified = built.LastModified
+			index = &existing
+		}
+	}
+	data, err := json.Marshal(index)
+	if err != nil {
+		return model.ReindexResult{}, err
+	}
+	// the index is renamed into place, so requests never read a partial index
+	tmp, err := os.CreateTemp(s.layout.ModelDir(modelID), ".modeindex-*")
+	if err != nil {
+		return model.ReindexResult{}, fmt.Errorf("failed to write modelindex file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.Write(data)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return model.ReindexResult{}, fmt.Errorf("failed to write modelindex file: %w", err)
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return model.ReindexResult{}, err
+	}
+	if err := os.Rename(tmp.Name(), indexPath); err != nil {
+		return model.ReindexResult{}, fmt.Errorf("failed to write modelindex file: %w", err)
+	}
+	s.forgetIndex(modelID)
+
+	return model.ReindexResult{
+		ID:    modelID,
+		SHA:   index.SHA,
+		Files: len(index.Siblings),
+		Size:  index.UsedStorage,
+	}, nil
+}
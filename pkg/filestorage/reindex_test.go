@@ -0,0 +1,90 @@
+package filestorage
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRefreshIndexes(t *testing.T) {
+	tests := []struct {
+		name          string
+		index         func(commit string) string
+		addFile       bool
+		wantRefreshed int
+	}{
+		{"no index", nil, false, 0},
+		{"current index", func(commit string) string { return commit }, false, 0},
+		{"ref moved", func(string) string { return "0123456789abcdef0123456789abcdef01234567" }, false, 1},
+		{"file added to the snapshot", func(commit string) string { return commit }, true, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestStorage(t)
+			commit, _, err := s.StoreSnapshotFile("acme/m", "main", "config.json", strings.NewReader("{}"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			indexPath := s.layout.IndexPath("acme/m")
+			if tt.index != nil {
+				data, _ := json.Marshal(Model{ID: "acme/m", SHA: tt.index(commit), Tags: []string{"upstream-tag"},
+					Siblings: []Sibling{{Rfilename: "config.json"}}})
+				if err := os.WriteFile(indexPath, data, 0644); err != nil {
+					t.Fatal(err)
+				}
+				past := time.Now().Add(-time.Hour)
+				if err := os.Chtimes(indexPath, past, past); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.Chtimes(s.layout.SnapshotPath("acme/m", commit, ""), past.Add(-time.Hour), past.Add(-time.Hour)); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if tt.addFile {
+				// copied into the snapshot behind the back of the storage
+				if err := os.WriteFile(s.layout.SnapshotPath("acme/m", commit, "extra.json"), []byte("{}"), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			refreshed, err := s.RefreshIndexes()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if refreshed != tt.wantRefreshed {
+				t.Fatalf("refreshed %d indexes, want %d", refreshed, tt.wantRefreshed)
+			}
+			if tt.wantRefreshed == 0 {
+				return
+			}
+			var index Model
+			data, err := os.ReadFile(indexPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := json.Unmarshal(data, &index); err != nil {
+				t.Fatal(err)
+			}
+			wantFiles := 1
+			if tt.addFile {
+				wantFiles = 2
+			}
+			if index.SHA != commit || len(index.Siblings) != wantFiles {
+				t.Errorf("index sha %s with %d files, want %s with %d", index.SHA, len(index.Siblings), commit, wantFiles)
+			}
+			if len(index.Tags) != 1 || index.Tags[0] != "upstream-tag" {
+				t.Errorf("tags = %v, want the upstream metadata kept", index.Tags)
+			}
+		})
+	}
+}
+
+func TestReindexUnknownModel(t *testing.T) {
+	s := newTestStorage(t)
+	if _, err := s.Reindex("acme/missing"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Reindex error = %v, want os.ErrNotExist", err)
+	}
+}
@@ -0,0 +1,89 @@
+package filestorage
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/lengrongfu/LLMDistribution/pkg/api"
+)
+
+// blobVerifier re-hashes blobs that have not been verified for longer than maxAge
+type blobVerifier struct {
+	maxAge time.Duration
+	now    func() time.Time
+	mu     sync.Mutex
+	// verified is the last successful verification of each blob path
+	verified map[string]time.Time
+}
+
+// WithBlobReverifyAge makes VerifyFile re-hash blobs that were downloaded or last
+// verified more than age ago. An age <= 0 disables re-verification.
+func (s *Storage) WithBlobReverifyAge(age time.Duration) {
+	if age <= 0 {
+		s.reverify = nil
+		return
+	}
+	s.reverify = &blobVerifier{
+		maxAge:   age,
+		now:      time.Now,
+		verified: make(map[string]time.Time),
+	}
+}
+
+// VerifyFile checks the blob of a snapshot file against its etag when it is older
+// than the re-verification age. A corrupt blob is removed so it can be fetched again
+// and api.ErrBlobCorrupt is returned.
+func (s *Storage) VerifyFile(modelID, sha, filename string) error {
+	v := s.reverify
+	if v == nil {
+		return nil
+	}
+	path := s.layout.SnapshotPath(modelID, sha, filename)
+	target, err := os.Readlink(path)
+	if err != nil {
+		// regular files have no etag to verify against
+		return nil
+	}
+	if !filepath.IsAbs(target) {
+		target = filepath.Join(filepath.Dir(path), target)
+	}
+	info, err := statBlob(target)
+	if err != nil {
+		return err
+	}
+
+	v.mu.Lock()
+	last, ok := v.verified[target]
+	v.mu.Unlock()
+	if !ok || last.Before(info.ModTime()) {
+		last = info.ModTime()
+	}
+	if v.now().Sub(last) < v.maxAge {
+		return nil
+	}
+
+	etag := blobEtag(target)
+	sum, err := hashBlob(target, info.Size(), etag)
+	if err != nil {
+		return err
+	}
+	if sum != etag {
+		slog.Error("blob failed re-verification", "blob", target, "hash", sum)
+		v.mu.Lock()
+		delete(v.verified, target)
+		v.mu.Unlock()
+		os.Remove(target)
+		if err := s.forgetSnapshotFile(modelID, sha, filename); err != nil {
+			slog.Warn("failed to update snapshot metadata", "model", modelID, "file", filename, "error", err)
+		}
+		return fmt.Errorf("%w: %s/%s", api.ErrBlobCorrupt, modelID, filename)
+	}
+	v.mu.Lock()
+	v.verified[target] = v.now()
+	v.mu.Unlock()
+	return nil
+}
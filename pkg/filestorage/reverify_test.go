@@ -0,0 +1,93 @@
+package filestorage
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lengrongfu/LLMDistribution/pkg/api"
+)
+
+func TestVerifyFileReverifyAge(t *testing.T) {
+	const age = 24 * time.Hour
+	tests := []struct {
+		name        string
+		elapsed     time.Duration
+		corrupt     bool
+		wantErr     error
+		wantRemoved bool
+	}{
+		// a fresh blob is trusted without being read, so its corruption goes unnoticed
+		{name: "fresh corrupt blob", elapsed: age / 2, corrupt: true},
+		{name: "stale intact blob", elapsed: 2 * age},
+		{name: "stale corrupt blob", elapsed: 2 * age, corrupt: true, wantErr: api.ErrBlobCorrupt, wantRemoved: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestStorage(t)
+			sha, _, err := s.StoreSnapshotFile("org/m", "main", "config.json", strings.NewReader(`{"model_type":"opt"}`))
+			if err != nil {
+				t.Fatal(err)
+			}
+			link := s.layout.SnapshotPath("org/m", sha, "config.json")
+			target, err := os.Readlink(link)
+			if err != nil {
+				t.Fatal(err)
+			}
+			blob := target
+			if !filepath.IsAbs(blob) {
+				blob = filepath.Join(filepath.Dir(link), blob)
+			}
+			info, err := os.Stat(blob)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.corrupt {
+				os.Chmod(blob, 0644)
+				if err := os.WriteFile(blob, []byte(`{"model_type":"bad"}`), 0644); err != nil {
+					t.Fatal(err)
+				}
+				os.Chtimes(blob, info.ModTime(), info.ModTime())
+			}
+
+			s.WithBlobReverifyAge(age)
+			s.reverify.now = func() time.Time { return info.ModTime().Add(tt.elapsed) }
+			if err := s.VerifyFile("org/m", sha, "config.json"); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("VerifyFile() error = %v, want %v", err, tt.wantErr)
+			}
+			if _, err := os.Stat(blob); os.IsNotExist(err) != tt.wantRemoved {
+				t.Errorf("blob removed = %v, want %v", os.IsNotExist(err), tt.wantRemoved)
+			}
+			// a removed blob is forgotten by the snapshot metadata
+			if _, ok := s.FileExists("org/m", sha, "config.json"); ok == tt.wantRemoved {
+				t.Errorf("FileExists = %v after removal %v", ok, tt.wantRemoved)
+			}
+		})
+	}
+}
+
+func TestVerifyFileRemembersVerification(t *testing.T) {
+	const age = time.Hour
+	s := newTestStorage(t)
+	sha, _, err := s.StoreSnapshotFile("org/m", "main", "config.json", strings.NewReader("{}"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.WithBlobReverifyAge(age)
+	now := time.Now().Add(2 * age)
+	s.reverify.now = func() time.Time { return now }
+	if err := s.VerifyFile("org/m", sha, "config.json"); err != nil {
+		t.Fatal(err)
+	}
+	if len(s.reverify.verified) != 1 {
+		t.Fatalf("verified = %v, want the blob recorded", s.reverify.verified)
+	}
+	for blob, at := range s.reverify.verified {
+		if !at.Equal(now) {
+			t.Errorf("%s verified at %v, want %v", blob, at, now)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package filestorage
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/lengrongfu/LLMDistribution/pkg/utils"
+)
+
+// Revisions lists the cached refs of a model, like "main" or "pr/1", followed by the
+// commits of its snapshots
+func (s *Storage) Revisions(modelID string) ([]string, error) {
+	if _, err := os.Stat(s.layout.ModelDir(modelID)); err != nil {
+		return nil, err
+	}
+
+	refs, err := s.refs(modelID)
+	if err != nil {
+		return nil, err
+	}
+	revisions := make([]string, 0, len(refs))
+	for ref := range refs {
+		revisions = append(revisions, ref)
+	}
+	sort.Strings(revisions)
+
+	snapshots, err := s.snapshots(modelID)
+	if err != nil {
+		return nil, err
+	}
+	return append(revisions, snapshots...), nil
+}
+
+// refs maps the refs of a model to the commits they point to
+func (s *Storage) refs(modelID string) (map[string]string, error) {
+	refs := make(map[string]string)
+	refsDir := s.layout.RefPath(modelID, "")
+	err := filepath.WalkDir(refsDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		// refs can not start with a dot, dot files are refs being written
+		if d.IsDir() || strings.HasPrefix(d.Name(), ".") {
+			return nil
+		}
+		rel, err := filepath.Rel(refsDir, path)
+		if err != nil {
+			return err
+		}
+		sha, err := utils.ReadRef(path)
+		if err != nil {
+			return err
+		}
+		refs[filepath.ToSlash(rel)] = sha
+		return nil
+	})
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	return refs, nil
+}
+
+// snapshots lists the commits of the snapshots of a model
+func (s *Storage) snapshots(modelID string) ([]string, error) {
+	entries, err := os.ReadDir(s.layout.SnapshotPath(modelID, "", ""))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	var snapshots []string
+	for _, entry := range entries {
+		if entry.IsDir() {
+			snapshots = append(snapshots, entry.Name())
+		}
+	}
+	return snapshots, nil
+}
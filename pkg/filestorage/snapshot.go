@@ -0,0 +1,242 @@
+package filestorage
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/lengrongfu/LLMDistribution/pkg/utils"
+)
+
+// AddToSnapshot stores content as a blob named by its SHA-256 and links it as filename
+// into the existing snapshot sha. The blob and the link are moved into place with a
+// rename, so files already served from the snapshot are not disturbed and readers
+// never see a partial file. The cached model index of the snapshot is updated in
+// place instead of being rebuilt. It returns the etag of the new blob.
+func (s *Storage) AddToSnapshot(modelID, sha, filename string, content io.Reader) (string, error) {
+	snapshotDir := s.layout.SnapshotPath(modelID, sha, "")
+	if info, err := os.Stat(snapshotDir); err != nil || !info.IsDir() {
+		return "", fmt.Errorf("snapshot not found: %s@%s", modelID, sha)
+	}
+	filename = utils.NormalizeRepoPath(filename)
+	if filename == "" {
+		return "", fmt.Errorf("invalid file name")
+	}
+	blobPath, etag, size, err := s.writeBlob(modelID, filename, content)
+	if err != nil {
+		return "", err
+	}
+	if err := s.linkBlob(modelID, sha, filename, blobPath, etag, size); err != nil {
+		return "", err
+	}
+	return etag, nil
+}
+
+// StoreSnapshotFile stores content as a blob linked as filename into the snapshot of
+// revision, which is either a commit sha or a ref like "main". A ref without a
+// snapshot is pointed at a newly generated commit, so files uploaded to the same ref
+// end up in one snapshot. It returns the commit and the etag of the blob.
+func (s *Storage) StoreSnapshotFile(modelID, revision, filename string, content io.Reader) (string, string, error) {
+	if !utils.ValidModelID(modelID) {
+		return "", "", fmt.Errorf("%w: model %q", utils.ErrInvalidPath, modelID)
+	}
+	filename, err := utils.CleanRepoPath(filename)
+	if err != nil {
+		return "", "", err
+	}
+	if revision != "" {
+		if ref, err := utils.CleanRepoPath(revision); err != nil || ref != revision {
+			return "", "", fmt.Errorf("%w: revision %q", utils.ErrInvalidPath, revision)
+		}
+	}
+	// the blob is written first, so a failed upload leaves no new ref behind
+	blobPath, etag, size, err := s.writeBlob(modelID, filename, content)
+	if err != nil {
+		return "", "", err
+	}
+	if revision == "" {
+		revision = s.defaultRevision
+	}
+	sha := revision
+	if !isCommitSha(revision) {
+		ref, err := s.refCommit(modelID, revision)
+		if err != nil {
+			return "", "", err
+		}
+		sha = ref
+	}
+	if err := os.MkdirAll(s.layout.SnapshotPath(modelID, sha, ""), 0755); err != nil {
+		return "", "", fmt.Errorf("failed to create snapshot directory: %w", err)
+	}
+	if err := s.linkBlob(modelID, sha, filename, blobPath, etag, size); err != nil {
+		return "", "", err
+	}
+	return sha, etag, nil
+}
+
+// refCommit returns the commit a ref points to, pointing the ref at a new random
+// commit when it does not exist yet
+func (s *Storage) refCommit(modelID, ref string) (string, error) {
+	refPath := s.layout.RefPath(modelID, ref)
+	if sha, err := utils.ReadRef(refPath); err == nil {
+		if isCommitSha(sha) {
+			return sha, nil
+		}
+		return "", fmt.Errorf("ref %s of %s does not point to a commit", ref, modelID)
+	} else if !os.IsNotExist(err) {
+		return "", fmt.Errorf("failed to read ref: %w", err)
+	}
+
+	commit := make([]byte, 20)
+	if _, err := rand.Read(commit); err != nil {
+		return "", err
+	}
+	sha := hex.EncodeToString(commit)
+	if err := os.MkdirAll(filepath.Dir(refPath), 0755); err != nil {
+		return "", fmt.Errorf("failed to create refs directory: %w", err)
+	}
+	// the ref is linked into place, so concurrent uploads to the same new ref can not
+	// end up in different snapshots
+	tmp, err := os.CreateTemp(filepath.Dir(refPath), ".ref-*")
+	if err != nil {
+		return "", fmt.Errorf("failed to write ref: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.WriteString(sha)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to write ref: %w", err)
+	}
+	if err := os.Link(tmp.Name(), refPath); err != nil {
+		if os.IsExist(err) {
+			return s.refCommit(modelID, ref)
+		}
+		return "", fmt.Errorf("failed to write ref: %w", err)
+	}
+	return sha, nil
+}
+
+// isCommitSha reports whether s looks like a full git commit sha
+func isCommitSha(s string) bool {
+	if len(s) != 40 {
+		return false
+	}
+	for _, c := range s {
+		if !strings.ContainsRune("0123456789abcdef", c) {
+			return false
+		}
+	}
+	return true
+}
+
+// writeBlob stores content as a blob of a model named by the etag the hub reports for
+// filename, see utils.ComputeEtag, and returns the path, etag and size of the blob
+func (s *Storage) writeBlob(modelID, filename string, content io.Reader) (string, string, int64, error) {
+	blobsDir := s.layout.BlobPath(modelID, "")
+	if err := os.MkdirAll(blobsDir, 0755); err != nil {
+		return "", "", 0, fmt.Errorf("failed to create blobs directory: %w", err)
+	}
+	tmp, err := os.CreateTemp(blobsDir, "*.incomplete")
+	if err != nil {
+		return "", "", 0, fmt.Errorf("failed to create blob: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	h := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmp, h), content)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return "", "", 0, fmt.Errorf("failed to write blob: %w", err)
+	}
+	etag := hex.EncodeToString(h.Sum(nil))
+	if !utils.IsLFSFile(filename, size) {
+		// regular files are small, hashing them again is cheaper than spooling them in memory
+		if etag, err = gitBlobEtag(tmp.Name(), size); err != nil {
+			return "", "", 0, fmt.Errorf("failed to hash blob: %w", err)
+		}
+	}
+	blobPath := filepath.Join(blobsDir, etag)
+	if err := os.Rename(tmp.Name(), blobPath); err != nil {
+		return "", "", 0, fmt.Errorf("failed to store blob: %w", err)
+	}
+	return blobPath, etag, size, nil
+}
+
+// linkBlob links a blob as filename into the snapshot sha, which must exist, and adds
+// it to the cached index of the snapshot
+func (s *Storage) linkBlob(modelID, sha, filename, blobPath, etag string, size int64) error {
+	// link through a temporary name, the rename replaces an existing link atomically
+	linkPath := filepath.Join(s.layout.SnapshotPath(modelID, sha, ""), filepath.FromSlash(filename))
+	if err := os.MkdirAll(filepath.Dir(linkPath), 0755); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+	absBlob, err := filepath.Abs(blobPath)
+	if err != nil {
+		return err
+	}
+	tmpLink := linkPath + ".link"
+	os.Remove(tmpLink)
+	if err := os.Symlink(absBlob, tmpLink); err != nil {
+		return fmt.Errorf("failed to link blob: %w", err)
+	}
+	if err := os.Rename(tmpLink, linkPath); err != nil {
+		os.Remove(tmpLink)
+		return fmt.Errorf("failed to link blob: %w", err)
+	}
+	if err := s.recordSnapshotFile(modelID, sha, filename, etag, blobPath); err != nil {
+		slog.Warn("failed to record file in the snapshot metadata", "model", modelID, "snapshot", sha, "file", filename, "error", err)
+	}
+
+	s.addToCachedIndex(modelID, sha, newSibling(filename, etag, size))
+	return nil
+}
+
+// addToCachedIndex adds or replaces a sibling in the cached index of a snapshot
+func (s *Storage) addToCachedIndex(modelID, sha string, sibling Sibling) {
+	info, err := os.Stat(s.layout.SnapshotPath(modelID, sha, ""))
+	if err != nil {
+		return
+	}
+	key := modelID + "@" + sha
+	s.indexMu.Lock()
+	defer s.indexMu.Unlock()
+	cached, ok := s.indexCache[key]
+	if !ok {
+		return
+	}
+	// cached models are shared with callers, so update a copy
+	model := *cached.model
+	model.Siblings = make([]Sibling, 0, len(cached.model.Siblings)+1)
+	model.UsedStorage = 0
+	for _, existing := range cached.model.Siblings {
+		if existing.Rfilename != sibling.Rfilename {
+			model.Siblings = append(model.Siblings, existing)
+			model.UsedStorage += existing.Size
+		}
+	}
+	model.Siblings = append(model.Siblings, sibling)
+	model.UsedStorage += sibling.Size
+	cached.model = &model
+	cached.modTime = info.ModTime()
+	s.indexCache[key] = cached
+}
+
+// gitBlobEtag returns the git blob SHA-1 of the file at path of size bytes
+func gitBlobEtag(path string, size int64) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	return utils.GitBlobSHA1(f, size)
+}
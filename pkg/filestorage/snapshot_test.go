@@ -0,0 +1,67 @@
+package filestorage
+
+import (
+	"os"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAddToSnapshot(t *testing.T) {
+	s := newTestStorage(t)
+	s.WithIndexCacheTTL(time.Minute)
+	sha, _, err := s.StoreSnapshotFile("acme/m", "main", "config.json", strings.NewReader("{}"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// cache the index before the snapshot grows
+	if _, err := s.cachedModelIndex("acme/m", "main"); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		sha      string
+		filename string
+		content  string
+		wantErr  bool
+	}{
+		{name: "new file", sha: sha, filename: "model.safetensors", content: "weights"},
+		{name: "nested file", sha: sha, filename: "./sub/tokenizer.json", content: "tokens"},
+		{name: "missing snapshot", sha: "0000000000000000000000000000000000000000", filename: "x.json", wantErr: true},
+		{name: "empty name", sha: sha, filename: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := s.AddToSnapshot("acme/m", tt.sha, tt.filename, strings.NewReader(tt.content))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("AddToSnapshot() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	want := map[string]string{
+		"config.json":        "{}",
+		"model.safetensors":  "weights",
+		"sub/tokenizer.json": "tokens",
+	}
+	for name, content := range want {
+		data, err := os.ReadFile(s.layout.SnapshotPath("acme/m", sha, name))
+		if err != nil || string(data) != content {
+			t.Errorf("%s = %q, %v, want %q", name, data, err, content)
+		}
+	}
+	index, err := s.cachedModelIndex("acme/m", "main")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, sibling := range index.Siblings {
+		names = append(names, sibling.Rfilename)
+	}
+	sort.Strings(names)
+	if got := strings.Join(names, ","); got != "config.json,model.safetensors,sub/tokenizer.json" {
+		t.Errorf("index siblings = %s", got)
+	}
+}
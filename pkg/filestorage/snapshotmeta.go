@@ -0,0 +1,112 @@
+package filestorage
+
+import (
+	"io/fs"
+	"os"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/lengrongfu/LLMDistribution/pkg/utils"
+)
+
+// snapshotMetaRecheck is how long a loaded snapshot metadata file is trusted before
+// it is stat'ed again to pick up files the proxy recorded meanwhile
+const snapshotMetaRecheck = time.Second
+
+// maxSnapshotMetas bounds the number of snapshot metadata files kept in memory
+const maxSnapshotMetas = 1024
+
+// snapshotMetaCache keeps the metadata files of the served snapshots in memory, so
+// FileEtag and FileExists answer without resolving the link of the file. Blobs are
+// only removed behind a recorded link by re-verification, which forgets the file.
+type snapshotMetaCache struct {
+	mu    sync.Mutex
+	metas map[string]snapshotMeta
+}
+
+// snapshotMeta is a loaded snapshot metadata file
+type snapshotMeta struct {
+	files   map[string]utils.SnapshotFileMeta
+	modTime time.Time
+	size    int64
+	checked time.Time
+}
+
+func newSnapshotMetaCache() *snapshotMetaCache {
+	return &snapshotMetaCache{metas: make(map[string]snapshotMeta)}
+}
+
+// lookupSnapshotFile returns the recorded metadata of filename of the snapshot sha,
+// it reports false when the file is not recorded and its link has to be resolved
+func (s *Storage) lookupSnapshotFile(modelID, sha, filename string) (utils.SnapshotFileMeta, bool) {
+	c := s.snapshotMeta
+	metaPath := s.layout.SnapshotMetaPath(modelID, sha)
+	now := time.Now()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	meta, ok := c.metas[metaPath]
+	if !ok || now.Sub(meta.checked) >= snapshotMetaRecheck {
+		info, err := os.Stat(metaPath)
+		if err != nil {
+			delete(c.metas, metaPath)
+			return utils.SnapshotFileMeta{}, false
+		}
+		if !ok || !info.ModTime().Equal(meta.modTime) || info.Size() != meta.size {
+			files, err := utils.ReadSnapshotMeta(metaPath)
+			if err != nil {
+				delete(c.metas, metaPath)
+				return utils.SnapshotFileMeta{}, false
+			}
+			if !ok && len(c.metas) >= maxSnapshotMetas {
+				c.metas = make(map[string]snapshotMeta)
+			}
+			meta = snapshotMeta{files: files, modTime: info.ModTime(), size: info.Size()}
+		}
+		meta.checked = now
+		c.metas[metaPath] = meta
+	}
+	file, ok := meta.files[utils.NormalizeRepoPath(filename)]
+	return file, ok
+}
+
+// recordSnapshotFile records a file linked into the snapshot sha in its metadata file
+func (s *Storage) recordSnapshotFile(modelID, sha, filename, etag, blobPath string) error {
+	metaPath := s.layout.SnapshotMetaPath(modelID, sha)
+	err := utils.RecordSnapshotBlob(metaPath, filename, etag, blobPath)
+	// reload on the next lookup instead of waiting for the recheck
+	s.snapshotMeta.mu.Lock()
+	delete(s.snapshotMeta.metas, metaPath)
+	s.snapshotMeta.mu.Unlock()
+	return err
+}
+
+// forgetSnapshotFile removes a file whose blob is gone from the metadata of the
+// snapshot sha
+func (s *Storage) forgetSnapshotFile(modelID, sha, filename string) error {
+	metaPath := s.layout.SnapshotMetaPath(modelID, sha)
+	err := utils.ForgetSnapshotFile(metaPath, filename)
+	s.snapshotMeta.mu.Lock()
+	delete(s.snapshotMeta.metas, metaPath)
+	s.snapshotMeta.mu.Unlock()
+	return err
+}
+
+// snapshotFileInfo is the file info of a snapshot file from its recorded metadata
+type snapshotFileInfo struct {
+	name string
+	meta utils.SnapshotFileMeta
+}
+
+func (i snapshotFileInfo) Name() string       { return i.name }
+func (i snapshotFileInfo) Size() int64        { return i.meta.Size }
+func (i snapshotFileInfo) Mode() fs.FileMode  { return 0644 }
+func (i snapshotFileInfo) ModTime() time.Time { return i.meta.ModTime }
+func (i snapshotFileInfo) IsDir() bool        { return false }
+func (i snapshotFileInfo) Sys() any           { return nil }
+
+// recordedFileInfo returns the file info of a recorded snapshot file
+func recordedFileInfo(filename string, meta utils.SnapshotFileMeta) os.FileInfo {
+	return snapshotFileInfo{name: path.Base(utils.NormalizeRepoPath(filename)), meta: meta}
+}
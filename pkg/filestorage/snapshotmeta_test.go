@@ -0,0 +1,76 @@
+package filestorage
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestRecordedFileSkipsLink(t *testing.T) {
+	tests := []struct {
+		name       string
+		removeMeta bool
+		exists     bool
+	}{
+		// a recorded file is answered from the metadata without following its link
+		{"recorded file", false, true},
+		{"unrecorded file", true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestStorage(t)
+			sha, etag, err := s.StoreSnapshotFile("org/m", "main", "config.json", strings.NewReader(`{"model_type":"opt"}`))
+			if err != nil {
+				t.Fatalf("StoreSnapshotFile: %v", err)
+			}
+			if tt.removeMeta {
+				if err := os.Remove(s.layout.SnapshotMetaPath("org/m", sha)); err != nil {
+					t.Fatal(err)
+				}
+				s.snapshotMeta = newSnapshotMetaCache()
+			}
+			if err := os.Remove(s.layout.SnapshotPath("org/m", sha, "config.json")); err != nil {
+				t.Fatal(err)
+			}
+
+			if _, ok := s.FileExists("org/m", sha, "config.json"); ok != tt.exists {
+				t.Fatalf("FileExists = %v, want %v", ok, tt.exists)
+			}
+			wantEtag := ""
+			if tt.exists {
+				wantEtag = etag
+			}
+			if got := s.FileEtag("org/m", sha, "config.json"); got != wantEtag {
+				t.Fatalf("FileEtag = %q, want %q", got, wantEtag)
+			}
+		})
+	}
+}
+
+// benchmarkFileLookup stores a file and removes the snapshot metadata when symlink
+// is set, so the lookups resolve the link of the file
+func benchmarkFileLookup(b *testing.B, symlink bool) {
+	s := newTestStorage(b)
+	sha, _, err := s.StoreSnapshotFile("org/m", "main", "model.safetensors", strings.NewReader(strings.Repeat("x", 4096)))
+	if err != nil {
+		b.Fatal(err)
+	}
+	if symlink {
+		if err := os.Remove(s.layout.SnapshotMetaPath("org/m", sha)); err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, ok := s.FileExists("org/m", sha, "model.safetensors"); !ok {
+			b.Fatal("file not found")
+		}
+		if s.FileEtag("org/m", sha, "model.safetensors") == "" {
+			b.Fatal("file has no etag")
+		}
+	}
+}
+
+func BenchmarkFileLookupSnapshotMeta(b *testing.B) { benchmarkFileLookup(b, false) }
+
+func BenchmarkFileLookupSymlink(b *testing.B) { benchmarkFileLookup(b, true) }
@@ -2,15 +2,18 @@ package filestorage
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
-	"io/fs"
-	"log"
+	"log/slog"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/lengrongfu/LLMDistribution/pkg/api"
+	"github.com/lengrongfu/LLMDistribution/pkg/api/model"
 	"github.com/lengrongfu/LLMDistribution/pkg/utils"
 )
 
@@ -18,6 +21,51 @@ import (
 type Storage struct {
 	// Base directory for file storage
 	baseDir string
+	// layout builds the paths of the files of a model below baseDir
+	layout utils.Layout
+	// blobDir keeps the blobs separate from the snapshots when set
+	blobDir string
+	// indexTTL is how long a built model index is reused (0 disables the cache)
+	indexTTL   time.Duration
+	indexMu    sync.Mutex
+	indexCache map[string]cachedIndex
+	// indexBuilds coalesces concurrent builds of the same model index
+	indexBuilds map[string]*indexBuild
+	// mmap serves small files from memory-mapped regions when enabled
+	mmap *mmapCache
+	// reverify re-hashes blobs older than a maximum age before they are served
+	reverify *blobVerifier
+	// defaultRevision is resolved for requests without a revision and, like "main"
+	// and "master", falls back to the latest snapshot when it has no ref
+	defaultRevision string
+	// access tracks the last time each model was served
+	access *accessTracker
+	// mergeIndex adds local files missing from a cached .modeindex to the served index
+	mergeIndex bool
+	// pins protects the snapshots being served from eviction
+	pins *snapshotPins
+	// compress compresses the blobs of cold models when enabled
+	compress *blobCompressor
+	// refresh regenerates stale .modeindex files when enabled
+	refresh *indexRefresher
+	// reindexMu serializes the regeneration of .modeindex files
+	reindexMu sync.Mutex
+	// snapshotMeta caches the recorded etag and size of snapshot files
+	snapshotMeta *snapshotMetaCache
+}
+
+// cachedIndex is a model index built from a snapshot directory
+type cachedIndex struct {
+	model   *Model
+	modTime time.Time
+	expires time.Time
+}
+
+// indexBuild is a model index being built, requests for the same index wait for it
+type indexBuild struct {
+	done  chan struct{}
+	model *Model
+	err   error
 }
 
 // NewStorage creates a new file storage
@@ -30,28 +78,74 @@ func NewStorage(baseDir string) (*Storage, error) {
 		}
 	}
 	return &Storage{
-		baseDir: baseDir,
+		baseDir:         baseDir,
+		layout:          utils.NewLayout(baseDir, utils.LayoutHF),
+		indexCache:      make(map[string]cachedIndex),
+		indexBuilds:     make(map[string]*indexBuild),
+		defaultRevision: "main",
+		pins:            newSnapshotPins(),
+		snapshotMeta:    newSnapshotMetaCache(),
 	}, nil
 }
 
-// StoreFile stores a file in the file storage
-func (s *Storage) StoreFile(modelID, filename string, content io.Reader) (string, error) {
-	// Create the model directory if it doesn't exist
-	modelDir := filepath.Join(s.baseDir, modelID)
-	if err := os.MkdirAll(modelDir, 0755); err != nil {
-		return "", fmt.Errorf("failed to create model directory: %w", err)
+// WithLayout sets how the files of the models are arranged below the base directory
+func (s *Storage) WithLayout(strategy utils.LayoutStrategy) {
+	s.layout = utils.NewLayout(s.baseDir, strategy).WithRepoType(s.layout.RepoType()).WithBlobDir(s.blobDir)
+}
+
+// WithRepoType sets the type of the stored repositories, which names their
+// directories like models--org--name or datasets--org--name
+func (s *Storage) WithRepoType(repoType utils.RepoType) {
+	s.layout = s.layout.WithRepoType(repoType)
+}
+
+// WithBlobDir keeps the blobs below dir, e.g. on bulk storage, while the snapshots
+// and refs stay in the model directories
+func (s *Storage) WithBlobDir(dir string) error {
+	if dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return fmt.Errorf("failed to create blob directory: %w", err)
+		}
 	}
+	s.blobDir = dir
+	s.layout = s.layout.WithBlobDir(dir)
+	return nil
+}
 
-	// Create the file path
-	filePath := filepath.Join(modelDir, filename)
+// WithIndexCacheTTL sets how long a model index built from a snapshot is reused
+func (s *Storage) WithIndexCacheTTL(ttl time.Duration) {
+	s.indexTTL = ttl
+}
 
-	// Create the directory if it doesn't exist
-	if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
-		return "", fmt.Errorf("failed to create directory: %w", err)
+// WithDefaultRevision sets the revision resolved for requests that name none
+func (s *Storage) WithDefaultRevision(revision string) {
+	if revision != "" {
+		s.defaultRevision = revision
+	}
+}
+
+// WithMmap serves files up to maxFileSize bytes from memory-mapped regions, keeping
+// at most maxEntries mappings. A maxFileSize <= 0 disables memory mapping.
+func (s *Storage) WithMmap(maxFileSize int64, maxEntries int) {
+	if maxFileSize <= 0 {
+		s.mmap = nil
+		return
+	}
+	s.mmap = newMmapCache(maxFileSize, maxEntries)
+}
+
+// StoreFile stores a file in the file storage. The content is written to
+// "<filename>.part" and only renamed to the final path once fully received, so an
+// interrupted upload can be resumed with StoreFileAt.
+func (s *Storage) StoreFile(modelID, filename string, content io.Reader) (string, error) {
+	filePath, err := s.uploadPath(modelID, filename)
+	if err != nil {
+		return "", err
 	}
+	partPath := filePath + ".part"
 
 	// Create the file
-	file, err := os.Create(filePath)
+	file, err := os.Create(partPath)
 	if err != nil {
 		return "", fmt.Errorf("failed to create file: %w", err)
 	}
@@ -61,22 +155,145 @@ func (s *Storage) StoreFile(modelID, filename string, content io.Reader) (string
 	if _, err := io.Copy(file, content); err != nil {
 		return "", fmt.Errorf("failed to write file: %w", err)
 	}
+	if err := os.Rename(partPath, filePath); err != nil {
+		return "", fmt.Errorf("failed to complete file: %w", err)
+	}
+	s.forgetIndex(modelID)
 
 	return filePath, nil
 }
 
-// GetFile retrieves a file from the file storage
+// UploadOffset returns the number of bytes already received for an interrupted upload
+func (s *Storage) UploadOffset(modelID, filename string) (int64, error) {
+	filePath, err := s.modelFilePath(modelID, filename)
+	if err != nil {
+		return 0, err
+	}
+	info, err := os.Stat(filePath + ".part")
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to stat partial file: %w", err)
+	}
+	return info.Size(), nil
+}
+
+// StoreFileAt appends content at offset to the partial upload of a file and renames it
+// to the final path once total bytes have been received
+func (s *Storage) StoreFileAt(modelID, filename string, offset, total int64, content io.Reader) (string, bool, error) {
+	filePath, err := s.uploadPath(modelID, filename)
+	if err != nil {
+		return "", false, err
+	}
+	partPath := filePath + ".part"
+
+	current, err := s.UploadOffset(modelID, filename)
+	if err != nil {
+		return "", false, err
+	}
+	if current != offset {
+		return "", false, fmt.Errorf("%w: expected offset %d, got %d", api.ErrUploadOffsetMismatch, current, offset)
+	}
+
+	file, err := os.OpenFile(partPath, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return "", false, fmt.Errorf("failed to open partial file: %w", err)
+	}
+	written, err := io.Copy(file, content)
+	file.Close()
+	if err != nil {
+		return "", false, fmt.Errorf("failed to write file: %w", err)
+	}
+	if offset+written < total {
+		return partPath, false, nil
+	}
+	if err := os.Rename(partPath, filePath); err != nil {
+		return "", false, fmt.Errorf("failed to complete file: %w", err)
+	}
+	s.forgetIndex(modelID)
+	return filePath, true, nil
+}
+
+// DiscardUpload removes the partial file of an upload that will not be resumed
+func (s *Storage) DiscardUpload(modelID, filename string) error {
+	filePath, err := s.modelFilePath(modelID, filename)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(filePath + ".part"); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove partial file: %w", err)
+	}
+	return nil
+}
+
+// uploadPath returns the destination of an uploaded file, creating its directory
+func (s *Storage) uploadPath(modelID, filename string) (string, error) {
+	filePath, err := s.modelFilePath(modelID, filename)
+	if err != nil {
+		return "", err
+	}
+
+	// Create the directory if it doesn't exist
+	if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+		return "", fmt.Errorf("failed to create directory: %w", err)
+	}
+	return filePath, nil
+}
+
+// modelFilePath returns the path of an uploaded file below the model directory. Model
+// IDs and file names that would resolve outside of it are rejected with
+// utils.ErrInvalidPath.
+func (s *Storage) modelFilePath(modelID, filename string) (string, error) {
+	if !utils.ValidModelID(modelID) {
+		return "", fmt.Errorf("%w: model %q", utils.ErrInvalidPath, modelID)
+	}
+	filename, err := utils.CleanRepoPath(filename)
+	if err != nil {
+		return "", err
+	}
+	modelDir := filepath.Join(s.baseDir, modelID)
+	filePath := filepath.Join(modelDir, filepath.FromSlash(filename))
+	if !utils.WithinDir(modelDir, filePath) || filePath == modelDir {
+		return "", fmt.Errorf("%w: %q", utils.ErrInvalidPath, filename)
+	}
+	return filePath, nil
+}
+
+// GetFile retrieves a file from the file storage. Files that are neither compressed
+// nor memory-mapped are returned as the *os.File of their blob.
 func (s *Storage) GetFile(modelID, sha, filename string) (io.ReadSeeker, error) {
-	modelPath := utils.ConvertModelIDToHFPath(modelID)
 	// Create the file path
-	filePath := filepath.Join(s.baseDir, modelPath, "snapshots", sha, filename)
+	filePath := s.layout.SnapshotPath(modelID, sha, filename)
 
 	// Check if the file exists
-	if _, err := os.Stat(filePath); os.IsNotExist(err) {
+	info, err := os.Stat(filePath)
+	if os.IsNotExist(err) {
 		return nil, fmt.Errorf("file not found: %s/%s", modelID, filename)
 	}
+	if s.access != nil {
+		s.access.touch(modelID)
+	}
 
-	// Open the file
+	// Compressed blobs are decompressed while they are read
+	if err == nil && compressed(filePath) {
+		return utils.OpenCompressed(filePath)
+	}
+
+	// Serve small files from a memory-mapped region
+	if s.mmap != nil && err == nil && s.mmap.eligible(info) {
+		reader, err := s.mmap.open(filePath, info)
+		if err == nil {
+			return reader, nil
+		}
+		slog.Warn("failed to mmap file, falling back to read", "path", filePath, "error", err)
+	}
+
+	// Open the blob the snapshot links to. The *os.File is returned unwrapped so
+	// http.ServeContent can send it with sendfile.
+	if blobPath, err := filepath.EvalSymlinks(filePath); err == nil {
+		filePath = blobPath
+	}
 	file, err := os.Open(filePath)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open file: %w", err)
@@ -85,21 +302,27 @@ func (s *Storage) GetFile(modelID, sha, filename string) (io.ReadSeeker, error)
 	return file, nil
 }
 
-// FileExists checks if a file exists in the file storage
+// FileExists checks if a file exists in the file storage, from the snapshot metadata
+// when the file is recorded there
 func (s *Storage) FileExists(modelID, sha, filename string) (os.FileInfo, bool) {
-	modelPath := utils.ConvertModelIDToHFPath(modelID)
+	if meta, ok := s.lookupSnapshotFile(modelID, sha, filename); ok {
+		return recordedFileInfo(filename, meta), true
+	}
+
 	// Create the file path
-	filePath := filepath.Join(s.baseDir, modelPath, "snapshots", sha, filename)
+	filePath := s.layout.SnapshotPath(modelID, sha, filename)
 
 	// Check if the file exists
-	info, err := os.Stat(filePath)
+	info, err := statBlob(filePath)
 	return info, err == nil
 }
 
 // DeleteFile deletes a file from the file storage
 func (s *Storage) DeleteFile(modelID, filename string) error {
-	// Create the file path
-	filePath := filepath.Join(s.baseDir, modelID, filename)
+	filePath, err := s.modelFilePath(modelID, filename)
+	if err != nil {
+		return err
+	}
 
 	// Delete the file
 	if err := os.Remove(filePath); err != nil {
@@ -111,9 +334,8 @@ func (s *Storage) DeleteFile(modelID, filename string) error {
 
 // ListFiles lists all files for a model in the file storage
 func (s *Storage) ListFiles(modelID string) ([]string, error) {
-	modePath := utils.ConvertModelIDToHFPath(modelID)
 	// Create the model directory path
-	modelDir := filepath.Join(s.baseDir, modePath)
+	modelDir := s.layout.ModelDir(modelID)
 
 	// Check if the model directory exists
 	if _, err := os.Stat(modelDir); os.IsNotExist(err) {
@@ -138,14 +360,20 @@ func (s *Storage) ListFiles(modelID string) ([]string, error) {
 }
 
 func (s *Storage) RepoInfo(modelID, version string) (*Model, error) {
-	modePath := utils.ConvertModelIDToHFPath(modelID)
-	modelIndexPath := filepath.Join(s.baseDir, modePath, ".modeindex")
+	modelIndexPath := s.layout.IndexPath(modelID)
+	// the stored index describes a single revision, other revisions of the model
+	// are built from their snapshot or reported as not cached
+	sha, err := s.getRepoSha(modelID, version)
+	var revErr *api.RevisionNotFoundError
+	if errors.As(err, &revErr) {
+		return nil, err
+	}
 
 	if _, err := os.Stat(modelIndexPath); err != nil {
 		if os.IsNotExist(err) {
-			log.Println("Warning: .modelindex file not found, building model index from scratch")
+			slog.Debug("model index not found, building it from the snapshot", "model", modelID)
 			// don't .modelindex file, return customer data
-			return s.buildModelIndex(modelID, version)
+			return s.cachedModelIndex(modelID, version)
 		}
 		return nil, fmt.Errorf("modelindex file not found: %s", modelID)
 	}
@@ -156,98 +384,215 @@ func (s *Storage) RepoInfo(modelID, version string) (*Model, error) {
 	}
 
 	var model Model
-	err = json.Unmarshal(data, &model)
-	if err != nil {
-		return nil, fmt.Errorf("failed to unmarshal modelindex file: %w", err)
+	if err := json.Unmarshal(data, &model); err != nil {
+		slog.Warn("failed to parse model index, building it from the snapshot", "path", modelIndexPath, "error", err)
+		return s.cachedModelIndex(modelID, version)
+	}
+	if err := model.validate(); err != nil {
+		slog.Warn("invalid model index, building it from the snapshot", "path", modelIndexPath, "error", err)
+		return s.cachedModelIndex(modelID, version)
+	}
+	if sha != "" && model.SHA != sha && s.hasSnapshot(modelID, model.SHA) {
+		// the index describes another cached snapshot than the one requested
+		return s.cachedModelIndex(modelID, version)
+	}
+	if s.mergeIndex {
+		if err := s.mergeLocalSiblings(modelID, &model); err != nil {
+			return nil, fmt.Errorf("failed to merge local files into modelindex: %w", err)
+		}
 	}
 
 	return &model, nil
 }
 
+// hasSnapshot reports whether a snapshot directory of sha is cached for a model
+func (s *Storage) hasSnapshot(modelID, sha string) bool {
+	info, err := os.Stat(s.layout.SnapshotPath(modelID, sha, ""))
+	return err == nil && info.IsDir()
+}
+
+// cachedModelIndex returns the built model index of a version, reusing a previous
+// build until the TTL expires or the snapshot directory is modified. Concurrent
+// requests for an index that is not cached share a single build.
+func (s *Storage) cachedModelIndex(modelID, version string) (*Model, error) {
+	sha, err := s.getRepoSha(modelID, version)
+	if err != nil {
+		return nil, err
+	}
+	snapshotDir := s.layout.SnapshotPath(modelID, sha, "")
+	info, err := os.Stat(snapshotDir)
+	if err != nil {
+		return nil, fmt.Errorf("snapshot not found: %s", snapshotDir)
+	}
+
+	key := modelID + "@" + sha
+	s.indexMu.Lock()
+	cached, ok := s.indexCache[key]
+	if s.indexTTL > 0 && ok && time.Now().Before(cached.expires) && cached.modTime.Equal(info.ModTime()) {
+		s.indexMu.Unlock()
+		return cached.model, nil
+	}
+	if build, ok := s.indexBuilds[key]; ok {
+		s.indexMu.Unlock()
+		<-build.done
+		return build.model, build.err
+	}
+	build := &indexBuild{done: make(chan struct{})}
+	s.indexBuilds[key] = build
+	s.indexMu.Unlock()
+
+	build.model, build.err = s.buildModelIndex(modelID, version)
+	s.indexMu.Lock()
+	delete(s.indexBuilds, key)
+	if build.err == nil && s.indexTTL > 0 {
+		s.indexCache[key] = cachedIndex{
+			model:   build.model,
+			modTime: info.ModTime(),
+			expires: time.Now().Add(s.indexTTL),
+		}
+	}
+	s.indexMu.Unlock()
+	close(build.done)
+	return build.model, build.err
+}
+
+// forgetIndex drops the cached model indexes of every snapshot of a model
+func (s *Storage) forgetIndex(modelID string) {
+	s.indexMu.Lock()
+	defer s.indexMu.Unlock()
+	for key := range s.indexCache {
+		if strings.HasPrefix(key, modelID+"@") {
+			delete(s.indexCache, key)
+		}
+	}
+}
+
 func (s *Storage) buildModelIndex(modelID, version string) (*Model, error) {
 	author := strings.Split(modelID, "/")[0]
-	modePath := utils.ConvertModelIDToHFPath(modelID)
 
 	sha, err := s.getRepoSha(modelID, version)
 	if err != nil {
 		return nil, err
 	}
 
-	modelDir := filepath.Join(s.baseDir, modePath, "snapshots", sha)
-	log.Println("buildModelIndex", modelDir)
+	modelDir := s.layout.SnapshotPath(modelID, sha, "")
+	slog.Debug("building model index", "dir", modelDir)
 	var (
 		totalSize int64
 		fileList  []Sibling = make([]Sibling, 0)
 	)
-	err = filepath.WalkDir(modelDir, func(path string, d fs.DirEntry, err error) error {
-		if err != nil {
-			return err
-		}
-		if d.IsDir() {
-			return nil
-		}
-		info, err := d.Info()
-		if err != nil {
-			return err
-		}
-		fileList = append(fileList, Sibling{Rfilename: d.Name()})
-		if info.Mode()&os.ModeSymlink == 0 {
-			totalSize += info.Size()
+	err = walkSnapshot(modelDir, modelDir, true, func(entry model.TreeEntry) error {
+		if entry.Type != model.TreeEntryFile {
 			return nil
 		}
-		target, err := os.Readlink(filepath.Join(modelDir, d.Name()))
-		if err != nil {
-			return err
+		if entry.Oid == "" {
+			fileList = append(fileList, Sibling{Rfilename: entry.Path, Size: entry.Size})
+		} else {
+			fileList = append(fileList, newSibling(entry.Path, entry.Oid, entry.Size))
 		}
-		// log.Println("buildModelIndex", target)
-		_, etag := filepath.Split(target)
-		absPath := filepath.Join(s.baseDir, modePath, "blobs", etag)
-		targetInfo, err := os.Stat(absPath)
-		if err != nil {
-			return err
-		}
-		totalSize += targetInfo.Size()
+		totalSize += entry.Size
 		return nil
 	})
 	if err != nil {
-		log.Printf("failed to walk model directory: %v", err)
+		slog.Error("failed to walk model directory", "dir", modelDir, "error", err)
 		return nil, err
 	}
 
-	return &Model{
+	// the snapshot time keeps the index, and the ETag hashed from it, stable between builds
+	modTime := snapshotModTime(modelDir)
+	index := &Model{
 		ID:           modelID,
 		ModelID:      modelID,
 		Author:       author,
 		SHA:          sha,
-		LastModified: time.Now().UTC(),
-		CreatedAt:    time.Now().UTC(),
+		LastModified: modTime,
+		CreatedAt:    modTime,
 		// TODO, this field is not file total size, is this model is need gpu memory.
 		UsedStorage: totalSize,
 		Siblings:    fileList,
-	}, nil
+	}
+	readModelMetadata(modelDir, index)
+	return index, nil
+}
+
+// snapshotModTime returns the time the snapshot directory was last modified, which is
+// when a file was last added to it
+func snapshotModTime(snapshotDir string) time.Time {
+	info, err := os.Stat(snapshotDir)
+	if err != nil {
+		return time.Now().UTC()
+	}
+	return info.ModTime().UTC()
 }
 
 func (s *Storage) getRepoSha(modelID, version string) (string, error) {
-	modePath := utils.ConvertModelIDToHFPath(modelID)
-	versionFilePath := filepath.Join(s.baseDir, modePath, "refs", version)
+	if version == "" {
+		version = s.defaultRevision
+	}
+	versionFilePath := s.layout.RefPath(modelID, version)
 	if _, err := os.Stat(versionFilePath); err != nil {
+		// a commit sha is served from its snapshot without a ref
+		if version != "" && s.hasSnapshot(modelID, version) {
+			return version, nil
+		}
+		// models stored by commit only still answer the default branch
+		if s.isRevisionAlias(version) {
+			if sha, ok := s.latestSnapshot(modelID); ok {
+				return sha, nil
+			}
+		}
+		if available, rerr := s.Revisions(modelID); rerr == nil && len(available) > 0 {
+			return "", &api.RevisionNotFoundError{ModelID: modelID, Revision: version, Available: available}
+		}
 		return "", fmt.Errorf("version file not found: %s", versionFilePath)
 	}
-	data, err := os.ReadFile(versionFilePath)
+	sha, err := utils.ReadRef(versionFilePath)
 	if err != nil {
 		return "", fmt.Errorf("failed to read version file: %w", err)
 	}
-	return string(data), nil
+	return sha, nil
+}
+
+// isRevisionAlias reports whether version names the default branch of a model
+func (s *Storage) isRevisionAlias(version string) bool {
+	return version == "main" || version == "master" || version == s.defaultRevision
+}
+
+// latestSnapshot returns the commit of the most recently modified snapshot of a model
+func (s *Storage) latestSnapshot(modelID string) (string, bool) {
+	entries, err := os.ReadDir(s.layout.SnapshotPath(modelID, "", ""))
+	if err != nil {
+		return "", false
+	}
+	var (
+		latest  string
+		modTime time.Time
+	)
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		if latest == "" || info.ModTime().After(modTime) {
+			latest, modTime = entry.Name(), info.ModTime()
+		}
+	}
+	return latest, latest != ""
 }
 
+// FileEtag returns the etag of a file of the snapshot sha, from the snapshot metadata
+// when the file is recorded there and otherwise from the blob its link points to
 func (s *Storage) FileEtag(modelID, sha, filename string) string {
-	modelPath := utils.ConvertModelIDToHFPath(modelID)
-	filePath := filepath.Join(s.baseDir, modelPath, "snapshots", sha, filename)
+	if meta, ok := s.lookupSnapshotFile(modelID, sha, filename); ok {
+		return meta.Etag
+	}
+	filePath := s.layout.SnapshotPath(modelID, sha, filename)
 	targetPath, err := os.Readlink(filePath)
 	if err != nil {
 		return ""
 	}
-	absPath, _ := filepath.Abs(targetPath)
-	_, etag := filepath.Split(absPath)
-	return etag
+	return blobEtag(targetPath)
 }
@@ -0,0 +1,441 @@
+package filestorage
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lengrongfu/LLMDistribution/pkg/api"
+	"github.com/lengrongfu/LLMDistribution/pkg/utils"
+)
+
+// newTestStorage creates a storage below a temporary directory
+func newTestStorage(t testing.TB) *Storage {
+	t.Helper()
+	s, err := NewStorage(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewStorage: %v", err)
+	}
+	return s
+}
+
+func TestStoreFileRejectsTraversal(t *testing.T) {
+	s := newTestStorage(t)
+	outside := filepath.Join(filepath.Dir(s.baseDir), "escaped")
+
+	tests := []struct {
+		name     string
+		modelID  string
+		filename string
+	}{
+		{"parent segments", "acme/m", "../../../escaped"},
+		{"absolute path", "acme/m", outside},
+		{"backslashes", "acme/m", "..\\..\\..\\escaped"},
+		{"model ID", "../..", "escaped"},
+		{"model directory", "acme/m", "."},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := s.StoreFile(tt.modelID, tt.filename, strings.NewReader("pwned"))
+			if !errors.Is(err, utils.ErrInvalidPath) {
+				t.Fatalf("StoreFile(%q, %q) = %v, want ErrInvalidPath", tt.modelID, tt.filename, err)
+			}
+			if _, err := os.Stat(outside); err == nil {
+				t.Fatalf("file escaped to %s", outside)
+			}
+		})
+	}
+}
+
+func TestStoreFile(t *testing.T) {
+	s := newTestStorage(t)
+	path, err := s.StoreFile("acme/m", "./sub\\config.json", strings.NewReader("{}"))
+	if err != nil {
+		t.Fatalf("StoreFile: %v", err)
+	}
+	if want := filepath.Join(s.baseDir, "acme", "m", "sub", "config.json"); path != want {
+		t.Fatalf("StoreFile path = %s, want %s", path, want)
+	}
+}
+
+func TestStoreSnapshotFileRejectsTraversal(t *testing.T) {
+	s := newTestStorage(t)
+	tests := []struct {
+		name     string
+		revision string
+		filename string
+	}{
+		{"file name", "main", "../../refs/main"},
+		{"revision", "../../../escaped", "config.json"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := s.StoreSnapshotFile("acme/m", tt.revision, tt.filename, strings.NewReader("{}"))
+			if !errors.Is(err, utils.ErrInvalidPath) {
+				t.Fatalf("StoreSnapshotFile = %v, want ErrInvalidPath", err)
+			}
+		})
+	}
+}
+
+func TestResumableUploadRejectsTraversal(t *testing.T) {
+	s := newTestStorage(t)
+	victim := filepath.Join(filepath.Dir(s.baseDir), "victim")
+	if err := os.WriteFile(victim, []byte("keep"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(victim+".part", []byte("keep"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	name := "../../../victim"
+	if _, err := s.UploadOffset("acme/m", name); !errors.Is(err, utils.ErrInvalidPath) {
+		t.Errorf("UploadOffset = %v, want ErrInvalidPath", err)
+	}
+	if _, _, err := s.StoreFileAt("acme/m", name, 4, 8, strings.NewReader("more")); !errors.Is(err, utils.ErrInvalidPath) {
+		t.Errorf("StoreFileAt = %v, want ErrInvalidPath", err)
+	}
+	if err := s.DiscardUpload("acme/m", name); !errors.Is(err, utils.ErrInvalidPath) {
+		t.Errorf("DiscardUpload = %v, want ErrInvalidPath", err)
+	}
+	if err := s.DeleteFile("acme/m", name); !errors.Is(err, utils.ErrInvalidPath) {
+		t.Errorf("DeleteFile = %v, want ErrInvalidPath", err)
+	}
+	for _, path := range []string{victim, victim + ".part"} {
+		if data, err := os.ReadFile(path); err != nil || string(data) != "keep" {
+			t.Errorf("%s was modified: %q, %v", path, data, err)
+		}
+	}
+}
+
+func TestStoreFileAt(t *testing.T) {
+	s := newTestStorage(t)
+	if _, complete, err := s.StoreFileAt("acme/m", "weights.bin", 0, 8, strings.NewReader("1234")); err != nil || complete {
+		t.Fatalf("first chunk: complete=%v, %v", complete, err)
+	}
+	if offset, err := s.UploadOffset("acme/m", "weights.bin"); err != nil || offset != 4 {
+		t.Fatalf("UploadOffset = %d, %v, want 4", offset, err)
+	}
+	path, complete, err := s.StoreFileAt("acme/m", "weights.bin", 4, 8, strings.NewReader("5678"))
+	if err != nil || !complete {
+		t.Fatalf("last chunk: complete=%v, %v", complete, err)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "12345678" {
+		t.Fatalf("content = %q", data)
+	}
+}
+
+func TestCachedModelIndex(t *testing.T) {
+	tests := []struct {
+		name   string
+		ttl    time.Duration
+		expire bool
+		reused bool
+	}{
+		{"disabled", 0, false, false},
+		{"within TTL", time.Minute, false, true},
+		{"expired", time.Minute, true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestStorage(t)
+			s.WithIndexCacheTTL(tt.ttl)
+			if _, _, err := s.StoreSnapshotFile("acme/m", "main", "config.json", strings.NewReader("{}")); err != nil {
+				t.Fatal(err)
+			}
+			first, err := s.cachedModelIndex("acme/m", "main")
+			if err != nil {
+				t.Fatalf("cachedModelIndex: %v", err)
+			}
+			if tt.expire {
+				s.indexMu.Lock()
+				for key, cached := range s.indexCache {
+					cached.expires = time.Now()
+					s.indexCache[key] = cached
+				}
+				s.indexMu.Unlock()
+			}
+			second, err := s.cachedModelIndex("acme/m", "main")
+			if err != nil {
+				t.Fatalf("cachedModelIndex: %v", err)
+			}
+			if reused := first == second; reused != tt.reused {
+				t.Errorf("index reused = %v, want %v", reused, tt.reused)
+			}
+			if len(second.Siblings) != 1 || second.Siblings[0].Rfilename != "config.json" {
+				t.Errorf("siblings = %+v", second.Siblings)
+			}
+		})
+	}
+}
+
+func TestLayoutStrategies(t *testing.T) {
+	tests := []struct {
+		strategy     utils.LayoutStrategy
+		wantModelDir string
+	}{
+		{utils.LayoutHF, "models--acme--m"},
+		{utils.LayoutFlat, "acme/m"},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.strategy), func(t *testing.T) {
+			s := newTestStorage(t)
+			s.WithLayout(tt.strategy)
+			sha, _, err := s.StoreSnapshotFile("acme/m", "main", "sub/config.json", strings.NewReader("{}"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			snapshot := filepath.Join(s.baseDir, filepath.FromSlash(tt.wantModelDir), "snapshots", sha, "sub", "config.json")
+			if data, err := os.ReadFile(snapshot); err != nil || string(data) != "{}" {
+				t.Fatalf("read %s = %q, %v", snapshot, data, err)
+			}
+			index, err := s.RepoInfo("acme/m", "main")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(index.Siblings) != 1 || index.Siblings[0].Rfilename != "sub/config.json" {
+				t.Errorf("siblings = %+v", index.Siblings)
+			}
+		})
+	}
+}
+
+func TestGetRepoShaAliases(t *testing.T) {
+	const (
+		older  = "1111111111111111111111111111111111111111"
+		latest = "2222222222222222222222222222222222222222"
+	)
+	s := newTestStorage(t)
+	s.WithDefaultRevision("release")
+	// the model is stored by commit only, without refs
+	for i, sha := range []string{older, latest} {
+		dir := s.layout.SnapshotPath("acme/m", sha, "")
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		modTime := time.Now().Add(time.Duration(i-2) * time.Hour)
+		if err := os.Chtimes(dir, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		version  string
+		want     string
+		notFound bool
+	}{
+		{version: "main", want: latest},
+		{version: "master", want: latest},
+		{version: "release", want: latest},
+		{version: "", want: latest},
+		{version: older, want: older},
+		{version: "dev", notFound: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.version, func(t *testing.T) {
+			sha, err := s.getRepoSha("acme/m", tt.version)
+			var notFound *api.RevisionNotFoundError
+			if tt.notFound {
+				if !errors.As(err, &notFound) {
+					t.Fatalf("getRepoSha(%q) = %q, %v, want RevisionNotFoundError", tt.version, sha, err)
+				}
+				return
+			}
+			if err != nil || sha != tt.want {
+				t.Errorf("getRepoSha(%q) = %q, %v, want %q", tt.version, sha, err, tt.want)
+			}
+		})
+	}
+
+	// an explicit ref wins over the latest snapshot
+	if err := utils.WriteRef(s.layout.RefPath("acme/m", "main"), older); err != nil {
+		t.Fatal(err)
+	}
+	if sha, err := s.getRepoSha("acme/m", "main"); err != nil || sha != older {
+		t.Errorf("getRepoSha(main) with a ref = %q, %v, want %q", sha, err, older)
+	}
+}
+
+func TestGetFileReturnsBlobFile(t *testing.T) {
+	s := newTestStorage(t)
+	sha, etag, err := s.StoreSnapshotFile("acme/m", "main", "model.bin", strings.NewReader("weights"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := s.GetFile("acme/m", sha, "model.bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// http.ServeContent only uses sendfile for an unwrapped *os.File
+	file, ok := r.(*os.File)
+	if !ok {
+		t.Fatalf("GetFile returned %T, want *os.File", r)
+	}
+	defer file.Close()
+	want, err := filepath.EvalSymlinks(s.layout.BlobPath("acme/m", etag))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if file.Name() != want {
+		t.Errorf("opened %s, want the blob %s", file.Name(), want)
+	}
+}
+
+func TestBlobDir(t *testing.T) {
+	tests := []struct {
+		name     string
+		strategy utils.LayoutStrategy
+	}{
+		{"hf layout", utils.LayoutHF},
+		{"flat layout", utils.LayoutFlat},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestStorage(t)
+			blobDir := filepath.Join(t.TempDir(), "bulk")
+			if err := s.WithBlobDir(blobDir); err != nil {
+				t.Fatal(err)
+			}
+			s.WithLayout(tt.strategy)
+			content := strings.Repeat("w", 100)
+			commit, etag, err := s.StoreSnapshotFile("acme/m", "main", "model.bin", strings.NewReader(content))
+			if err != nil {
+				t.Fatal(err)
+			}
+			blob := s.layout.BlobPath("acme/m", etag)
+			if !utils.WithinDir(blobDir, blob) {
+				t.Fatalf("blob %s is not below %s", blob, blobDir)
+			}
+			if _, err := os.Stat(blob); err != nil {
+				t.Fatalf("blob not stored: %v", err)
+			}
+			r, err := s.GetFile("acme/m", commit, "model.bin")
+			if err != nil {
+				t.Fatal(err)
+			}
+			data, _ := io.ReadAll(r)
+			r.(io.Closer).Close()
+			if string(data) != content {
+				t.Errorf("content = %q, want %q", data, content)
+			}
+			preview, err := s.EvictionPreview(0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if preview.TotalBytes < int64(len(content)) {
+				t.Errorf("total bytes %d do not count the separate blob", preview.TotalBytes)
+			}
+			if result, err := s.CollectGarbage(); err != nil || result.Removed != 0 {
+				t.Errorf("CollectGarbage = %+v, %v, want the linked blob kept", result, err)
+			}
+			if err := s.DeleteModel("acme/m"); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := os.Stat(blob); !os.IsNotExist(err) {
+				t.Errorf("blob kept after deleting the model: %v", err)
+			}
+		})
+	}
+}
+
+func TestCachedModelIndexDroppedOnUpload(t *testing.T) {
+	tests := []struct {
+		name     string
+		filename string
+	}{
+		{"top-level file", "tokenizer.json"},
+		// the snapshot directory itself is not modified
+		{"file in an existing directory", "sub/b.json"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestStorage(t)
+			s.WithIndexCacheTTL(time.Hour)
+			for _, name := range []string{"config.json", "sub/a.json"} {
+				if _, _, err := s.StoreSnapshotFile("acme/m", "main", name, strings.NewReader("{}")); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if _, err := s.cachedModelIndex("acme/m", "main"); err != nil {
+				t.Fatal(err)
+			}
+			if _, _, err := s.StoreSnapshotFile("acme/m", "main", tt.filename, strings.NewReader("{}")); err != nil {
+				t.Fatal(err)
+			}
+			index, err := s.cachedModelIndex("acme/m", "main")
+			if err != nil {
+				t.Fatal(err)
+			}
+			var found bool
+			for _, sibling := range index.Siblings {
+				found = found || sibling.Rfilename == tt.filename
+			}
+			if !found {
+				t.Errorf("uploaded %s missing from the cached index %+v", tt.filename, index.Siblings)
+			}
+		})
+	}
+}
+
+func TestCachedModelIndexSharesBuild(t *testing.T) {
+	s := newTestStorage(t)
+	commit, _, err := s.StoreSnapshotFile("acme/m", "main", "config.json", strings.NewReader("{}"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a build of the index is in progress
+	build := &indexBuild{done: make(chan struct{}), model: &Model{ID: "acme/m", SHA: commit}}
+	s.indexBuilds["acme/m@"+commit] = build
+
+	results := make(chan *Model, 2)
+	for i := 0; i < cap(results); i++ {
+		go func() {
+			index, err := s.cachedModelIndex("acme/m", "main")
+			if err != nil {
+				t.Error(err)
+			}
+			results <- index
+		}()
+	}
+	select {
+	case <-results:
+		t.Fatal("index built again while a build was in progress")
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(build.done)
+	for i := 0; i < cap(results); i++ {
+		if index := <-results; index != build.model {
+			t.Errorf("got index %p, want the shared build %p", index, build.model)
+		}
+	}
+}
+
+func TestRevisionsSkipsRefsBeingWritten(t *testing.T) {
+	s := newTestStorage(t)
+	commit, _, err := s.StoreSnapshotFile("acme/m", "main", "config.json", strings.NewReader("{}"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a ref being written by WriteRef, and a ref git wrote with a trailing newline
+	refsDir := s.layout.RefPath("acme/m", "")
+	if err := os.WriteFile(filepath.Join(refsDir, ".ref-123"), []byte("partial"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(refsDir, "v1"), []byte(commit+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	revisions, err := s.Revisions("acme/m")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := strings.Join(revisions, ","), "main,v1,"+commit; got != want {
+		t.Errorf("revisions = %s, want %s", got, want)
+	}
+	if sha, err := s.getRepoSha("acme/m", "v1"); err != nil || sha != commit {
+		t.Errorf("getRepoSha(v1) = %q, %v, want %s", sha, err, commit)
+	}
+}
@@ -0,0 +1,88 @@
+package filestorage
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/lengrongfu/LLMDistribution/pkg/api/model"
+)
+
+// hasModelIndexFile reports whether the model ships a .modeindex file
+func (s *Storage) hasModelIndexFile(modelID string) bool {
+	_, err := os.Stat(s.layout.IndexPath(modelID))
+	return err == nil
+}
+
+// StreamModelIndex builds the model index of a version from its snapshot and writes it
+// to w, encoding each sibling as the snapshot is walked so the siblings of repositories
+// with a very large number of files are never held in memory. Nothing is written when
+// the version can not be resolved.
+func (s *Storage) StreamModelIndex(modelID, version string, w io.Writer) error {
+	sha, err := s.getRepoSha(modelID, version)
+	if err != nil {
+		return err
+	}
+	snapshotDir := s.layout.SnapshotPath(modelID, sha, "")
+	info, err := os.Stat(snapshotDir)
+	if err != nil {
+		return fmt.Errorf("snapshot not found: %s", snapshotDir)
+	}
+
+	modTime := info.ModTime().UTC()
+	var metadata Model
+	readModelMetadata(snapshotDir, &metadata)
+	config, safetensors := modelConfigInfo(&metadata)
+	header, err := json.Marshal(model.ModelIndexInfo{
+		ID:           modelID,
+		ModelID:      modelID,
+		Author:       strings.Split(modelID, "/")[0],
+		SHA:          sha,
+		LastModified: modTime,
+		CreatedAt:    modTime,
+		Config:       config,
+		Safetensors:  safetensors,
+	})
+	if err != nil {
+		return err
+	}
+	// The total size is only known after the walk, so the encoded header is cut
+	// before usedStorage and the siblings and usedStorage is written last
+	header = header[:strings.Index(string(header), `,"usedStorage"`)]
+
+	bw := bufio.NewWriterSize(w, 32*1024)
+	bw.Write(header)
+	bw.WriteString(`,"siblings":[`)
+	var (
+		totalSize int64
+		count     int
+	)
+	err = walkSnapshot(snapshotDir, snapshotDir, true, func(entry model.TreeEntry) error {
+		if entry.Type != model.TreeEntryFile {
+			return nil
+		}
+		sibling := Sibling{Rfilename: entry.Path, Size: entry.Size}
+		if entry.Oid != "" {
+			sibling = newSibling(entry.Path, entry.Oid, entry.Size)
+		}
+		data, err := json.Marshal(sibling)
+		if err != nil {
+			return err
+		}
+		if count > 0 {
+			bw.WriteByte(',')
+		}
+		count++
+		totalSize += entry.Size
+		_, err = bw.Write(data)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to walk model directory: %w", err)
+	}
+	fmt.Fprintf(bw, `],"usedStorage":%d}`+"\n", totalSize)
+	return bw.Flush()
+}
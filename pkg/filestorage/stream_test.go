@@ -0,0 +1,86 @@
+package filestorage
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/lengrongfu/LLMDistribution/pkg/api/model"
+)
+
+// countingWriter counts the writes it receives
+type countingWriter struct {
+	bytes.Buffer
+	writes int
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.writes++
+	return w.Buffer.Write(p)
+}
+
+func TestStreamModelIndex(t *testing.T) {
+	tests := []struct {
+		name  string
+		files int
+	}{
+		{"single file", 1},
+		{"large repository", 2000},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestStorage(t)
+			sha, _, err := s.StoreSnapshotFile("acme/m", "main", "config.json", strings.NewReader("{}"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			dir := s.layout.SnapshotPath("acme/m", sha, "shards")
+			if err := os.MkdirAll(dir, 0755); err != nil {
+				t.Fatal(err)
+			}
+			for i := 1; i < tt.files; i++ {
+				if err := os.WriteFile(filepath.Join(dir, fmt.Sprintf("shard-%05d.bin", i)), []byte("x"), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			var w countingWriter
+			if err := s.StreamModelIndex("acme/m", "main", &w); err != nil {
+				t.Fatal(err)
+			}
+			var streamed model.ModelIndexInfo
+			if err := json.Unmarshal(w.Bytes(), &streamed); err != nil {
+				t.Fatalf("invalid JSON: %v", err)
+			}
+			built, err := s.buildModelIndex("acme/m", "main")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if streamed.SHA != sha || len(streamed.Siblings) != tt.files || len(built.Siblings) != tt.files {
+				t.Errorf("sha %s with %d siblings, built %d, want %s with %d", streamed.SHA, len(streamed.Siblings), len(built.Siblings), sha, tt.files)
+			}
+			if streamed.UsedStorage != int64(tt.files+1) {
+				t.Errorf("usedStorage = %d, want %d", streamed.UsedStorage, tt.files+1)
+			}
+			// a large index is flushed while the snapshot is walked instead of at once
+			if tt.files > 1000 && w.writes < 2 {
+				t.Errorf("index written in %d writes, want it streamed", w.writes)
+			}
+		})
+	}
+}
+
+func TestStreamModelIndexMissingVersion(t *testing.T) {
+	s := newTestStorage(t)
+	var w bytes.Buffer
+	if err := s.StreamModelIndex("acme/m", "main", &w); err == nil {
+		t.Fatal("StreamModelIndex() error = nil, want an error")
+	}
+	if w.Len() != 0 {
+		t.Errorf("wrote %q for a missing version", w.String())
+	}
+}
@@ -0,0 +1,92 @@
+package filestorage
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+
+	"github.com/lengrongfu/LLMDistribution/pkg/api/model"
+	"github.com/lengrongfu/LLMDistribution/pkg/utils"
+)
+
+// ListTree lists the files and directories below dir of a snapshot, paths are
+// relative to the snapshot root. With recursive the whole subtree is listed. Parent
+// segments of dir are cleaned, they never leave the snapshot.
+func (s *Storage) ListTree(modelID, sha, dir string, recursive bool) ([]model.TreeEntry, error) {
+	snapshotDir := s.layout.SnapshotPath(modelID, sha, "")
+	root := filepath.Join(snapshotDir, filepath.FromSlash(utils.NormalizeRepoPath(dir)))
+	if info, err := os.Stat(root); err != nil || !info.IsDir() {
+		return nil, fmt.Errorf("directory not found: %s/%s", modelID, dir)
+	}
+
+	entries := make([]model.TreeEntry, 0)
+	err := walkSnapshot(snapshotDir, root, recursive, func(entry model.TreeEntry) error {
+		entries = append(entries, entry)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to walk snapshot directory: %w", err)
+	}
+	return entries, nil
+}
+
+// walkSnapshot calls fn for each file and directory below root of a snapshot, entry
+// paths are relative to snapshotDir. Without recursive only the direct children of
+// root are visited. Links to a missing blob, e.g. one evicted or left behind by an
+// interrupted download, are skipped with a warning.
+func walkSnapshot(snapshotDir, root string, recursive bool, fn func(model.TreeEntry) error) error {
+	return filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if path == root {
+			return nil
+		}
+		relPath, err := filepath.Rel(snapshotDir, path)
+		if err != nil {
+			return err
+		}
+		relPath = filepath.ToSlash(relPath)
+		if d.IsDir() {
+			if err := fn(model.TreeEntry{Type: model.TreeEntryDirectory, Path: relPath}); err != nil {
+				return err
+			}
+			if !recursive {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		entry, err := treeFileEntry(path, relPath)
+		if errors.Is(err, fs.ErrNotExist) {
+			slog.Warn("skipping file with a missing blob", "file", relPath, "snapshot", snapshotDir, "error", err)
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		return fn(entry)
+	})
+}
+
+// treeFileEntry describes a snapshot file, the oid is the etag of the blob it links to
+func treeFileEntry(path, relPath string) (model.TreeEntry, error) {
+	info, err := statBlob(path)
+	if err != nil {
+		return model.TreeEntry{}, err
+	}
+	entry := model.TreeEntry{Type: model.TreeEntryFile, Path: relPath, Size: info.Size()}
+	target, err := os.Readlink(path)
+	if err != nil {
+		// a regular file written by an upload has no blob
+		return entry, nil
+	}
+	sibling := newSibling(relPath, blobEtag(target), info.Size())
+	entry.Oid = sibling.BlobID
+	if sibling.LFS != nil {
+		entry.LFS = &model.LFSInfo{SHA256: sibling.LFS.SHA256, Size: sibling.LFS.Size}
+	}
+	return entry, nil
+}
@@ -0,0 +1,119 @@
+package filestorage
+
+import (
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/lengrongfu/LLMDistribution/pkg/api/model"
+)
+
+func TestListTree(t *testing.T) {
+	s := newTestStorage(t)
+	var sha string
+	for _, name := range []string{"config.json", "sub/a.json", "sub/deep/b.json"} {
+		commit, _, err := s.StoreSnapshotFile("acme/m", "main", name, strings.NewReader("{}"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		sha = commit
+	}
+
+	tests := []struct {
+		name      string
+		dir       string
+		recursive bool
+		want      []string
+		wantErr   bool
+	}{
+		{"root", "", false, []string{"config.json", "sub/"}, false},
+		{"subdirectory", "sub", false, []string{"sub/a.json", "sub/deep/"}, false},
+		{"recursive", "sub", true, []string{"sub/a.json", "sub/deep/", "sub/deep/b.json"}, false},
+		{"parent segments stay in the snapshot", "../..", false, []string{"config.json", "sub/"}, false},
+		{"missing directory", "other", false, nil, true},
+		{"file", "config.json", false, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entries, err := s.ListTree("acme/m", sha, tt.dir, tt.recursive)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("ListTree = %+v, want an error", entries)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ListTree: %v", err)
+			}
+			var got []string
+			for _, entry := range entries {
+				if entry.Type == model.TreeEntryDirectory {
+					got = append(got, entry.Path+"/")
+					continue
+				}
+				if entry.Size != 2 || entry.Oid == "" {
+					t.Errorf("entry %+v", entry)
+				}
+				got = append(got, entry.Path)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("entries = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWalkSnapshotSkipsMissingBlobs(t *testing.T) {
+	s := newTestStorage(t)
+	sha, _, err := s.StoreSnapshotFile("acme/m", "main", "config.json", strings.NewReader("{}"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, etag, err := s.StoreSnapshotFile("acme/m", "main", "sub/model.bin", strings.NewReader("weights"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the blob was evicted, its snapshot link is left dangling
+	if err := os.Remove(s.layout.BlobPath("acme/m", etag)); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		files func() ([]string, error)
+	}{
+		{"tree", func() ([]string, error) {
+			entries, err := s.ListTree("acme/m", sha, "", true)
+			var files []string
+			for _, entry := range entries {
+				if entry.Type == model.TreeEntryFile {
+					files = append(files, entry.Path)
+				}
+			}
+			return files, err
+		}},
+		{"model index", func() ([]string, error) {
+			index, err := s.buildModelIndex("acme/m", "main")
+			if err != nil {
+				return nil, err
+			}
+			var files []string
+			for _, sibling := range index.Siblings {
+				files = append(files, sibling.Rfilename)
+			}
+			return files, nil
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			files, err := tt.files()
+			if err != nil {
+				t.Fatalf("walking the snapshot failed on the missing blob: %v", err)
+			}
+			if want := []string{"config.json"}; !reflect.DeepEqual(files, want) {
+				t.Fatalf("files = %v, want %v", files, want)
+			}
+		})
+	}
+}
@@ -5,9 +5,12 @@ import (
 	"io"
 	"io/fs"
 	"os"
+	"os/exec"
 	"path/filepath"
 
+	"github.com/lengrongfu/LLMDistribution/pkg/api"
 	"github.com/lengrongfu/LLMDistribution/pkg/api/model"
+	"github.com/lengrongfu/LLMDistribution/pkg/utils"
 )
 
 // Distribution implements the api.Distribution interface for Git storage
@@ -27,19 +30,55 @@ func NewDistribution(baseDir string, useLFS bool) (*Distribution, error) {
 	}, nil
 }
 
+// CheckHealth verifies that the git binary is installed and the storage directory is usable
+func (d *Distribution) CheckHealth() error {
+	if _, err := exec.LookPath("git"); err != nil {
+		return fmt.Errorf("git binary not found: %w", err)
+	}
+	return utils.CheckWritableDir(d.Storage.baseDir)
+}
+
 // StoreFile stores a file in Git storage
 func (d *Distribution) StoreFile(modelID, filename string, content io.Reader) (string, error) {
 	return d.Storage.StoreFile(modelID, filename, content)
 }
 
-// GetFile retrieves a file from Git storage
+// StoreFiles stores several files in Git storage with a single commit
+func (d *Distribution) StoreFiles(modelID string, files map[string]io.Reader) ([]string, error) {
+	return d.Storage.StoreFiles(modelID, files)
+}
+
+// ListModels lists the repositories in Git storage
+func (d *Distribution) ListModels() ([]model.CachedModel, error) {
+	return d.Storage.ListModels()
+}
+
+// GetFile retrieves a file as of commit sha from Git storage
 func (d *Distribution) GetFile(modelID, sha, filename string) (io.ReadSeeker, error) {
-	return d.Storage.GetFile(modelID, filename)
+	path, err := d.Storage.SnapshotFile(modelID, sha, filename)
+	if err != nil {
+		return nil, fmt.Errorf("file not found: %s: %w", filename, err)
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file: %w", err)
+	}
+	return file, nil
 }
 
-// FileExists checks if a file exists in Git storage
+// FileExists checks if a file exists in Git storage at commit sha
 func (d *Distribution) FileExists(modelID, sha, filename string) (fs.FileInfo, bool) {
-	return d.Storage.FileExists(modelID, filename)
+	path, err := d.Storage.SnapshotFile(modelID, sha, filename)
+	if err != nil {
+		return nil, false
+	}
+	info, err := os.Stat(path)
+	return info, err == nil
+}
+
+// Revisions lists the branches and tags of a model
+func (d *Distribution) Revisions(modelID string) ([]string, error) {
+	return d.Storage.Revisions(modelID)
 }
 
 // ListFiles lists all files in Git storage for a model
@@ -77,15 +116,21 @@ func (d *Distribution) GetStorageInfo(modelID string) (int64, error) {
 }
 
 func (d *Distribution) RepoInfo(modelID, version string) (model.ModelIndexInfo, error) {
-	return model.ModelIndexInfo{}, nil
+	return model.ModelIndexInfo{}, fmt.Errorf("%w: git storage does not provide model index", api.ErrUnsupportedOperation)
 }
 
 func (d *Distribution) FileEtag(modelID, sha, filename string) string {
-	return ""
+	return d.Storage.FileEtag(modelID, sha, filename)
 }
 
+// RepoSha resolves a branch, tag or commit of a model to its commit, "" when the
+// revision does not exist
 func (d *Distribution) RepoSha(modelID, version string) string {
-	return ""
+	sha, err := d.Storage.ResolveRevision(modelID, version)
+	if err != nil {
+		return ""
+	}
+	return sha
 }
 
 // Model-related methods removed - not needed
@@ -0,0 +1,165 @@
+package git
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// snapshotDir holds the files of commits extracted from the repositories, laid out
+// as <model>/<sha>/<filename> like the snapshots of the file storage
+const snapshotDir = ".snapshots"
+
+// lfsPointerPrefix starts the content of a Git LFS pointer file
+const lfsPointerPrefix = "version https://git-lfs.github.com/spec/"
+
+// maxLFSPointerSize bounds the size of a blob that is inspected as an LFS pointer
+const maxLFSPointerSize = 1024
+
+// ResolveRevision returns the commit a branch, tag or commit of a model points to.
+// "main" and "master" resolve to HEAD when the repository has no such branch, as
+// the default branch name depends on the git configuration.
+func (s *Storage) ResolveRevision(modelID, revision string) (string, error) {
+	repoPath := filepath.Join(s.baseDir, modelID)
+	if _, err := os.Stat(filepath.Join(repoPath, ".git")); err != nil {
+		return "", fmt.Errorf("repository not found: %s", modelID)
+	}
+	if strings.HasPrefix(revision, "-") {
+		return "", fmt.Errorf("invalid revision %q", revision)
+	}
+	sha, err := s.git(repoPath, "rev-parse", "--verify", "--quiet", revision+"^{commit}")
+	if err != nil && (revision == "main" || revision == "master") {
+		sha, err = s.git(repoPath, "rev-parse", "--verify", "--quiet", "HEAD^{commit}")
+	}
+	if err != nil {
+		return "", fmt.Errorf("revision %s of %s not found", revision, modelID)
+	}
+	return strings.TrimSpace(string(sha)), nil
+}
+
+// Revisions lists the branches and tags of a model repository
+func (s *Storage) Revisions(modelID string) ([]string, error) {
+	repoPath := filepath.Join(s.baseDir, modelID)
+	if _, err := os.Stat(filepath.Join(repoPath, ".git")); err != nil {
+		return nil, err
+	}
+	output, err := s.git(repoPath, "for-each-ref", "--format=%(refname:short)", "refs/heads", "refs/tags")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list refs: %w", err)
+	}
+	return strings.Fields(string(output)), nil
+}
+
+// SnapshotFile returns the path of filename as of commit sha, extracting it from the
+// repository the first time it is requested. LFS files are extracted with their
+// content rather than their pointer. fs.ErrNotExist is returned when the commit has
+// no such file.
+func (s *Storage) SnapshotFile(modelID, sha, filename string) (string, error) {
+	if !isCommitSha(sha) {
+		return "", fmt.Errorf("invalid commit %q", sha)
+	}
+	if !filepath.IsLocal(filepath.FromSlash(filename)) {
+		return "", fs.ErrNotExist
+	}
+	snapshotPath := filepath.Join(s.baseDir, snapshotDir, modelID, sha, filepath.FromSlash(filename))
+	if _, err := os.Stat(snapshotPath); err == nil {
+		return snapshotPath, nil
+	}
+
+	repoPath := filepath.Join(s.baseDir, modelID)
+	object := sha + ":" + filepath.ToSlash(filename)
+	objectType, err := s.git(repoPath, "cat-file", "-t", object)
+	if err != nil {
+		return "", fs.ErrNotExist
+	}
+	if strings.TrimSpace(string(objectType)) == "tree" {
+		return snapshotPath, os.MkdirAll(snapshotPath, 0755)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(snapshotPath), 0755); err != nil {
+		return "", fmt.Errorf("failed to create snapshot directory: %w", err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(snapshotPath), filepath.Base(snapshotPath)+".*.incomplete")
+	if err != nil {
+		return "", fmt.Errorf("failed to create snapshot file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	cmd := exec.Command("git", "cat-file", "--filters", object)
+	cmd.Dir = repoPath
+	cmd.Stdout = tmp
+	err = cmd.Run()
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to extract %s: %w", object, err)
+	}
+	if err := os.Rename(tmp.Name(), snapshotPath); err != nil {
+		return "", fmt.Errorf("failed to write snapshot file: %w", err)
+	}
+	return snapshotPath, nil
+}
+
+// FileEtag returns the etag of filename as of commit sha the way the Hugging Face
+// hub reports it, the SHA-256 of LFS files and the git blob id of other files
+func (s *Storage) FileEtag(modelID, sha, filename string) string {
+	if !isCommitSha(sha) {
+		return ""
+	}
+	repoPath := filepath.Join(s.baseDir, modelID)
+	object := sha + ":" + filepath.ToSlash(filename)
+	blobID, err := s.git(repoPath, "rev-parse", "--verify", "--quiet", object)
+	if err != nil {
+		return ""
+	}
+	// only small blobs can be LFS pointers, large files are not read
+	size, err := s.git(repoPath, "cat-file", "-s", object)
+	if n, _ := strconv.Atoi(strings.TrimSpace(string(size))); err == nil && n < maxLFSPointerSize {
+		content, err := s.git(repoPath, "cat-file", "blob", object)
+		if err == nil && bytes.HasPrefix(content, []byte(lfsPointerPrefix)) {
+			if oid := lfsPointerOid(content); oid != "" {
+				return oid
+			}
+		}
+	}
+	return strings.TrimSpace(string(blobID))
+}
+
+// lfsPointerOid returns the SHA-256 a Git LFS pointer file refers to
+func lfsPointerOid(pointer []byte) string {
+	scanner := bufio.NewScanner(bytes.NewReader(pointer))
+	for scanner.Scan() {
+		if oid, ok := strings.CutPrefix(scanner.Text(), "oid sha256:"); ok {
+			return oid
+		}
+	}
+	return ""
+}
+
+// git runs a git command in a repository and returns its output
+func (s *Storage) git(repoPath string, args ...string) ([]byte, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = repoPath
+	cmd.Stderr = io.Discard
+	return cmd.Output()
+}
+
+// isCommitSha reports whether s looks like a full git commit sha
+func isCommitSha(s string) bool {
+	if len(s) != 40 {
+		return false
+	}
+	for _, c := range s {
+		if !strings.ContainsRune("0123456789abcdef", c) {
+			return false
+		}
+	}
+	return true
+}
@@ -7,7 +7,12 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
+
+	"github.com/lengrongfu/LLMDistribution/pkg/api/model"
+	"github.com/lengrongfu/LLMDistribution/pkg/utils"
 )
 
 // Storage represents a Git storage system
@@ -16,6 +21,8 @@ type Storage struct {
 	baseDir string
 	// Whether to use Git LFS
 	useLFS bool
+	// Template of the commit messages, see WithCommitTemplate
+	commitTemplate string
 }
 
 // NewStorage creates a new Git storage
@@ -26,21 +33,95 @@ func NewStorage(baseDir string, useLFS bool) (*Storage, error) {
 	}
 
 	return &Storage{
-		baseDir: baseDir,
-		useLFS:  useLFS,
+		baseDir:        baseDir,
+		useLFS:         useLFS,
+		commitTemplate: DefaultCommitTemplate,
 	}, nil
 }
 
+// DefaultCommitTemplate is the commit message template used when none is configured
+const DefaultCommitTemplate = "Add {filename}"
+
+// WithCommitTemplate sets the template of the commit messages of stored files. The
+// placeholders {filename}, {modelID} and {count} are replaced by the committed file
+// names, the model ID and the number of committed files.
+func (s *Storage) WithCommitTemplate(template string) {
+	if template == "" {
+		template = DefaultCommitTemplate
+	}
+	s.commitTemplate = template
+}
+
+// commitMessage renders the commit message template for the files committed to a model
+func (s *Storage) commitMessage(modelID string, filenames []string) string {
+	template := s.commitTemplate
+	if template == "" {
+		template = DefaultCommitTemplate
+	}
+	return strings.NewReplacer(
+		"{filename}", strings.Join(filenames, ", "),
+		"{modelID}", modelID,
+		"{count}", strconv.Itoa(len(filenames)),
+	).Replace(template)
+}
+
 // StoreFile stores a file in the Git repository
 func (s *Storage) StoreFile(modelID, filename string, content io.Reader) (string, error) {
+	paths, err := s.StoreFiles(modelID, map[string]io.Reader{filename: content})
+	if err != nil {
+		return "", err
+	}
+	return paths[0], nil
+}
+
+// StoreFiles stores several files in the Git repository with a single commit and
+// returns their paths in the order of the sorted file names
+func (s *Storage) StoreFiles(modelID string, files map[string]io.Reader) ([]string, error) {
+	if !utils.ValidModelID(modelID) {
+		return nil, fmt.Errorf("%w: model %q", utils.ErrInvalidPath, modelID)
+	}
 	// Initialize the repository if it doesn't exist
 	repoPath, err := s.initRepository(modelID)
 	if err != nil {
-		return "", fmt.Errorf("failed to initialize repository: %w", err)
+		return nil, fmt.Errorf("failed to initialize repository: %w", err)
 	}
 
-	// Create the file path
-	filePath := filepath.Join(repoPath, filename)
+	filenames := make([]string, 0, len(files))
+	for filename := range files {
+		filenames = append(filenames, filename)
+	}
+	sort.Strings(filenames)
+
+	paths := make([]string, 0, len(filenames))
+	for _, filename := range filenames {
+		filePath, err := s.addFile(repoPath, filename, files[filename])
+		if err != nil {
+			return nil, err
+		}
+		paths = append(paths, filePath)
+	}
+
+	// Commit the changes
+	cmd := exec.Command("git", "commit", "-m", s.commitMessage(modelID, filenames))
+	cmd.Dir = repoPath
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("failed to commit changes: %w", err)
+	}
+
+	return paths, nil
+}
+
+// addFile writes a file into the repository and stages it. File names that would
+// resolve outside of the work tree or into its .git directory are rejected.
+func (s *Storage) addFile(repoPath, filename string, content io.Reader) (string, error) {
+	filename, err := utils.CleanRepoPath(filename)
+	if err != nil {
+		return "", err
+	}
+	if strings.EqualFold(strings.Split(filename, "/")[0], ".git") {
+		return "", fmt.Errorf("%w: %q", utils.ErrInvalidPath, filename)
+	}
+	filePath := filepath.Join(repoPath, filepath.FromSlash(filename))
 
 	// Create the directory if it doesn't exist
 	if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
@@ -72,19 +153,12 @@ func (s *Storage) StoreFile(modelID, filename string, content io.Reader) (string
 	}
 
 	// Add the file to Git
-	cmd := exec.Command("git", "add", filename)
+	cmd := exec.Command("git", "add", "--", filename)
 	cmd.Dir = repoPath
 	if err := cmd.Run(); err != nil {
 		return "", fmt.Errorf("failed to add file to Git: %w", err)
 	}
 
-	// Commit the changes
-	cmd = exec.Command("git", "commit", "-m", fmt.Sprintf("Add %s", filename))
-	cmd.Dir = repoPath
-	if err := cmd.Run(); err != nil {
-		return "", fmt.Errorf("failed to commit changes: %w", err)
-	}
-
 	return filePath, nil
 }
 
@@ -156,6 +230,30 @@ func (s *Storage) ListFiles(modelID string) ([]string, error) {
 	return result, nil
 }
 
+// ListModels lists the repositories below the base directory, a model is an
+// org/name directory holding a .git directory
+func (s *Storage) ListModels() ([]model.CachedModel, error) {
+	repos, err := filepath.Glob(filepath.Join(s.baseDir, "*", "*", ".git"))
+	if err != nil {
+		return nil, err
+	}
+	var models []model.CachedModel
+	for _, gitDir := range repos {
+		repoPath := filepath.Dir(gitDir)
+		info, err := os.Stat(repoPath)
+		if err != nil {
+			continue
+		}
+		rel, err := filepath.Rel(s.baseDir, repoPath)
+		if err != nil {
+			continue
+		}
+		models = append(models, model.CachedModel{ID: filepath.ToSlash(rel), LastModified: info.ModTime()})
+	}
+	sort.Slice(models, func(i, j int) bool { return models[i].ID < models[j].ID })
+	return models, nil
+}
+
 // initRepository initializes a Git repository
 func (s *Storage) initRepository(repoName string) (string, error) {
 	repoPath := filepath.Join(s.baseDir, repoName)
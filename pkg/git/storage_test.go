@@ -0,0 +1,154 @@
+package git
+
+import (
+	"errors"
+	"io"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/lengrongfu/LLMDistribution/pkg/utils"
+)
+
+// newTestStorage creates a git storage below a temporary directory, skipping the test
+// when git is not installed
+func newTestStorage(t *testing.T) *Storage {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	s, err := NewStorage(t.TempDir(), false)
+	if err != nil {
+		t.Fatalf("NewStorage: %v", err)
+	}
+	return s
+}
+
+func TestStoreFileRejectsTraversal(t *testing.T) {
+	s := newTestStorage(t)
+	tests := []struct {
+		name     string
+		modelID  string
+		filename string
+	}{
+		{"parent segments", "acme/m", "../../escaped"},
+		{"absolute path", "acme/m", "/tmp/escaped"},
+		{"git directory", "acme/m", ".git/hooks/post-commit"},
+		{"git directory case", "acme/m", ".GIT/config"},
+		{"model ID", "../escaped", "config.json"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := s.StoreFile(tt.modelID, tt.filename, strings.NewReader("pwned"))
+			if !errors.Is(err, utils.ErrInvalidPath) {
+				t.Fatalf("StoreFile(%q, %q) = %v, want ErrInvalidPath", tt.modelID, tt.filename, err)
+			}
+		})
+	}
+}
+
+func TestCommitMessage(t *testing.T) {
+	tests := []struct {
+		name     string
+		template string
+		files    map[string]string
+		want     string
+	}{
+		{"default", "", map[string]string{"config.json": "{}"}, "Add config.json"},
+		{"placeholders", "Sync {count} files of {modelID}: {filename}",
+			map[string]string{"config.json": "{}", "model.bin": "weights"},
+			"Sync 2 files of acme/m: config.json, model.bin"},
+		{"no placeholders", "Mirror update", map[string]string{"config.json": "{}"}, "Mirror update"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestStorage(t)
+			s.WithCommitTemplate(tt.template)
+			files := make(map[string]io.Reader)
+			for name, content := range tt.files {
+				files[name] = strings.NewReader(content)
+			}
+			if _, err := s.StoreFiles("acme/m", files); err != nil {
+				t.Fatal(err)
+			}
+			repoPath, err := s.initRepository("acme/m")
+			if err != nil {
+				t.Fatal(err)
+			}
+			cmd := exec.Command("git", "log", "-1", "--format=%s")
+			cmd.Dir = repoPath
+			out, err := cmd.Output()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := strings.TrimSpace(string(out)); got != tt.want {
+				t.Errorf("commit message = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDistributionResolvesByCommit(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	d, err := NewDistribution(t.TempDir(), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.StoreFile("acme/m", "config.json", strings.NewReader("v1")); err != nil {
+		t.Fatal(err)
+	}
+	first := d.RepoSha("acme/m", "main")
+	if _, err := d.StoreFiles("acme/m", map[string]io.Reader{
+		"config.json":   strings.NewReader("v2"),
+		"sub/model.bin": strings.NewReader("weights"),
+	}); err != nil {
+		t.Fatal(err)
+	}
+	second := d.RepoSha("acme/m", "main")
+	if !isCommitSha(first) || !isCommitSha(second) || first == second {
+		t.Fatalf("commits %q and %q", first, second)
+	}
+
+	tests := []struct {
+		name     string
+		sha      string
+		filename string
+		want     string
+		exists   bool
+	}{
+		{"old commit", first, "config.json", "v1", true},
+		{"new commit", second, "config.json", "v2", true},
+		{"nested file", second, "sub/model.bin", "weights", true},
+		{"file added later", first, "sub/model.bin", "", false},
+		{"unknown commit", strings.Repeat("0", 40), "config.json", "", false},
+		{"ref instead of commit", "main", "config.json", "", false},
+		{"traversal", second, "../../escaped", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, exists := d.FileExists("acme/m", tt.sha, tt.filename); exists != tt.exists {
+				t.Fatalf("FileExists = %v, want %v", exists, tt.exists)
+			}
+			r, err := d.GetFile("acme/m", tt.sha, tt.filename)
+			if !tt.exists {
+				if err == nil {
+					t.Fatal("GetFile() error = nil, want an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer r.(io.Closer).Close()
+			data, _ := io.ReadAll(r)
+			if string(data) != tt.want {
+				t.Errorf("content = %q, want %q", data, tt.want)
+			}
+		})
+	}
+	if etag := d.FileEtag("acme/m", first, "config.json"); etag == "" || etag == d.FileEtag("acme/m", second, "config.json") {
+		t.Errorf("etag of config.json at %s = %q, want the blob id of v1", first, etag)
+	}
+}
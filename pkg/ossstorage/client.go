@@ -0,0 +1,130 @@
+package ossstorage
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/aliyun/aliyun-oss-go-sdk/oss"
+)
+
+// ErrObjectNotFound is returned by a Client for keys that are not in the bucket
+var ErrObjectNotFound = errors.New("object not found")
+
+// etagMeta is the user metadata holding the SHA-256 etag of a stored file
+const etagMeta = "etag"
+
+// ObjectInfo describes an object of the bucket
+type ObjectInfo struct {
+	Key     string
+	Size    int64
+	ModTime time.Time
+	// Etag is the etag of the file from the object metadata, empty for objects
+	// listed or stored without one
+	Etag string
+}
+
+// Client is the part of an OSS bucket the storage uses, implemented by the SDK
+// bucket returned by NewBucketClient
+type Client interface {
+	// PutObject stores content at key with the etag of the file in its metadata
+	PutObject(key string, content io.Reader, etag string) error
+	// GetObject reads an object from offset to its end
+	GetObject(key string, offset int64) (io.ReadCloser, error)
+	// HeadObject returns the size, modification time and etag of an object
+	HeadObject(key string) (ObjectInfo, error)
+	// ListObjects lists up to limit objects whose keys start with prefix, all of them
+	// when limit <= 0
+	ListObjects(prefix string, limit int) ([]ObjectInfo, error)
+}
+
+// bucketClient implements Client with the Aliyun OSS SDK
+type bucketClient struct {
+	bucket *oss.Bucket
+}
+
+// NewBucketClient connects to bucket at endpoint, like "oss-cn-hangzhou.aliyuncs.com",
+// with the AccessKey pair of a RAM user
+func NewBucketClient(endpoint, bucket, accessKeyID, accessKeySecret string) (Client, error) {
+	client, err := oss.New(endpoint, accessKeyID, accessKeySecret)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create OSS client: %w", err)
+	}
+	b, err := client.Bucket(bucket)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open OSS bucket %s: %w", bucket, err)
+	}
+	return &bucketClient{bucket: b}, nil
+}
+
+func (c *bucketClient) PutObject(key string, content io.Reader, etag string) error {
+	var options []oss.Option
+	if etag != "" {
+		options = append(options, oss.Meta(etagMeta, etag))
+	}
+	return c.bucket.PutObject(key, content, options...)
+}
+
+func (c *bucketClient) GetObject(key string, offset int64) (io.ReadCloser, error) {
+	var options []oss.Option
+	if offset > 0 {
+		options = append(options, oss.NormalizedRange(strconv.FormatInt(offset, 10)+"-"))
+	}
+	body, err := c.bucket.GetObject(key, options...)
+	return body, notFound(err)
+}
+
+func (c *bucketClient) HeadObject(key string) (ObjectInfo, error) {
+	header, err := c.bucket.GetObjectDetailedMeta(key)
+	if err != nil {
+		return ObjectInfo{}, notFound(err)
+	}
+	size, err := strconv.ParseInt(header.Get("Content-Length"), 10, 64)
+	if err != nil {
+		return ObjectInfo{}, fmt.Errorf("invalid size of object %s: %w", key, err)
+	}
+	modTime, _ := http.ParseTime(header.Get("Last-Modified"))
+	return ObjectInfo{
+		Key:     key,
+		Size:    size,
+		ModTime: modTime,
+		Etag:    header.Get(oss.HTTPHeaderOssMetaPrefix + etagMeta),
+	}, nil
+}
+
+func (c *bucketClient) ListObjects(prefix string, limit int) ([]ObjectInfo, error) {
+	var objects []ObjectInfo
+	token := ""
+	for {
+		options := []oss.Option{oss.Prefix(prefix)}
+		if token != "" {
+			options = append(options, oss.ContinuationToken(token))
+		}
+		if limit > 0 {
+			options = append(options, oss.MaxKeys(min(limit-len(objects), 1000)))
+		}
+		result, err := c.bucket.ListObjectsV2(options...)
+		if err != nil {
+			return nil, err
+		}
+		for _, object := range result.Objects {
+			objects = append(objects, ObjectInfo{Key: object.Key, Size: object.Size, ModTime: object.LastModified})
+		}
+		if !result.IsTruncated || (limit > 0 && len(objects) >= limit) {
+			return objects, nil
+		}
+		token = result.NextContinuationToken
+	}
+}
+
+// notFound converts the OSS error of a missing object to ErrObjectNotFound
+func notFound(err error) error {
+	var serviceErr oss.ServiceError
+	if errors.As(err, &serviceErr) && serviceErr.StatusCode == http.StatusNotFound {
+		return ErrObjectNotFound
+	}
+	return err
+}
@@ -0,0 +1,82 @@
+package ossstorage
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/lengrongfu/LLMDistribution/pkg/api/model"
+)
+
+// Distribution implements the api.Distribution interface for OSS storage
+type Distribution struct {
+	Storage *Storage // Exported for access in server
+}
+
+// Options configure the bucket of an OSS distribution
+type Options struct {
+	// Endpoint is the OSS endpoint of the region of the bucket, like "oss-cn-hangzhou.aliyuncs.com"
+	Endpoint string
+	Bucket   string
+	// AccessKeyID and AccessKeySecret are the AccessKey pair of a RAM user
+	AccessKeyID     string
+	AccessKeySecret string
+	// Prefix is the key prefix the models are stored below, like "hub"
+	Prefix string
+}
+
+// NewDistribution creates an OSS distribution storing the models in the configured bucket
+func NewDistribution(options Options) (*Distribution, error) {
+	client, err := NewBucketClient(options.Endpoint, options.Bucket, options.AccessKeyID, options.AccessKeySecret)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create OSS storage: %w", err)
+	}
+	return &Distribution{
+		Storage: NewStorage(client, options.Prefix),
+	}, nil
+}
+
+// StoreFile stores a file in the snapshot of the default revision
+func (d *Distribution) StoreFile(modelID, filename string, content io.Reader) (string, error) {
+	return d.Storage.StoreFile(modelID, filename, content)
+}
+
+// ListFiles lists the files of the default revision of a model
+func (d *Distribution) ListFiles(modelID string) ([]string, error) {
+	return d.Storage.ListFiles(modelID)
+}
+
+// GetStorageInfo sums the size of the objects of a model
+func (d *Distribution) GetStorageInfo(modelID string) (int64, error) {
+	return d.Storage.StorageSize(modelID)
+}
+
+// FileEtag gets the etag of a file from its object metadata
+func (d *Distribution) FileEtag(modelID, sha, filename string) string {
+	return d.Storage.FileEtag(modelID, sha, filename)
+}
+
+// FileExists checks if a file exists in the snapshot sha
+func (d *Distribution) FileExists(modelID, sha, filename string) (os.FileInfo, bool) {
+	return d.Storage.FileExists(modelID, sha, filename)
+}
+
+// GetFile retrieves a file of the snapshot sha
+func (d *Distribution) GetFile(modelID, sha, filename string) (io.ReadSeeker, error) {
+	return d.Storage.GetFile(modelID, sha, filename)
+}
+
+// RepoInfo returns the model index of a version
+func (d *Distribution) RepoInfo(modelID, version string) (model.ModelIndexInfo, error) {
+	return d.Storage.RepoInfo(modelID, version)
+}
+
+// RepoSha resolves a ref or commit of a model to its commit, "" when the revision
+// does not exist
+func (d *Distribution) RepoSha(modelID, version string) string {
+	sha, err := d.Storage.ResolveRevision(modelID, version)
+	if err != nil {
+		return ""
+	}
+	return sha
+}
@@ -0,0 +1,392 @@
+package ossstorage
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lengrongfu/LLMDistribution/pkg/api/model"
+	"github.com/lengrongfu/LLMDistribution/pkg/utils"
+)
+
+// Storage stores models in an OSS bucket in the Hugging Face cache layout, a
+// models--org--name prefix per model with its refs, snapshots and .modeindex as
+// objects. Object storage has no links, so the files of a snapshot are stored as
+// objects of their own with their etag in the object metadata.
+type Storage struct {
+	client Client
+	// layout builds the object keys of a model below the key prefix
+	layout utils.Layout
+	// defaultRevision is resolved for requests without a revision and receives
+	// the uploaded files
+	defaultRevision string
+	// refMu serializes the creation of refs by uploads
+	refMu sync.Mutex
+}
+
+// NewStorage creates a storage keeping the models below prefix, like "hub", in the
+// bucket of client
+func NewStorage(client Client, prefix string) *Storage {
+	return &Storage{
+		client:          client,
+		layout:          utils.NewLayout(strings.Trim(prefix, "/"), utils.LayoutHF),
+		defaultRevision: "main",
+	}
+}
+
+// WithDefaultRevision sets the revision resolved for requests that name none
+func (s *Storage) WithDefaultRevision(revision string) {
+	if revision != "" {
+		s.defaultRevision = revision
+	}
+}
+
+// key converts a path of the layout to an object key
+func key(path string) string {
+	return filepath.ToSlash(path)
+}
+
+// snapshotPrefix is the key prefix of the files of a snapshot
+func (s *Storage) snapshotPrefix(modelID, sha string) string {
+	return key(s.layout.SnapshotPath(modelID, sha, "")) + "/"
+}
+
+// ResolveRevision resolves a ref like "main" or a commit of a model to the commit of
+// its snapshot
+func (s *Storage) ResolveRevision(modelID, version string) (string, error) {
+	if version == "" {
+		version = s.defaultRevision
+	}
+	sha, err := s.readRef(modelID, version)
+	if err == nil {
+		return sha, nil
+	}
+	if !errors.Is(err, ErrObjectNotFound) {
+		return "", err
+	}
+	// a commit sha is served from its snapshot without a ref
+	if isCommitSha(version) {
+		objects, err := s.client.ListObjects(s.snapshotPrefix(modelID, version), 1)
+		if err != nil {
+			return "", err
+		}
+		if len(objects) > 0 {
+			return version, nil
+		}
+	}
+	return "", fmt.Errorf("revision %s of %s not found", version, modelID)
+}
+
+// readRef returns the commit a ref of a model points to
+func (s *Storage) readRef(modelID, ref string) (string, error) {
+	body, err := s.client.GetObject(key(s.layout.RefPath(modelID, ref)), 0)
+	if err != nil {
+		return "", err
+	}
+	defer body.Close()
+	data, err := io.ReadAll(io.LimitReader(body, 1024))
+	if err != nil {
+		return "", fmt.Errorf("failed to read ref %s of %s: %w", ref, modelID, err)
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// refCommit returns the commit a ref points to, pointing the ref at a new random
+// commit when it does not exist yet
+func (s *Storage) refCommit(modelID, ref string) (string, error) {
+	s.refMu.Lock()
+	defer s.refMu.Unlock()
+	sha, err := s.readRef(modelID, ref)
+	if err == nil {
+		if !isCommitSha(sha) {
+			return "", fmt.Errorf("ref %s of %s does not point to a commit", ref, modelID)
+		}
+		return sha, nil
+	}
+	if !errors.Is(err, ErrObjectNotFound) {
+		return "", err
+	}
+	commit := make([]byte, 20)
+	if _, err := rand.Read(commit); err != nil {
+		return "", err
+	}
+	sha = hex.EncodeToString(commit)
+	if err := s.client.PutObject(key(s.layout.RefPath(modelID, ref)), strings.NewReader(sha), ""); err != nil {
+		return "", fmt.Errorf("failed to write ref: %w", err)
+	}
+	return sha, nil
+}
+
+// isCommitSha reports whether s looks like a full git commit sha
+func isCommitSha(s string) bool {
+	if len(s) != 40 {
+		return false
+	}
+	for _, c := range s {
+		if !strings.ContainsRune("0123456789abcdef", c) {
+			return false
+		}
+	}
+	return true
+}
+
+// StoreFile stores a file in the snapshot of the default revision and returns its
+// object key. The content is spooled to a temporary file first, the etag the hub
+// reports for it is stored in the object metadata.
+func (s *Storage) StoreFile(modelID, filename string, content io.Reader) (string, error) {
+	filename = utils.NormalizeRepoPath(filename)
+	if filename == "" {
+		return "", fmt.Errorf("invalid file name")
+	}
+	tmp, err := os.CreateTemp("", "oss-upload-*")
+	if err != nil {
+		return "", fmt.Errorf("failed to create file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	h := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmp, h), content)
+	if err != nil {
+		return "", fmt.Errorf("failed to write file: %w", err)
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	etag := hex.EncodeToString(h.Sum(nil))
+	if !utils.IsLFSFile(filename, size) {
+		if etag, err = utils.GitBlobSHA1(tmp, size); err != nil {
+			return "", fmt.Errorf("failed to hash file: %w", err)
+		}
+		if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+			return "", err
+		}
+	}
+	// the file is received before the ref is created, so a failed upload leaves no new ref behind
+	sha, err := s.refCommit(modelID, s.defaultRevision)
+	if err != nil {
+		return "", err
+	}
+	objectKey := s.snapshotPrefix(modelID, sha) + filename
+	if err := s.client.PutObject(objectKey, tmp, etag); err != nil {
+		return "", fmt.Errorf("failed to store file: %w", err)
+	}
+	return objectKey, nil
+}
+
+// GetFile returns a reader of a file of the snapshot sha, the object is read with
+// ranged requests from the position the reader is seeked to
+func (s *Storage) GetFile(modelID, sha, filename string) (io.ReadSeeker, error) {
+	info, err := s.client.HeadObject(s.snapshotPrefix(modelID, sha) + filename)
+	if errors.Is(err, ErrObjectNotFound) {
+		return nil, fmt.Errorf("file not found: %s/%s", modelID, filename)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat file: %w", err)
+	}
+	return &objectReader{client: s.client, key: info.Key, size: info.Size}, nil
+}
+
+// FileExists stats a file of the snapshot sha
+func (s *Storage) FileExists(modelID, sha, filename string) (os.FileInfo, bool) {
+	info, err := s.client.HeadObject(s.snapshotPrefix(modelID, sha) + filename)
+	if err != nil {
+		return nil, false
+	}
+	return objectFileInfo{name: path.Base(filename), info: info}, true
+}
+
+// FileEtag returns the etag of a file of the snapshot sha from its object metadata
+func (s *Storage) FileEtag(modelID, sha, filename string) string {
+	info, err := s.client.HeadObject(s.snapshotPrefix(modelID, sha) + filename)
+	if err != nil {
+		return ""
+	}
+	return info.Etag
+}
+
+// ListFiles lists the files of the snapshot of the default revision
+func (s *Storage) ListFiles(modelID string) ([]string, error) {
+	sha, err := s.ResolveRevision(modelID, "")
+	if err != nil {
+		return nil, err
+	}
+	objects, err := s.snapshotObjects(modelID, sha)
+	if err != nil {
+		return nil, err
+	}
+	files := make([]string, len(objects))
+	for i, object := range objects {
+		files[i] = object.Key
+	}
+	return files, nil
+}
+
+// snapshotObjects lists the files of a snapshot sorted by name, the keys are made
+// relative to the snapshot
+func (s *Storage) snapshotObjects(modelID, sha string) ([]ObjectInfo, error) {
+	prefix := s.snapshotPrefix(modelID, sha)
+	objects, err := s.client.ListObjects(prefix, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list snapshot: %w", err)
+	}
+	files := objects[:0]
+	for _, object := range objects {
+		// keys ending with a slash are directory placeholders of OSS consoles
+		if name := strings.TrimPrefix(object.Key, prefix); name != "" && !strings.HasSuffix(name, "/") {
+			object.Key = name
+			files = append(files, object)
+		}
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Key < files[j].Key })
+	return files, nil
+}
+
+// StorageSize sums the size of the objects of a model
+func (s *Storage) StorageSize(modelID string) (int64, error) {
+	objects, err := s.client.ListObjects(key(s.layout.ModelDir(modelID))+"/", 0)
+	if err != nil {
+		return 0, err
+	}
+	if len(objects) == 0 {
+		return 0, fmt.Errorf("model not found: %s", modelID)
+	}
+	var size int64
+	for _, object := range objects {
+		size += object.Size
+	}
+	return size, nil
+}
+
+// RepoInfo returns the model index of a version, the stored .modeindex when it
+// describes the snapshot of the version and otherwise one built from the snapshot
+func (s *Storage) RepoInfo(modelID, version string) (model.ModelIndexInfo, error) {
+	sha, err := s.ResolveRevision(modelID, version)
+	if err != nil {
+		return model.ModelIndexInfo{}, err
+	}
+	if index, ok := s.storedIndex(modelID, sha); ok {
+		return index, nil
+	}
+
+	objects, err := s.snapshotObjects(modelID, sha)
+	if err != nil {
+		return model.ModelIndexInfo{}, err
+	}
+	index := model.ModelIndexInfo{
+		ID:       modelID,
+		ModelID:  modelID,
+		Author:   strings.Split(modelID, "/")[0],
+		SHA:      sha,
+		Siblings: make([]model.SiblingFile, 0, len(objects)),
+	}
+	for _, object := range objects {
+		index.Siblings = append(index.Siblings, model.SiblingFile{RFilename: object.Key, Size: object.Size})
+		index.UsedStorage += object.Size
+		if object.ModTime.After(index.LastModified) {
+			index.LastModified = object.ModTime
+		}
+	}
+	index.CreatedAt = index.LastModified
+	if index.LastModified.IsZero() {
+		index.LastModified = time.Now().UTC()
+		index.CreatedAt = index.LastModified
+	}
+	return index, nil
+}
+
+// storedIndex reads the .modeindex object of a model when it describes the snapshot sha
+func (s *Storage) storedIndex(modelID, sha string) (model.ModelIndexInfo, bool) {
+	body, err := s.client.GetObject(key(s.layout.IndexPath(modelID)), 0)
+	if err != nil {
+		return model.ModelIndexInfo{}, false
+	}
+	defer body.Close()
+	var index model.ModelIndexInfo
+	if err := json.NewDecoder(body).Decode(&index); err != nil || index.SHA != sha || len(index.Siblings) == 0 {
+		return model.ModelIndexInfo{}, false
+	}
+	return index, true
+}
+
+// objectFileInfo is the file info of a snapshot file stored as an object
+type objectFileInfo struct {
+	name string
+	info ObjectInfo
+}
+
+func (i objectFileInfo) Name() string       { return i.name }
+func (i objectFileInfo) Size() int64        { return i.info.Size }
+func (i objectFileInfo) Mode() fs.FileMode  { return 0444 }
+func (i objectFileInfo) ModTime() time.Time { return i.info.ModTime }
+func (i objectFileInfo) IsDir() bool        { return false }
+func (i objectFileInfo) Sys() any           { return i.info }
+
+// objectReader reads an object with ranged requests. Seeking only moves the read
+// position, the next read requests the object from there.
+type objectReader struct {
+	client Client
+	key    string
+	size   int64
+	pos    int64
+	body   io.ReadCloser
+}
+
+func (r *objectReader) Read(p []byte) (int, error) {
+	if r.pos >= r.size {
+		return 0, io.EOF
+	}
+	if r.body == nil {
+		body, err := r.client.GetObject(r.key, r.pos)
+		if err != nil {
+			return 0, err
+		}
+		r.body = body
+	}
+	n, err := r.body.Read(p)
+	r.pos += int64(n)
+	if err == io.EOF && r.pos < r.size {
+		err = io.ErrUnexpectedEOF
+	}
+	return n, err
+}
+
+func (r *objectReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += r.pos
+	case io.SeekEnd:
+		offset += r.size
+	}
+	if offset < 0 {
+		return 0, fmt.Errorf("seek to negative position %d", offset)
+	}
+	if offset != r.pos && r.body != nil {
+		r.body.Close()
+		r.body = nil
+	}
+	r.pos = offset
+	return offset, nil
+}
+
+// Close closes the pending object request
+func (r *objectReader) Close() error {
+	if r.body == nil {
+		return nil
+	}
+	err := r.body.Close()
+	r.body = nil
+	return err
+}
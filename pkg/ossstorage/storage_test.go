@@ -0,0 +1,368 @@
+package ossstorage
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lengrongfu/LLMDistribution/pkg/utils"
+)
+
+// memClient is a Client keeping the objects of a bucket in memory
+type memClient struct {
+	mu      sync.Mutex
+	objects map[string]memObject
+	// gets counts the GetObject requests
+	gets int
+}
+
+type memObject struct {
+	data    []byte
+	etag    string
+	modTime time.Time
+}
+
+func newMemClient() *memClient {
+	return &memClient{objects: map[string]memObject{}}
+}
+
+func (c *memClient) PutObject(key string, content io.Reader, etag string) error {
+	data, err := io.ReadAll(content)
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.objects[key] = memObject{data: data, etag: etag, modTime: time.Now().UTC()}
+	return nil
+}
+
+func (c *memClient) GetObject(key string, offset int64) (io.ReadCloser, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.gets++
+	object, ok := c.objects[key]
+	if !ok {
+		return nil, ErrObjectNotFound
+	}
+	return io.NopCloser(bytes.NewReader(object.data[min(offset, int64(len(object.data))):])), nil
+}
+
+func (c *memClient) HeadObject(key string) (ObjectInfo, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	object, ok := c.objects[key]
+	if !ok {
+		return ObjectInfo{}, ErrObjectNotFound
+	}
+	return ObjectInfo{Key: key, Size: int64(len(object.data)), ModTime: object.modTime, Etag: object.etag}, nil
+}
+
+func (c *memClient) ListObjects(prefix string, limit int) ([]ObjectInfo, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var objects []ObjectInfo
+	for key, object := range c.objects {
+		if strings.HasPrefix(key, prefix) {
+			objects = append(objects, ObjectInfo{Key: key, Size: int64(len(object.data)), ModTime: object.modTime})
+		}
+	}
+	sort.Slice(objects, func(i, j int) bool { return objects[i].Key < objects[j].Key })
+	if limit > 0 && len(objects) > limit {
+		objects = objects[:limit]
+	}
+	return objects, nil
+}
+
+// ref returns the content of the ref object of a model
+func (c *memClient) ref(modelID, ref string) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return string(c.objects["hub/models--"+strings.ReplaceAll(modelID, "/", "--")+"/refs/"+ref].data)
+}
+
+func TestStoreFile(t *testing.T) {
+	client := newMemClient()
+	s := NewStorage(client, "/hub/")
+	bigData := strings.Repeat("w", 64)
+
+	tests := []struct {
+		name     string
+		filename string
+		content  string
+		etag     func() string
+	}{
+		{"git blob etag", "config.json", "{}", func() string {
+			etag, _ := utils.GitBlobSHA1(strings.NewReader("{}"), 2)
+			return etag
+		}},
+		{"lfs etag", "sub/model.safetensors", bigData, func() string {
+			etag, _ := utils.ComputeEtag("model.safetensors", strings.NewReader(bigData), int64(len(bigData)))
+			return etag
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			objectKey, err := s.StoreFile("acme/m", tt.filename, strings.NewReader(tt.content))
+			if err != nil {
+				t.Fatalf("StoreFile: %v", err)
+			}
+			sha := client.ref("acme/m", "main")
+			if !isCommitSha(sha) {
+				t.Fatalf("ref main = %q, want a commit", sha)
+			}
+			if want := "hub/models--acme--m/snapshots/" + sha + "/" + tt.filename; objectKey != want {
+				t.Fatalf("object key = %q, want %q", objectKey, want)
+			}
+			if got, want := s.FileEtag("acme/m", sha, tt.filename), tt.etag(); got != want {
+				t.Fatalf("FileEtag = %q, want %q", got, want)
+			}
+		})
+	}
+
+	if _, err := s.StoreFile("acme/m", "..", strings.NewReader("x")); err == nil {
+		t.Fatal("StoreFile accepted an invalid file name")
+	}
+}
+
+func TestStoreFileKeepsRef(t *testing.T) {
+	client := newMemClient()
+	s := NewStorage(client, "hub")
+	s.WithDefaultRevision("dev")
+	for _, name := range []string{"a.txt", "b.txt"} {
+		if _, err := s.StoreFile("acme/m", name, strings.NewReader(name)); err != nil {
+			t.Fatalf("StoreFile(%s): %v", name, err)
+		}
+	}
+	if client.ref("acme/m", "main") != "" {
+		t.Fatal("upload created ref main, want only the default revision")
+	}
+	files, err := s.ListFiles("acme/m")
+	if err != nil {
+		t.Fatalf("ListFiles: %v", err)
+	}
+	if len(files) != 2 || files[0] != "a.txt" || files[1] != "b.txt" {
+		t.Fatalf("ListFiles = %v, want both files in one snapshot", files)
+	}
+}
+
+func TestResolveRevision(t *testing.T) {
+	client := newMemClient()
+	s := NewStorage(client, "hub")
+	if _, err := s.StoreFile("acme/m", "config.json", strings.NewReader("{}")); err != nil {
+		t.Fatalf("StoreFile: %v", err)
+	}
+	sha := client.ref("acme/m", "main")
+	orphan := strings.Repeat("ab", 20)
+	client.PutObject("hub/models--acme--m/snapshots/"+orphan+"/x.txt", strings.NewReader("x"), "")
+	client.PutObject("hub/models--acme--m/refs/broken", strings.NewReader("not-a-commit"), "")
+
+	tests := []struct {
+		name    string
+		version string
+		want    string
+		wantErr bool
+	}{
+		{"default revision", "", sha, false},
+		{"ref", "main", sha, false},
+		{"commit without ref", orphan, orphan, false},
+		{"unknown commit", strings.Repeat("cd", 20), "", true},
+		{"unknown ref", "dev", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := s.ResolveRevision("acme/m", tt.version)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ResolveRevision(%q) error = %v, wantErr %v", tt.version, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Fatalf("ResolveRevision(%q) = %q, want %q", tt.version, got, tt.want)
+			}
+		})
+	}
+
+	if _, err := s.StoreFile("acme/m", "x.txt", strings.NewReader("x")); err != nil {
+		t.Fatalf("StoreFile: %v", err)
+	}
+	s.WithDefaultRevision("broken")
+	if _, err := s.StoreFile("acme/m", "x.txt", strings.NewReader("x")); err == nil {
+		t.Fatal("StoreFile wrote below a ref that is no commit")
+	}
+}
+
+func TestGetFile(t *testing.T) {
+	client := newMemClient()
+	s := NewStorage(client, "hub")
+	content := "0123456789"
+	if _, err := s.StoreFile("acme/m", "data.txt", strings.NewReader(content)); err != nil {
+		t.Fatalf("StoreFile: %v", err)
+	}
+	sha := client.ref("acme/m", "main")
+
+	tests := []struct {
+		name   string
+		offset int64
+		whence int
+		want   string
+	}{
+		{"whole file", 0, io.SeekStart, content},
+		{"from offset", 4, io.SeekStart, "456789"},
+		{"from end", -3, io.SeekEnd, "789"},
+		{"past end", 20, io.SeekStart, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := s.GetFile("acme/m", sha, "data.txt")
+			if err != nil {
+				t.Fatalf("GetFile: %v", err)
+			}
+			defer r.(io.Closer).Close()
+			if _, err := r.Seek(tt.offset, tt.whence); err != nil {
+				t.Fatalf("Seek: %v", err)
+			}
+			got, err := io.ReadAll(r)
+			if err != nil {
+				t.Fatalf("ReadAll: %v", err)
+			}
+			if string(got) != tt.want {
+				t.Fatalf("read %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := s.GetFile("acme/m", sha, "missing.txt"); err == nil {
+		t.Fatal("GetFile of a missing file succeeded")
+	}
+	if _, ok := s.FileExists("acme/m", sha, "missing.txt"); ok {
+		t.Fatal("FileExists reported a missing file")
+	}
+	info, ok := s.FileExists("acme/m", sha, "data.txt")
+	if !ok || info.Name() != "data.txt" || info.Size() != int64(len(content)) {
+		t.Fatalf("FileExists = %v, %v, want data.txt of %d bytes", info, ok, len(content))
+	}
+}
+
+func TestObjectReaderSeekKeepsRequest(t *testing.T) {
+	client := newMemClient()
+	client.PutObject("k", strings.NewReader("abcdef"), "")
+	r := &objectReader{client: client, key: "k", size: 6}
+	defer r.Close()
+
+	buf := make([]byte, 2)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+	// seeking to the current position keeps the open request
+	if _, err := r.Seek(0, io.SeekCurrent); err != nil {
+		t.Fatalf("Seek: %v", err)
+	}
+	rest, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("ReadAll: %v", err)
+	}
+	if string(rest) != "cdef" || client.gets != 1 {
+		t.Fatalf("read %q with %d requests, want \"cdef\" with 1", rest, client.gets)
+	}
+	if _, err := r.Seek(-1, io.SeekStart); err == nil {
+		t.Fatal("Seek to a negative position succeeded")
+	}
+}
+
+func TestRepoInfo(t *testing.T) {
+	client := newMemClient()
+	s := NewStorage(client, "hub")
+	for name, content := range map[string]string{"config.json": "{}", "sub/weights.bin": "0123"} {
+		if _, err := s.StoreFile("acme/m", name, strings.NewReader(content)); err != nil {
+			t.Fatalf("StoreFile(%s): %v", name, err)
+		}
+	}
+	sha := client.ref("acme/m", "main")
+	// directory placeholders of OSS consoles are no files
+	client.PutObject("hub/models--acme--m/snapshots/"+sha+"/sub/", strings.NewReader(""), "")
+
+	index, err := s.RepoInfo("acme/m", "main")
+	if err != nil {
+		t.Fatalf("RepoInfo: %v", err)
+	}
+	if index.SHA != sha || index.Author != "acme" || index.UsedStorage != 6 {
+		t.Fatalf("RepoInfo = sha %q author %q storage %d, want %q acme 6", index.SHA, index.Author, index.UsedStorage, sha)
+	}
+	if len(index.Siblings) != 2 || index.Siblings[0].RFilename != "config.json" || index.Siblings[1].RFilename != "sub/weights.bin" {
+		t.Fatalf("siblings = %+v, want config.json and sub/weights.bin", index.Siblings)
+	}
+
+	tests := []struct {
+		name     string
+		index    string
+		wantSize int64
+	}{
+		{"stored index of the snapshot", `{"sha":"` + sha + `","siblings":[{"rfilename":"x"}],"usedStorage":42}`, 42},
+		{"stored index of another commit", `{"sha":"` + strings.Repeat("0", 40) + `","siblings":[{"rfilename":"x"}],"usedStorage":42}`, 6},
+		{"stored index without siblings", `{"sha":"` + sha + `","usedStorage":42}`, 6},
+		{"invalid stored index", `{`, 6},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client.PutObject("hub/models--acme--m/.modeindex", strings.NewReader(tt.index), "")
+			index, err := s.RepoInfo("acme/m", "")
+			if err != nil {
+				t.Fatalf("RepoInfo: %v", err)
+			}
+			if index.UsedStorage != tt.wantSize {
+				t.Fatalf("used storage = %d, want %d", index.UsedStorage, tt.wantSize)
+			}
+		})
+	}
+
+	if _, err := s.RepoInfo("acme/missing", ""); err == nil {
+		t.Fatal("RepoInfo of a missing model succeeded")
+	}
+}
+
+func TestStorageSize(t *testing.T) {
+	client := newMemClient()
+	s := NewStorage(client, "hub")
+	if _, err := s.StoreFile("acme/m", "data.txt", strings.NewReader("0123456789")); err != nil {
+		t.Fatalf("StoreFile: %v", err)
+	}
+	size, err := s.StorageSize("acme/m")
+	if err != nil {
+		t.Fatalf("StorageSize: %v", err)
+	}
+	// the ref object holds the 40 character commit
+	if size != 50 {
+		t.Fatalf("StorageSize = %d, want 50", size)
+	}
+	if _, err := s.StorageSize("acme/missing"); err == nil {
+		t.Fatal("StorageSize of a missing model succeeded")
+	}
+}
+
+func TestDistributionRepoSha(t *testing.T) {
+	client := newMemClient()
+	d := &Distribution{Storage: NewStorage(client, "hub")}
+	if _, err := d.StoreFile("acme/m", "config.json", strings.NewReader("{}")); err != nil {
+		t.Fatalf("StoreFile: %v", err)
+	}
+	if got, want := d.RepoSha("acme/m", "main"), client.ref("acme/m", "main"); got != want {
+		t.Fatalf("RepoSha = %q, want %q", got, want)
+	}
+	if got := d.RepoSha("acme/m", "dev"); got != "" {
+		t.Fatalf("RepoSha of a missing ref = %q, want empty", got)
+	}
+}
+
+func TestNotFound(t *testing.T) {
+	other := errors.New("boom")
+	if err := notFound(other); err != other {
+		t.Fatalf("notFound(%v) = %v, want it unchanged", other, err)
+	}
+	if err := notFound(nil); err != nil {
+		t.Fatalf("notFound(nil) = %v", err)
+	}
+}
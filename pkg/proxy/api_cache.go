@@ -0,0 +1,169 @@
+package proxy
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// apiCacheEntry is an upstream API response stored on disk
+type apiCacheEntry struct {
+	Status    int         `json:"status"`
+	Header    http.Header `json:"header"`
+	Body      []byte      `json:"body"`
+	FetchedAt time.Time   `json:"fetchedAt"`
+}
+
+// WithAPICache enables caching of GET responses for upstream API paths starting with
+// one of the given prefixes. Entries younger than ttl are served without contacting the
+// upstream, older entries are still served when the upstream is unavailable until
+// they are maxStale old (0: no stale entries are served).
+func (p *Proxy) WithAPICache(ttl, maxStale time.Duration, prefixes []string) {
+	p.apiCacheTTL = ttl
+	p.apiCacheMaxStale = maxStale
+	p.apiCachePrefixes = prefixes
+}
+
+// HandleAPI proxies an upstream API request, serving whitelisted GET endpoints from the cache
+func (p *Proxy) HandleAPI(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" || !p.apiCacheable(r.URL.Path) {
+		p.proxy.ServeHTTP(w, r)
+		return
+	}
+
+	uri := r.URL.RequestURI()
+	key := apiCacheKey(r)
+	cached, _ := p.loadAPICache(key)
+	if cached != nil && time.Since(cached.FetchedAt) < p.apiCacheTTL {
+		writeAPICacheEntry(w, cached, "HIT")
+		return
+	}
+
+	entry, err := p.fetchAPI(r)
+	if err != nil || entry.Status >= http.StatusInternalServerError {
+		if cached != nil && time.Since(cached.FetchedAt) < p.apiCacheTTL+p.apiCacheMaxStale {
+			slog.Warn("upstream unavailable, serving stale cache entry", "uri", uri)
+			writeAPICacheEntry(w, cached, "STALE")
+			return
+		}
+		if err != nil {
+			slog.Error("failed to fetch from upstream", "uri", uri, "error", err)
+			http.Error(w, "Service unavailable", http.StatusServiceUnavailable)
+			return
+		}
+	}
+	if entry.Status == http.StatusOK {
+		if err := p.storeAPICache(key, entry); err != nil {
+			slog.Error("failed to cache API response", "uri", uri, "error", err)
+		}
+	}
+	writeAPICacheEntry(w, entry, "MISS")
+}
+
+// apiCacheKey identifies the cached response of a request. Responses to requests with
+// an Authorization header may include gated or private models, so they are cached
+// per credential under a hash of the header rather than shared with other clients.
+func apiCacheKey(r *http.Request) string {
+	key := r.URL.RequestURI()
+	if auth := r.Header.Get("Authorization"); auth != "" {
+		sum := sha256.Sum256([]byte(auth))
+		key += " auth:" + hex.EncodeToString(sum[:])
+	}
+	return key
+}
+
+func (p *Proxy) apiCacheable(path string) bool {
+	if p.apiCacheTTL <= 0 {
+		return false
+	}
+	for _, prefix := range p.apiCachePrefixes {
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// fetchAPI performs the request against the upstream and reads the full response
+func (p *Proxy) fetchAPI(r *http.Request) (*apiCacheEntry, error) {
+	req, err := http.NewRequestWithContext(r.Context(), "GET", p.baseURL+r.URL.RequestURI(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	if auth := r.Header.Get("Authorization"); auth != "" {
+		req.Header.Set("Authorization", auth)
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response body: %w", err)
+	}
+	header := http.Header{}
+	for _, name := range []string{"Content-Type", "ETag", "Link", "X-Repo-Commit"} {
+		if v := resp.Header.Get(name); v != "" {
+			header.Set(name, v)
+		}
+	}
+	return &apiCacheEntry{
+		Status:    resp.StatusCode,
+		Header:    header,
+		Body:      body,
+		FetchedAt: time.Now(),
+	}, nil
+}
+
+func (p *Proxy) apiCachePath(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(p.baseDir, "api-cache", hex.EncodeToString(sum[:]))
+}
+
+func (p *Proxy) loadAPICache(key string) (*apiCacheEntry, error) {
+	data, err := os.ReadFile(p.apiCachePath(key))
+	if err != nil {
+		return nil, err
+	}
+	var entry apiCacheEntry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
+
+func (p *Proxy) storeAPICache(key string, entry *apiCacheEntry) error {
+	path := p.apiCachePath(key)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func writeAPICacheEntry(w http.ResponseWriter, entry *apiCacheEntry, status string) {
+	for name, values := range entry.Header {
+		for _, v := range values {
+			w.Header().Add(name, v)
+		}
+	}
+	w.Header().Set("X-Cache", status)
+	w.WriteHeader(entry.Status)
+	w.Write(entry.Body)
+}
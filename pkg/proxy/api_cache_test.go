@@ -0,0 +1,106 @@
+package proxy
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newTestProxy creates a proxy caching below a temporary directory in front of upstream
+func newTestProxy(t *testing.T, upstream string) *Proxy {
+	t.Helper()
+	p := NewProxy(upstream, Options{})
+	p.WithFallbackProxy(true, t.TempDir())
+	return p
+}
+
+// serveAPI sends a GET for uri through the API cache of p with the Authorization header auth
+func serveAPI(p *Proxy, uri, auth string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("GET", uri, nil)
+	if auth != "" {
+		req.Header.Set("Authorization", auth)
+	}
+	rec := httptest.NewRecorder()
+	p.HandleAPI(rec, req)
+	return rec
+}
+
+func TestAPICacheKeyedByAuthorization(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") == "Bearer user-a" {
+			io.WriteString(w, `{"id":"org/private"}`)
+			return
+		}
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer upstream.Close()
+	p := newTestProxy(t, upstream.URL)
+	p.WithAPICache(time.Minute, time.Hour, []string{"/api/models"})
+
+	tests := []struct {
+		name   string
+		auth   string
+		status int
+		cache  string
+	}{
+		{"authorized miss", "Bearer user-a", http.StatusOK, "MISS"},
+		{"authorized hit", "Bearer user-a", http.StatusOK, "HIT"},
+		{"anonymous", "", http.StatusUnauthorized, "MISS"},
+		{"other token", "Bearer user-b", http.StatusUnauthorized, "MISS"},
+	}
+	for _, tt := range tests {
+		rec := serveAPI(p, "/api/models/org/private", tt.auth)
+		if rec.Code != tt.status || rec.Header().Get("X-Cache") != tt.cache {
+			t.Errorf("%s: status %d, X-Cache %s, want %d, %s", tt.name, rec.Code, rec.Header().Get("X-Cache"), tt.status, tt.cache)
+		}
+	}
+}
+
+func TestAPICacheMaxStale(t *testing.T) {
+	var down atomic.Bool
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if down.Load() {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		io.WriteString(w, `{"id":"org/m"}`)
+	}))
+	defer upstream.Close()
+	p := newTestProxy(t, upstream.URL)
+	p.WithAPICache(time.Minute, time.Hour, []string{"/api/models"})
+
+	if rec := serveAPI(p, "/api/models/org/m", ""); rec.Code != http.StatusOK {
+		t.Fatalf("first request: %d", rec.Code)
+	}
+	down.Store(true)
+	req := httptest.NewRequest("GET", "/api/models/org/m", nil)
+	key := apiCacheKey(req)
+
+	tests := []struct {
+		name   string
+		age    time.Duration
+		status int
+		cache  string
+	}{
+		{"fresh", time.Second, http.StatusOK, "HIT"},
+		{"stale", 30 * time.Minute, http.StatusOK, "STALE"},
+		{"too stale", 2 * time.Hour, http.StatusBadGateway, "MISS"},
+	}
+	for _, tt := range tests {
+		entry, err := p.loadAPICache(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		entry.FetchedAt = time.Now().Add(-tt.age)
+		if err := p.storeAPICache(key, entry); err != nil {
+			t.Fatal(err)
+		}
+		rec := serveAPI(p, "/api/models/org/m", "")
+		if rec.Code != tt.status || rec.Header().Get("X-Cache") != tt.cache {
+			t.Errorf("%s: status %d, X-Cache %s, want %d, %s", tt.name, rec.Code, rec.Header().Get("X-Cache"), tt.status, tt.cache)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// background tracks the goroutines that write the cache outside of a request, so a
+// shutdown waits for their writes instead of cutting them off
+type background struct {
+	mu     sync.Mutex
+	wg     sync.WaitGroup
+	closed bool
+	// ctx is cancelled when the shutdown stops waiting, aborting the writes
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+func newBackground() *background {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &background{ctx: ctx, cancel: cancel}
+}
+
+// goBackground runs f in a tracked goroutine, it is not started once the proxy is
+// closing. The context passed to f is cancelled when Close gives up waiting.
+func (p *Proxy) goBackground(f func(ctx context.Context)) bool {
+	bg := p.bg
+	bg.mu.Lock()
+	defer bg.mu.Unlock()
+	if bg.closed {
+		return false
+	}
+	bg.wg.Add(1)
+	go func() {
+		defer bg.wg.Done()
+		f(bg.ctx)
+	}()
+	return true
+}
+
+// Close waits for the background cache writes until ctx is done. Writes still running
+// then are cancelled, they discard their partial files before Close returns.
+func (p *Proxy) Close(ctx context.Context) error {
+	bg := p.bg
+	bg.mu.Lock()
+	bg.closed = true
+	bg.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		bg.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		bg.cancel()
+		return nil
+	case <-ctx.Done():
+	}
+	bg.cancel()
+	<-done
+	return fmt.Errorf("background cache writes aborted: %w", ctx.Err())
+}
@@ -0,0 +1,107 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lengrongfu/LLMDistribution/pkg/utils"
+)
+
+func TestCloseWaitsForBackgroundWrites(t *testing.T) {
+	p := newTestProxy(t, "http://127.0.0.1:1")
+	finished := make(chan struct{})
+	if !p.goBackground(func(ctx context.Context) {
+		time.Sleep(50 * time.Millisecond)
+		close(finished)
+	}) {
+		t.Fatal("goBackground did not start the write")
+	}
+	if err := p.Close(context.Background()); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	select {
+	case <-finished:
+	default:
+		t.Fatal("Close returned before the background write finished")
+	}
+	if p.goBackground(func(context.Context) {}) {
+		t.Fatal("goBackground started a write after Close")
+	}
+}
+
+func TestCloseCancelsBackgroundWritesAtDeadline(t *testing.T) {
+	p := newTestProxy(t, "http://127.0.0.1:1")
+	cancelled := make(chan struct{})
+	p.goBackground(func(ctx context.Context) {
+		<-ctx.Done()
+		close(cancelled)
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := p.Close(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Close = %v, want DeadlineExceeded", err)
+	}
+	select {
+	case <-cancelled:
+	default:
+		t.Fatal("Close returned before the cancelled write returned")
+	}
+}
+
+func TestCloseWaitsForFills(t *testing.T) {
+	const content = `{"model_type":"opt"}`
+	etag, err := utils.ComputeEtag("config.json", strings.NewReader(content), int64(len(content)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Repo-Commit", testCommit)
+		w.Header().Set("X-Linked-Etag", `"`+etag+`"`)
+		w.Header().Set("X-Linked-Size", strconv.Itoa(len(content)))
+		if r.Method == "GET" {
+			// the fill is still downloading when the proxy is closed
+			time.Sleep(50 * time.Millisecond)
+		}
+		io.WriteString(w, content)
+	}))
+	defer upstream.Close()
+
+	tests := []struct {
+		name       string
+		closeFirst bool
+		wantCached bool
+	}{
+		{"fill running at close", false, true},
+		{"fill after close", true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newTestProxy(t, upstream.URL)
+			if tt.closeFirst {
+				if err := p.Close(context.Background()); err != nil {
+					t.Fatalf("Close: %v", err)
+				}
+			}
+			p.FillInBackground("org/m", "main", "config.json")
+			if err := p.Close(context.Background()); err != nil {
+				t.Fatalf("Close: %v", err)
+			}
+			_, size := p.cachedBlob("org/m", etag)
+			if cached := size >= 0; cached != tt.wantCached {
+				t.Fatalf("cached = %v, want %v", cached, tt.wantCached)
+			}
+			p.fillMu.Lock()
+			defer p.fillMu.Unlock()
+			if len(p.fills) != 0 {
+				t.Fatalf("fills %v left registered", p.fills)
+			}
+		})
+	}
+}
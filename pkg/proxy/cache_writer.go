@@ -0,0 +1,152 @@
+package proxy
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// errCacheInProgress is returned when another request is already writing the same cache file
+var errCacheInProgress = errors.New("cache file is already being written")
+
+// errBlobCached is returned when the blob of a file was already cached and has been
+// linked into the snapshot, so the upstream content is not needed
+var errBlobCached = errors.New("blob is already cached")
+
+// errBlobConflict is returned in strict blob mode when a blob already exists with different content
+var errBlobConflict = errors.New("blob already exists with different content")
+
+// CacheWriter writes a cache file to a temporary ".incomplete" path that is only moved
+// into place by Commit, so readers never see a partially written file. Only one
+// CacheWriter can exist for a path at a time.
+type CacheWriter struct {
+	*os.File
+	path     string
+	release  func()
+	onCommit func() error
+	// verify checks the written temporary file before it replaces path
+	verify func(tmp string) error
+	once   sync.Once
+}
+
+// newCacheWriter reserves path and creates its temporary file, onCommit runs after the
+// file has been moved into place
+func (p *Proxy) newCacheWriter(path string, onCommit func() error) (*CacheWriter, error) {
+	p.writeMu.Lock()
+	if _, ok := p.writing[path]; ok {
+		p.writeMu.Unlock()
+		return nil, errCacheInProgress
+	}
+	p.writing[path] = struct{}{}
+	p.writeMu.Unlock()
+	release := func() {
+		p.writeMu.Lock()
+		delete(p.writing, path)
+		p.writeMu.Unlock()
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		release()
+		return nil, fmt.Errorf("failed to create directory: %w", err)
+	}
+	f, err := os.Create(path + ".incomplete")
+	if err != nil {
+		release()
+		return nil, err
+	}
+	return &CacheWriter{
+		File:     f,
+		path:     path,
+		release:  release,
+		onCommit: onCommit,
+	}, nil
+}
+
+// Commit moves the completely written file into place
+func (w *CacheWriter) Commit() error {
+	err := errors.New("cache writer already finished")
+	w.once.Do(func() {
+		defer w.release()
+		if err = w.File.Close(); err != nil {
+			os.Remove(w.File.Name())
+			return
+		}
+		if w.verify != nil {
+			if err = w.verify(w.File.Name()); err != nil {
+				os.Remove(w.File.Name())
+				return
+			}
+		}
+		if err = os.Rename(w.File.Name(), w.path); err != nil {
+			return
+		}
+		if w.onCommit != nil {
+			err = w.onCommit()
+		}
+	})
+	return err
+}
+
+// Abort discards the partially written file
+func (w *CacheWriter) Abort() {
+	w.once.Do(func() {
+		defer w.release()
+		w.File.Close()
+		os.Remove(w.File.Name())
+	})
+}
+
+// verifyBlobConflict refuses to replace an existing blob with content that differs,
+// the etag of a blob identifies its content so a mismatch indicates an upstream bug
+func verifyBlobConflict(blobPath string) func(tmp string) error {
+	return func(tmp string) error {
+		existing, err := os.Stat(blobPath)
+		if os.IsNotExist(err) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		written, err := os.Stat(tmp)
+		if err != nil {
+			return err
+		}
+		same := existing.Size() == written.Size()
+		if same {
+			existingSum, err := fileSHA256(blobPath)
+			if err != nil {
+				return err
+			}
+			writtenSum, err := fileSHA256(tmp)
+			if err != nil {
+				return err
+			}
+			same = bytes.Equal(existingSum, writtenSum)
+		}
+		if !same {
+			slog.Error("refusing to overwrite blob", "blob", blobPath, "error", errBlobConflict,
+				"existing_bytes", existing.Size(), "new_bytes", written.Size())
+			return fmt.Errorf("%w: %s", errBlobConflict, filepath.Base(blobPath))
+		}
+		return nil
+	}
+}
+
+// fileSHA256 hashes the content of a file
+func fileSHA256(path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
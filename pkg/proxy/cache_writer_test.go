@@ -0,0 +1,119 @@
+package proxy
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCacheWriter(t *testing.T) {
+	tests := []struct {
+		name   string
+		commit bool
+	}{
+		{"commit", true},
+		{"abort", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newTestProxy(t, "http://127.0.0.1:1")
+			path := filepath.Join(t.TempDir(), "blobs", "abc")
+			committed := false
+			w, err := p.newCacheWriter(path, func() error {
+				committed = true
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("newCacheWriter: %v", err)
+			}
+			if _, err := p.newCacheWriter(path, nil); !errors.Is(err, errCacheInProgress) {
+				t.Fatalf("second writer = %v, want errCacheInProgress", err)
+			}
+			if _, err := w.WriteString("content"); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := os.Stat(path); !os.IsNotExist(err) {
+				t.Fatalf("partially written file is visible: %v", err)
+			}
+
+			if tt.commit {
+				if err := w.Commit(); err != nil {
+					t.Fatalf("Commit: %v", err)
+				}
+			} else {
+				w.Abort()
+			}
+			if data, err := os.ReadFile(path); tt.commit != (err == nil && string(data) == "content") {
+				t.Errorf("file after %s = %q, %v", tt.name, data, err)
+			}
+			if committed != tt.commit {
+				t.Errorf("onCommit ran = %v", committed)
+			}
+			if _, err := os.Stat(path + ".incomplete"); !os.IsNotExist(err) {
+				t.Errorf("temporary file left behind: %v", err)
+			}
+			next, err := p.newCacheWriter(path, nil)
+			if err != nil {
+				t.Fatalf("writer after %s: %v", tt.name, err)
+			}
+			next.Abort()
+		})
+	}
+}
+
+func TestVerifyBlobConflict(t *testing.T) {
+	tests := []struct {
+		name     string
+		existing string
+		written  string
+		wantErr  bool
+	}{
+		{"no existing blob", "", "content", false},
+		{"same content", "content", "content", false},
+		{"different size", "content", "other content", true},
+		{"same size, different content", "content", "CONTENT", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			blob := filepath.Join(dir, "blob")
+			if tt.existing != "" {
+				if err := os.WriteFile(blob, []byte(tt.existing), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			tmp := blob + ".incomplete"
+			if err := os.WriteFile(tmp, []byte(tt.written), 0644); err != nil {
+				t.Fatal(err)
+			}
+			err := verifyBlobConflict(blob)(tmp)
+			if tt.wantErr != errors.Is(err, errBlobConflict) {
+				t.Errorf("verify = %v, want conflict %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCacheWriterKeepsConflictingBlob(t *testing.T) {
+	p := newTestProxy(t, "http://127.0.0.1:1")
+	blob := filepath.Join(t.TempDir(), "blob")
+	if err := os.WriteFile(blob, []byte("original"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	w, err := p.newCacheWriter(blob, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.verify = verifyBlobConflict(blob)
+	w.WriteString("replaced")
+	if err := w.Commit(); !errors.Is(err, errBlobConflict) {
+		t.Fatalf("Commit = %v, want errBlobConflict", err)
+	}
+	if data, _ := os.ReadFile(blob); string(data) != "original" {
+		t.Errorf("blob = %q, want the original content", data)
+	}
+	if _, err := os.Stat(blob + ".incomplete"); !os.IsNotExist(err) {
+		t.Errorf("temporary file left behind: %v", err)
+	}
+}
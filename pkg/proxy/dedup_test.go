@@ -0,0 +1,119 @@
+package proxy
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/lengrongfu/LLMDistribution/pkg/utils"
+)
+
+func TestLinkCachedBlob(t *testing.T) {
+	content := strings.Repeat("weights ", 16<<10)
+	tests := []struct {
+		name       string
+		compressed bool
+		size       int64
+		linked     bool
+	}{
+		{"plain blob", false, int64(len(content)), true},
+		{"compressed blob", true, int64(len(content)), true},
+		{"size mismatch", false, int64(len(content)) + 1, false},
+		{"compressed size mismatch", true, int64(len(content)) + 1, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newTestProxy(t, "http://127.0.0.1:1")
+			blob := p.blobPath("org/m", "etag")
+			if err := os.MkdirAll(filepath.Dir(blob), 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(blob, []byte(content), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if tt.compressed {
+				if _, err := utils.CompressBlob(blob); err != nil {
+					t.Fatal(err)
+				}
+				os.Remove(blob)
+			}
+
+			if linked := p.linkCachedBlob("org/m", "model.bin", testCommit, "etag", tt.size); linked != tt.linked {
+				t.Fatalf("linkCachedBlob = %v, want %v", linked, tt.linked)
+			}
+			if !tt.linked {
+				return
+			}
+			files, err := utils.ReadSnapshotMeta(p.layout().SnapshotMetaPath("org/m", testCommit))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := files["model.bin"]; got.Etag != "etag" || got.Size != int64(len(content)) {
+				t.Fatalf("recorded %+v, want size %d", got, len(content))
+			}
+			r, err := p.openCachedBlob("org/m", "etag")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer r.Close()
+			data, _ := io.ReadAll(r)
+			if string(data) != content {
+				t.Fatalf("cached blob holds %d bytes, want %d", len(data), len(content))
+			}
+		})
+	}
+}
+
+func TestFetchToCacheReusesBlobAcrossRevisions(t *testing.T) {
+	const otherCommit = "fedcba9876543210fedcba9876543210fedcba98"
+	content := `{"model_type":"opt"}`
+	etag, err := utils.ComputeEtag("config.json", strings.NewReader(content), int64(len(content)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var gets atomic.Int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// the path is /org/m/resolve/<commit>/config.json
+		w.Header().Set("X-Repo-Commit", strings.Split(r.URL.Path, "/")[4])
+		w.Header().Set("ETag", `"`+etag+`"`)
+		w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+		if r.Method == "GET" {
+			gets.Add(1)
+			io.WriteString(w, content)
+		}
+	}))
+	defer upstream.Close()
+	p := newTestProxy(t, upstream.URL)
+
+	// the rows run in order, the second revision has the same file as the first
+	tests := []struct {
+		commit    string
+		wantBytes int64
+		wantGets  int32
+	}{
+		{testCommit, int64(len(content)), 1},
+		{otherCommit, 0, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.commit, func(t *testing.T) {
+			n, err := p.FetchToCache(context.Background(), "org/m", tt.commit, "config.json")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n != tt.wantBytes || gets.Load() != tt.wantGets {
+				t.Errorf("fetched %d bytes with %d GETs, want %d bytes with %d", n, gets.Load(), tt.wantBytes, tt.wantGets)
+			}
+			data, err := os.ReadFile(p.layout().SnapshotPath("org/m", tt.commit, "config.json"))
+			if err != nil || string(data) != content {
+				t.Errorf("snapshot file = %q, %v", data, err)
+			}
+		})
+	}
+}
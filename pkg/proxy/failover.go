@@ -0,0 +1,93 @@
+package proxy
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// failoverBackoff is the wait before trying the second upstream, it doubles for every
+// further upstream
+const failoverBackoff = 100 * time.Millisecond
+
+// ParseUpstreams parses a comma-separated list of upstream base URLs
+func ParseUpstreams(baseURLs string) ([]*url.URL, error) {
+	var upstreams []*url.URL
+	for _, baseURL := range strings.Split(baseURLs, ",") {
+		baseURL = strings.TrimRight(strings.TrimSpace(baseURL), "/")
+		if baseURL == "" {
+			continue
+		}
+		u, err := url.Parse(baseURL)
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			return nil, fmt.Errorf("upstream must be an absolute URL, got %q", baseURL)
+		}
+		upstreams = append(upstreams, u)
+	}
+	if len(upstreams) == 0 {
+		return nil, fmt.Errorf("no upstream configured")
+	}
+	return upstreams, nil
+}
+
+// failoverTransport sends the requests for the first upstream to the next upstream in
+// order when an upstream is unreachable or answers with a server error. Requests for
+// other hosts, like the CDN file downloads are redirected to, are sent unchanged.
+type failoverTransport struct {
+	base      http.RoundTripper
+	upstreams []*url.URL
+}
+
+func (t *failoverTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	primary := t.upstreams[0]
+	if len(t.upstreams) == 1 || req.URL.Host != primary.Host || (req.Method != "GET" && req.Method != "HEAD") {
+		return t.base.RoundTrip(req)
+	}
+
+	backoff := failoverBackoff
+	var (
+		resp *http.Response
+		err  error
+	)
+	for i, upstream := range t.upstreams {
+		if i > 0 {
+			select {
+			case <-time.After(backoff):
+			case <-req.Context().Done():
+				return nil, req.Context().Err()
+			}
+			backoff *= 2
+		}
+		resp, err = t.base.RoundTrip(upstreamRequest(req, primary, upstream))
+		if err == nil && resp.StatusCode < http.StatusInternalServerError {
+			return resp, nil
+		}
+		if i == len(t.upstreams)-1 {
+			break
+		}
+		if err != nil {
+			slog.Warn("upstream failed, trying the next", "upstream", upstream.Host, "error", err)
+		} else {
+			slog.Warn("upstream failed, trying the next", "upstream", upstream.Host, "status", resp.Status)
+			resp.Body.Close()
+		}
+	}
+	return resp, err
+}
+
+// upstreamRequest rewrites a request for the primary upstream into one for upstream
+func upstreamRequest(req *http.Request, primary, upstream *url.URL) *http.Request {
+	if upstream == primary {
+		return req
+	}
+	out := req.Clone(req.Context())
+	out.URL.Scheme = upstream.Scheme
+	out.URL.Host = upstream.Host
+	out.URL.Path = upstream.Path + strings.TrimPrefix(req.URL.Path, primary.Path)
+	out.URL.RawPath = ""
+	out.Host = upstream.Host
+	return out
+}
@@ -0,0 +1,126 @@
+package proxy
+
+import (
+	"bytes"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// captureLogs sends the default slog output to the returned buffer for the test
+func captureLogs(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	prev := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug})))
+	t.Cleanup(func() { slog.SetDefault(prev) })
+	return &buf
+}
+
+func TestFailoverTransport(t *testing.T) {
+	tests := []struct {
+		name       string
+		status     int
+		wantBody   string
+		wantLogged bool
+	}{
+		{name: "primary serves", status: http.StatusOK, wantBody: "primary"},
+		{name: "primary not found", status: http.StatusNotFound, wantBody: "primary"},
+		{name: "primary fails", status: http.StatusBadGateway, wantBody: "secondary", wantLogged: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logs := captureLogs(t)
+			primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				io.WriteString(w, "primary")
+			}))
+			defer primary.Close()
+			secondary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				io.WriteString(w, "secondary")
+			}))
+			defer secondary.Close()
+
+			upstreams, err := ParseUpstreams(primary.URL + "," + secondary.URL)
+			if err != nil {
+				t.Fatal(err)
+			}
+			client := &http.Client{Transport: &failoverTransport{base: http.DefaultTransport, upstreams: upstreams}}
+			resp, err := client.Get(primary.URL + "/api/models/org/m")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			body, _ := io.ReadAll(resp.Body)
+			if string(body) != tt.wantBody {
+				t.Errorf("body = %q, want %q", body, tt.wantBody)
+			}
+
+			primaryHost := strings.TrimPrefix(primary.URL, "http://")
+			logged := strings.Contains(logs.String(), `msg="upstream failed, trying the next" upstream=`+primaryHost)
+			if logged != tt.wantLogged {
+				t.Errorf("failover logged = %v, want %v, logs: %s", logged, tt.wantLogged, logs)
+			}
+		})
+	}
+}
+
+func TestParseUpstreams(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    []string
+		wantErr bool
+	}{
+		{name: "single", input: "https://hf.co", want: []string{"https://hf.co"}},
+		{name: "list", input: "https://hf.co/, https://mirror.example/hf", want: []string{"https://hf.co", "https://mirror.example/hf"}},
+		{name: "empty entries", input: "https://hf.co,,", want: []string{"https://hf.co"}},
+		{name: "relative", input: "hf.co", wantErr: true},
+		{name: "empty", input: " , ", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			upstreams, err := ParseUpstreams(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseUpstreams error = %v, want error %v", err, tt.wantErr)
+			}
+			var got []string
+			for _, u := range upstreams {
+				got = append(got, u.String())
+			}
+			if strings.Join(got, " ") != strings.Join(tt.want, " ") {
+				t.Errorf("upstreams = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUpstreamRequest(t *testing.T) {
+	upstreams, err := ParseUpstreams("https://hf.co,https://mirror.example/hf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest("GET", "https://hf.co/api/models/org/m?full=1", nil)
+	tests := []struct {
+		name     string
+		upstream int
+		want     string
+	}{
+		{"primary unchanged", 0, "https://hf.co/api/models/org/m?full=1"},
+		{"mirror with path prefix", 1, "https://mirror.example/hf/api/models/org/m?full=1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := upstreamRequest(req, upstreams[0], upstreams[tt.upstream])
+			if got := out.URL.String(); got != tt.want {
+				t.Errorf("url = %q, want %q", got, tt.want)
+			}
+			if out.Host != upstreams[tt.upstream].Host {
+				t.Errorf("host = %q, want %q", out.Host, upstreams[tt.upstream].Host)
+			}
+		})
+	}
+}
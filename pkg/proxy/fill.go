@@ -0,0 +1,189 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/lengrongfu/LLMDistribution/pkg/utils"
+)
+
+// RedirectOnMiss redirects the client to the upstream resolve URL with a 307 and
+// fills the cache in the background so later requests are served locally
+func (p *Proxy) RedirectOnMiss(w http.ResponseWriter, r *http.Request) {
+	p.recordMiss()
+	vars := mux.Vars(r)
+	modelID := vars["model_id"]
+	revision := vars["sha"]
+	filename := vars["filename"]
+	p.FillInBackground(modelID, revision, filename)
+	http.Redirect(w, r, p.baseURL+r.URL.RequestURI(), http.StatusTemporaryRedirect)
+}
+
+// FillInBackground starts a background cache fill for a file unless one is already running
+func (p *Proxy) FillInBackground(modelID, revision, filename string) {
+	if p.readOnly.Load() {
+		return
+	}
+	key := modelID + "/" + revision + "/" + filename
+	p.fillMu.Lock()
+	if _, ok := p.fills[key]; ok {
+		p.fillMu.Unlock()
+		return
+	}
+	p.fills[key] = struct{}{}
+	p.fillMu.Unlock()
+
+	started := p.goBackground(func(ctx context.Context) {
+		defer func() {
+			p.fillMu.Lock()
+			delete(p.fills, key)
+			p.fillMu.Unlock()
+		}()
+		n, err := p.FetchToCache(ctx, modelID, revision, filename)
+		if err != nil {
+			slog.Error("failed to fill cache", "file", key, "error", err)
+			return
+		}
+		slog.Info("filled cache", "file", key, "bytes", n)
+	})
+	if !started {
+		p.fillMu.Lock()
+		delete(p.fills, key)
+		p.fillMu.Unlock()
+	}
+}
+
+// FetchToCache downloads a single file of a model revision from the upstream into
+// the local cache layout and returns the number of bytes written
+func (p *Proxy) FetchToCache(ctx context.Context, modelID, revision, filename string) (int64, error) {
+	fileURL := p.resolveURL(modelID, revision, filename)
+	head, err := p.headFile(ctx, fileURL)
+	if err != nil {
+		return 0, err
+	}
+	commit, etag, err := getCommitAndEtag(head)
+	if err != nil {
+		return 0, err
+	}
+	if commit == "" {
+		if commit, err = p.resolveCommit(modelID, revision); err != nil {
+			return 0, err
+		}
+	}
+	if etag == "" {
+		return 0, fmt.Errorf("upstream response for %s is missing etag", fileURL)
+	}
+	if p.linkCachedBlob(modelID, filename, commit, etag, responseSize(head)) {
+		// unchanged since a cached revision, nothing to transfer
+		return 0, p.writeRef(modelID, revision, commit)
+	}
+	downloadURL := fileURL
+	if location := head.Header.Get("Location"); location != "" {
+		// the hub may redirect relative to the request
+		resolved, err := head.Request.URL.Parse(location)
+		if err != nil {
+			return 0, fmt.Errorf("invalid redirect location for %s: %w", fileURL, err)
+		}
+		downloadURL = resolved.String()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", downloadURL, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create request: %w", err)
+	}
+	resp, err := (&http.Client{Transport: p.proxy.Transport}).Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("upstream returned %s for %s", resp.Status, downloadURL)
+	}
+
+	w, err := p.createCacheFile(modelID, filename, commit, etag)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create file: %w", err)
+	}
+	n, err := io.Copy(w, resp.Body)
+	if err != nil {
+		w.Abort()
+		return n, fmt.Errorf("failed to write file: %w", err)
+	}
+	if err := w.Commit(); err != nil {
+		return n, fmt.Errorf("failed to commit file: %w", err)
+	}
+
+	// record the revision so it resolves locally to the fetched commit
+	if err := p.writeRef(modelID, revision, commit); err != nil {
+		return n, err
+	}
+	return n, nil
+}
+
+// resolveURL returns the upstream resolve URL of a file of a model revision
+func (p *Proxy) resolveURL(modelID, revision, filename string) string {
+	return fmt.Sprintf("%s/%s/resolve/%s/%s", p.baseURL, modelID, revision, filename)
+}
+
+// headFile sends a HEAD request for an upstream file. The redirect to the CDN is not
+// followed, as the CDN response drops the commit and etag headers.
+func (p *Proxy) headFile(ctx context.Context, fileURL string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, "HEAD", fileURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	client := &http.Client{
+		Transport: p.proxy.Transport,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	head, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	head.Body.Close()
+	if head.StatusCode >= http.StatusBadRequest {
+		return nil, fmt.Errorf("upstream returned %s for %s", head.Status, fileURL)
+	}
+	return head, nil
+}
+
+// writeRef points refs/<revision> at commit unless the revision is the commit itself
+func (p *Proxy) writeRef(modelID, revision, commit string) error {
+	if revision == "" || revision == commit {
+		return nil
+	}
+	refPath := p.layout().RefPath(modelID, revision)
+	current, _ := utils.ReadRef(refPath)
+	if current == commit {
+		return nil
+	}
+	if err := utils.WriteRef(refPath, commit); err != nil {
+		return fmt.Errorf("failed to write ref: %w", err)
+	}
+	if current != "" {
+		// the previous snapshot stays cached and is still served by its commit
+		slog.Info("moved ref", "model", modelID, "ref", revision, "from", current, "to", commit)
+	}
+	return nil
+}
+
+// Ping checks that the upstream answers HTTP requests. Any response, including an
+// error status, means the upstream is reachable.
+func (p *Proxy) Ping(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, "HEAD", p.baseURL+"/api/models", nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("upstream %s is unreachable: %w", p.baseURL, err)
+	}
+	resp.Body.Close()
+	return nil
+}
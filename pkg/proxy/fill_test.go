@@ -0,0 +1,64 @@
+package proxy
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/lengrongfu/LLMDistribution/pkg/utils"
+)
+
+func TestFetchToCacheFollowsLocation(t *testing.T) {
+	const content = `{"model_type":"opt"}`
+	etag, err := utils.ComputeEtag("config.json", strings.NewReader(content), int64(len(content)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cdn := cdnServer(t, content)
+
+	tests := []struct {
+		name     string
+		location string
+	}{
+		{"absolute", cdn.URL + "/blob?sig=1"},
+		{"relative path", "/cdn/blob?sig=1"},
+		{"relative to the file", "../../../cdn/blob?sig=1"},
+		{"no redirect", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if strings.HasPrefix(r.URL.Path, "/cdn/") {
+					io.WriteString(w, content)
+					return
+				}
+				w.Header().Set("X-Repo-Commit", testCommit)
+				w.Header().Set("X-Linked-Etag", `"`+etag+`"`)
+				w.Header().Set("X-Linked-Size", strconv.Itoa(len(content)))
+				if tt.location != "" && r.Method == "HEAD" {
+					w.Header().Set("Location", tt.location)
+					w.WriteHeader(http.StatusFound)
+					return
+				}
+				io.WriteString(w, content)
+			}))
+			defer upstream.Close()
+
+			p := newTestProxy(t, upstream.URL)
+			n, err := p.FetchToCache(context.Background(), "org/m", "main", "config.json")
+			if err != nil {
+				t.Fatalf("FetchToCache: %v", err)
+			}
+			if n != int64(len(content)) {
+				t.Fatalf("fetched %d bytes, want %d", n, len(content))
+			}
+			if got := cachedSnapshotFile(t, p, "config.json"); got != content {
+				t.Fatalf("cached %q, want %q", got, content)
+			}
+		})
+	}
+}
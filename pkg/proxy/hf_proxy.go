@@ -1,18 +1,24 @@
 package proxy
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
-	"log"
+	"io/fs"
+	"log/slog"
 	"net"
 	"net/http"
 	"net/http/httputil"
 	"net/url"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gorilla/mux"
@@ -25,42 +31,130 @@ type Proxy struct {
 	client        *http.Client
 	proxy         *httputil.ReverseProxy
 	FallbackProxy bool
-	baseDir       string
-	bufferPool    sync.Pool
+	// KeepOldSnapshots keeps the previous snapshot when a cached ref moves to a new sha
+	KeepOldSnapshots bool
+	// SharedBlobs stores blobs in a directory shared by all models to deduplicate identical files
+	SharedBlobs bool
+	// RewriteLocation keeps clients away from the CDN file downloads are redirected to
+	RewriteLocation bool
+	// StrictBlobs refuses to overwrite an existing blob with different content
+	StrictBlobs bool
+	// RateLimit caps the bytes per second each proxied response is read from the upstream (0 means unlimited)
+	RateLimit int64
+	baseDir   string
+	// layoutStrategy arranges the cached files of a model, see utils.Layout
+	layoutStrategy utils.LayoutStrategy
+	bufferPool     sync.Pool
+	// blobDir keeps the blobs separate from the snapshots when set
+	blobDir string
+	// repoType names the cached model directories, see utils.RepoType
+	repoType utils.RepoType
+	// fills tracks in-flight background cache fills keyed by model, revision and file
+	fillMu sync.Mutex
+	fills  map[string]struct{}
+	// writing tracks cache files that are being written to avoid concurrent writers
+	writeMu sync.Mutex
+	writing map[string]struct{}
+	// readOnly disables writing to the cache during maintenance
+	readOnly atomic.Bool
+	// apiCacheTTL and apiCachePrefixes configure caching of upstream API responses
+	apiCacheTTL      time.Duration
+	apiCacheMaxStale time.Duration
+	apiCachePrefixes []string
+	// sparseMinSize is the smallest file of which ranged requests are cached sparsely
+	// (0 disables sparse caching), see WithSparseCache
+	sparseMinSize int64
+	sparseMu      sync.Mutex
+	sparseMetas   map[string]sparseMeta
+	sparseBlobs   map[string]*sparseBlob
+	// bg tracks the background cache writes a shutdown waits for
+	bg *background
+	// stats counts cache hits, misses and transferred bytes
+	stats *cacheStats
+	// pinned reports snapshots being served, which are kept when their ref moves
+	pinned func(modelID, sha string) bool
 }
 
-func NewProxy(baseURL string) *Proxy {
+// Options tunes the upstream HTTP client, zero values fall back to the defaults
+type Options struct {
+	// UpstreamTimeout bounds upstream API requests and waiting for response headers (default 60s)
+	UpstreamTimeout time.Duration
+	// MaxIdleConns is the size of the idle connection pool to the upstream (default 100)
+	MaxIdleConns int
+	// IdleConnTimeout is how long idle upstream connections are kept (default 90s)
+	IdleConnTimeout time.Duration
+}
+
+// NewProxy creates a proxy to baseURL, a comma-separated list of upstreams that are
+// tried in order when an upstream fails
+func NewProxy(baseURL string, opts Options) *Proxy {
 	if baseURL == "" {
 		baseURL = "https://huggingface.co"
 	}
-	target, _ := url.Parse(baseURL)
+	upstreams, err := ParseUpstreams(baseURL)
+	if err != nil {
+		slog.Error("invalid upstreams", "upstreams", baseURL, "error", err)
+		u, _ := url.Parse(baseURL)
+		upstreams = []*url.URL{u}
+	}
+	baseURL = upstreams[0].String()
+	if opts.UpstreamTimeout <= 0 {
+		opts.UpstreamTimeout = 60 * time.Second
+	}
+	if opts.MaxIdleConns <= 0 {
+		opts.MaxIdleConns = 100
+	}
+	if opts.IdleConnTimeout <= 0 {
+		opts.IdleConnTimeout = 90 * time.Second
+	}
+	target := upstreams[0]
 	proxy := httputil.NewSingleHostReverseProxy(target)
 	proxy.Director = func(req *http.Request) {
 		req.URL.Scheme = target.Scheme
 		req.URL.Host = target.Host
 		req.Host = target.Host
+		StripXetHeaders(req.Header)
+	}
+	proxy.ModifyResponse = func(resp *http.Response) error {
+		StripXetHeaders(resp.Header)
+		return nil
 	}
+	// upstream requests carry the context of the client request, a client that goes
+	// away cancels the upstream fetch instead of leaving it downloading
 	proxy.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
-		log.Printf("Error proxying to %s: %v", target, err)
+		if r.Context().Err() != nil {
+			slog.Debug("client canceled request, upstream fetch aborted", "path", r.URL.Path)
+			return
+		}
+		slog.Error("failed to proxy request", "upstream", target.String(), "path", r.URL.Path, "error", err)
 		http.Error(w, "Service unavailable", http.StatusServiceUnavailable)
 	}
-	proxy.Transport = &http.Transport{
+	transport := &http.Transport{
 		Proxy: http.ProxyFromEnvironment,
 		DialContext: (&net.Dialer{
 			Timeout:   60 * time.Second,
 			KeepAlive: 60 * time.Second,
 		}).DialContext,
-		MaxIdleConns:          100,
-		IdleConnTimeout:       90 * time.Second,
+		MaxIdleConns:          opts.MaxIdleConns,
+		MaxIdleConnsPerHost:   opts.MaxIdleConns,
+		IdleConnTimeout:       opts.IdleConnTimeout,
+		ResponseHeaderTimeout: opts.UpstreamTimeout,
 		TLSHandshakeTimeout:   10 * time.Second,
 		ExpectContinueTimeout: 1 * time.Second,
 	}
+	stats := newCacheStats()
+	proxy.Transport = &tracingTransport{base: &statsTransport{base: &failoverTransport{base: transport, upstreams: upstreams}, stats: stats}}
 	p := &Proxy{
 		baseURL: baseURL,
 		client: &http.Client{
-			Timeout: 60 * time.Second,
+			Transport: proxy.Transport,
+			Timeout:   opts.UpstreamTimeout,
 		},
-		proxy: proxy,
+		proxy:   proxy,
+		fills:   make(map[string]struct{}),
+		writing: make(map[string]struct{}),
+		bg:      newBackground(),
+		stats:   stats,
 	}
 	p.bufferPool = sync.Pool{
 		New: func() interface{} {
@@ -75,6 +169,7 @@ func (p *Proxy) HandleGetModelIndex(w http.ResponseWriter, r *http.Request) {
 }
 
 func (p *Proxy) HandleGetModelFile(w http.ResponseWriter, r *http.Request) {
+	p.recordMiss()
 	p.proxy.ServeHTTP(w, r)
 }
 
@@ -82,7 +177,54 @@ func (p *Proxy) WithFallbackProxy(fallback bool, baseDir string) {
 	p.FallbackProxy = fallback
 	p.baseDir = baseDir
 	os.Setenv("HF_HOME", baseDir)
-	log.Printf("Set HF_HOME environment variable to %s", baseDir)
+	slog.Debug("set HF_HOME environment variable", "dir", baseDir)
+}
+
+// SetReadOnly enables or disables writing proxied responses to the cache
+func (p *Proxy) SetReadOnly(readOnly bool) {
+	p.readOnly.Store(readOnly)
+}
+
+// WithSharedBlobs enables storing blobs in a directory shared by all models
+func (p *Proxy) WithSharedBlobs(shared bool) {
+	p.SharedBlobs = shared
+}
+
+// WithStrictBlobs enables verifying an existing blob before it is overwritten
+func (p *Proxy) WithStrictBlobs(strict bool) {
+	p.StrictBlobs = strict
+}
+
+// WithRateLimit caps the transfer rate of each proxied response to bytesPerSec
+func (p *Proxy) WithRateLimit(bytesPerSec int64) {
+	p.RateLimit = bytesPerSec
+}
+
+// WithLayout sets how the cached files of the models are arranged
+func (p *Proxy) WithLayout(strategy utils.LayoutStrategy) {
+	p.layoutStrategy = strategy
+}
+
+// WithRepoType sets the type of the cached repositories, which names their directories
+// like models--org--name or datasets--org--name
+func (p *Proxy) WithRepoType(repoType utils.RepoType) {
+	p.repoType = repoType
+}
+
+// WithBlobDir keeps the cached blobs below dir instead of the model directories
+func (p *Proxy) WithBlobDir(dir string) {
+	p.blobDir = dir
+}
+
+// WithPinnedSnapshots keeps the snapshots pinned reports as being served when their
+// ref moves to a new sha
+func (p *Proxy) WithPinnedSnapshots(pinned func(modelID, sha string) bool) {
+	p.pinned = pinned
+}
+
+// WithKeepOldSnapshots controls whether snapshots of superseded refs are kept
+func (p *Proxy) WithKeepOldSnapshots(keep bool) {
+	p.KeepOldSnapshots = keep
 }
 
 func (p *Proxy) GetModelIndex(r *http.Request) (*http.Response, error) {
@@ -91,74 +233,172 @@ func (p *Proxy) GetModelIndex(r *http.Request) (*http.Response, error) {
 	modelID := vars["model_id"]
 	version := vars["version"]
 	url := fmt.Sprintf("%s/api/models/%s/revision/%s", p.baseURL, modelID, version)
-	// Create the context with timeout
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
-	// Create the request
-	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	// the request is canceled with the client request, the response header timeout of
+	// the upstream transport bounds the wait for the upstream
+	req, err := http.NewRequestWithContext(r.Context(), "GET", url, nil)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
-	// Send the request
-	// Send the request
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	return resp, err
+	return (&http.Client{Transport: p.proxy.Transport}).Do(req)
 }
 
 func (p *Proxy) WithModifyRequest(f func(*http.Response) error) {
-	p.proxy.ModifyResponse = f
+	p.proxy.ModifyResponse = func(resp *http.Response) error {
+		// clients must not be pointed at Xet endpoints the cache knows nothing about
+		StripXetHeaders(resp.Header)
+		return f(resp)
+	}
 }
 func (p *Proxy) WithModifyResponseToCache(resp *http.Response) error {
+	if p.RateLimit > 0 {
+		// wrap last, so the cache is written at the pace the client is served
+		defer func() {
+			resp.Body = struct {
+				io.Reader
+				io.Closer
+			}{utils.NewThrottledReader(resp.Body, p.RateLimit), resp.Body}
+		}()
+	}
+	if p.RewriteLocation && resp.Request.Method == "GET" && isRedirect(resp.StatusCode) {
+		if err := p.followRedirect(resp); err != nil {
+			return err
+		}
+	}
+	if p.RewriteLocation && resp.Request.Method == "HEAD" && isRedirect(resp.StatusCode) {
+		// cache in the background below, then send the client back to this server
+		defer p.rewriteLocation(resp)
+	}
+	if p.readOnly.Load() {
+		// maintenance mode, proxy without touching the cache
+		return nil
+	}
 	if resp.Request.Method == "HEAD" {
-		if location := resp.Header.Get("Location"); location != "" {
-			go func() {
-				f, err := p.CreateModelFile(resp, resp.Request)
+		// the hub may redirect relative to the request, like followRedirect resolves it
+		location, err := resp.Request.URL.Parse(resp.Header.Get("Location"))
+		if resp.Header.Get("Location") != "" && err == nil {
+			// the fill outlives this call while the deferred rewriteLocation still
+			// changes resp, so it works on a copy of the response metadata
+			head := &http.Response{
+				Status:        resp.Status,
+				StatusCode:    resp.StatusCode,
+				Header:        resp.Header.Clone(),
+				ContentLength: resp.ContentLength,
+				Request:       resp.Request,
+			}
+			p.goBackground(func(ctx context.Context) {
+				w, err := p.CreateModelFile(head, head.Request)
+				if errors.Is(err, errCacheInProgress) || errors.Is(err, errBlobCached) {
+					return
+				}
+				if err != nil {
+					slog.Error("failed to create cache file", "path", head.Request.URL.Path, "error", err)
+					return
+				}
+				req, err := http.NewRequestWithContext(ctx, http.MethodGet, location.String(), nil)
 				if err != nil {
-					log.Printf("failed to create file: %+v", err)
+					w.Abort()
+					slog.Error("failed to create upstream request", "path", head.Request.URL.Path, "error", err)
 					return
 				}
-				rsp, err := http.Get(location)
+				rsp, err := (&http.Client{Transport: p.proxy.Transport}).Do(req)
 				if err != nil {
-					log.Printf("failed to get file: %+v", err)
+					w.Abort()
+					slog.Error("failed to fetch file", "path", head.Request.URL.Path, "error", err)
 					return
 				}
 				defer rsp.Body.Close()
-				defer f.Close()
-				io.Copy(f, rsp.Body)
-				log.Println("Write file done", f.Name())
-			}()
-			log.Println("HEAD request with Location header", location)
+				if rsp.StatusCode != http.StatusOK {
+					w.Abort()
+					slog.Error("failed to fetch file", "path", head.Request.URL.Path, "status", rsp.Status)
+					return
+				}
+				if _, err := io.Copy(w, rsp.Body); err != nil {
+					w.Abort()
+					slog.Error("failed to write cache file", "path", w.path, "error", err)
+					return
+				}
+				if err := w.Commit(); err != nil {
+					slog.Error("failed to commit cache file", "path", w.path, "error", err)
+					return
+				}
+				slog.Debug("cached file", "path", w.path)
+			})
+			slog.Debug("caching redirected file in the background", "location", redactQuery(location))
 		}
 		return nil
 	}
 	vars := mux.Vars(resp.Request)
+	if vars["model_id"] == "" {
+		// generic API responses are cached by HandleAPI, not in the model layout
+		return nil
+	}
+	// only complete responses are cached, errors, redirects and partial content
+	// must not replace the cached index or end up in a blob
+	if resp.StatusCode != http.StatusOK {
+		return nil
+	}
 	shaOrVersion := vars["sha"]
 	var (
-		f   *os.File
-		err error
+		w        *CacheWriter
+		err      error
+		onCommit func()
 	)
 	if shaOrVersion == "" {
 		// save .modexlindex
-		f, err = p.CreateModelIndexFile(resp.Request)
+		w, err = p.CreateModelIndexFile(resp.Request)
+		if err == nil {
+			index := &bytes.Buffer{}
+			resp.Body = struct {
+				io.Reader
+				io.Closer
+			}{io.TeeReader(resp.Body, index), resp.Body}
+			onCommit = func() {
+				p.updateRef(vars["model_id"], vars["version"], index.Bytes())
+			}
+		}
 	} else {
 		// other file
-		f, err = p.CreateModelFile(resp, resp.Request)
+		w, err = p.CreateModelFile(resp, resp.Request)
+	}
+	if errors.Is(err, errCacheInProgress) {
+		// another request is populating the cache, just stream from the upstream
+		return nil
+	}
+	if errors.Is(err, errBlobCached) {
+		// the file is unchanged since a cached revision, serve the blob instead of
+		// transferring it again
+		return p.serveCachedBlob(resp, vars["model_id"])
 	}
 	if err != nil {
-		log.Printf("failed to create file: %+v", err)
+		slog.Error("failed to create cache file", "path", resp.Request.URL.Path, "error", err)
 		return err
 	}
 
 	buf := p.bufferPool.Get().([]byte)
-	defer p.bufferPool.Put(buf)
-	resp.Body = io.NopCloser(io.TeeReader(
-		resp.Body,
-		&streamWriter{
-			writer: f,
-			buffer: buf,
+	resp.Body = &cacheBody{
+		Reader: io.TeeReader(
+			resp.Body,
+			&streamWriter{
+				writer: w,
+				buffer: buf,
+			},
+		),
+		body: resp.Body,
+		onClose: func(complete bool) {
+			p.bufferPool.Put(buf)
+			if !complete {
+				w.Abort()
+				return
+			}
+			if err := w.Commit(); err != nil {
+				slog.Error("failed to commit cache file", "path", w.path, "error", err)
+				return
+			}
+			if onCommit != nil {
+				onCommit()
+			}
 		},
-	))
+	}
 	// if shaOrVersion != "" {
 	// 	vars := mux.Vars(resp.Request)
 	// 	modelID := vars["model_id"]
@@ -178,6 +418,32 @@ func (p *Proxy) WithModifyResponseToCache(resp *http.Response) error {
 	return nil
 }
 
+// cacheBody tees the upstream body into the cache and runs onClose once the
+// proxied response has been fully consumed or aborted
+type cacheBody struct {
+	io.Reader
+	body     io.Closer
+	onClose  func(complete bool)
+	once     sync.Once
+	complete bool
+}
+
+func (b *cacheBody) Read(p []byte) (int, error) {
+	n, err := b.Reader.Read(p)
+	if err == io.EOF {
+		b.complete = true
+	}
+	return n, err
+}
+
+func (b *cacheBody) Close() error {
+	err := b.body.Close()
+	b.once.Do(func() {
+		b.onClose(b.complete)
+	})
+	return err
+}
+
 type streamWriter struct {
 	writer io.Writer
 	buffer []byte
@@ -202,54 +468,256 @@ func (sw *streamWriter) Write(p []byte) (n int, err error) {
 	return written, nil
 }
 
-func (p *Proxy) CreateModelFile(resp *http.Response, r *http.Request) (*os.File, error) {
+func (p *Proxy) CreateModelFile(resp *http.Response, r *http.Request) (*CacheWriter, error) {
 	vars := mux.Vars(r)
 	modelID := vars["model_id"]
 	filename := vars["filename"]
+	revision := vars["sha"]
 	commit, etag, err := getCommitAndEtag(resp)
 	if err != nil {
 		return nil, err
 	}
-	blobDir := filepath.Join(p.path(modelID), "blobs")
-	if _, err := os.Stat(blobDir); os.IsNotExist(err) {
-		os.MkdirAll(blobDir, 0755)
+	if commit == "" {
+		// some CDN responses omit x-repo-commit, fall back to the requested revision
+		if commit, err = p.resolveCommit(modelID, revision); err != nil {
+			return nil, err
+		}
+	}
+	if etag == "" {
+		return nil, fmt.Errorf("upstream response for %s/%s is missing etag", modelID, filename)
+	}
+	if p.linkCachedBlob(modelID, filename, commit, etag, responseSize(resp)) {
+		if err := p.writeRef(modelID, revision, commit); err != nil {
+			return nil, err
+		}
+		return nil, errBlobCached
+	}
+	w, err := p.createCacheFile(modelID, filename, commit, etag)
+	if err != nil {
+		return nil, err
+	}
+	// like the index, record which commit the requested revision resolved to so the
+	// cached file is also served for the revision name
+	linkSnapshot := w.onCommit
+	w.onCommit = func() error {
+		if err := linkSnapshot(); err != nil {
+			return err
+		}
+		return p.writeRef(modelID, revision, commit)
+	}
+	return w, nil
+}
+
+// resolveCommit derives the commit of a revision that is either a commit sha or a cached ref
+func (p *Proxy) resolveCommit(modelID, revision string) (string, error) {
+	if isCommitSha(revision) {
+		return revision, nil
+	}
+	if revision != "" {
+		if commit, err := utils.ReadRef(p.layout().RefPath(modelID, revision)); err == nil && commit != "" {
+			return commit, nil
+		}
+	}
+	return "", fmt.Errorf("cannot determine commit for %s revision %q: upstream sent no x-repo-commit and no cached ref exists", modelID, revision)
+}
+
+// isCommitSha reports whether s looks like a full git commit sha
+func isCommitSha(s string) bool {
+	if len(s) != 40 {
+		return false
+	}
+	for _, c := range s {
+		if !strings.ContainsRune("0123456789abcdef", c) {
+			return false
+		}
 	}
-	blobPath := filepath.Join(blobDir, etag)
-	file, err := os.Create(blobPath)
-	destDir := filepath.Join(p.path(modelID), "snapshots", commit)
-	if _, err := os.Stat(destDir); os.IsNotExist(err) {
-		os.MkdirAll(destDir, 0755)
+	return true
+}
+
+// createCacheFile creates the blob for etag, it is linked into the snapshot of commit
+// once the blob has been completely written
+func (p *Proxy) createCacheFile(modelID, filename, commit, etag string) (*CacheWriter, error) {
+	blobPath := p.blobPath(modelID, etag)
+	w, err := p.newCacheWriter(blobPath, func() error {
+		return p.linkBlob(modelID, commit, filename, etag, blobPath)
+	})
+	if err == nil && p.StrictBlobs {
+		w.verify = verifyBlobConflict(blobPath)
+	}
+	return w, err
+}
+
+// serveCachedBlob replaces the body of an upstream response with the cached blob of
+// the same etag and drops the upstream connection
+func (p *Proxy) serveCachedBlob(resp *http.Response, modelID string) error {
+	_, etag, err := getCommitAndEtag(resp)
+	if err != nil {
+		return err
+	}
+	blob, err := p.openCachedBlob(modelID, etag)
+	if err != nil {
+		// removed in the meantime, stream from the upstream
+		return nil
+	}
+	resp.Body.Close()
+	resp.Body = blob
+	return nil
+}
+
+// cachedBlob returns the path and content size of the cached blob of etag, which the
+// storage may have compressed since it was cached. The size is -1 when the blob is not
+// cached.
+func (p *Proxy) cachedBlob(modelID, etag string) (string, int64) {
+	blobPath := p.blobPath(modelID, etag)
+	if info, err := os.Stat(blobPath); err == nil {
+		if info.IsDir() {
+			return blobPath, -1
+		}
+		return blobPath, info.Size()
+	}
+	blobPath += utils.CompressedSuffix
+	size, err := utils.CompressedSize(blobPath)
+	if err != nil {
+		return blobPath, -1
+	}
+	return blobPath, size
+}
+
+// openCachedBlob opens the cached blob of etag for reading its content
+func (p *Proxy) openCachedBlob(modelID, etag string) (io.ReadCloser, error) {
+	blobPath, _ := p.cachedBlob(modelID, etag)
+	if strings.HasSuffix(blobPath, utils.CompressedSuffix) {
+		return utils.OpenCompressed(blobPath)
+	}
+	return os.Open(blobPath)
+}
+
+// blobPath returns the path of the cached blob of etag
+func (p *Proxy) blobPath(modelID, etag string) string {
+	if p.SharedBlobs {
+		// identical files of different models are stored once, keyed by etag
+		return p.layout().SharedBlobPath(etag)
 	}
-	destfile := filepath.Join(destDir, filename)
-	symlinkOrRename(blobPath, destfile)
-	return file, err
+	return p.layout().BlobPath(modelID, etag)
 }
 
-func (p *Proxy) CreateModelIndexFile(r *http.Request) (*os.File, error) {
+// linkBlob links the blob of etag as filename into the snapshot of commit and records
+// it in the metadata of the snapshot
+func (p *Proxy) linkBlob(modelID, commit, filename, etag, blobPath string) error {
+	destfile := p.layout().SnapshotPath(modelID, commit, filename)
+	if err := os.MkdirAll(filepath.Dir(destfile), 0755); err != nil {
+		return err
+	}
+	if err := symlinkOrRename(blobPath, destfile); err != nil {
+		return err
+	}
+	// on Windows a blob that can not be hard linked is moved into the snapshot
+	if _, err := os.Stat(blobPath); err != nil {
+		blobPath = destfile
+	}
+	if err := utils.RecordSnapshotBlob(p.layout().SnapshotMetaPath(modelID, commit), filename, etag, blobPath); err != nil {
+		slog.Warn("failed to record file in the snapshot metadata", "model", modelID, "snapshot", commit, "file", filename, "error", err)
+	}
+	return nil
+}
+
+// linkCachedBlob links the cached blob of etag into the snapshot of commit when it
+// exists with the expected size, which is the case when a file is unchanged between
+// revisions. It reports whether the blob was linked, the upstream content is then not
+// needed. A negative size is unknown and never matches.
+func (p *Proxy) linkCachedBlob(modelID, filename, commit, etag string, size int64) bool {
+	if size < 0 {
+		return false
+	}
+	blobPath, cachedSize := p.cachedBlob(modelID, etag)
+	if cachedSize != size {
+		return false
+	}
+	// an unlinked blob is kept by the garbage collection while it is young, so it
+	// survives until the snapshot links to it
+	now := time.Now()
+	os.Chtimes(blobPath, now, now)
+	if err := p.linkBlob(modelID, commit, filename, etag, blobPath); err != nil {
+		slog.Error("failed to link cached blob", "blob", blobPath, "error", err)
+		return false
+	}
+	return true
+}
+
+// responseSize returns the size of the file an upstream response describes, from
+// X-Linked-Size for redirected LFS files, or -1 when it is unknown
+func responseSize(resp *http.Response) int64 {
+	if size, err := strconv.ParseInt(resp.Header.Get("X-Linked-Size"), 10, 64); err == nil {
+		return size
+	}
+	if resp.StatusCode == http.StatusOK {
+		return resp.ContentLength
+	}
+	return -1
+}
+
+func (p *Proxy) CreateModelIndexFile(r *http.Request) (*CacheWriter, error) {
 	vars := mux.Vars(r)
 	modelID := vars["model_id"]
-	version := vars["version"]
-	modelIndexPath := filepath.Join(p.path(modelID), ".modeindex")
-	if _, err := os.Stat(modelIndexPath); err == nil {
-		os.Remove(modelIndexPath)
+	modelIndexPath := p.layout().IndexPath(modelID)
+	slog.Debug("caching model index", "path", modelIndexPath)
+	return p.newCacheWriter(modelIndexPath, nil)
+}
+
+// updateRef points refs/<version> at the sha of a freshly fetched model index.
+// When the upstream ref has moved, the previous snapshot is removed unless
+// KeepOldSnapshots is set, another ref still points to it or it is being served.
+func (p *Proxy) updateRef(modelID, version string, index []byte) {
+	var info struct {
+		SHA string `json:"sha"`
+	}
+	if err := json.Unmarshal(index, &info); err != nil || info.SHA == "" {
+		slog.Warn("skip updating ref, no sha in model index", "model", modelID, "ref", version)
+		return
 	}
-	file, err := os.Create(modelIndexPath)
-	log.Printf("Downloading model index for %s", modelIndexPath)
-	versionFileDir := filepath.Join(p.path(modelID), "refs")
-	if _, err := os.Stat(versionFileDir); os.IsNotExist(err) {
-		os.MkdirAll(versionFileDir, 0755)
+	versionFilePath := p.layout().RefPath(modelID, version)
+	oldSha, _ := utils.ReadRef(versionFilePath)
+	if oldSha == info.SHA {
+		return
+	}
+	if err := utils.WriteRef(versionFilePath, info.SHA); err != nil {
+		slog.Error("failed to update ref", "model", modelID, "ref", version, "error", err)
+		return
+	}
+	slog.Info("updated ref", "model", modelID, "ref", version, "from", oldSha, "to", info.SHA)
+	// a snapshot another ref still points to, like a tag, must stay served
+	if oldSha != "" && !p.KeepOldSnapshots && !p.refersTo(modelID, oldSha) && !p.snapshotPinned(modelID, oldSha) {
+		if err := os.RemoveAll(p.layout().SnapshotPath(modelID, oldSha, "")); err != nil {
+			slog.Error("failed to remove old snapshot", "model", modelID, "snapshot", oldSha, "error", err)
+		}
+		os.Remove(p.layout().SnapshotMetaPath(modelID, oldSha))
 	}
-	versionFilePath := filepath.Join(versionFileDir, version)
-	os.Create(versionFilePath)
-	return file, err
 }
 
-func (p *Proxy) path(modelID string) string {
-	dir := filepath.Join(p.baseDir, "hub", utils.ConvertModelIDToHFPath(modelID))
-	if _, err := os.Stat(dir); os.IsNotExist(err) {
-		os.MkdirAll(dir, 0755)
-	}
-	return dir
+// snapshotPinned reports whether the snapshot sha of a model is being served
+func (p *Proxy) snapshotPinned(modelID, sha string) bool {
+	return p.pinned != nil && p.pinned(modelID, sha)
+}
+
+// refersTo reports whether a ref of a model points to commit
+func (p *Proxy) refersTo(modelID, commit string) bool {
+	refsDir := p.layout().RefPath(modelID, "")
+	found := false
+	filepath.WalkDir(refsDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || found {
+			return nil
+		}
+		if sha, err := utils.ReadRef(path); err == nil && sha == commit {
+			found = true
+		}
+		return nil
+	})
+	return found
+}
+
+// layout returns the layout of the models in the hub directory of the cache
+func (p *Proxy) layout() utils.Layout {
+	return utils.NewLayout(filepath.Join(p.baseDir, "hub"), p.layoutStrategy).WithRepoType(p.repoType).WithBlobDir(p.blobDir)
 }
 
 func getCommitAndEtag(res *http.Response) (string, string, error) {
@@ -258,6 +726,10 @@ func getCommitAndEtag(res *http.Response) (string, string, error) {
 	if len(etag) == 0 {
 		etag = res.Header.Get("etag")
 	}
-	etag = strings.ReplaceAll(etag, "\"", "")
+	etag = strings.ReplaceAll(strings.TrimPrefix(etag, "W/"), "\"", "")
+	if etag == "" && res.ContentLength == 0 {
+		// every empty file has the same content, so its blob can be named without an etag
+		etag = utils.EmptyBlobEtag
+	}
 	return commitHash, etag, nil
 }
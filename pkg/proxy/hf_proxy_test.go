@@ -0,0 +1,219 @@
+package proxy
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/lengrongfu/LLMDistribution/pkg/utils"
+)
+
+// testCommit is the commit the test upstreams report in X-Repo-Commit
+const testCommit = "0123456789abcdef0123456789abcdef01234567"
+
+// headRedirect returns the response of the upstream at base to a HEAD for filename of
+// org/m at main, redirecting to location
+func headRedirect(t *testing.T, base, filename, content, location string) *http.Response {
+	t.Helper()
+	etag, err := utils.ComputeEtag(filename, strings.NewReader(content), int64(len(content)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest("HEAD", base+"/org/m/resolve/main/"+filename, nil)
+	req = mux.SetURLVars(req, map[string]string{"model_id": "org/m", "sha": "main", "filename": filename})
+	header := http.Header{}
+	header.Set("Location", location)
+	header.Set("X-Repo-Commit", testCommit)
+	header.Set("X-Linked-Etag", `"`+etag+`"`)
+	header.Set("X-Linked-Size", strconv.Itoa(len(content)))
+	return &http.Response{
+		Status:     "302 Found",
+		StatusCode: http.StatusFound,
+		Header:     header,
+		Body:       http.NoBody,
+		Request:    req,
+	}
+}
+
+// cdnServer serves content at every path
+func cdnServer(t *testing.T, content string) *httptest.Server {
+	t.Helper()
+	cdn := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, content)
+	}))
+	t.Cleanup(cdn.Close)
+	return cdn
+}
+
+// cachedSnapshotFile returns the content of filename in the snapshot of testCommit
+func cachedSnapshotFile(t *testing.T, p *Proxy, filename string) string {
+	t.Helper()
+	data, err := os.ReadFile(p.layout().SnapshotPath("org/m", testCommit, filename))
+	if err != nil {
+		t.Fatalf("%s was not cached: %v", filename, err)
+	}
+	return string(data)
+}
+
+func TestHeadLocationFillWithRewrittenLocation(t *testing.T) {
+	cdn := cdnServer(t, "{}")
+	p := newTestProxy(t, cdn.URL)
+	p.WithRewriteLocation(true)
+
+	resp := headRedirect(t, cdn.URL, "config.json", "{}", cdn.URL+"/cdn/config.json")
+	if err := p.WithModifyResponseToCache(resp); err != nil {
+		t.Fatalf("WithModifyResponseToCache: %v", err)
+	}
+	if got, want := resp.Header.Get("Location"), "/org/m/resolve/"+testCommit+"/config.json"; got != want {
+		t.Errorf("Location = %s, want %s", got, want)
+	}
+	if err := p.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got := cachedSnapshotFile(t, p, "config.json"); got != "{}" {
+		t.Errorf("cached content = %q", got)
+	}
+}
+
+func TestHeadLocationFillResolvesRelativeLocation(t *testing.T) {
+	tests := []struct {
+		name     string
+		location string
+	}{
+		{"absolute path", "/cdn/config.json"},
+		{"relative path", "../../cdn/config.json"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			upstream := cdnServer(t, "{}")
+			p := newTestProxy(t, upstream.URL)
+			resp := headRedirect(t, upstream.URL, "config.json", "{}", tt.location)
+			if err := p.WithModifyResponseToCache(resp); err != nil {
+				t.Fatalf("WithModifyResponseToCache: %v", err)
+			}
+			if err := p.Close(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+			if got := cachedSnapshotFile(t, p, "config.json"); got != "{}" {
+				t.Errorf("cached content = %q", got)
+			}
+		})
+	}
+}
+
+func TestUpstreamTimeout(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+		io.WriteString(w, "{}")
+	}))
+	defer upstream.Close()
+
+	tests := []struct {
+		name    string
+		timeout time.Duration
+		want    int
+	}{
+		{"default timeout", 0, http.StatusOK},
+		{"slow upstream", 50 * time.Millisecond, http.StatusServiceUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := NewProxy(upstream.URL, Options{UpstreamTimeout: tt.timeout})
+			rec := httptest.NewRecorder()
+			p.HandleGetModelFile(rec, httptest.NewRequest("GET", "/org/m/resolve/main/config.json", nil))
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d", rec.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetCommitAndEtag(t *testing.T) {
+	tests := []struct {
+		name          string
+		linkedEtag    string
+		etag          string
+		contentLength int64
+		want          string
+	}{
+		{name: "linked etag wins", linkedEtag: `"lfs"`, etag: `"git"`, contentLength: 3, want: "lfs"},
+		{name: "quoted etag", etag: `"git"`, contentLength: 3, want: "git"},
+		{name: "weak etag", etag: `W/"git"`, contentLength: 3, want: "git"},
+		{name: "empty file without etag", contentLength: 0, want: utils.EmptyBlobEtag},
+		{name: "unknown length without etag", contentLength: -1, want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := http.Header{}
+			header.Set("X-Repo-Commit", testCommit)
+			if tt.linkedEtag != "" {
+				header.Set("X-Linked-Etag", tt.linkedEtag)
+			}
+			if tt.etag != "" {
+				header.Set("ETag", tt.etag)
+			}
+			commit, etag, err := getCommitAndEtag(&http.Response{Header: header, ContentLength: tt.contentLength})
+			if err != nil || commit != testCommit || etag != tt.want {
+				t.Errorf("getCommitAndEtag() = %q, %q, %v, want %q, %q", commit, etag, err, testCommit, tt.want)
+			}
+		})
+	}
+}
+
+func TestUpstreamCanceledWithClient(t *testing.T) {
+	canceled := make(chan struct{}, 1)
+	received := make(chan struct{}, 1)
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received <- struct{}{}
+		<-r.Context().Done()
+		canceled <- struct{}{}
+	}))
+	defer upstream.Close()
+	p := newTestProxy(t, upstream.URL)
+	logs := captureLogs(t)
+
+	tests := []struct {
+		name  string
+		serve func(w http.ResponseWriter, r *http.Request)
+	}{
+		{"file", p.HandleGetModelFile},
+		{"model index", func(w http.ResponseWriter, r *http.Request) {
+			if _, err := p.GetModelIndex(r); err == nil {
+				t.Error("GetModelIndex succeeded for a canceled client")
+			}
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			req := httptest.NewRequest("GET", "/org/m/resolve/main/config.json", nil).WithContext(ctx)
+			req = mux.SetURLVars(req, map[string]string{"model_id": "org/m", "version": "main"})
+			go func() {
+				<-received
+				cancel()
+			}()
+			rec := httptest.NewRecorder()
+			tt.serve(rec, req)
+
+			select {
+			case <-canceled:
+			case <-time.After(5 * time.Second):
+				t.Fatal("upstream request was not canceled with the client request")
+			}
+			if rec.Code == http.StatusServiceUnavailable {
+				t.Fatal("canceled client was answered with 503")
+			}
+		})
+	}
+	if strings.Contains(logs.String(), "failed to proxy request") {
+		t.Fatalf("client cancellation was logged as an upstream error:\n%s", logs)
+	}
+}
@@ -0,0 +1,87 @@
+package proxy
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/lengrongfu/LLMDistribution/pkg/utils"
+)
+
+func TestUpdateRefRemovesOldSnapshot(t *testing.T) {
+	const newCommit = "fedcba9876543210fedcba9876543210fedcba98"
+	tests := []struct {
+		name    string
+		pinned  bool
+		tag     bool
+		keepOld bool
+		kept    bool
+	}{
+		{"unused snapshot", false, false, false, false},
+		{"pinned snapshot", true, false, false, true},
+		{"tagged snapshot", false, true, false, true},
+		{"keep old snapshots", false, false, true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newTestProxy(t, "http://127.0.0.1:1")
+			p.WithKeepOldSnapshots(tt.keepOld)
+			p.WithPinnedSnapshots(func(modelID, sha string) bool {
+				return tt.pinned && modelID == "org/m" && sha == testCommit
+			})
+			layout := p.layout()
+			snapshotFile := layout.SnapshotPath("org/m", testCommit, "config.json")
+			if err := os.MkdirAll(filepath.Dir(snapshotFile), 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(snapshotFile, []byte("{}"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if err := utils.WriteRef(layout.RefPath("org/m", "main"), testCommit); err != nil {
+				t.Fatal(err)
+			}
+			if tt.tag {
+				if err := utils.WriteRef(layout.RefPath("org/m", "v1"), testCommit); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			p.updateRef("org/m", "main", []byte(`{"sha":"`+newCommit+`"}`))
+
+			if sha, _ := utils.ReadRef(layout.RefPath("org/m", "main")); sha != newCommit {
+				t.Fatalf("ref main = %q, want %q", sha, newCommit)
+			}
+			_, err := os.Stat(snapshotFile)
+			if kept := err == nil; kept != tt.kept {
+				t.Fatalf("old snapshot kept = %v, want %v", kept, tt.kept)
+			}
+		})
+	}
+}
+
+func TestResolveCommit(t *testing.T) {
+	p := newTestProxy(t, "http://127.0.0.1:1")
+	if err := utils.WriteRef(p.layout().RefPath("org/m", "main"), testCommit); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name     string
+		revision string
+		want     string
+		wantErr  bool
+	}{
+		{"commit", "fedcba9876543210fedcba9876543210fedcba98", "fedcba9876543210fedcba9876543210fedcba98", false},
+		{"cached ref", "main", testCommit, false},
+		{"uncached ref", "dev", "", true},
+		{"no revision", "", "", true},
+		{"short sha", "0123456", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := p.resolveCommit("org/m", tt.revision)
+			if (err != nil) != tt.wantErr || got != tt.want {
+				t.Errorf("resolveCommit(%q) = %q, %v, want %q", tt.revision, got, err, tt.want)
+			}
+		})
+	}
+}
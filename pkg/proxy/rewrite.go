@@ -0,0 +1,103 @@
+package proxy
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// WithRewriteLocation makes the proxy keep clients away from the CDN the upstream
+// redirects file downloads to: redirect Locations of HEAD requests point back at this
+// server and redirects of GET requests are followed by the proxy itself.
+func (p *Proxy) WithRewriteLocation(rewrite bool) {
+	p.RewriteLocation = rewrite
+}
+
+// rewriteLocation points the Location of a file redirect at the local resolve route of
+// the commit, which the client then downloads from this server
+func (p *Proxy) rewriteLocation(resp *http.Response) {
+	vars := mux.Vars(resp.Request)
+	if vars["model_id"] == "" || vars["filename"] == "" {
+		return
+	}
+	revision := resp.Header.Get("X-Repo-Commit")
+	if revision == "" {
+		revision = vars["sha"]
+	}
+	local := fmt.Sprintf("/%s/resolve/%s/%s", vars["model_id"], revision, vars["filename"])
+	if local != resp.Request.URL.Path {
+		resp.Header.Set("Location", local)
+		return
+	}
+	// the client already asked for the commit, redirecting to the same path would loop
+	// while the file is still being cached, so answer with the file metadata instead
+	resp.Header.Del("Location")
+	if size := resp.Header.Get("X-Linked-Size"); size != "" {
+		resp.Header.Set("Content-Length", size)
+	}
+	resp.Status = "200 OK"
+	resp.StatusCode = http.StatusOK
+}
+
+// followRedirect replaces a redirect response with the response of its Location. The
+// headers describing the file, like X-Repo-Commit and X-Linked-Etag, are kept from the
+// redirect so the content can still be cached.
+func (p *Proxy) followRedirect(resp *http.Response) error {
+	location, err := resp.Request.URL.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		return fmt.Errorf("invalid redirect location: %w", err)
+	}
+	req, err := http.NewRequestWithContext(resp.Request.Context(), "GET", location.String(), nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	if rng := resp.Request.Header.Get("Range"); rng != "" {
+		req.Header.Set("Range", rng)
+	}
+	// the body is streamed to the client, so only the response headers are bounded
+	target, err := (&http.Client{Transport: p.proxy.Transport}).Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to follow redirect to %s: %w", redactQuery(location), err)
+	}
+
+	resp.Body.Close()
+	header := resp.Header.Clone()
+	header.Del("Location")
+	for _, key := range []string{"Content-Type", "Content-Length", "Content-Range", "Accept-Ranges", "Last-Modified"} {
+		header.Del(key)
+		if value := target.Header.Get(key); value != "" {
+			header.Set(key, value)
+		}
+	}
+	if header.Get("ETag") == "" {
+		header.Set("ETag", target.Header.Get("ETag"))
+	}
+	resp.Status = target.Status
+	resp.StatusCode = target.StatusCode
+	resp.Header = header
+	resp.Body = target.Body
+	resp.ContentLength = target.ContentLength
+	return nil
+}
+
+// isRedirect reports whether status redirects to a Location
+func isRedirect(status int) bool {
+	switch status {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusSeeOther,
+		http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		return true
+	}
+	return false
+}
+
+// redactQuery drops the query of a URL, CDN URLs carry signed credentials there
+func redactQuery(u *url.URL) string {
+	s := u.String()
+	if i := strings.IndexByte(s, '?'); i >= 0 {
+		return s[:i]
+	}
+	return s
+}
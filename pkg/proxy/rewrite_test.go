@@ -0,0 +1,73 @@
+package proxy
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+func TestRewriteLocation(t *testing.T) {
+	const cdn = "https://cdn.example.com/blob?signature=x"
+	tests := []struct {
+		name         string
+		path         string
+		vars         map[string]string
+		wantStatus   int
+		wantLocation string
+	}{
+		{"ref request", "/org/m/resolve/main/config.json",
+			map[string]string{"model_id": "org/m", "sha": "main", "filename": "config.json"},
+			http.StatusFound, "/org/m/resolve/" + testCommit + "/config.json"},
+		{"commit request", "/org/m/resolve/" + testCommit + "/config.json",
+			map[string]string{"model_id": "org/m", "sha": testCommit, "filename": "config.json"},
+			http.StatusOK, ""},
+		{"not a file route", "/api/models/org/m", nil, http.StatusFound, cdn},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("HEAD", tt.path, nil)
+			if tt.vars != nil {
+				req = mux.SetURLVars(req, tt.vars)
+			}
+			header := http.Header{}
+			header.Set("Location", cdn)
+			header.Set("X-Repo-Commit", testCommit)
+			header.Set("X-Linked-Size", "42")
+			resp := &http.Response{StatusCode: http.StatusFound, Header: header, Request: req}
+
+			(&Proxy{}).rewriteLocation(resp)
+			if resp.StatusCode != tt.wantStatus || resp.Header.Get("Location") != tt.wantLocation {
+				t.Errorf("got %d Location %q, want %d %q", resp.StatusCode, resp.Header.Get("Location"), tt.wantStatus, tt.wantLocation)
+			}
+			if tt.wantStatus == http.StatusOK && resp.Header.Get("Content-Length") != "42" {
+				t.Errorf("Content-Length = %q, want the linked size", resp.Header.Get("Content-Length"))
+			}
+		})
+	}
+}
+
+func TestFollowRedirect(t *testing.T) {
+	cdn := cdnServer(t, "weights")
+	p := newTestProxy(t, cdn.URL)
+	req := httptest.NewRequest("GET", "http://upstream/org/m/resolve/main/model.bin", nil)
+	header := http.Header{}
+	header.Set("Location", cdn.URL+"/blob")
+	header.Set("X-Repo-Commit", testCommit)
+	header.Set("X-Linked-Etag", `"abc"`)
+	resp := &http.Response{StatusCode: http.StatusFound, Header: header, Body: http.NoBody, Request: req}
+
+	if err := p.followRedirect(resp); err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK || string(body) != "weights" {
+		t.Errorf("got %d %q, want %d %q", resp.StatusCode, body, http.StatusOK, "weights")
+	}
+	if resp.Header.Get("Location") != "" || resp.Header.Get("X-Repo-Commit") != testCommit || resp.Header.Get("X-Linked-Etag") != `"abc"` {
+		t.Errorf("headers = %v", resp.Header)
+	}
+}
@@ -0,0 +1,393 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// sparseMetaTTL is how long the upstream commit, etag and size of a branch or tag file
+// served from a sparse blob are reused, the metadata of a commit never changes
+const sparseMetaTTL = time.Minute
+
+// byteRange is the half-open range [Start, End) of a file
+type byteRange struct {
+	Start int64 `json:"start"`
+	End   int64 `json:"end"`
+}
+
+// sparseMeta describes an upstream file served from a sparse blob. The signed CDN
+// location the upstream redirects to expires, so it is not part of the metadata and
+// every fill resolves it again.
+type sparseMeta struct {
+	commit string
+	etag   string
+	size   int64
+	// url is the resolve URL of the file on the upstream
+	url     string
+	expires time.Time
+}
+
+// sparseBlob is a blob of which only the ranges fetched so far are cached. The data
+// is written at its offset into a sparse file and the cached ranges are recorded in a
+// ".ranges" file next to it. mu guards the range bookkeeping only, ranges are fetched
+// from the upstream without holding it.
+type sparseBlob struct {
+	mu     sync.Mutex
+	path   string
+	size   int64
+	ranges []byteRange
+	// promoted is set once the blob has been moved into the blobs
+	promoted bool
+}
+
+// WithSparseCache caches only the requested ranges of files of at least minSize bytes
+// instead of downloading the whole file for a ranged request. A minSize <= 0 disables
+// sparse caching.
+func (p *Proxy) WithSparseCache(minSize int64) {
+	p.sparseMu.Lock()
+	defer p.sparseMu.Unlock()
+	p.sparseMinSize = minSize
+	p.sparseMetas = make(map[string]sparseMeta)
+	p.sparseBlobs = make(map[string]*sparseBlob)
+}
+
+// ServeRange answers a single range request for an uncached file from a sparse blob,
+// fetching only the parts of the range that are not cached yet from the upstream.
+// Once every byte of a file has been fetched the blob is linked into the snapshot
+// like a fully downloaded file. It returns false without writing a response when the
+// request is not eligible, so the caller can proxy it instead.
+func (p *Proxy) ServeRange(w http.ResponseWriter, r *http.Request) bool {
+	if p.sparseMinSize <= 0 || p.readOnly.Load() || r.Method != "GET" {
+		return false
+	}
+	vars := mux.Vars(r)
+	modelID := vars["model_id"]
+	revision := vars["sha"]
+	filename := vars["filename"]
+
+	meta, err := p.sparseFileMeta(r.Context(), modelID, revision, filename)
+	if err != nil {
+		slog.Warn("failed to resolve file for a sparse read", "model", modelID, "file", filename, "error", err)
+		return false
+	}
+	if meta.size < p.sparseMinSize {
+		return false
+	}
+	want, ok := parseRange(r.Header.Get("Range"), meta.size)
+	if !ok {
+		// multiple or unsatisfiable ranges are answered by the upstream
+		return false
+	}
+
+	blob, err := p.sparseBlob(modelID, meta)
+	if err != nil {
+		slog.Error("failed to open sparse blob", "model", modelID, "file", filename, "error", err)
+		return false
+	}
+	if err := blob.fill(r.Context(), p.proxy.Transport, meta.url, want); err != nil {
+		slog.Error("failed to fetch range", "model", modelID, "file", filename, "error", err)
+		return false
+	}
+	f, err := os.Open(blob.path)
+	if err != nil {
+		slog.Error("failed to read sparse blob", "blob", blob.path, "error", err)
+		return false
+	}
+	defer f.Close()
+	p.recordMiss()
+
+	w.Header().Set("X-Repo-Commit", meta.commit)
+	w.Header().Set("ETag", `"`+meta.etag+`"`)
+	w.Header().Set("Accept-Ranges", "bytes")
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", want.Start, want.End-1, meta.size))
+	w.Header().Set("Content-Length", strconv.FormatInt(want.End-want.Start, 10))
+	w.WriteHeader(http.StatusPartialContent)
+	io.Copy(w, io.NewSectionReader(f, want.Start, want.End-want.Start))
+
+	if blob.complete() {
+		p.promoteSparseBlob(modelID, revision, filename, meta, blob)
+	}
+	return true
+}
+
+// sparseFileMeta resolves the commit, etag and size of an upstream file, its url is
+// the resolve URL of the upstream that redirects to the current CDN location
+func (p *Proxy) sparseFileMeta(ctx context.Context, modelID, revision, filename string) (sparseMeta, error) {
+	key := modelID + "/" + revision + "/" + filename
+	p.sparseMu.Lock()
+	meta, ok := p.sparseMetas[key]
+	p.sparseMu.Unlock()
+	if ok && (isCommitSha(revision) || time.Now().Before(meta.expires)) {
+		return meta, nil
+	}
+
+	fileURL := p.resolveURL(modelID, revision, filename)
+	head, err := p.headFile(ctx, fileURL)
+	if err != nil {
+		return meta, err
+	}
+	commit, etag, err := getCommitAndEtag(head)
+	if err != nil {
+		return meta, err
+	}
+	if commit == "" {
+		if commit, err = p.resolveCommit(modelID, revision); err != nil {
+			return meta, err
+		}
+	}
+	if etag == "" {
+		return meta, fmt.Errorf("upstream response for %s is missing etag", fileURL)
+	}
+	meta = sparseMeta{
+		commit:  commit,
+		etag:    etag,
+		size:    responseSize(head),
+		url:     fileURL,
+		expires: time.Now().Add(sparseMetaTTL),
+	}
+	if meta.size < 0 {
+		return meta, fmt.Errorf("upstream response for %s has no size", fileURL)
+	}
+	p.sparseMu.Lock()
+	p.sparseMetas[key] = meta
+	p.sparseMu.Unlock()
+	return meta, nil
+}
+
+// sparseBlob returns the sparse blob of a file, loading the ranges cached by a
+// previous run
+func (p *Proxy) sparseBlob(modelID string, meta sparseMeta) (*sparseBlob, error) {
+	path := p.layout().SparsePath(modelID, meta.etag)
+	p.sparseMu.Lock()
+	defer p.sparseMu.Unlock()
+	if blob, ok := p.sparseBlobs[path]; ok {
+		return blob, nil
+	}
+	blob := &sparseBlob{path: path, size: meta.size}
+	data, err := os.ReadFile(path + ".ranges")
+	if err == nil {
+		if err := json.Unmarshal(data, &blob.ranges); err != nil {
+			return nil, fmt.Errorf("failed to parse cached ranges: %w", err)
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+	p.sparseBlobs[path] = blob
+	return blob, nil
+}
+
+// fill fetches the parts of want that are not cached from url. The redirect of url is
+// followed for every range, so an expired CDN location is never reused.
+func (b *sparseBlob) fill(ctx context.Context, transport http.RoundTripper, url string, want byteRange) error {
+	f, missing, err := b.open(want)
+	if err != nil || f == nil {
+		return err
+	}
+	defer f.Close()
+
+	client := &http.Client{Transport: transport}
+	for _, part := range missing {
+		req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", part.Start, part.End-1))
+		resp, err := client.Do(req)
+		if err != nil {
+			return err
+		}
+		if resp.StatusCode != http.StatusPartialContent {
+			resp.Body.Close()
+			return fmt.Errorf("upstream answered a range request with %s", resp.Status)
+		}
+		n, err := io.Copy(io.NewOffsetWriter(f, part.Start), io.LimitReader(resp.Body, part.End-part.Start))
+		resp.Body.Close()
+		if err == nil && n != part.End-part.Start {
+			err = io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			return err
+		}
+		if err := b.addRange(part); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// open opens the sparse file to fetch the parts of want that are not cached, the
+// file is nil when there are none
+func (b *sparseBlob) open(want byteRange) (*os.File, []byteRange, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	missing := missingRanges(b.ranges, want)
+	if len(missing) == 0 || b.promoted {
+		return nil, nil, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(b.path), 0755); err != nil {
+		return nil, nil, err
+	}
+	f, err := os.OpenFile(b.path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, nil, err
+	}
+	// extending the file without writing keeps the uncached ranges as holes
+	if info, err := f.Stat(); err == nil && info.Size() != b.size {
+		if err := f.Truncate(b.size); err != nil {
+			f.Close()
+			return nil, nil, err
+		}
+	}
+	return f, missing, nil
+}
+
+// addRange records a fetched range, concurrent fills may have fetched it too
+func (b *sparseBlob) addRange(part byteRange) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.promoted {
+		return nil
+	}
+	b.ranges = addRange(b.ranges, part)
+	return b.saveRanges()
+}
+
+// saveRanges records the cached ranges, replacing the file atomically so a crash
+// never records data that was not written
+func (b *sparseBlob) saveRanges() error {
+	data, err := json.Marshal(b.ranges)
+	if err != nil {
+		return err
+	}
+	tmp := b.path + ".ranges.tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, b.path+".ranges")
+}
+
+// complete reports whether every byte of the blob has been fetched
+func (b *sparseBlob) complete() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.ranges) == 1 && b.ranges[0].Start == 0 && b.ranges[0].End == b.size
+}
+
+// promoteSparseBlob moves a completely fetched sparse blob into the blobs and links it
+// into the snapshot, later requests are then served by the storage
+func (p *Proxy) promoteSparseBlob(modelID, revision, filename string, meta sparseMeta, blob *sparseBlob) {
+	blob.mu.Lock()
+	defer blob.mu.Unlock()
+	if blob.promoted {
+		return
+	}
+	blob.promoted = true
+	p.sparseMu.Lock()
+	delete(p.sparseBlobs, blob.path)
+	p.sparseMu.Unlock()
+
+	blobPath := p.blobPath(modelID, meta.etag)
+	if err := os.MkdirAll(filepath.Dir(blobPath), 0755); err != nil {
+		slog.Error("failed to create blobs directory", "error", err)
+		return
+	}
+	if err := os.Rename(blob.path, blobPath); err != nil {
+		slog.Error("failed to move sparse blob", "blob", blob.path, "error", err)
+		return
+	}
+	os.Remove(blob.path + ".ranges")
+	if err := p.linkBlob(modelID, meta.commit, filename, meta.etag, blobPath); err != nil {
+		slog.Error("failed to link blob", "blob", blobPath, "error", err)
+		return
+	}
+	if err := p.writeRef(modelID, revision, meta.commit); err != nil {
+		slog.Error("failed to write ref", "model", modelID, "ref", revision, "error", err)
+		return
+	}
+	slog.Info("completed sparse blob", "blob", blobPath)
+}
+
+// parseRange parses a Range header holding a single range of a file of size bytes
+func parseRange(header string, size int64) (byteRange, bool) {
+	spec, ok := strings.CutPrefix(header, "bytes=")
+	if !ok || strings.Contains(spec, ",") {
+		return byteRange{}, false
+	}
+	first, last, ok := strings.Cut(strings.TrimSpace(spec), "-")
+	if !ok {
+		return byteRange{}, false
+	}
+	if first == "" {
+		// a suffix range selects the last bytes
+		n, err := strconv.ParseInt(last, 10, 64)
+		if err != nil || n <= 0 {
+			return byteRange{}, false
+		}
+		return byteRange{Start: max(size-n, 0), End: size}, size > 0
+	}
+	start, err := strconv.ParseInt(first, 10, 64)
+	if err != nil || start < 0 || start >= size {
+		return byteRange{}, false
+	}
+	end := size
+	if last != "" {
+		n, err := strconv.ParseInt(last, 10, 64)
+		if err != nil || n < start {
+			return byteRange{}, false
+		}
+		end = min(n+1, size)
+	}
+	return byteRange{Start: start, End: end}, true
+}
+
+// missingRanges returns the parts of want not covered by the sorted, disjoint ranges
+func missingRanges(ranges []byteRange, want byteRange) []byteRange {
+	var missing []byteRange
+	next := want.Start
+	for _, r := range ranges {
+		if r.End <= next {
+			continue
+		}
+		if r.Start >= want.End {
+			break
+		}
+		if r.Start > next {
+			missing = append(missing, byteRange{Start: next, End: r.Start})
+		}
+		next = r.End
+	}
+	if next < want.End {
+		missing = append(missing, byteRange{Start: next, End: want.End})
+	}
+	return missing
+}
+
+// addRange adds r to the sorted, disjoint ranges, merging overlapping and adjacent ones
+func addRange(ranges []byteRange, r byteRange) []byteRange {
+	ranges = append(ranges, r)
+	sort.Slice(ranges, func(i, j int) bool { return ranges[i].Start < ranges[j].Start })
+	merged := ranges[:1]
+	for _, next := range ranges[1:] {
+		last := &merged[len(merged)-1]
+		if next.Start <= last.End {
+			last.End = max(last.End, next.End)
+			continue
+		}
+		merged = append(merged, next)
+	}
+	return merged
+}
@@ -0,0 +1,212 @@
+package proxy
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+func TestParseRange(t *testing.T) {
+	tests := []struct {
+		header string
+		want   byteRange
+		ok     bool
+	}{
+		{"bytes=0-9", byteRange{0, 10}, true},
+		{"bytes=10-", byteRange{10, 100}, true},
+		{"bytes=-10", byteRange{90, 100}, true},
+		{"bytes=90-200", byteRange{90, 100}, true},
+		{"bytes=100-", byteRange{}, false},
+		{"bytes=0-1,5-6", byteRange{}, false},
+		{"items=0-1", byteRange{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.header, func(t *testing.T) {
+			got, ok := parseRange(tt.header, 100)
+			if got != tt.want || ok != tt.ok {
+				t.Fatalf("parseRange = %v, %v, want %v, %v", got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
+
+func TestMissingRanges(t *testing.T) {
+	cached := []byteRange{{10, 20}, {30, 40}}
+	tests := []struct {
+		name string
+		want byteRange
+		miss []byteRange
+	}{
+		{"cached", byteRange{12, 18}, nil},
+		{"before", byteRange{0, 10}, []byteRange{{0, 10}}},
+		{"gap", byteRange{15, 35}, []byteRange{{20, 30}}},
+		{"around", byteRange{0, 50}, []byteRange{{0, 10}, {20, 30}, {40, 50}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := missingRanges(cached, tt.want); !reflect.DeepEqual(got, tt.miss) {
+				t.Fatalf("missingRanges = %v, want %v", got, tt.miss)
+			}
+		})
+	}
+}
+
+// TestSparseFillResolvesExpiredLocation serves a file from an upstream whose CDN only
+// accepts the signature issued by the latest redirect, the signatures expire before
+// every request
+func TestSparseFillResolvesExpiredLocation(t *testing.T) {
+	const content = "0123456789abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ+/"
+	var signature atomic.Int64
+	cdn := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("sig") != strconv.FormatInt(signature.Load(), 10) {
+			http.Error(w, "signature expired", http.StatusForbidden)
+			return
+		}
+		http.ServeContent(w, r, "model.bin", time.Time{}, strings.NewReader(content))
+	}))
+	defer cdn.Close()
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Repo-Commit", testCommit)
+		w.Header().Set("X-Linked-Etag", `"sparse-etag"`)
+		w.Header().Set("X-Linked-Size", strconv.Itoa(len(content)))
+		http.Redirect(w, r, fmt.Sprintf("%s/blob?sig=%d", cdn.URL, signature.Add(1)), http.StatusFound)
+	}))
+	defer upstream.Close()
+
+	p := newTestProxy(t, upstream.URL)
+	p.WithSparseCache(1)
+	tests := []struct {
+		name   string
+		header string
+		want   string
+	}{
+		{"first range", "bytes=0-9", content[:10]},
+		{"cached metadata", "bytes=10-19", content[10:20]},
+		{"completing range", "bytes=20-", content[20:]},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// the locations of the earlier requests expire
+			signature.Add(1)
+			req := httptest.NewRequest("GET", "/org/m/resolve/"+testCommit+"/model.bin", nil)
+			req = mux.SetURLVars(req, map[string]string{"model_id": "org/m", "sha": testCommit, "filename": "model.bin"})
+			req.Header.Set("Range", tt.header)
+			rec := httptest.NewRecorder()
+			if !p.ServeRange(rec, req) {
+				t.Fatal("range was not served from the sparse blob")
+			}
+			body, _ := io.ReadAll(rec.Body)
+			if rec.Code != http.StatusPartialContent || string(body) != tt.want {
+				t.Fatalf("got %d %q, want %q", rec.Code, body, tt.want)
+			}
+		})
+	}
+	if got := cachedSnapshotFile(t, p, "model.bin"); got != content {
+		t.Fatalf("cached %q, want %q", got, content)
+	}
+}
+
+// TestSparseCachedRangeNotBlockedByFetch reads a cached range while another request
+// is still fetching a range of the same blob from the upstream
+func TestSparseCachedRangeNotBlockedByFetch(t *testing.T) {
+	const content = "0123456789abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ+/"
+	release := make(chan struct{})
+	fetching := make(chan struct{}, 1)
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Repo-Commit", testCommit)
+		w.Header().Set("X-Linked-Etag", `"sparse-etag"`)
+		w.Header().Set("X-Linked-Size", strconv.Itoa(len(content)))
+		if r.Method == "GET" && r.Header.Get("Range") != "bytes=0-9" {
+			fetching <- struct{}{}
+			<-release
+		}
+		http.ServeContent(w, r, "model.bin", time.Time{}, strings.NewReader(content))
+	}))
+	defer upstream.Close()
+
+	p := newTestProxy(t, upstream.URL)
+	p.WithSparseCache(1)
+	serve := func(header string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/org/m/resolve/"+testCommit+"/model.bin", nil)
+		req = mux.SetURLVars(req, map[string]string{"model_id": "org/m", "sha": testCommit, "filename": "model.bin"})
+		req.Header.Set("Range", header)
+		rec := httptest.NewRecorder()
+		p.ServeRange(rec, req)
+		return rec
+	}
+	if rec := serve("bytes=0-9"); rec.Body.String() != content[:10] {
+		t.Fatalf("first range = %q", rec.Body.String())
+	}
+	fetched := make(chan struct{})
+	go func() {
+		serve("bytes=20-29")
+		close(fetched)
+	}()
+	<-fetching
+	defer func() {
+		close(release)
+		<-fetched
+	}()
+
+	done := make(chan string)
+	go func() { done <- serve("bytes=0-9").Body.String() }()
+	select {
+	case got := <-done:
+		if got != content[:10] {
+			t.Fatalf("cached range = %q", got)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("cached range blocked by the fetch of another range")
+	}
+}
+
+func TestServeRangeIneligible(t *testing.T) {
+	const content = "0123456789abcdefghijklmnopqrstuvwxyz"
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Repo-Commit", testCommit)
+		w.Header().Set("X-Linked-Etag", `"sparse-etag"`)
+		w.Header().Set("X-Linked-Size", strconv.Itoa(len(content)))
+		http.ServeContent(w, r, "model.bin", time.Time{}, strings.NewReader(content))
+	}))
+	defer upstream.Close()
+
+	tests := []struct {
+		name    string
+		minSize int64
+		method  string
+		header  string
+		served  bool
+	}{
+		{"eligible", 1, "GET", "bytes=0-9", true},
+		{"disabled", 0, "GET", "bytes=0-9", false},
+		{"below minimum size", int64(len(content)) + 1, "GET", "bytes=0-9", false},
+		{"multiple ranges", 1, "GET", "bytes=0-1,5-6", false},
+		{"unsatisfiable range", 1, "GET", "bytes=100-", false},
+		{"head request", 1, "HEAD", "bytes=0-9", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newTestProxy(t, upstream.URL)
+			p.WithSparseCache(tt.minSize)
+			req := httptest.NewRequest(tt.method, "/org/m/resolve/"+testCommit+"/model.bin", nil)
+			req = mux.SetURLVars(req, map[string]string{"model_id": "org/m", "sha": testCommit, "filename": "model.bin"})
+			req.Header.Set("Range", tt.header)
+			rec := httptest.NewRecorder()
+			if served := p.ServeRange(rec, req); served != tt.served {
+				t.Fatalf("ServeRange = %v, want %v", served, tt.served)
+			}
+			if !tt.served && rec.Body.Len() != 0 {
+				t.Errorf("ineligible request wrote %q", rec.Body)
+			}
+		})
+	}
+}
@@ -0,0 +1,135 @@
+package proxy
+
+import (
+	"io"
+	"io/fs"
+	"net/http"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/lengrongfu/LLMDistribution/pkg/api/model"
+)
+
+// cacheSizeTTL is how long the size of the cache is reused before the cache is walked
+// again, walking a large cache takes a while
+const cacheSizeTTL = time.Minute
+
+// cacheStats are the cumulative counters of the cache since they were last reset
+type cacheStats struct {
+	hits          atomic.Int64
+	misses        atomic.Int64
+	upstreamBytes atomic.Int64
+	servedBytes   atomic.Int64
+	mu            sync.Mutex
+	since         time.Time
+	// sizeMu serializes the walks of the cache, size is the cache size at sizedAt
+	sizeMu  sync.Mutex
+	size    int64
+	sizedAt time.Time
+}
+
+func newCacheStats() *cacheStats {
+	return &cacheStats{since: time.Now().UTC()}
+}
+
+// RecordHit counts a file request answered from the cache with n bytes of content
+func (p *Proxy) RecordHit(n int64) {
+	p.stats.hits.Add(1)
+	p.stats.servedBytes.Add(n)
+}
+
+// recordMiss counts a file request answered by the upstream
+func (p *Proxy) recordMiss() {
+	p.stats.misses.Add(1)
+}
+
+// Stats returns the cache counters and the size of the cached files
+func (p *Proxy) Stats() model.CacheStats {
+	p.stats.mu.Lock()
+	since := p.stats.since
+	p.stats.mu.Unlock()
+	return model.CacheStats{
+		Hits:          p.stats.hits.Load(),
+		Misses:        p.stats.misses.Load(),
+		UpstreamBytes: p.stats.upstreamBytes.Load(),
+		ServedBytes:   p.stats.servedBytes.Load(),
+		CacheSize:     p.cacheSize(),
+		Since:         since,
+	}
+}
+
+// ResetStats sets the cache counters back to zero
+func (p *Proxy) ResetStats() {
+	p.stats.mu.Lock()
+	defer p.stats.mu.Unlock()
+	p.stats.hits.Store(0)
+	p.stats.misses.Store(0)
+	p.stats.upstreamBytes.Store(0)
+	p.stats.servedBytes.Store(0)
+	p.stats.since = time.Now().UTC()
+}
+
+// cacheSize returns the size of the cache, walked at most once per cacheSizeTTL
+func (p *Proxy) cacheSize() int64 {
+	p.stats.sizeMu.Lock()
+	defer p.stats.sizeMu.Unlock()
+	if p.stats.sizedAt.IsZero() || time.Since(p.stats.sizedAt) >= cacheSizeTTL {
+		p.stats.size = p.walkCacheSize()
+		p.stats.sizedAt = time.Now()
+	}
+	return p.stats.size
+}
+
+// walkCacheSize sums the size of the files below the cache directory and the blob
+// directory, links into the snapshots are not counted
+func (p *Proxy) walkCacheSize() int64 {
+	if p.baseDir == "" {
+		return 0
+	}
+	dirs := []string{p.layout().BaseDir()}
+	if p.blobDir != "" {
+		dirs = append(dirs, p.blobDir)
+	}
+	var size int64
+	for _, dir := range dirs {
+		filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+			if err != nil || !d.Type().IsRegular() {
+				return nil
+			}
+			if info, err := d.Info(); err == nil {
+				size += info.Size()
+			}
+			return nil
+		})
+	}
+	return size
+}
+
+// statsTransport counts the bytes of the upstream response bodies
+type statsTransport struct {
+	base  http.RoundTripper
+	stats *cacheStats
+}
+
+func (t *statsTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = &countingBody{ReadCloser: resp.Body, n: &t.stats.upstreamBytes}
+	return resp, nil
+}
+
+// countingBody adds the bytes read from a response body to n
+type countingBody struct {
+	io.ReadCloser
+	n *atomic.Int64
+}
+
+func (b *countingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.n.Add(int64(n))
+	return n, err
+}
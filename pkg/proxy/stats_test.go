@@ -0,0 +1,35 @@
+package proxy
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCacheSizeReusedWithinTTL(t *testing.T) {
+	p := newTestProxy(t, "http://127.0.0.1:1")
+	write := func(name string, size int) {
+		t.Helper()
+		path := filepath.Join(p.layout().BaseDir(), name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, make([]byte, size), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write("a", 100)
+	if got := p.Stats().CacheSize; got != 100 {
+		t.Fatalf("CacheSize = %d, want 100", got)
+	}
+	write("b", 50)
+	if got := p.Stats().CacheSize; got != 100 {
+		t.Errorf("CacheSize within the TTL = %d, want the cached 100", got)
+	}
+	p.stats.sizedAt = time.Now().Add(-cacheSizeTTL)
+	if got := p.Stats().CacheSize; got != 150 {
+		t.Errorf("CacheSize after the TTL = %d, want 150", got)
+	}
+}
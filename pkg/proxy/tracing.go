@@ -0,0 +1,46 @@
+package proxy
+
+import (
+	"net/http"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracingTransport records a proxy.fetchUpstream span around each upstream request
+// and propagates the trace context to the upstream
+type tracingTransport struct {
+	base http.RoundTripper
+}
+
+func (t *tracingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx, span := otel.Tracer("github.com/lengrongfu/LLMDistribution/pkg/proxy").Start(req.Context(), "proxy.fetchUpstream",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("http.request.method", req.Method),
+			// the query of signed CDN locations carries credentials
+			attribute.String("url.full", redactQuery(req.URL)),
+		),
+	)
+	defer span.End()
+	req = req.Clone(ctx)
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
+
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+	span.SetAttributes(
+		attribute.Int("http.response.status_code", resp.StatusCode),
+		attribute.Int64("http.response.body.size", resp.ContentLength),
+	)
+	if resp.StatusCode >= http.StatusInternalServerError {
+		span.SetStatus(codes.Error, resp.Status)
+	}
+	return resp, nil
+}
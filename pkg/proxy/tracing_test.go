@@ -0,0 +1,51 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestTracingTransportRedactsQuery(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer upstream.Close()
+
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(provider)
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+
+	tests := []struct {
+		name string
+		path string
+		want string
+	}{
+		{"no query", "/org/m/resolve/main/config.json", upstream.URL + "/org/m/resolve/main/config.json"},
+		{"signed query", "/blob?X-Amz-Signature=secret&Expires=1", upstream.URL + "/blob"},
+	}
+	client := &http.Client{Transport: &tracingTransport{base: http.DefaultTransport}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := client.Get(upstream.URL + tt.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			spans := recorder.Ended()
+			var got string
+			for _, attr := range spans[len(spans)-1].Attributes() {
+				if attr.Key == "url.full" {
+					got = attr.Value.AsString()
+				}
+			}
+			if got != tt.want {
+				t.Fatalf("url.full = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,126 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/lengrongfu/LLMDistribution/pkg/api/model"
+)
+
+// WarmResult summarizes a cache warm-up of a model revision
+type WarmResult struct {
+	ModelID    string   `json:"modelId"`
+	Revision   string   `json:"revision"`
+	SHA        string   `json:"sha"`
+	Downloaded []string `json:"downloaded"`
+	Skipped    []string `json:"skipped"`
+	Bytes      int64    `json:"bytes"`
+}
+
+// Warm fetches the model index and every sibling of a revision from the upstream
+// into the local cache. Files that are already cached are skipped.
+func (p *Proxy) Warm(ctx context.Context, modelID, revision string) (*WarmResult, error) {
+	index, err := p.fetchModelIndex(ctx, modelID, revision)
+	if err != nil {
+		return nil, err
+	}
+	var info struct {
+		SHA      string `json:"sha"`
+		Siblings []struct {
+			Rfilename string `json:"rfilename"`
+		} `json:"siblings"`
+	}
+	if err := json.Unmarshal(index, &info); err != nil {
+		return nil, fmt.Errorf("failed to parse model index: %w", err)
+	}
+	if info.SHA == "" {
+		return nil, fmt.Errorf("model index of %s has no sha", modelID)
+	}
+	indexPath := p.layout().IndexPath(modelID)
+	if err := os.MkdirAll(filepath.Dir(indexPath), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create model directory: %w", err)
+	}
+	if err := os.WriteFile(indexPath, index, 0644); err != nil {
+		return nil, fmt.Errorf("failed to write model index: %w", err)
+	}
+	p.updateRef(modelID, revision, index)
+
+	result := &WarmResult{
+		ModelID:    modelID,
+		Revision:   revision,
+		SHA:        info.SHA,
+		Downloaded: make([]string, 0),
+		Skipped:    make([]string, 0),
+	}
+	for _, sibling := range info.Siblings {
+		filename := sibling.Rfilename
+		if strings.HasSuffix(filename, "/") {
+			continue
+		}
+		if _, err := os.Stat(p.layout().SnapshotPath(modelID, info.SHA, filename)); err == nil {
+			result.Skipped = append(result.Skipped, filename)
+			continue
+		}
+		n, err := p.FetchToCache(ctx, modelID, info.SHA, filename)
+		if errors.Is(err, errCacheInProgress) {
+			// another request is already caching this file
+			result.Skipped = append(result.Skipped, filename)
+			continue
+		}
+		if err != nil {
+			return result, fmt.Errorf("failed to fetch %s: %w", filename, err)
+		}
+		result.Downloaded = append(result.Downloaded, filename)
+		result.Bytes += n
+	}
+	return result, nil
+}
+
+// fetchModelIndex gets the raw model index of a revision from the upstream
+func (p *Proxy) fetchModelIndex(ctx context.Context, modelID, revision string) ([]byte, error) {
+	// blobs=true makes the upstream include sizes and LFS metadata in the siblings
+	url := fmt.Sprintf("%s/api/models/%s/revision/%s?blobs=true", p.baseURL, modelID, revision)
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("failed to get model index: %s", string(body))
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response body: %w", err)
+	}
+	return body, nil
+}
+
+// ModelIndex gets the model index of a revision from the upstream
+func (p *Proxy) ModelIndex(ctx context.Context, modelID, revision string) (model.ModelIndexInfo, error) {
+	body, err := p.fetchModelIndex(ctx, modelID, revision)
+	if err != nil {
+		return model.ModelIndexInfo{}, err
+	}
+	var index model.ModelIndexInfo
+	if err := json.Unmarshal(body, &index); err != nil {
+		return model.ModelIndexInfo{}, fmt.Errorf("failed to parse model index: %w", err)
+	}
+	return index, nil
+}
+
+// FileURL returns the upstream resolve URL of a file
+func (p *Proxy) FileURL(modelID, revision, filename string) string {
+	return fmt.Sprintf("%s/%s/resolve/%s/%s", p.baseURL, modelID, revision, filename)
+}
@@ -0,0 +1,55 @@
+package proxy
+
+import (
+	"net/http"
+	"strings"
+)
+
+// xetHeaderPrefix starts the headers of the Xet storage protocol, like X-Xet-Hash
+const xetHeaderPrefix = "X-Xet-"
+
+// StripXetHeaders removes the headers of the Xet storage protocol and the xet links of
+// the Link header, and reports whether there were any. Without them Xet-capable
+// clients fall back to the classic download of the file from its resolve URL, the
+// only protocol this server speaks.
+func StripXetHeaders(header http.Header) bool {
+	stripped := false
+	for key := range header {
+		if strings.HasPrefix(http.CanonicalHeaderKey(key), xetHeaderPrefix) {
+			header.Del(key)
+			stripped = true
+		}
+	}
+	links := header.Values("Link")
+	if len(links) == 0 {
+		return stripped
+	}
+	var kept []string
+	for _, value := range links {
+		for _, link := range strings.Split(value, ",") {
+			if isXetLink(link) {
+				stripped = true
+			} else if link = strings.TrimSpace(link); link != "" {
+				kept = append(kept, link)
+			}
+		}
+	}
+	header.Del("Link")
+	if len(kept) > 0 {
+		header.Set("Link", strings.Join(kept, ", "))
+	}
+	return stripped
+}
+
+// isXetLink reports whether a Link header entry points at a Xet endpoint, like
+// `<https://huggingface.co/api/models/org/model/xet-read-token/sha>; rel="xet-auth"`
+func isXetLink(link string) bool {
+	_, params, _ := strings.Cut(link, ";")
+	for _, param := range strings.Split(params, ";") {
+		name, value, _ := strings.Cut(strings.TrimSpace(param), "=")
+		if strings.EqualFold(name, "rel") && strings.HasPrefix(strings.Trim(value, `"`), "xet-") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,77 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestStripXetHeaders(t *testing.T) {
+	tests := []struct {
+		name         string
+		header       http.Header
+		wantStripped bool
+		wantLink     string
+	}{
+		{
+			name:     "no xet headers",
+			header:   http.Header{"Etag": {`"abc"`}, "Link": {`<https://hf.co/next>; rel="next"`}},
+			wantLink: `<https://hf.co/next>; rel="next"`,
+		},
+		{
+			name:         "xet headers",
+			header:       http.Header{"X-Xet-Hash": {"abc"}, "X-Xet-Refresh-Route": {"/api/xet"}},
+			wantStripped: true,
+		},
+		{
+			name:         "xet link among others",
+			header:       http.Header{"Link": {`<https://hf.co/api/models/org/m/xet-read-token/sha>; rel="xet-auth", <https://hf.co/next>; rel="next"`}},
+			wantStripped: true,
+			wantLink:     `<https://hf.co/next>; rel="next"`,
+		},
+		{
+			name:         "only xet links",
+			header:       http.Header{"Link": {`<https://cas.example>; rel=xet-reconstruction`}},
+			wantStripped: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if stripped := StripXetHeaders(tt.header); stripped != tt.wantStripped {
+				t.Errorf("stripped = %v, want %v", stripped, tt.wantStripped)
+			}
+			for key := range tt.header {
+				if strings.HasPrefix(http.CanonicalHeaderKey(key), xetHeaderPrefix) {
+					t.Errorf("header %s kept", key)
+				}
+			}
+			if got := tt.header.Get("Link"); got != tt.wantLink {
+				t.Errorf("Link = %q, want %q", got, tt.wantLink)
+			}
+		})
+	}
+}
+
+func TestProxyStripsXetHeaders(t *testing.T) {
+	var requestXet string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestXet = r.Header.Get("X-Xet-Session")
+		w.Header().Set("X-Xet-Hash", "abc")
+		w.Header().Set("Link", `<https://cas.example>; rel="xet-auth"`)
+		w.Write([]byte("{}"))
+	}))
+	defer upstream.Close()
+	p := newTestProxy(t, upstream.URL)
+
+	req := httptest.NewRequest("GET", "/org/m/resolve/main/config.json", nil)
+	req.Header.Set("X-Xet-Session", "client")
+	rec := httptest.NewRecorder()
+	p.HandleGetModelFile(rec, req)
+	if requestXet != "" {
+		t.Errorf("upstream received X-Xet-Session %q", requestXet)
+	}
+	if rec.Header().Get("X-Xet-Hash") != "" || rec.Header().Get("Link") != "" {
+		t.Errorf("xet headers reached the client: %v", rec.Header())
+	}
+}
@@ -0,0 +1,134 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// AccessLogEntry is the JSON line written to the access log for every request
+type AccessLogEntry struct {
+	Time     time.Time `json:"time"`
+	Method   string    `json:"method"`
+	Path     string    `json:"path"`
+	Status   int       `json:"status"`
+	Bytes    int64     `json:"bytes"`
+	Duration float64   `json:"durationMs"`
+	ModelID  string    `json:"modelId,omitempty"`
+	Remote   string    `json:"remoteAddr"`
+}
+
+// accessLog appends one JSON object per request to a file, separate from the server
+// log. When maxSize is set the file is rotated to <path>.1 before it grows beyond it.
+type accessLog struct {
+	path    string
+	maxSize int64
+	mu      sync.Mutex
+	file    *os.File
+	size    int64
+}
+
+// newAccessLog opens the access log at path for appending, an empty path disables it
+func newAccessLog(path string, maxSize int64) (*accessLog, error) {
+	l := &accessLog{path: path, maxSize: maxSize}
+	if path == "" {
+		return l, nil
+	}
+	if err := l.open(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+func (l *accessLog) open() error {
+	file, err := os.OpenFile(l.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open access log: %w", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("failed to open access log: %w", err)
+	}
+	l.file, l.size = file, info.Size()
+	return nil
+}
+
+// middleware writes an access log entry once a request has been answered
+func (l *accessLog) middleware(next http.Handler) http.Handler {
+	if l.path == "" {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &responseRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r)
+		status := rec.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		l.write(AccessLogEntry{
+			Time:     start.UTC(),
+			Method:   r.Method,
+			Path:     r.URL.Path,
+			Status:   status,
+			Bytes:    rec.bytes,
+			Duration: float64(time.Since(start).Microseconds()) / 1000,
+			ModelID:  mux.Vars(r)["model_id"],
+			Remote:   r.RemoteAddr,
+		})
+	})
+}
+
+func (l *accessLog) write(entry AccessLogEntry) {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+	line = append(line, '\n')
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.file == nil {
+		return
+	}
+	if l.maxSize > 0 && l.size > 0 && l.size+int64(len(line)) > l.maxSize {
+		if err := l.rotate(); err != nil {
+			slog.Error("failed to rotate access log", "path", l.path, "error", err)
+		}
+	}
+	n, err := l.file.Write(line)
+	l.size += int64(n)
+	if err != nil {
+		slog.Error("failed to write access log", "path", l.path, "error", err)
+	}
+}
+
+// rotate moves the current file to <path>.1, replacing the previous one, and starts
+// a new file
+func (l *accessLog) rotate() error {
+	l.file.Close()
+	l.file = nil
+	if err := os.Rename(l.path, l.path+".1"); err != nil {
+		slog.Error("failed to rename access log", "path", l.path, "error", err)
+	}
+	return l.open()
+}
+
+// Close closes the access log file
+func (l *accessLog) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.file == nil {
+		return nil
+	}
+	err := l.file.Close()
+	l.file = nil
+	return err
+}
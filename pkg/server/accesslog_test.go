@@ -0,0 +1,111 @@
+package server
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// readAccessLog returns the entries of an access log file
+func readAccessLog(t *testing.T, path string) []AccessLogEntry {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var entries []AccessLogEntry
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var entry AccessLogEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			t.Fatalf("invalid access log line %q: %v", scanner.Text(), err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+func TestAccessLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "access.log")
+	_, ts := newTestServer(t, func(c *Config) { c.AccessLog = path })
+	status, body := doRequest(t, "PUT", ts.URL+"/api/models/org/m/upload/main?path=config.json", testAdminToken, strings.NewReader("{}"))
+	if status != http.StatusOK {
+		t.Fatalf("upload: %d %s", status, body)
+	}
+
+	tests := []struct {
+		method  string
+		path    string
+		status  int
+		bytes   int64
+		modelID string
+	}{
+		{"GET", "/org/m/resolve/main/config.json", http.StatusOK, 2, "org/m"},
+		{"GET", "/org/m/resolve/main/missing.json", http.StatusNotFound, -1, "org/m"},
+		{"GET", "/healthz", http.StatusOK, -1, ""},
+	}
+	for _, tt := range tests {
+		doRequest(t, tt.method, ts.URL+tt.path, "", nil)
+	}
+	entries := readAccessLog(t, path)
+	// the upload is logged first
+	if len(entries) != len(tests)+1 {
+		t.Fatalf("got %d entries, want %d", len(entries), len(tests)+1)
+	}
+	for i, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			got := entries[i+1]
+			if got.Method != tt.method || got.Path != tt.path || got.Status != tt.status || got.ModelID != tt.modelID {
+				t.Errorf("entry = %+v", got)
+			}
+			if tt.bytes >= 0 && got.Bytes != tt.bytes {
+				t.Errorf("bytes = %d, want %d", got.Bytes, tt.bytes)
+			}
+			if got.Time.IsZero() || got.Remote == "" {
+				t.Errorf("entry without time or remote address: %+v", got)
+			}
+		})
+	}
+}
+
+func TestAccessLogRotation(t *testing.T) {
+	tests := []struct {
+		name        string
+		maxSize     int64
+		writes      int
+		wantCurrent int
+		wantRotated int
+	}{
+		{"disabled", 0, 5, 5, 0},
+		{"rotates before exceeding", 300, 5, 1, 2},
+		{"entry larger than the limit", 10, 3, 1, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "access.log")
+			l, err := newAccessLog(path, tt.maxSize)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer l.Close()
+			for i := 0; i < tt.writes; i++ {
+				l.write(AccessLogEntry{Method: "GET", Path: "/org/m/resolve/main/config.json", Status: 200})
+			}
+			if got := len(readAccessLog(t, path)); got != tt.wantCurrent {
+				t.Errorf("current log has %d entries, want %d", got, tt.wantCurrent)
+			}
+			var rotated int
+			if _, err := os.Stat(path + ".1"); err == nil {
+				rotated = len(readAccessLog(t, path+".1"))
+			}
+			if rotated != tt.wantRotated {
+				t.Errorf("rotated log has %d entries, want %d", rotated, tt.wantRotated)
+			}
+		})
+	}
+}
@@ -0,0 +1,136 @@
+package server
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"gopkg.in/yaml.v3"
+)
+
+// ModelACL lists the tokens allowed to access a private model
+type ModelACL struct {
+	Tokens []string `yaml:"tokens"`
+}
+
+// aclFile is the format of the ACL file, keyed by model ID. A key ending with "*"
+// matches every model ID with that prefix, e.g. "org-private/*".
+type aclFile struct {
+	Models map[string]ModelACL `yaml:"models"`
+}
+
+// accessList restricts the listed models to requests presenting one of their tokens,
+// models that are not listed stay public
+type accessList struct {
+	exact    map[string]ModelACL
+	prefixes map[string]ModelACL
+	// admin is the admin token of the server, it grants access to every model
+	admin string
+}
+
+// loadAccessList reads an ACL file, an empty path returns a list without restrictions
+func loadAccessList(path string) (*accessList, error) {
+	acl := &accessList{exact: map[string]ModelACL{}, prefixes: map[string]ModelACL{}}
+	if path == "" {
+		return acl, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read ACL file: %w", err)
+	}
+	var file aclFile
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse ACL file %s: %w", path, err)
+	}
+	for key, entry := range file.Models {
+		if prefix, ok := strings.CutSuffix(key, "*"); ok {
+			acl.prefixes[prefix] = entry
+		} else {
+			acl.exact[key] = entry
+		}
+	}
+	return acl, nil
+}
+
+// lookup returns the ACL of a model and whether the model is private
+func (a *accessList) lookup(modelID string) (ModelACL, bool) {
+	if entry, ok := a.exact[modelID]; ok {
+		return entry, true
+	}
+	// the longest matching prefix wins
+	var (
+		match  ModelACL
+		length = -1
+	)
+	for prefix, entry := range a.prefixes {
+		if strings.HasPrefix(modelID, prefix) && len(prefix) > length {
+			match, length = entry, len(prefix)
+		}
+	}
+	return match, length >= 0
+}
+
+// private reports whether a model is restricted by the access list
+func (a *accessList) private(modelID string) bool {
+	_, ok := a.lookup(modelID)
+	return ok
+}
+
+// allowed reports whether token grants access to modelID
+func (a *accessList) allowed(modelID, token string) bool {
+	entry, ok := a.lookup(modelID)
+	if !ok {
+		return true
+	}
+	if token != "" && a.admin != "" && subtle.ConstantTimeCompare([]byte(a.admin), []byte(token)) == 1 {
+		return true
+	}
+	for _, candidate := range entry.Tokens {
+		if token != "" && subtle.ConstantTimeCompare([]byte(candidate), []byte(token)) == 1 {
+			return true
+		}
+	}
+	return false
+}
+
+// middleware answers 403 to requests for a private model without an authorized
+// bearer token
+func (a *accessList) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		modelID := mux.Vars(r)["model_id"]
+		if modelID != "" && !a.allowed(modelID, bearerToken(r)) {
+			writeJSONError(w, http.StatusForbidden, "forbidden", fmt.Sprintf("Access to model %s is restricted", modelID))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// requireAdmin restricts a route to requests presenting the admin token as bearer
+// token. Without a configured admin token the route is disabled.
+func (s *Server) requireAdmin(next http.HandlerFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.adminToken == "" {
+			writeJSONError(w, http.StatusForbidden, "forbidden", "This operation is disabled, set admin-token to enable it")
+			return
+		}
+		if subtle.ConstantTimeCompare([]byte(s.adminToken), []byte(bearerToken(r))) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="llmdistribution"`)
+			writeJSONError(w, http.StatusUnauthorized, "unauthorized", "This operation requires the admin token")
+			return
+		}
+		next(w, r)
+	})
+}
+
+// bearerToken returns the token of an "Authorization: Bearer" header
+func bearerToken(r *http.Request) string {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		return ""
+	}
+	return strings.TrimSpace(token)
+}
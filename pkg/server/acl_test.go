@@ -0,0 +1,162 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/lengrongfu/LLMDistribution/pkg/api/model"
+)
+
+// newACLTestServer starts a server restricting org-private/* to privateToken, with
+// the models public/m and org-private/m stored
+func newACLTestServer(t *testing.T, configure func(*Config)) (*Server, string) {
+	t.Helper()
+	aclFile := filepath.Join(t.TempDir(), "acl.yaml")
+	acl := "models:\n  org-private/*:\n    tokens: [" + privateToken + "]\n"
+	if err := os.WriteFile(aclFile, []byte(acl), 0644); err != nil {
+		t.Fatal(err)
+	}
+	s, ts := newTestServer(t, func(c *Config) {
+		c.ACLFile = aclFile
+		if configure != nil {
+			configure(c)
+		}
+	})
+	for _, modelID := range []string{"public/m", "org-private/m"} {
+		status, body := doRequest(t, "PUT", ts.URL+"/api/models/"+modelID+"/upload/main?path=config.json", testAdminToken, strings.NewReader("{}"))
+		if status != http.StatusOK {
+			t.Fatalf("upload %s: %d %s", modelID, status, body)
+		}
+	}
+	return s, ts.URL
+}
+
+// privateToken grants access to the private models of newACLTestServer
+const privateToken = "private-token"
+
+func TestEvictionPreviewRequiresAdmin(t *testing.T) {
+	_, url := newACLTestServer(t, nil)
+	tests := []struct {
+		name   string
+		token  string
+		status int
+		want   []string
+	}{
+		{"anonymous", "", http.StatusUnauthorized, nil},
+		{"wrong token", "guess", http.StatusUnauthorized, nil},
+		{"private token", privateToken, http.StatusUnauthorized, nil},
+		{"admin token", testAdminToken, http.StatusOK, []string{"org-private/m", "public/m"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, body := doRequest(t, "GET", url+"/api/admin/eviction-preview?target-bytes=0", tt.token, nil)
+			if status != tt.status {
+				t.Fatalf("status %d: %s, want %d", status, body, tt.status)
+			}
+			if status != http.StatusOK {
+				return
+			}
+			var preview model.EvictionPreview
+			if err := json.Unmarshal([]byte(body), &preview); err != nil {
+				t.Fatal(err)
+			}
+			var ids []string
+			for _, candidate := range preview.Models {
+				ids = append(ids, candidate.ID)
+			}
+			sort.Strings(ids)
+			if strings.Join(ids, ",") != strings.Join(tt.want, ",") {
+				t.Fatalf("models = %v, want %v", ids, tt.want)
+			}
+		})
+	}
+}
+
+func TestACLRestrictsModelRoutes(t *testing.T) {
+	_, url := newACLTestServer(t, nil)
+	tests := []struct {
+		name   string
+		model  string
+		token  string
+		status int
+	}{
+		{"public", "public/m", "", http.StatusOK},
+		{"private anonymous", "org-private/m", "", http.StatusForbidden},
+		{"private token", "org-private/m", privateToken, http.StatusOK},
+		{"admin token", "org-private/m", testAdminToken, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, body := doRequest(t, "GET", url+"/"+tt.model+"/resolve/main/config.json", tt.token, nil)
+			if status != tt.status {
+				t.Fatalf("status = %d, want %d: %s", status, tt.status, body)
+			}
+		})
+	}
+}
+
+func TestACLFiltersOpenAIModels(t *testing.T) {
+	_, url := newACLTestServer(t, func(c *Config) { c.OpenAIModels = true })
+	tests := []struct {
+		name  string
+		token string
+		want  []string
+	}{
+		{"anonymous", "", []string{"public/m"}},
+		{"private token", privateToken, []string{"org-private/m", "public/m"}},
+		{"admin token", testAdminToken, []string{"org-private/m", "public/m"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, body := doRequest(t, "GET", url+"/v1/models", tt.token, nil)
+			if status != http.StatusOK {
+				t.Fatalf("status %d: %s", status, body)
+			}
+			var list model.OpenAIModelList
+			if err := json.Unmarshal([]byte(body), &list); err != nil {
+				t.Fatal(err)
+			}
+			var ids []string
+			for _, m := range list.Data {
+				ids = append(ids, m.ID)
+			}
+			sort.Strings(ids)
+			if strings.Join(ids, ",") != strings.Join(tt.want, ",") {
+				t.Fatalf("models = %v, want %v", ids, tt.want)
+			}
+		})
+	}
+}
+
+func TestACLMarksIndexPrivate(t *testing.T) {
+	_, url := newACLTestServer(t, nil)
+	tests := []struct {
+		model       string
+		wantPrivate bool
+	}{
+		{"public/m", false},
+		{"org-private/m", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.model, func(t *testing.T) {
+			status, body := doRequest(t, "GET", url+"/api/models/"+tt.model+"/revision/main", privateToken, nil)
+			if status != http.StatusOK {
+				t.Fatalf("status %d: %s", status, body)
+			}
+			var index struct {
+				Private bool `json:"private"`
+			}
+			if err := json.Unmarshal([]byte(body), &index); err != nil {
+				t.Fatal(err)
+			}
+			if index.Private != tt.wantPrivate {
+				t.Errorf("private = %v, want %v", index.Private, tt.wantPrivate)
+			}
+		})
+	}
+}
@@ -0,0 +1,46 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+// modelAliases maps the model IDs clients request to the IDs the models are stored
+// under, like an internal mirror served under the name of its upstream model
+type modelAliases map[string]string
+
+// newModelAliases checks an alias table, an alias must name a stored model and not
+// another alias
+func newModelAliases(aliases map[string]string) (modelAliases, error) {
+	for alias, target := range aliases {
+		if alias == "" || target == "" {
+			return nil, fmt.Errorf("invalid model alias %q -> %q", alias, target)
+		}
+		if _, ok := aliases[target]; ok {
+			return nil, fmt.Errorf("model alias %s points to alias %s", alias, target)
+		}
+	}
+	return modelAliases(aliases), nil
+}
+
+// middleware replaces an aliased model ID in the route variables with the ID of the
+// stored model, so handlers and the ACL only see stored models
+func (a modelAliases) middleware(next http.Handler) http.Handler {
+	if len(a) == 0 {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		if target, ok := a[vars["model_id"]]; ok {
+			resolved := make(map[string]string, len(vars))
+			for key, value := range vars {
+				resolved[key] = value
+			}
+			resolved["model_id"] = target
+			r = mux.SetURLVars(r, resolved)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
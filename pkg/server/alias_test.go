@@ -0,0 +1,57 @@
+package server
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestNewModelAliases(t *testing.T) {
+	tests := []struct {
+		name    string
+		aliases map[string]string
+		wantErr bool
+	}{
+		{"none", nil, false},
+		{"alias to stored model", map[string]string{"upstream/m": "mirror/m"}, false},
+		{"empty alias", map[string]string{"": "mirror/m"}, true},
+		{"empty target", map[string]string{"upstream/m": ""}, true},
+		{"alias to alias", map[string]string{"a/m": "b/m", "b/m": "c/m"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := newModelAliases(tt.aliases); (err != nil) != tt.wantErr {
+				t.Errorf("newModelAliases error = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestModelAliasesResolve(t *testing.T) {
+	_, ts := newTestServer(t, func(c *Config) {
+		c.ModelAliases = map[string]string{"upstream/m": "mirror/m"}
+	})
+	status, body := doRequest(t, "PUT", ts.URL+"/api/models/mirror/m/upload/main?path=config.json", testAdminToken, strings.NewReader(`{"a":1}`))
+	if status != http.StatusOK {
+		t.Fatalf("upload: %d %s", status, body)
+	}
+	tests := []struct {
+		name     string
+		path     string
+		want     int
+		wantBody string
+	}{
+		{"stored model", "/mirror/m/resolve/main/config.json", http.StatusOK, `{"a":1}`},
+		{"alias", "/upstream/m/resolve/main/config.json", http.StatusOK, `{"a":1}`},
+		{"alias index", "/api/models/upstream/m/revision/main", http.StatusOK, `"config.json"`},
+		{"not an alias", "/other/m/resolve/main/config.json", http.StatusNotFound, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, body := doRequest(t, "GET", ts.URL+tt.path, "", nil)
+			if status != tt.want || !strings.Contains(body, tt.wantBody) {
+				t.Errorf("status %d: %s, want %d with %s", status, body, tt.want, tt.wantBody)
+			}
+		})
+	}
+}
@@ -0,0 +1,215 @@
+package server
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/lengrongfu/LLMDistribution/pkg/api"
+	"github.com/lengrongfu/LLMDistribution/pkg/proxy"
+	"github.com/lengrongfu/LLMDistribution/pkg/utils"
+	"gopkg.in/yaml.v3"
+)
+
+// Config represents the server configuration. The yaml keys match the command line
+// flag names, JSON config files use the same keys.
+type Config struct {
+	Host        string          `yaml:"host"`
+	Port        int             `yaml:"port"`
+	StorageType api.StorageType `yaml:"storage-type"`
+	GitBaseDir  string          `yaml:"git-base-dir"`
+	FileBaseDir string          `yaml:"file-base-dir"`
+	// OSSEndpoint, OSSBucket and the AccessKey pair configure the bucket of OSS storage,
+	// the models are stored below OSSPrefix in the Hugging Face cache layout
+	OSSEndpoint        string `yaml:"oss-endpoint"`
+	OSSBucket          string `yaml:"oss-bucket"`
+	OSSPrefix          string `yaml:"oss-prefix"`
+	OSSAccessKeyID     string `yaml:"oss-access-key-id"`
+	OSSAccessKeySecret string `yaml:"oss-access-key-secret"`
+	// Layout arranges the cached files of a model, "hf" (models--org--name) or "flat" (org/name)
+	Layout string `yaml:"layout"`
+	// RepoType is the type of the served repositories, "model", "dataset" or "space",
+	// which names their cache directories like models--org--name (empty: model)
+	RepoType string `yaml:"repo-type"`
+	// BlobDir keeps the cached blobs below a separate directory, e.g. bulk storage, while
+	// snapshots and refs stay below the file base directory (empty: in the model directories)
+	BlobDir string `yaml:"blob-dir"`
+	// GitCommitTemplate is the commit message of files stored in git, {filename}, {modelID}
+	// and {count} are replaced by the committed files, the model ID and the number of files
+	GitCommitTemplate string `yaml:"git-commit-template"`
+	// ProxyBaseURL is a comma-separated list of upstreams, the next one is tried when an
+	// upstream is unreachable or answers with a server error
+	ProxyBaseURL  string `yaml:"proxy-base-url"`
+	EnableProxy   bool   `yaml:"enable-proxy"`
+	FallbackProxy bool   `yaml:"fallback-proxy"`
+	// DefaultRevision is the revision used when a request names none, it resolves to the
+	// latest cached snapshot like "main" and "master" when the model has no such ref
+	DefaultRevision string `yaml:"default-revision"`
+	// RedirectOnMiss answers cache misses with a 307 to the upstream and fills the cache in the background
+	RedirectOnMiss bool `yaml:"redirect-on-miss"`
+	// RewriteLocation points upstream CDN redirects back at this server for clients that can not reach the CDN
+	RewriteLocation bool `yaml:"rewrite-location"`
+	// KeepOldSnapshots keeps superseded snapshots when a proxied ref moves to a new sha
+	KeepOldSnapshots bool `yaml:"keep-old-snapshots"`
+	// SharedBlobs stores proxied blobs once in a directory shared by all models
+	SharedBlobs bool `yaml:"shared-blobs"`
+	// StrictBlobs refuses writes that would replace a cached blob with different content
+	StrictBlobs bool `yaml:"strict-blobs"`
+	// SparseCacheMinSize is the smallest file of which ranged requests only cache the
+	// requested ranges instead of the whole file (0 disables sparse caching)
+	SparseCacheMinSize int64 `yaml:"sparse-cache-min-size"`
+	// BlobReverifyAge is how long a cached blob is trusted before it is hashed again on serve (0 disables it)
+	BlobReverifyAge time.Duration `yaml:"blob-reverify-age"`
+	// BlobCompressAfter zstd-compresses cached blobs not read for this long, they are
+	// decompressed while served (0 disables compression)
+	BlobCompressAfter time.Duration `yaml:"blob-compress-after"`
+	// AccessFlushInterval is how often the tracked last access of each model is written
+	// to disk (0 disables access tracking)
+	AccessFlushInterval time.Duration `yaml:"access-flush-interval"`
+	// IndexCacheTTL is how long a model index built from a snapshot is reused (0 disables the cache)
+	IndexCacheTTL time.Duration `yaml:"index-cache-ttl"`
+	// IndexRefreshInterval is how often .modeindex files are regenerated when files
+	// were added to their snapshot out of band (0 disables the refresh)
+	IndexRefreshInterval time.Duration `yaml:"index-refresh-interval"`
+	// MergeIndex lists local files that the cached upstream index of a model is missing,
+	// like files uploaded after the index was fetched, in the served model index
+	MergeIndex bool `yaml:"merge-index"`
+	// StreamIndex streams model indexes built from a snapshot as the snapshot is walked,
+	// bounding memory for huge repositories. Streamed indexes carry no ETag.
+	StreamIndex bool `yaml:"stream-index"`
+	// OpenAIModels serves the cached models at the OpenAI compatible /v1/models listing
+	OpenAIModels bool `yaml:"openai-models"`
+	// WebDAV serves the models of the storage over WebDAV at /dav
+	WebDAV bool `yaml:"webdav"`
+	// WebDAVWriteToken allows WebDAV clients presenting it to upload and delete files
+	// (empty: the WebDAV mount is read-only)
+	WebDAVWriteToken string `yaml:"webdav-write-token"`
+	// MmapMaxFileSize is the largest file served from a memory-mapped region (0 disables mmap)
+	MmapMaxFileSize int64 `yaml:"mmap-max-file-size"`
+	// MmapCacheEntries bounds the number of files kept memory-mapped
+	MmapCacheEntries int `yaml:"mmap-cache-entries"`
+	// UpstreamTimeout bounds upstream API requests and response headers
+	UpstreamTimeout time.Duration `yaml:"upstream-timeout"`
+	// MaxIdleConns is the size of the idle connection pool to the upstream
+	MaxIdleConns int `yaml:"max-idle-conns"`
+	// IdleConnTimeout is how long idle upstream connections are kept
+	IdleConnTimeout time.Duration `yaml:"idle-conn-timeout"`
+	// APICacheTTL is how long proxied API responses are served from the cache (0 disables caching)
+	APICacheTTL time.Duration `yaml:"api-cache-ttl"`
+	// APICacheMaxStale is how long expired API responses are still served while the
+	// upstream is unavailable (0: never)
+	APICacheMaxStale time.Duration `yaml:"api-cache-max-stale"`
+	// APICachePaths are the upstream API path prefixes whose GET responses are cached
+	APICachePaths []string `yaml:"api-cache-paths"`
+	// MaxConcurrentPerModel caps concurrent file downloads of a single model (0 means unlimited)
+	MaxConcurrentPerModel int `yaml:"max-concurrent-per-model"`
+	// OTLPEndpoint is the OTLP/HTTP collector URL traces are exported to (empty disables export)
+	OTLPEndpoint string `yaml:"otlp-endpoint"`
+	// PerIPBytes caps the bytes downloaded by a client IP per quota window (0 means unlimited)
+	PerIPBytes int64 `yaml:"per-ip-daily-bytes"`
+	// PerIPQuotaWindow is the period after which a client's download quota resets
+	PerIPQuotaWindow time.Duration `yaml:"per-ip-quota-window"`
+	// PerIPRequestRate caps the requests per second of a client IP to the file and
+	// index routes (0 means unlimited)
+	PerIPRequestRate float64 `yaml:"per-ip-request-rate"`
+	// PerIPBurst is the number of requests a client IP may send at once above its rate
+	// (0 means the rate rounded up)
+	PerIPBurst int `yaml:"per-ip-burst"`
+	// PerIPMaxConcurrent caps the requests of a client IP in flight to the file and
+	// index routes (0 means unlimited)
+	PerIPMaxConcurrent int `yaml:"per-ip-max-concurrent"`
+	// RateLimit caps the bytes per second of each download and proxied response (0 means unlimited)
+	RateLimit int64 `yaml:"rate-limit"`
+	// MaxUploadBytes caps the size of an uploaded file, larger uploads are answered
+	// with 413 (0 means unlimited)
+	MaxUploadBytes int64 `yaml:"max-upload-bytes"`
+	// DownloadWebhook is a URL every completed download is posted to (empty disables it)
+	DownloadWebhook string `yaml:"download-webhook"`
+	// AccessLog is a file one JSON object per request is appended to (empty disables it)
+	AccessLog string `yaml:"access-log"`
+	// AccessLogMaxSize rotates the access log to <access-log>.1 before it grows beyond
+	// this many bytes (0 only appends)
+	AccessLogMaxSize int64 `yaml:"access-log-max-size"`
+	// CORSOrigins are the origins allowed to make cross-origin requests, "*" allows any origin
+	CORSOrigins []string `yaml:"cors-origins"`
+	// CORSMethods are the methods allowed in cross-origin requests (empty: GET, HEAD and POST)
+	CORSMethods []string `yaml:"cors-methods"`
+	// CORSHeaders are the request headers allowed in cross-origin requests besides the
+	// always allowed simple headers
+	CORSHeaders []string `yaml:"cors-headers"`
+	// AdminToken authorizes uploads and other administrative operations presented as
+	// bearer token (empty: those operations are disabled)
+	AdminToken string `yaml:"admin-token"`
+	// ACLFile lists private models and the tokens allowed to access them (empty: all models are public)
+	ACLFile string `yaml:"acl-file"`
+	// StorageRules route models to a storage other than StorageType, the first matching
+	// rule wins. Rules can only be set in the config file.
+	StorageRules []StorageRule `yaml:"storage-rules"`
+	// ModelAliases serves a stored model under another model ID, mapping the requested
+	// ID to the stored one. Aliases can only be set in the config file.
+	ModelAliases map[string]string `yaml:"model-aliases"`
+}
+
+// LoadConfigFile reads a YAML or JSON config file into config. Fields missing from the
+// file keep their current value, so config can be pre-populated with defaults.
+func LoadConfigFile(path string, config *Config) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+	// JSON is valid YAML, so a single decoder handles both formats
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(config); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+	return nil
+}
+
+// Validate checks that the configuration is usable
+func (c Config) Validate() error {
+	if c.Port <= 0 || c.Port > 65535 {
+		return fmt.Errorf("port must be between 1 and 65535, got %d", c.Port)
+	}
+	switch c.StorageType {
+	case api.GitStorage:
+		if c.GitBaseDir == "" {
+			return errors.New("git-base-dir is required for git storage")
+		}
+	case api.FileStorage:
+		if c.FileBaseDir == "" {
+			return errors.New("file-base-dir is required for file storage")
+		}
+	case api.OSSStorage:
+		if c.OSSEndpoint == "" || c.OSSBucket == "" {
+			return errors.New("oss-endpoint and oss-bucket are required for OSS storage")
+		}
+	default:
+		return fmt.Errorf("invalid storage type: %d", c.StorageType)
+	}
+	if _, err := utils.ParseLayoutStrategy(c.Layout); err != nil {
+		return err
+	}
+	if _, err := utils.ParseRepoType(c.RepoType); err != nil {
+		return err
+	}
+	if c.RewriteLocation && !c.FallbackProxy {
+		return errors.New("rewrite-location requires fallback-proxy")
+	}
+	if _, err := newModelAliases(c.ModelAliases); err != nil {
+		return err
+	}
+	proxied := false
+	for _, rule := range c.StorageRules {
+		proxied = proxied || rule.Storage == RouteProxy
+	}
+	if c.EnableProxy || c.FallbackProxy || proxied {
+		if _, err := proxy.ParseUpstreams(c.ProxyBaseURL); err != nil {
+			return fmt.Errorf("invalid proxy-base-url: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+package server
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lengrongfu/LLMDistribution/pkg/api"
+)
+
+func TestLoadConfigFile(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		content string
+		wantErr string
+		check   func(t *testing.T, c Config)
+	}{
+		{"yaml", "config.yaml", "port: 9000\nstorage-type: 1\nfile-base-dir: /data\nindex-cache-ttl: 1m\ncors-origins: [\"https://a.example\"]\n", "", func(t *testing.T, c Config) {
+			if c.Port != 9000 || c.StorageType != api.FileStorage || c.FileBaseDir != "/data" || c.IndexCacheTTL != time.Minute {
+				t.Errorf("config = %+v", c)
+			}
+			if len(c.CORSOrigins) != 1 || c.CORSOrigins[0] != "https://a.example" {
+				t.Errorf("cors-origins = %v", c.CORSOrigins)
+			}
+		}},
+		{"json", "config.json", `{"port": 9001, "fallback-proxy": true}`, "", func(t *testing.T, c Config) {
+			if c.Port != 9001 || !c.FallbackProxy {
+				t.Errorf("config = %+v", c)
+			}
+		}},
+		{"defaults kept", "config.yaml", "port: 9002\n", "", func(t *testing.T, c Config) {
+			if c.DefaultRevision != "main" {
+				t.Errorf("default-revision = %q, want the preset main", c.DefaultRevision)
+			}
+		}},
+		{"empty file", "config.yaml", "", "", func(t *testing.T, c Config) {
+			if c.Port != 8081 {
+				t.Errorf("port = %d, want the preset 8081", c.Port)
+			}
+		}},
+		{"unknown key", "config.yaml", "prot: 9000\n", "field prot not found", nil},
+		{"missing file", "", "", "failed to read config file", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "missing.yaml")
+			if tt.file != "" {
+				path = filepath.Join(filepath.Dir(path), tt.file)
+				if err := os.WriteFile(path, []byte(tt.content), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			config := Config{Port: 8081, DefaultRevision: "main"}
+			err := LoadConfigFile(path, &config)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("LoadConfigFile = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("LoadConfigFile: %v", err)
+			}
+			tt.check(t, config)
+		})
+	}
+}
+
+func TestConfigValidate(t *testing.T) {
+	valid := Config{Port: 8081, StorageType: api.FileStorage, FileBaseDir: "/data"}
+	tests := []struct {
+		name    string
+		modify  func(c *Config)
+		wantErr string
+	}{
+		{"valid", func(c *Config) {}, ""},
+		{"port", func(c *Config) { c.Port = 0 }, "port must be between"},
+		{"file base dir", func(c *Config) { c.FileBaseDir = "" }, "file-base-dir is required"},
+		{"git base dir", func(c *Config) { c.StorageType = api.GitStorage }, "git-base-dir is required"},
+		{"oss bucket", func(c *Config) { c.StorageType = api.OSSStorage }, "oss-endpoint and oss-bucket are required"},
+		{"storage type", func(c *Config) { c.StorageType = 42 }, "invalid storage type"},
+		{"layout", func(c *Config) { c.Layout = "tree" }, "layout"},
+		{"rewrite without fallback", func(c *Config) { c.RewriteLocation = true }, "rewrite-location requires fallback-proxy"},
+		{"upstream", func(c *Config) {
+			c.FallbackProxy = true
+			c.ProxyBaseURL = "huggingface.co"
+		}, "invalid proxy-base-url"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := valid
+			tt.modify(&config)
+			err := config.Validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("Validate: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("Validate = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,63 @@
+package server
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestCORS(t *testing.T) {
+	tests := []struct {
+		name        string
+		origins     []string
+		methods     []string
+		headers     []string
+		origin      string
+		preflight   string
+		reqHeader   string
+		wantOrigin  string
+		wantMethods bool
+	}{
+		{name: "any origin by default", origin: "https://a.example", wantOrigin: "*"},
+		{name: "allowed origin", origins: []string{"https://a.example"}, origin: "https://a.example", wantOrigin: "https://a.example"},
+		{name: "disallowed origin", origins: []string{"https://a.example"}, origin: "https://b.example"},
+		{name: "preflight allowed method", origins: []string{"https://a.example"}, methods: []string{"PUT"}, origin: "https://a.example", preflight: "PUT", wantOrigin: "https://a.example", wantMethods: true},
+		{name: "preflight disallowed method", origins: []string{"https://a.example"}, methods: []string{"PUT"}, origin: "https://a.example", preflight: "DELETE"},
+		{name: "preflight allowed header", origins: []string{"https://a.example"}, headers: []string{"X-Custom"}, origin: "https://a.example", preflight: "GET", reqHeader: "X-Custom", wantOrigin: "https://a.example"},
+		{name: "preflight disallowed header", origins: []string{"https://a.example"}, origin: "https://a.example", preflight: "GET", reqHeader: "X-Custom"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, ts := newTestServer(t, func(c *Config) {
+				c.CORSOrigins = tt.origins
+				c.CORSMethods = tt.methods
+				c.CORSHeaders = tt.headers
+			})
+			method := http.MethodGet
+			if tt.preflight != "" {
+				method = http.MethodOptions
+			}
+			req, err := http.NewRequest(method, ts.URL+"/healthz", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Origin", tt.origin)
+			if tt.preflight != "" {
+				req.Header.Set("Access-Control-Request-Method", tt.preflight)
+			}
+			if tt.reqHeader != "" {
+				req.Header.Set("Access-Control-Request-Headers", tt.reqHeader)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if got := resp.Header.Get("Access-Control-Allow-Origin"); got != tt.wantOrigin {
+				t.Errorf("Access-Control-Allow-Origin = %q, want %q", got, tt.wantOrigin)
+			}
+			if got := resp.Header.Get("Access-Control-Allow-Methods") != ""; got != tt.wantMethods {
+				t.Errorf("Access-Control-Allow-Methods set = %v, want %v", got, tt.wantMethods)
+			}
+		})
+	}
+}
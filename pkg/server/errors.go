@@ -0,0 +1,81 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/lengrongfu/LLMDistribution/pkg/api"
+	"github.com/lengrongfu/LLMDistribution/pkg/utils"
+)
+
+// errorResponse is the JSON body returned for failed requests
+type errorResponse struct {
+	Error errorDetail `json:"error"`
+}
+
+// errorDetail describes why a request failed
+type errorDetail struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	// AvailableRevisions hints at the cached revisions when the requested one is missing
+	AvailableRevisions []string `json:"available_revisions,omitempty"`
+}
+
+// writeJSONError writes a {"error":{"code":...,"message":...}} response with the given status
+func writeJSONError(w http.ResponseWriter, status int, code, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(errorResponse{
+		Error: errorDetail{
+			Code:    code,
+			Message: message,
+		},
+	})
+}
+
+// writeStorageError writes a JSON error for a failed storage operation, mapping the
+// storage error to the HTTP status and code reported to the client
+func writeStorageError(w http.ResponseWriter, message string, err error) {
+	var revErr *api.RevisionNotFoundError
+	if errors.As(err, &revErr) {
+		writeRevisionNotFound(w, revErr)
+		return
+	}
+	if errors.Is(err, api.ErrUnsupportedOperation) {
+		writeJSONError(w, http.StatusNotImplemented, "unsupported_operation", message)
+		return
+	}
+	var sizeErr *http.MaxBytesError
+	if errors.As(err, &sizeErr) {
+		writeUploadTooLarge(w, sizeErr.Limit)
+		return
+	}
+	if errors.Is(err, utils.ErrInvalidPath) {
+		writeJSONError(w, http.StatusBadRequest, "invalid_path", message)
+		return
+	}
+	writeJSONError(w, http.StatusInternalServerError, "internal_error", message)
+}
+
+// writeUploadTooLarge answers 413 for an upload exceeding the maximum upload size
+func writeUploadTooLarge(w http.ResponseWriter, limit int64) {
+	writeJSONError(w, http.StatusRequestEntityTooLarge, "payload_too_large", fmt.Sprintf("Uploads are limited to %d bytes", limit))
+}
+
+// writeRevisionNotFound answers 404 for an uncached revision, listing the revisions
+// of the model that are cached
+func writeRevisionNotFound(w http.ResponseWriter, err *api.RevisionNotFoundError) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(http.StatusNotFound)
+	json.NewEncoder(w).Encode(errorResponse{
+		Error: errorDetail{
+			Code:               "revision_not_found",
+			Message:            err.Error(),
+			AvailableRevisions: err.Available,
+		},
+	})
+}
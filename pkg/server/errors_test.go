@@ -0,0 +1,129 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/lengrongfu/LLMDistribution/pkg/api"
+	"github.com/lengrongfu/LLMDistribution/pkg/utils"
+)
+
+func TestWriteStorageError(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		wantStatus int
+		wantCode   string
+	}{
+		{"unsupported operation", fmt.Errorf("%w: no index", api.ErrUnsupportedOperation), http.StatusNotImplemented, "unsupported_operation"},
+		{"other error", errors.New("disk full"), http.StatusInternalServerError, "internal_error"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			writeStorageError(rec, "Failed", tt.err)
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			var body errorResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+				t.Fatalf("body %q: %v", rec.Body, err)
+			}
+			if body.Error.Code != tt.wantCode {
+				t.Errorf("code = %q, want %q", body.Error.Code, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestJSONErrorResponses(t *testing.T) {
+	_, ts := newTestServer(t, nil)
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		wantStatus int
+		wantCode   string
+	}{
+		{"missing file", "GET", "/org/m/resolve/main/config.json", http.StatusNotFound, "file_not_found"},
+		{"upload without token", "PUT", "/api/models/org/m/upload/main?path=config.json", http.StatusUnauthorized, "unauthorized"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest(tt.method, ts.URL+tt.path, nil)
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode != tt.wantStatus {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+			if ct := resp.Header.Get("Content-Type"); ct != "application/json" {
+				t.Errorf("Content-Type = %q", ct)
+			}
+			var body errorResponse
+			if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+				t.Fatal(err)
+			}
+			if body.Error.Code != tt.wantCode || body.Error.Message == "" {
+				t.Errorf("error = %+v, want code %q", body.Error, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestRevisionNotFound(t *testing.T) {
+	var fileDir string
+	_, ts := newTestServer(t, func(c *Config) { fileDir = c.FileBaseDir })
+	status, body := doRequest(t, "PUT", ts.URL+"/api/models/org/m/upload/main?path=config.json", testAdminToken, strings.NewReader("{}"))
+	if status != http.StatusOK {
+		t.Fatalf("upload: %d %s", status, body)
+	}
+	// the model index of the cached revision is stored like the proxy stores it
+	status, index := doRequest(t, "GET", ts.URL+"/api/models/org/m/revision/main", "", nil)
+	if status != http.StatusOK {
+		t.Fatalf("index: %d %s", status, index)
+	}
+	indexPath := utils.NewLayout(filepath.Join(fileDir, "hub"), utils.LayoutHF).IndexPath("org/m")
+	if err := os.WriteFile(indexPath, []byte(index), 0644); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name          string
+		path          string
+		wantCode      string
+		wantAvailable bool
+	}{
+		{"uncached revision", "/org/m/resolve/v2/config.json", "revision_not_found", true},
+		{"missing file at cached revision", "/org/m/resolve/main/other.json", "file_not_found", false},
+		{"uncached model", "/org/other/resolve/main/config.json", "file_not_found", false},
+		{"index of an uncached revision", "/api/models/org/m/revision/v2", "revision_not_found", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, raw := doRequest(t, "GET", ts.URL+tt.path, "", nil)
+			if status != http.StatusNotFound {
+				t.Fatalf("status %d: %s", status, raw)
+			}
+			var body errorResponse
+			if err := json.Unmarshal([]byte(raw), &body); err != nil {
+				t.Fatal(err)
+			}
+			if body.Error.Code != tt.wantCode {
+				t.Errorf("code = %q, want %q", body.Error.Code, tt.wantCode)
+			}
+			if hasMain := slices.Contains(body.Error.AvailableRevisions, "main"); hasMain != tt.wantAvailable {
+				t.Errorf("available revisions = %v, want main listed %v", body.Error.AvailableRevisions, tt.wantAvailable)
+			}
+		})
+	}
+}
@@ -0,0 +1,171 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lengrongfu/LLMDistribution/pkg/api"
+	"github.com/lengrongfu/LLMDistribution/pkg/utils"
+)
+
+// ggufShardPattern matches the shards of a split GGUF file, like model-00001-of-00003.gguf
+var ggufShardPattern = regexp.MustCompile(`^(.+)-(\d{5})-of-(\d{5})\.gguf$`)
+
+// ggufShard is one cached shard of a split GGUF file
+type ggufShard struct {
+	filename string
+	size     int64
+	modTime  time.Time
+}
+
+// ggufShards returns the shards of the split GGUF file filename in order. It returns
+// nil unless every shard of the split is cached.
+func ggufShards(dist api.Distribution, modelID, sha, filename string) []ggufShard {
+	lister, ok := dist.(api.TreeLister)
+	if !ok {
+		return nil
+	}
+	dir := path.Dir(filename)
+	if dir == "." {
+		dir = ""
+	}
+	entries, err := lister.ListTree(modelID, sha, dir, false)
+	if err != nil {
+		return nil
+	}
+	base := strings.TrimSuffix(path.Base(filename), ".gguf")
+	byIndex := map[int]string{}
+	total := 0
+	for _, entry := range entries {
+		m := ggufShardPattern.FindStringSubmatch(path.Base(entry.Path))
+		if m == nil || m[1] != base {
+			continue
+		}
+		index, _ := strconv.Atoi(m[2])
+		count, _ := strconv.Atoi(m[3])
+		if total != 0 && count != total {
+			// shards of two different splits
+			return nil
+		}
+		total = count
+		byIndex[index] = entry.Path
+	}
+	if total == 0 || len(byIndex) != total {
+		return nil
+	}
+
+	shards := make([]ggufShard, 0, total)
+	for i := 1; i <= total; i++ {
+		name, ok := byIndex[i]
+		if !ok {
+			return nil
+		}
+		info, ok := dist.FileExists(modelID, sha, name)
+		if !ok {
+			return nil
+		}
+		shards = append(shards, ggufShard{filename: name, size: info.Size(), modTime: info.ModTime()})
+	}
+	return shards
+}
+
+// serveMergedGGUF streams the shards of a split GGUF file as a single file. Ranges are
+// supported across shard boundaries.
+func (s *Server) serveMergedGGUF(w http.ResponseWriter, r *http.Request, dist api.Distribution, modelID, sha, filename string, shards []ggufShard) {
+	var modTime time.Time
+	parts := make([]io.ReadSeeker, 0, len(shards))
+	sizes := make([]int64, 0, len(shards))
+	defer func() {
+		for _, part := range parts {
+			if closer, ok := part.(io.Closer); ok {
+				closer.Close()
+			}
+		}
+	}()
+	for _, shard := range shards {
+		file, err := dist.GetFile(modelID, sha, shard.filename)
+		if err != nil {
+			writeJSONError(w, http.StatusInternalServerError, "internal_error", fmt.Sprintf("Failed to get shard %s", shard.filename))
+			return
+		}
+		parts = append(parts, file)
+		sizes = append(sizes, shard.size)
+		if shard.modTime.After(modTime) {
+			modTime = shard.modTime
+		}
+	}
+	content := &concatReadSeeker{parts: parts, sizes: sizes}
+	for _, size := range sizes {
+		content.total += size
+	}
+
+	w.Header().Set("X-Repo-Commit", sha)
+	w.Header().Set("Content-Disposition", contentDisposition(r, path.Base(filename)))
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Length", strconv.FormatInt(content.total, 10))
+	if s.RateLimit > 0 {
+		w = &throttledResponseWriter{ResponseWriter: w, w: utils.NewThrottledWriter(w, s.RateLimit)}
+	}
+	rec := &responseRecorder{ResponseWriter: w}
+	http.ServeContent(streamWriter(rec, content, content.total), r, path.Base(filename), modTime, content)
+	s.proxy.RecordHit(rec.bytes)
+}
+
+// concatReadSeeker reads several ReadSeekers of known sizes as one seekable stream
+type concatReadSeeker struct {
+	parts  []io.ReadSeeker
+	sizes  []int64
+	total  int64
+	offset int64
+}
+
+func (c *concatReadSeeker) Read(p []byte) (int, error) {
+	start := int64(0)
+	for i, part := range c.parts {
+		end := start + c.sizes[i]
+		if c.offset >= end {
+			start = end
+			continue
+		}
+		if _, err := part.Seek(c.offset-start, io.SeekStart); err != nil {
+			return 0, err
+		}
+		if int64(len(p)) > end-c.offset {
+			p = p[:end-c.offset]
+		}
+		n, err := part.Read(p)
+		c.offset += int64(n)
+		if errors.Is(err, io.EOF) && c.offset < end {
+			return n, io.ErrUnexpectedEOF
+		}
+		if errors.Is(err, io.EOF) {
+			err = nil
+		}
+		return n, err
+	}
+	return 0, io.EOF
+}
+
+func (c *concatReadSeeker) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += c.offset
+	case io.SeekEnd:
+		offset += c.total
+	default:
+		return 0, errors.New("invalid whence")
+	}
+	if offset < 0 {
+		return 0, errors.New("negative position")
+	}
+	c.offset = offset
+	return offset, nil
+}
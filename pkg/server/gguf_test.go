@@ -0,0 +1,62 @@
+package server
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestMergedGGUF(t *testing.T) {
+	_, ts := newTestServer(t, nil)
+	shards := map[string]string{
+		"model-00001-of-00003.gguf":   "AAA",
+		"model-00002-of-00003.gguf":   "BBB",
+		"model-00003-of-00003.gguf":   "CCC",
+		"partial-00001-of-00002.gguf": "AAA",
+	}
+	for name, content := range shards {
+		status, body := doRequest(t, "PUT", ts.URL+"/api/models/org/m/upload/main?path="+name, testAdminToken, strings.NewReader(content))
+		if status != http.StatusOK {
+			t.Fatalf("upload %s: %d %s", name, status, body)
+		}
+	}
+
+	tests := []struct {
+		name       string
+		path       string
+		rangeHdr   string
+		wantStatus int
+		wantBody   string
+	}{
+		{"merged", "model.gguf?merge=true", "", http.StatusOK, "AAABBBCCC"},
+		{"range across shards", "model.gguf?merge=true", "bytes=2-6", http.StatusPartialContent, "ABBBC"},
+		{"range in last shard", "model.gguf?merge=true", "bytes=-2", http.StatusPartialContent, "CC"},
+		{"without merge", "model.gguf", "", http.StatusNotFound, ""},
+		{"missing shard", "partial.gguf?merge=true", "", http.StatusNotFound, ""},
+		{"single shard", "model-00002-of-00003.gguf?merge=true", "", http.StatusOK, "BBB"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest("GET", ts.URL+"/org/m/resolve/main/"+tt.path, nil)
+			if tt.rangeHdr != "" {
+				req.Header.Set("Range", tt.rangeHdr)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			body, _ := io.ReadAll(resp.Body)
+			if resp.StatusCode != tt.wantStatus {
+				t.Fatalf("status %d: %s, want %d", resp.StatusCode, body, tt.wantStatus)
+			}
+			if tt.wantBody != "" && string(body) != tt.wantBody {
+				t.Errorf("body = %q, want %q", body, tt.wantBody)
+			}
+			if tt.wantBody != "" && resp.ContentLength != int64(len(tt.wantBody)) {
+				t.Errorf("Content-Length = %d, want %d", resp.ContentLength, len(tt.wantBody))
+			}
+		})
+	}
+}
@@ -0,0 +1,46 @@
+package server
+
+import "sync"
+
+// modelLimiter caps the number of concurrent downloads for each model
+type modelLimiter struct {
+	mu     sync.Mutex
+	limit  int
+	active map[string]int
+}
+
+// newModelLimiter creates a limiter allowing limit concurrent downloads per model,
+// a limit <= 0 disables the limiter
+func newModelLimiter(limit int) *modelLimiter {
+	return &modelLimiter{
+		limit:  limit,
+		active: make(map[string]int),
+	}
+}
+
+// acquire reserves a download slot for the model and reports whether one was available
+func (l *modelLimiter) acquire(modelID string) bool {
+	if l.limit <= 0 {
+		return true
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.active[modelID] >= l.limit {
+		return false
+	}
+	l.active[modelID]++
+	return true
+}
+
+// release frees a download slot previously reserved by acquire
+func (l *modelLimiter) release(modelID string) {
+	if l.limit <= 0 {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.active[modelID]--
+	if l.active[modelID] <= 0 {
+		delete(l.active, modelID)
+	}
+}
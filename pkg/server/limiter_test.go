@@ -0,0 +1,119 @@
+package server
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestModelLimiter(t *testing.T) {
+	tests := []struct {
+		name  string
+		limit int
+		// acquires are the models a slot is acquired for in order, want whether each
+		// acquire succeeds
+		acquires []string
+		want     []bool
+	}{
+		{"disabled", 0, []string{"org/a", "org/a", "org/a"}, []bool{true, true, true}},
+		{"limit reached", 2, []string{"org/a", "org/a", "org/a"}, []bool{true, true, false}},
+		{"per model", 1, []string{"org/a", "org/b", "org/a"}, []bool{true, true, false}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := newModelLimiter(tt.limit)
+			for i, modelID := range tt.acquires {
+				if got := l.acquire(modelID); got != tt.want[i] {
+					t.Errorf("acquire #%d of %s = %v, want %v", i, modelID, got, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestModelLimiterRelease(t *testing.T) {
+	l := newModelLimiter(1)
+	if !l.acquire("org/a") {
+		t.Fatal("first acquire failed")
+	}
+	l.release("org/a")
+	if !l.acquire("org/a") {
+		t.Error("acquire after release failed")
+	}
+	l.release("org/a")
+	if len(l.active) != 0 {
+		t.Errorf("active = %v, want no models", l.active)
+	}
+}
+
+func TestModelLimiterRejectsExtraStreams(t *testing.T) {
+	const limit = 2
+	// the upstream holds the downloads of org/slow until release is closed
+	release := make(chan struct{})
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Repo-Commit", testCommit)
+		w.Header().Set("ETag", `"0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"`)
+		w.Header().Set("Content-Length", "2")
+		if r.Method == "GET" {
+			<-release
+			io.WriteString(w, "{}")
+		}
+	}))
+	t.Cleanup(upstream.Close)
+	var once sync.Once
+	unblock := func() { once.Do(func() { close(release) }) }
+	t.Cleanup(unblock)
+
+	s, ts := newTestServer(t, func(c *Config) {
+		c.ProxyBaseURL = upstream.URL
+		c.FallbackProxy = true
+		c.MaxConcurrentPerModel = limit
+	})
+	status, body := doRequest(t, "PUT", ts.URL+"/api/models/org/m/upload/main?path=config.json", testAdminToken, strings.NewReader("{}"))
+	if status != http.StatusOK {
+		t.Fatalf("upload: %d %s", status, body)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < limit; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			resp, err := http.Get(fmt.Sprintf("%s/org/slow/resolve/main/file%d.json", ts.URL, i))
+			if err == nil {
+				io.Copy(io.Discard, resp.Body)
+				resp.Body.Close()
+			}
+		}(i)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		s.modelLimiter.mu.Lock()
+		active := s.modelLimiter.active["org/slow"]
+		s.modelLimiter.mu.Unlock()
+		if active == limit {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%d streams of org/slow active, want %d", active, limit)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	status, body = doRequest(t, "GET", ts.URL+"/org/slow/resolve/main/extra.json", "", nil)
+	if status != http.StatusTooManyRequests || !strings.Contains(body, `"code":"too_many_requests"`) {
+		t.Errorf("stream above the limit: %d %s, want 429", status, body)
+	}
+	// the limit is per model, other models are still served
+	if status, body := doRequest(t, "GET", ts.URL+"/org/m/resolve/main/config.json", "", nil); status != http.StatusOK {
+		t.Errorf("other model: %d %s, want 200", status, body)
+	}
+
+	unblock()
+	wg.Wait()
+}
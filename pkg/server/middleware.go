@@ -0,0 +1,82 @@
+package server
+
+import (
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// responseRecorder wraps an http.ResponseWriter to capture the status code and bytes written
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (rr *responseRecorder) WriteHeader(status int) {
+	if rr.status == 0 {
+		rr.status = status
+	}
+	rr.ResponseWriter.WriteHeader(status)
+}
+
+func (rr *responseRecorder) Write(p []byte) (int, error) {
+	if rr.status == 0 {
+		rr.status = http.StatusOK
+	}
+	n, err := rr.ResponseWriter.Write(p)
+	rr.bytes += int64(n)
+	return n, err
+}
+
+// ReadFrom keeps the underlying writer's io.ReaderFrom (sendfile) fast path available
+func (rr *responseRecorder) ReadFrom(src io.Reader) (int64, error) {
+	if rr.status == 0 {
+		rr.status = http.StatusOK
+	}
+	var (
+		n   int64
+		err error
+	)
+	if rf, ok := rr.ResponseWriter.(io.ReaderFrom); ok {
+		n, err = rf.ReadFrom(src)
+	} else {
+		n, err = io.Copy(rr.ResponseWriter, src)
+	}
+	rr.bytes += n
+	return n, err
+}
+
+// Flush implements http.Flusher so streamed proxy responses are not buffered
+func (rr *responseRecorder) Flush() {
+	if f, ok := rr.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap returns the underlying writer for http.ResponseController
+func (rr *responseRecorder) Unwrap() http.ResponseWriter {
+	return rr.ResponseWriter
+}
+
+// loggingMiddleware emits one structured log line per request
+func loggingMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &responseRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r)
+		status := rec.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		slog.Info("request",
+			"method", r.Method,
+			"path", r.URL.Path,
+			"status", status,
+			"bytes", rec.bytes,
+			"duration", time.Since(start),
+			"remote_addr", r.RemoteAddr,
+		)
+	})
+}
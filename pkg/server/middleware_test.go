@@ -0,0 +1,52 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestLoggingMiddleware(t *testing.T) {
+	tests := []struct {
+		name       string
+		handler    http.HandlerFunc
+		wantStatus float64
+		wantBytes  float64
+	}{
+		{"no body", func(w http.ResponseWriter, r *http.Request) {}, 200, 0},
+		{"status", func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNotFound)
+			io.WriteString(w, "missing")
+		}, 404, 7},
+		{"read from", func(w http.ResponseWriter, r *http.Request) {
+			w.(io.ReaderFrom).ReadFrom(strings.NewReader("content"))
+		}, 200, 7},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			prev := slog.Default()
+			slog.SetDefault(slog.New(slog.NewJSONHandler(&buf, nil)))
+			defer slog.SetDefault(prev)
+
+			req := httptest.NewRequest("GET", "/org/m/resolve/main/config.json", nil)
+			loggingMiddleware(tt.handler).ServeHTTP(httptest.NewRecorder(), req)
+
+			var record map[string]any
+			if err := json.Unmarshal(buf.Bytes(), &record); err != nil {
+				t.Fatalf("log line %q: %v", buf.String(), err)
+			}
+			if record["msg"] != "request" || record["method"] != "GET" || record["path"] != req.URL.Path {
+				t.Errorf("record = %v", record)
+			}
+			if record["status"] != tt.wantStatus || record["bytes"] != tt.wantBytes {
+				t.Errorf("status %v, bytes %v, want %v, %v", record["status"], record["bytes"], tt.wantStatus, tt.wantBytes)
+			}
+		})
+	}
+}
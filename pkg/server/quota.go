@@ -0,0 +1,102 @@
+package server
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// byteQuota limits the number of bytes served to each client IP per time window
+type byteQuota struct {
+	mu     sync.Mutex
+	limit  int64
+	window time.Duration
+	usage  map[string]*quotaUsage
+	now    func() time.Time
+}
+
+// quotaUsage is the number of bytes served to a client in the current window
+type quotaUsage struct {
+	bytes int64
+	start time.Time
+}
+
+// newByteQuota creates a quota of limit bytes per window, a limit <= 0 disables it
+func newByteQuota(limit int64, window time.Duration) *byteQuota {
+	if window <= 0 {
+		window = 24 * time.Hour
+	}
+	return &byteQuota{
+		limit:  limit,
+		window: window,
+		usage:  make(map[string]*quotaUsage),
+		now:    time.Now,
+	}
+}
+
+// current returns the usage of ip in the current window, starting a new window if
+// the previous one has ended. The caller must hold q.mu.
+func (q *byteQuota) current(ip string) *quotaUsage {
+	now := q.now()
+	u, ok := q.usage[ip]
+	if !ok || now.Sub(u.start) >= q.window {
+		u = &quotaUsage{start: now}
+		q.usage[ip] = u
+	}
+	return u
+}
+
+// remaining reports whether ip has budget left and when its window resets
+func (q *byteQuota) remaining(ip string) (bool, time.Duration) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	u := q.current(ip)
+	return u.bytes < q.limit, u.start.Add(q.window).Sub(q.now())
+}
+
+// add records n bytes served to ip
+func (q *byteQuota) add(ip string, n int64) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.current(ip).bytes += n
+	// drop clients whose window has ended to bound memory
+	now := q.now()
+	for key, u := range q.usage {
+		if now.Sub(u.start) >= q.window {
+			delete(q.usage, key)
+		}
+	}
+}
+
+// middleware rejects clients that exhausted their budget with 429 and counts the
+// bytes served to the others
+func (q *byteQuota) middleware(next http.Handler) http.Handler {
+	if q.limit <= 0 {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ip := clientIP(r)
+		ok, reset := q.remaining(ip)
+		if !ok {
+			w.Header().Set("Retry-After", strconv.Itoa(int(reset.Seconds())+1))
+			writeJSONError(w, http.StatusTooManyRequests, "quota_exceeded",
+				fmt.Sprintf("Download quota of %d bytes exceeded, retry after %s", q.limit, reset.Round(time.Second)))
+			return
+		}
+		rec := &responseRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r)
+		q.add(ip, rec.bytes)
+	})
+}
+
+// clientIP returns the IP address of the client that sent the request
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
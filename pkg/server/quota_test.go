@@ -0,0 +1,46 @@
+package server
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestByteQuota(t *testing.T) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	q := newByteQuota(15, time.Hour)
+	q.now = func() time.Time { return now }
+	handler := q.middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "0123456789")
+	}))
+
+	tests := []struct {
+		name    string
+		ip      string
+		advance time.Duration
+		want    int
+	}{
+		{"first download", "10.0.0.1", 0, http.StatusOK},
+		{"budget left", "10.0.0.1", 0, http.StatusOK},
+		{"budget exhausted", "10.0.0.1", 0, http.StatusTooManyRequests},
+		{"other client", "10.0.0.2", 0, http.StatusOK},
+		{"window reset", "10.0.0.1", time.Hour, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now = now.Add(tt.advance)
+			req := httptest.NewRequest("GET", "/org/m/resolve/main/model.bin", nil)
+			req.RemoteAddr = tt.ip + ":1234"
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.want)
+			}
+			if tt.want == http.StatusTooManyRequests && rec.Header().Get("Retry-After") != "3601" {
+				t.Errorf("Retry-After = %q", rec.Header().Get("Retry-After"))
+			}
+		})
+	}
+}
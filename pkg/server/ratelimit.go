@@ -0,0 +1,118 @@
+package server
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// clientLimiter limits the request rate of each client IP with a token bucket and
+// the number of requests a client IP has in flight
+type clientLimiter struct {
+	mu sync.Mutex
+	// rate is the number of requests per second a client's bucket refills with and
+	// burst its capacity (rate <= 0 disables rate limiting)
+	rate  float64
+	burst float64
+	// maxConcurrent caps the requests of a client in flight (0 means unlimited)
+	maxConcurrent int
+	clients       map[string]*clientState
+	now           func() time.Time
+}
+
+// clientState is the token bucket and the requests in flight of a client
+type clientState struct {
+	tokens  float64
+	updated time.Time
+	active  int
+}
+
+// newClientLimiter creates a limiter allowing rate requests per second with bursts of
+// burst requests and maxConcurrent requests in flight per client IP, limits <= 0 are
+// disabled
+func newClientLimiter(rate float64, burst, maxConcurrent int) *clientLimiter {
+	if burst < 1 {
+		burst = int(math.Max(1, math.Ceil(rate)))
+	}
+	return &clientLimiter{
+		rate:          rate,
+		burst:         float64(burst),
+		maxConcurrent: maxConcurrent,
+		clients:       make(map[string]*clientState),
+		now:           time.Now,
+	}
+}
+
+// enabled reports whether any limit is configured
+func (l *clientLimiter) enabled() bool {
+	return l.rate > 0 || l.maxConcurrent > 0
+}
+
+// acquire admits a request of ip, taking a token and a concurrency slot. When the
+// request is rejected it returns false and how long the client should wait.
+func (l *clientLimiter) acquire(ip string) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	c, ok := l.clients[ip]
+	if !ok {
+		c = &clientState{tokens: l.burst, updated: now}
+		l.clients[ip] = c
+	}
+	if l.rate > 0 {
+		c.tokens = math.Min(l.burst, c.tokens+now.Sub(c.updated).Seconds()*l.rate)
+		c.updated = now
+		if c.tokens < 1 {
+			return false, time.Duration((1 - c.tokens) / l.rate * float64(time.Second))
+		}
+	}
+	if l.maxConcurrent > 0 && c.active >= l.maxConcurrent {
+		return false, time.Second
+	}
+	if l.rate > 0 {
+		c.tokens--
+	}
+	c.active++
+	return true, 0
+}
+
+// release frees the concurrency slot of a request admitted by acquire
+func (l *clientLimiter) release(ip string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	c, ok := l.clients[ip]
+	if !ok {
+		return
+	}
+	c.active--
+	// drop idle clients whose bucket has refilled to bound memory
+	now := l.now()
+	for key, c := range l.clients {
+		if c.active <= 0 && (l.rate <= 0 || c.tokens+now.Sub(c.updated).Seconds()*l.rate >= l.burst) {
+			delete(l.clients, key)
+		}
+	}
+}
+
+// middleware rejects requests of clients above their rate or concurrency limit with
+// 429 and a Retry-After header
+func (l *clientLimiter) middleware(next http.Handler) http.Handler {
+	if !l.enabled() {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ip := clientIP(r)
+		ok, wait := l.acquire(ip)
+		if !ok {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			writeJSONError(w, http.StatusTooManyRequests, "rate_limited",
+				fmt.Sprintf("Too many requests from %s, retry after %s", ip, wait.Round(time.Millisecond)))
+			return
+		}
+		defer l.release(ip)
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,136 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestClientLimiter(t *testing.T) {
+	// step is a request of ip after advancing the clock by after, held in flight when
+	// hold is set
+	type step struct {
+		ip    string
+		after time.Duration
+		hold  bool
+		want  bool
+	}
+	tests := []struct {
+		name          string
+		rate          float64
+		burst         int
+		maxConcurrent int
+		steps         []step
+	}{
+		{"burst then rejected", 1, 2, 0, []step{
+			{"a", 0, false, true}, {"a", 0, false, true}, {"a", 0, false, false},
+		}},
+		{"bucket refills", 1, 1, 0, []step{
+			{"a", 0, false, true}, {"a", 500 * time.Millisecond, false, false}, {"a", 500 * time.Millisecond, false, true},
+		}},
+		{"burst defaults to the rate", 2.5, 0, 0, []step{
+			{"a", 0, false, true}, {"a", 0, false, true}, {"a", 0, false, true}, {"a", 0, false, false},
+		}},
+		{"per client", 1, 1, 0, []step{
+			{"a", 0, false, true}, {"b", 0, false, true}, {"a", 0, false, false},
+		}},
+		{"concurrency", 0, 0, 1, []step{
+			{"a", 0, true, true}, {"a", 0, false, false}, {"b", 0, false, true},
+		}},
+		{"released requests", 0, 0, 1, []step{
+			{"a", 0, false, true}, {"a", 0, false, true}, {"a", 0, false, true},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now := time.Unix(0, 0)
+			l := newClientLimiter(tt.rate, tt.burst, tt.maxConcurrent)
+			l.now = func() time.Time { return now }
+			for i, s := range tt.steps {
+				now = now.Add(s.after)
+				ok, wait := l.acquire(s.ip)
+				if ok != s.want {
+					t.Fatalf("request #%d of %s admitted = %v, want %v", i, s.ip, ok, s.want)
+				}
+				if !ok && wait <= 0 {
+					t.Fatalf("request #%d of %s rejected without a wait", i, s.ip)
+				}
+				if ok && !s.hold {
+					l.release(s.ip)
+				}
+			}
+		})
+	}
+}
+
+func TestClientLimiterDropsIdleClients(t *testing.T) {
+	now := time.Unix(0, 0)
+	l := newClientLimiter(1, 1, 0)
+	l.now = func() time.Time { return now }
+	l.acquire("a")
+	l.release("a")
+	if _, ok := l.clients["a"]; !ok {
+		t.Fatal("client with an empty bucket was dropped")
+	}
+	now = now.Add(time.Second)
+	l.acquire("b")
+	l.release("b")
+	if _, ok := l.clients["a"]; ok {
+		t.Fatal("client with a refilled bucket was kept")
+	}
+}
+
+func TestClientLimiterMiddleware(t *testing.T) {
+	tests := []struct {
+		name           string
+		rate           float64
+		wantStatus     int
+		wantRetryAfter string
+	}{
+		{"disabled", 0, http.StatusOK, ""},
+		{"rate exceeded", 0.5, http.StatusTooManyRequests, "2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := newClientLimiter(tt.rate, 1, 0)
+			now := time.Unix(0, 0)
+			l.now = func() time.Time { return now }
+			h := l.middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+			var rec *httptest.ResponseRecorder
+			for i := 0; i < 2; i++ {
+				rec = httptest.NewRecorder()
+				h.ServeHTTP(rec, httptest.NewRequest("GET", "/org/m/resolve/main/config.json", nil))
+			}
+			if rec.Code != tt.wantStatus || rec.Header().Get("Retry-After") != tt.wantRetryAfter {
+				t.Fatalf("second request = %d with Retry-After %q, want %d with %q",
+					rec.Code, rec.Header().Get("Retry-After"), tt.wantStatus, tt.wantRetryAfter)
+			}
+		})
+	}
+}
+
+func TestClientRateLimitRoutes(t *testing.T) {
+	_, ts := newTestServer(t, func(c *Config) {
+		c.PerIPRequestRate = 0.001
+		c.PerIPBurst = 1
+	})
+	tests := []struct {
+		name string
+		path string
+		// want is the status of the second request
+		want int
+	}{
+		{"model index", "/api/models/org/m/revision/main", http.StatusTooManyRequests},
+		{"model file", "/org/m/resolve/main/config.json", http.StatusTooManyRequests},
+		{"not limited", "/health", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doRequest(t, "GET", ts.URL+tt.path, "", nil)
+			if status, body := doRequest(t, "GET", ts.URL+tt.path, "", nil); status != tt.want {
+				t.Fatalf("status %d: %s, want %d", status, body, tt.want)
+			}
+		})
+	}
+}
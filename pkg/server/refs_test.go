@@ -0,0 +1,52 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/lengrongfu/LLMDistribution/pkg/client"
+)
+
+func TestClientListRefs(t *testing.T) {
+	_, ts := newTestServer(t, nil)
+	status, body := doRequest(t, "PUT", ts.URL+"/api/models/org/m/upload/main?path=config.json", testAdminToken, strings.NewReader("{}"))
+	if status != http.StatusOK {
+		t.Fatalf("upload = %d %s", status, body)
+	}
+
+	c := client.NewClient(ts.URL)
+	refs, err := c.ListRefs(context.Background(), "org/m")
+	if err != nil {
+		t.Fatalf("ListRefs: %v", err)
+	}
+	if len(refs.Branches) != 1 || len(refs.Tags) != 0 {
+		t.Fatalf("refs = %+v, want the main branch only", refs)
+	}
+	main := refs.Branches[0]
+	if main.Name != "main" || main.Ref != "refs/heads/main" || !isCommitSha(main.TargetCommit) {
+		t.Errorf("branch = %+v, want main pointing to a commit", main)
+	}
+
+	// the proxy is disabled, models that are not cached are not found
+	if refs, err := c.ListRefs(context.Background(), "org/missing"); err == nil {
+		t.Errorf("ListRefs of a missing model = %+v, want an error", refs)
+	}
+}
+
+func TestModelRefsSnapshots(t *testing.T) {
+	_, ts := newTestServer(t, nil)
+	status, body := doRequest(t, "PUT", ts.URL+"/api/models/org/m/upload/main?path=config.json", testAdminToken, strings.NewReader("{}"))
+	if status != http.StatusOK {
+		t.Fatalf("upload = %d %s", status, body)
+	}
+
+	status, body = doRequest(t, "GET", ts.URL+"/api/models/org/m/refs", "", nil)
+	if status != http.StatusOK {
+		t.Fatalf("refs = %d %s", status, body)
+	}
+	if !strings.Contains(body, `"snapshots":["`) || !strings.Contains(body, `"tags":[]`) {
+		t.Errorf("refs = %s, want the snapshot commits and no tags", body)
+	}
+}
@@ -0,0 +1,92 @@
+package server
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/lengrongfu/LLMDistribution/pkg/api"
+)
+
+// Storage names a StorageRule can route a model to
+const (
+	RouteGit   = "git"
+	RouteFile  = "file"
+	RouteProxy = "proxy"
+)
+
+// StorageRule routes the models matching Prefix or Pattern to a storage. Prefix
+// may end with "*", "org-private/*" and "org-private/" are equivalent.
+type StorageRule struct {
+	// Prefix matches model IDs starting with it
+	Prefix string `yaml:"prefix"`
+	// Pattern is a regular expression matched against the model ID
+	Pattern string `yaml:"pattern"`
+	// Storage is one of git, file or proxy
+	Storage string `yaml:"storage"`
+}
+
+// storageRoute is where the requests for a model are served from
+type storageRoute struct {
+	dist api.Distribution
+	// proxy passes requests through to the upstream
+	proxy bool
+}
+
+// modelRouter selects the storage of a model from the first matching rule
+type modelRouter struct {
+	rules        []compiledRule
+	defaultRoute storageRoute
+}
+
+type compiledRule struct {
+	prefix  string
+	pattern *regexp.Regexp
+	route   storageRoute
+}
+
+// newModelRouter compiles rules, models no rule matches use defaultRoute
+func newModelRouter(rules []StorageRule, dists map[api.StorageType]api.Distribution, defaultRoute storageRoute) (*modelRouter, error) {
+	router := &modelRouter{defaultRoute: defaultRoute}
+	for i, rule := range rules {
+		compiled := compiledRule{prefix: strings.TrimSuffix(rule.Prefix, "*")}
+		if rule.Pattern != "" {
+			pattern, err := regexp.Compile(rule.Pattern)
+			if err != nil {
+				return nil, fmt.Errorf("storage rule %d: invalid pattern: %w", i, err)
+			}
+			compiled.pattern = pattern
+		} else if compiled.prefix == "" {
+			return nil, fmt.Errorf("storage rule %d: prefix or pattern is required", i)
+		}
+		switch rule.Storage {
+		case RouteGit:
+			compiled.route = storageRoute{dist: dists[api.GitStorage]}
+		case RouteFile:
+			compiled.route = storageRoute{dist: dists[api.FileStorage]}
+		case RouteProxy:
+			// proxied models still fall back to the default storage for local-only operations
+			compiled.route = storageRoute{dist: defaultRoute.dist, proxy: true}
+		default:
+			return nil, fmt.Errorf("storage rule %d: invalid storage %q, must be one of git, file, proxy", i, rule.Storage)
+		}
+		router.rules = append(router.rules, compiled)
+	}
+	return router, nil
+}
+
+// route returns the storage serving modelID
+func (m *modelRouter) route(modelID string) storageRoute {
+	for _, rule := range m.rules {
+		if rule.pattern != nil {
+			if rule.pattern.MatchString(modelID) {
+				return rule.route
+			}
+			continue
+		}
+		if strings.HasPrefix(modelID, rule.prefix) {
+			return rule.route
+		}
+	}
+	return m.defaultRoute
+}
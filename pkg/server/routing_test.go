@@ -0,0 +1,98 @@
+package server
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/lengrongfu/LLMDistribution/pkg/api"
+)
+
+// namedDist is a distribution told apart by name, its methods are never called
+type namedDist struct {
+	api.Distribution
+	name string
+}
+
+func TestModelRouter(t *testing.T) {
+	git, file, def := &namedDist{name: "git"}, &namedDist{name: "file"}, &namedDist{name: "default"}
+	dists := map[api.StorageType]api.Distribution{api.GitStorage: git, api.FileStorage: file}
+	router, err := newModelRouter([]StorageRule{
+		{Prefix: "org-private/*", Storage: RouteGit},
+		{Pattern: `^mirror/.*-gguf$`, Storage: RouteProxy},
+		{Prefix: "mirror/", Storage: RouteFile},
+	}, dists, storageRoute{dist: def})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		modelID   string
+		wantDist  *namedDist
+		wantProxy bool
+	}{
+		{"org-private/m", git, false},
+		{"mirror/m-gguf", def, true},
+		{"mirror/m", file, false},
+		{"org/m", def, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.modelID, func(t *testing.T) {
+			route := router.route(tt.modelID)
+			if route.dist != api.Distribution(tt.wantDist) {
+				t.Errorf("dist = %v, want %s", route.dist, tt.wantDist.name)
+			}
+			if route.proxy != tt.wantProxy {
+				t.Errorf("proxy = %v, want %v", route.proxy, tt.wantProxy)
+			}
+		})
+	}
+}
+
+func TestNewModelRouterInvalidRules(t *testing.T) {
+	tests := []struct {
+		name string
+		rule StorageRule
+	}{
+		{"no prefix or pattern", StorageRule{Storage: RouteGit}},
+		{"bare wildcard", StorageRule{Prefix: "*", Storage: RouteGit}},
+		{"invalid pattern", StorageRule{Pattern: "(", Storage: RouteGit}},
+		{"invalid storage", StorageRule{Prefix: "org/", Storage: "s3"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := newModelRouter([]StorageRule{tt.rule}, nil, storageRoute{}); err == nil {
+				t.Error("newModelRouter() error = nil, want an error")
+			}
+		})
+	}
+}
+
+func TestStorageRulesRouteRequests(t *testing.T) {
+	upstream := slowUpstream(t, `{"model_type":"proxied"}`, 0)
+	_, ts := newTestServer(t, func(c *Config) {
+		c.ProxyBaseURL = upstream.URL
+		c.EnableProxy = true
+		c.StorageRules = []StorageRule{{Prefix: "org-private/*", Storage: RouteFile}}
+	})
+	status, body := doRequest(t, "PUT", ts.URL+"/api/models/org-private/m/upload/main?path=config.json", testAdminToken, strings.NewReader(`{"model_type":"local"}`))
+	if status != http.StatusOK {
+		t.Fatalf("upload status %d: %s", status, body)
+	}
+
+	tests := []struct {
+		modelID  string
+		wantBody string
+	}{
+		{"org-private/m", `{"model_type":"local"}`},
+		{"org/m", `{"model_type":"proxied"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.modelID, func(t *testing.T) {
+			status, body := doRequest(t, "GET", ts.URL+"/"+tt.modelID+"/resolve/main/config.json", "", nil)
+			if status != http.StatusOK || body != tt.wantBody {
+				t.Errorf("got %d %q, want %d %q", status, body, http.StatusOK, tt.wantBody)
+			}
+		})
+	}
+}
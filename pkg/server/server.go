@@ -2,44 +2,84 @@ package server
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"io"
+	"log/slog"
+	"mime"
 	"net/http"
 	"os"
 	"path/filepath"
 	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gorilla/handlers"
 	"github.com/gorilla/mux"
 	"github.com/lengrongfu/LLMDistribution/pkg/api"
+	"github.com/lengrongfu/LLMDistribution/pkg/api/model"
 	"github.com/lengrongfu/LLMDistribution/pkg/filestorage"
 	"github.com/lengrongfu/LLMDistribution/pkg/git"
+	"github.com/lengrongfu/LLMDistribution/pkg/ossstorage"
 	"github.com/lengrongfu/LLMDistribution/pkg/proxy"
+	"github.com/lengrongfu/LLMDistribution/pkg/utils"
 )
 
+// maxFormMemory is the part of a multipart upload kept in memory, the rest is
+// buffered in temporary files
+const maxFormMemory = 32 << 20
+
 // Server represents the LLM Distribution server
 type Server struct {
-	router        *mux.Router
-	httpServer    *http.Server
-	distribution  api.Distribution
+	router       *mux.Router
+	httpServer   *http.Server
+	distribution api.Distribution
+	// models selects the storage of each model from the configured storage rules
+	models        *modelRouter
 	proxy         *proxy.Proxy
 	baseDir       string
 	EnableProxy   bool
 	FallbackProxy bool
-}
-
-// Config represents the server configuration
-type Config struct {
-	Host          string
-	Port          int
-	StorageType   api.StorageType
-	GitBaseDir    string
-	FileBaseDir   string
-	ProxyBaseURL  string
-	EnableProxy   bool
-	FallbackProxy bool
+	// RedirectOnMiss redirects cache misses to the upstream while filling the cache in the background
+	RedirectOnMiss bool
+	// OpenAIModels serves the cached models at the OpenAI compatible /v1/models
+	OpenAIModels bool
+	// dav serves the models over WebDAV, nil when disabled
+	dav http.Handler
+	// defaultRevision is used when a request names no revision
+	defaultRevision string
+	// StreamIndex streams model indexes built from a snapshot instead of buffering them
+	StreamIndex bool
+	// RateLimit caps the bytes per second of each file download (0 means unlimited)
+	RateLimit    int64
+	modelLimiter *modelLimiter
+	// maxUploadBytes caps the size of an uploaded file (0 means unlimited)
+	maxUploadBytes int64
+	// quota limits the bytes downloaded by each client IP
+	quota *byteQuota
+	// clients limits the request rate and concurrency of each client IP
+	clients *clientLimiter
+	// acl restricts private models to authorized tokens
+	acl *accessList
+	// adminToken authorizes uploads and administrative operations, they are
+	// disabled when it is empty
+	adminToken string
+	// webhook posts completed downloads to an external sink
+	webhook *downloadWebhook
+	// accessLog writes a JSON line per request to a file
+	accessLog *accessLog
+	// closeStorage flushes the state kept in memory by the storage on shutdown
+	closeStorage func() error
+	// shutdownTracing flushes exported spans on shutdown
+	shutdownTracing func(context.Context) error
+	// maintenance puts the server in read-only mode, rejecting write operations
+	maintenance atomic.Bool
 }
 
 // NewServer creates a new LLM Distribution server
@@ -57,15 +97,66 @@ func NewServer(config Config) (*Server, error) {
 	if err != nil {
 		return nil, fmt.Errorf("failed to create Git distribution: %w", err)
 	}
+	gitDist.Storage.WithCommitTemplate(config.GitCommitTemplate)
 
 	// Initialize the File distribution
 	fileDist, err := filestorage.NewDistribution(config.FileBaseDir)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create File distribution: %w", err)
 	}
+	layout, err := utils.ParseLayoutStrategy(config.Layout)
+	if err != nil {
+		return nil, err
+	}
+	repoType, err := utils.ParseRepoType(config.RepoType)
+	if err != nil {
+		return nil, err
+	}
+	fileDist.Storage.WithLayout(layout)
+	fileDist.Storage.WithRepoType(repoType)
+	if err := fileDist.Storage.WithBlobDir(config.BlobDir); err != nil {
+		return nil, err
+	}
+	fileDist.Storage.WithIndexCacheTTL(config.IndexCacheTTL)
+	fileDist.Storage.WithMmap(config.MmapMaxFileSize, config.MmapCacheEntries)
+	fileDist.Storage.WithBlobReverifyAge(config.BlobReverifyAge)
+	fileDist.Storage.WithBlobCompression(config.BlobCompressAfter)
+	fileDist.Storage.WithIndexRefresh(config.IndexRefreshInterval)
+	fileDist.Storage.WithDefaultRevision(config.DefaultRevision)
+	fileDist.Storage.WithIndexMerge(config.MergeIndex)
+	if err := fileDist.Storage.WithAccessTracking(config.AccessFlushInterval); err != nil {
+		return nil, err
+	}
 
 	// Create the router with StrictSlash option
 	router := mux.NewRouter().StrictSlash(true)
+	router.Use(loggingMiddleware, tracingMiddleware)
+
+	accessLog, err := newAccessLog(config.AccessLog, config.AccessLogMaxSize)
+	if err != nil {
+		return nil, err
+	}
+	router.Use(accessLog.middleware)
+
+	aliases, err := newModelAliases(config.ModelAliases)
+	if err != nil {
+		return nil, err
+	}
+	router.Use(aliases.middleware)
+
+	acl, err := loadAccessList(config.ACLFile)
+	if err != nil {
+		return nil, err
+	}
+	acl.admin = config.AdminToken
+	router.Use(acl.middleware)
+
+	// Create the upstream proxy
+	upstream := proxy.NewProxy(config.ProxyBaseURL, proxy.Options{
+		UpstreamTimeout: config.UpstreamTimeout,
+		MaxIdleConns:    config.MaxIdleConns,
+		IdleConnTimeout: config.IdleConnTimeout,
+	})
 
 	// Create the server
 	server := &Server{
@@ -73,28 +164,88 @@ func NewServer(config Config) (*Server, error) {
 		baseDir:       filepath.Dir(config.GitBaseDir), // Use parent directory as base
 		EnableProxy:   config.EnableProxy,
 		FallbackProxy: config.FallbackProxy,
-		proxy:         proxy.NewProxy(config.ProxyBaseURL),
+		StreamIndex:   config.StreamIndex,
+		OpenAIModels:  config.OpenAIModels,
+		RateLimit:     config.RateLimit,
+		proxy:         upstream,
+		modelLimiter:  newModelLimiter(config.MaxConcurrentPerModel),
+		quota:         newByteQuota(config.PerIPBytes, config.PerIPQuotaWindow),
+		clients:       newClientLimiter(config.PerIPRequestRate, config.PerIPBurst, config.PerIPMaxConcurrent),
+		webhook:       newDownloadWebhook(config.DownloadWebhook),
+		accessLog:     accessLog,
+		acl:           acl,
+		adminToken:    config.AdminToken,
+
+		RedirectOnMiss:  config.RedirectOnMiss,
+		maxUploadBytes:  config.MaxUploadBytes,
+		defaultRevision: config.DefaultRevision,
+		closeStorage:    fileDist.Close,
+	}
+	if server.defaultRevision == "" {
+		server.defaultRevision = "main"
 	}
 	switch config.StorageType {
 	case api.GitStorage:
 		server.distribution = gitDist
 	case api.FileStorage:
 		server.distribution = fileDist
+	case api.OSSStorage:
+		ossDist, err := ossstorage.NewDistribution(ossstorage.Options{
+			Endpoint:        config.OSSEndpoint,
+			Bucket:          config.OSSBucket,
+			AccessKeyID:     config.OSSAccessKeyID,
+			AccessKeySecret: config.OSSAccessKeySecret,
+			Prefix:          config.OSSPrefix,
+		})
+		if err != nil {
+			return nil, err
+		}
+		ossDist.Storage.WithDefaultRevision(config.DefaultRevision)
+		server.distribution = ossDist
 	default:
 		return nil, fmt.Errorf("invalid storage type: %d", config.StorageType)
 	}
+	server.models, err = newModelRouter(config.StorageRules, map[api.StorageType]api.Distribution{
+		api.GitStorage:  gitDist,
+		api.FileStorage: fileDist,
+	}, storageRoute{dist: server.distribution, proxy: config.EnableProxy})
+	if err != nil {
+		return nil, err
+	}
 	server.proxy.WithFallbackProxy(config.FallbackProxy, config.FileBaseDir)
+	server.proxy.WithKeepOldSnapshots(config.KeepOldSnapshots)
+	server.proxy.WithPinnedSnapshots(fileDist.Storage.SnapshotPinned)
+	server.proxy.WithSharedBlobs(config.SharedBlobs)
+	server.proxy.WithStrictBlobs(config.StrictBlobs)
+	server.proxy.WithRewriteLocation(config.RewriteLocation)
+	server.proxy.WithRateLimit(config.RateLimit)
+	server.proxy.WithSparseCache(config.SparseCacheMinSize)
+	server.proxy.WithLayout(layout)
+	server.proxy.WithRepoType(repoType)
+	server.proxy.WithBlobDir(config.BlobDir)
+	server.proxy.WithAPICache(config.APICacheTTL, config.APICacheMaxStale, config.APICachePaths)
 	if config.FallbackProxy {
 		server.proxy.WithModifyRequest(server.proxy.WithModifyResponseToCache)
 	}
 
+	// Export traces when a collector is configured
+	if config.OTLPEndpoint != "" {
+		if server.shutdownTracing, err = setupTracing(config.OTLPEndpoint); err != nil {
+			return nil, err
+		}
+	}
+
+	if config.WebDAV {
+		server.dav = server.newDAVHandler(config.WebDAVWriteToken)
+	}
+
 	// Set up routes
 	server.setupRoutes()
 
 	// Create the HTTP server
 	server.httpServer = &http.Server{
 		Addr:         fmt.Sprintf("%s:%d", config.Host, config.Port),
-		Handler:      handlers.CORS(handlers.AllowedOrigins([]string{"*"}))(router),
+		Handler:      handlers.CORS(corsOptions(config)...)(router),
 		ReadTimeout:  15 * time.Second,
 		WriteTimeout: 15 * time.Second,
 		IdleTimeout:  60 * time.Second,
@@ -103,6 +254,23 @@ func NewServer(config Config) (*Server, error) {
 	return server, nil
 }
 
+// corsOptions builds the CORS policy of the configuration, any origin is allowed when
+// no origins are configured
+func corsOptions(config Config) []handlers.CORSOption {
+	origins := config.CORSOrigins
+	if len(origins) == 0 {
+		origins = []string{"*"}
+	}
+	options := []handlers.CORSOption{handlers.AllowedOrigins(origins)}
+	if len(config.CORSMethods) > 0 {
+		options = append(options, handlers.AllowedMethods(config.CORSMethods))
+	}
+	if len(config.CORSHeaders) > 0 {
+		options = append(options, handlers.AllowedHeaders(config.CORSHeaders))
+	}
+	return options
+}
+
 // setupRoutes sets up the server routes
 func (s *Server) setupRoutes() {
 	// API routes
@@ -110,86 +278,397 @@ func (s *Server) setupRoutes() {
 
 	// Model routes - 顺序很重要，更具体的路由必须先定义
 	// 使用正则表达式模式允许 model_id 包含斜杠
-	api.HandleFunc("/models/{model_id:.+}/revision/{version}", s.handleGetModelIndex).Methods("GET")
-	s.router.HandleFunc("/{model_id:.+}/resolve/{sha}/{filename:.+}", s.handleGetModelFile).Methods("GET", "HEAD")
+	api.Handle("/models/{model_id:.+}/revision/{version}", s.clients.middleware(http.HandlerFunc(s.handleGetModelIndex))).Methods("GET", "HEAD")
+	api.HandleFunc("/models/{model_id:.+}/tree/{revision}/{path:.+}", s.handleGetModelTree).Methods("GET")
+	api.HandleFunc("/models/{model_id:.+}/tree/{revision}", s.handleGetModelTree).Methods("GET")
+	api.HandleFunc("/models/{model_id:.+}/status/{version}", s.handleGetModelStatus).Methods("GET")
+	api.HandleFunc("/models/{model_id:.+}/manifest/{version}", s.handleGetModelManifest).Methods("GET")
+	api.HandleFunc("/models/{model_id:.+}/refs", s.handleGetModelRefs).Methods("GET")
+	api.Handle("/models/{model_id:.+}/warm", s.requireAdmin(s.handleWarmModel)).Methods("POST")
+	api.Handle("/models/{model_id:.+}/reindex", s.requireAdmin(s.handleReindexModel)).Methods("POST")
+	api.HandleFunc("/admin/maintenance", s.handleGetMaintenance).Methods("GET")
+	api.Handle("/admin/maintenance", s.requireAdmin(s.handleSetMaintenance)).Methods("POST")
+	api.Handle("/admin/models/{model_id:.+}/check", s.requireAdmin(s.handleCheckModel)).Methods("POST")
+	api.Handle("/admin/eviction-preview", s.requireAdmin(s.handleEvictionPreview)).Methods("GET")
+	api.Handle("/maintenance/gc", s.requireAdmin(s.handleCollectGarbage)).Methods("POST")
+	api.HandleFunc("/cache/stats", s.handleGetCacheStats).Methods("GET")
+	api.Handle("/cache/stats", s.requireAdmin(s.handleResetCacheStats)).Methods("DELETE")
+	api.Handle("/models/{model_id:.+}/upload/{revision}", s.requireAdmin(s.handleUploadSnapshotFile)).Methods("PUT", "POST")
+	api.Handle("/models/{model_id:.+}", s.requireAdmin(s.handleUploadModelFile)).Methods("PUT", "POST")
+	api.Handle("/models/{model_id:.+}", s.requireAdmin(s.handleGetUploadOffset)).Methods("HEAD")
+	api.Handle("/models/{model_id:.+}", s.requireAdmin(s.handleDeleteModel)).Methods("DELETE")
+	// Any other API request is proxied to the upstream, whitelisted GETs are cached
+	api.PathPrefix("/").HandlerFunc(s.handleProxyAPI)
+	if s.dav != nil {
+		// mounted before the file routes, which would match paths below /dav
+		s.router.Path("/dav").Handler(s.dav)
+		s.router.PathPrefix("/dav/").Handler(s.dav)
+	}
+	s.router.Handle("/{model_id:.+}/resolve/{sha}/{filename:.+}", s.clients.middleware(s.webhook.middleware(s.quota.middleware(http.HandlerFunc(s.handleGetModelFile))))).Methods("GET", "HEAD")
+	// The snapshot root, the router redirects a trailing slash here
+	s.router.Handle("/{model_id:.+}/resolve/{sha}", s.clients.middleware(s.webhook.middleware(s.quota.middleware(http.HandlerFunc(s.handleGetModelFile))))).Methods("GET", "HEAD")
+
+	if s.OpenAIModels {
+		s.router.HandleFunc("/v1/models", s.handleListOpenAIModels).Methods("GET")
+	}
 
 	// Health check
 	s.router.HandleFunc("/health", s.handleHealthCheck).Methods("GET")
+	s.router.HandleFunc("/healthz", s.handleLiveness).Methods("GET")
+	s.router.HandleFunc("/readyz", s.handleReadiness).Methods("GET")
 }
 
 // Start starts the server
 func (s *Server) Start() error {
-	log.Printf("Starting server on %s", s.httpServer.Addr)
+	slog.Info("starting server", "addr", s.httpServer.Addr)
 	return s.httpServer.ListenAndServe()
 }
 
 // Shutdown gracefully shuts down the server
 func (s *Server) Shutdown(ctx context.Context) error {
-	return s.httpServer.Shutdown(ctx)
+	err := s.httpServer.Shutdown(ctx)
+	// background cache writes outlive their requests, they finish or are aborted
+	// before the storage is closed
+	if perr := s.proxy.Close(ctx); perr != nil && err == nil {
+		err = perr
+	}
+	if werr := s.webhook.Close(ctx); werr != nil && err == nil {
+		err = werr
+	}
+	if cerr := s.closeStorage(); cerr != nil && err == nil {
+		err = cerr
+	}
+	if lerr := s.accessLog.Close(); lerr != nil && err == nil {
+		err = lerr
+	}
+	if s.shutdownTracing != nil {
+		if terr := s.shutdownTracing(ctx); terr != nil && err == nil {
+			err = terr
+		}
+	}
+	return err
 }
 
 // handleHealthCheck handles health check requests
 func (s *Server) handleHealthCheck(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if checker, ok := s.distribution.(api.HealthChecker); ok {
+		if err := checker.CheckHealth(); err != nil {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			json.NewEncoder(w).Encode(map[string]string{"status": "unhealthy", "error": err.Error()})
+			return
+		}
+	}
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
 }
 
+// handleLiveness is the Kubernetes liveness probe. It only reports that the process
+// is serving requests and never checks dependencies, so a storage or upstream outage
+// does not get the pod restarted.
+func (s *Server) handleLiveness(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+}
+
+// handleReadiness is the Kubernetes readiness probe. It answers 503 while the storage
+// backend is unusable or, when proxying is enabled, the upstream is unreachable, so
+// traffic is routed to other replicas until the dependencies recover.
+func (s *Server) handleReadiness(w http.ResponseWriter, r *http.Request) {
+	checks := map[string]string{"storage": "ok"}
+	ready := true
+	if checker, ok := s.distribution.(api.HealthChecker); ok {
+		if err := checker.CheckHealth(); err != nil {
+			checks["storage"] = err.Error()
+			ready = false
+		}
+	}
+	if s.EnableProxy || s.FallbackProxy {
+		ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+		defer cancel()
+		checks["upstream"] = "ok"
+		if err := s.proxy.Ping(ctx); err != nil {
+			checks["upstream"] = err.Error()
+			ready = false
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	status := "ok"
+	if !ready {
+		status = "unavailable"
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"status": status, "checks": checks})
+}
+
 // handleGetModelFile handles model file requests
 func (s *Server) handleGetModelFile(w http.ResponseWriter, r *http.Request) {
-	log.Printf("handleGetModelFile called with URL: %s", r.URL.Path)
+	vars := mux.Vars(r)
+	modelID := vars["model_id"]
+	if !s.modelLimiter.acquire(modelID) {
+		writeJSONError(w, http.StatusTooManyRequests, "too_many_requests", fmt.Sprintf("Too many concurrent downloads for model %s", modelID))
+		return
+	}
+	defer s.modelLimiter.release(modelID)
+	// large or throttled downloads take longer than the WriteTimeout of the server
+	clearWriteDeadline(w)
+	if proxy.StripXetHeaders(r.Header) {
+		slog.Debug("serving Xet client the classic download", "model", modelID, "path", r.URL.Path)
+	}
 
-	if s.EnableProxy {
-		s.proxy.HandleGetModelIndex(w, r)
+	route := s.models.route(modelID)
+	if route.proxy {
+		s.proxy.HandleGetModelFile(w, r)
 		return
 	}
 	var err error
 	if s.FallbackProxy {
 		defer func() {
-			if err != nil {
+			if err == nil {
+				return
+			}
+			if s.RedirectOnMiss {
+				s.proxy.RedirectOnMiss(w, r)
+			} else if r.Header.Get("Range") == "" || !s.proxy.ServeRange(w, r) {
 				s.proxy.HandleGetModelFile(w, r)
 			}
 		}()
 	}
-	vars := mux.Vars(r)
-	modelID := vars["model_id"]
 	shaOrVersion := vars["sha"]
-	filename := vars["filename"]
-	log.Printf("handleGetModelFile: modelID=%s, sha=%s, filename=%s", modelID, shaOrVersion, filename)
+	filename := utils.NormalizeRepoPath(vars["filename"])
+	dist := withTracing(r.Context(), route.dist)
 
-	sha := s.distribution.RepoSha(modelID, shaOrVersion)
+	sha := dist.RepoSha(modelID, shaOrVersion)
+	if r.URL.Query().Get("merge") == "true" && strings.HasSuffix(filename, ".gguf") {
+		// a split GGUF file is served as the concatenation of its shards
+		if shards := ggufShards(route.dist, modelID, sha, filename); shards != nil {
+			s.serveMergedGGUF(w, r, dist, modelID, sha, filename, shards)
+			return
+		}
+	}
 	// 2. 检查文件是否存在
-	fileInfo, exist := s.distribution.FileExists(modelID, sha, filename)
+	fileInfo, exist := dist.FileExists(modelID, sha, filename)
+	if !exist {
+		// the name may differ from the index entry in case only
+		if name, ok := resolveSibling(dist, modelID, shaOrVersion, filename); ok {
+			filename = name
+			fileInfo, exist = dist.FileExists(modelID, sha, filename)
+		}
+	}
 	if !exist {
 		err = fmt.Errorf("file not found: %s", filename)
 		if !s.FallbackProxy {
-			http.Error(w, "File not found", http.StatusNotFound)
+			if revErr := missingRevision(route.dist, modelID, shaOrVersion); revErr != nil {
+				writeRevisionNotFound(w, revErr)
+				return
+			}
+			writeJSONError(w, http.StatusNotFound, "file_not_found", "File not found")
 		}
 		return
 	}
-	etga := s.distribution.FileEtag(modelID, sha, filename)
-	log.Println("handleGetModelFile: etga=", etga)
+	if fileInfo.IsDir() {
+		s.writeDirectoryListing(w, modelID, sha, filename)
+		return
+	}
+	if pinner, ok := route.dist.(api.SnapshotPinner); ok {
+		// eviction must not remove the snapshot while the file is transferred
+		pinner.PinSnapshot(modelID, sha)
+		defer pinner.UnpinSnapshot(modelID, sha)
+	}
+	if verifier, ok := route.dist.(api.FileVerifier); ok {
+		if err = verifier.VerifyFile(modelID, sha, filename); err != nil {
+			// in proxy mode the corrupt blob has been removed and is fetched again
+			if !s.FallbackProxy {
+				writeStorageError(w, "Cached file failed verification", err)
+			}
+			return
+		}
+	}
+	etga := dist.FileEtag(modelID, sha, filename)
+	if etga == "" && fileInfo.Size() == 0 {
+		etga = utils.EmptyBlobEtag
+	}
 
 	// 3. 设置 HTTP 头（关键优化点）
 	w.Header().Set("X-Repo-Commit", sha)
-	w.Header().Set("ETag", etga)
-	w.Header().Set("Content-Disposition",
-		fmt.Sprintf("inline; filename=\"%s\"", fileInfo.Name()))
+	if etga != "" {
+		w.Header().Set("ETag", quoteEtag(etga))
+	}
+	setLinkedEtag(w.Header(), etga, fileInfo.Size())
+	w.Header().Set("Content-Disposition", contentDisposition(r, fileInfo.Name()))
 	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
 	w.Header().Set("Content-Length", strconv.FormatInt(fileInfo.Size(), 10))
+	// http.ServeContent only advertises ranges on GET, clients probing the file
+	// with HEAD before a ranged download need it as well
+	w.Header().Set("Accept-Ranges", "bytes")
+	// http.ServeContent uses the same modtime to answer If-Modified-Since with 304
+	w.Header().Set("Last-Modified", fileInfo.ModTime().UTC().Format(http.TimeFormat))
 
+	if (etga != "" && etagMatches(r.Header.Get("If-None-Match"), etga)) || notModifiedSince(r, fileInfo.ModTime()) {
+		w.Header().Del("Content-Type")
+		w.Header().Del("Content-Length")
+		w.WriteHeader(http.StatusNotModified)
+		s.proxy.RecordHit(0)
+		return
+	}
 	if r.Method == "HEAD" {
+		s.proxy.RecordHit(0)
 		return
 	}
 	// 4. 流式传输（核心代码）
-	file, err := s.distribution.GetFile(modelID, sha, filename)
+	file, err := dist.GetFile(modelID, sha, filename)
 	if err != nil {
 		if !s.FallbackProxy {
-			http.Error(w, "Failed to get file", http.StatusInternalServerError)
+			writeJSONError(w, http.StatusInternalServerError, "internal_error", "Failed to get file")
 		}
 		return
 	}
 
-	http.ServeContent(w, r, fileInfo.Name(), fileInfo.ModTime(), file)
+	if closer, ok := file.(io.Closer); ok {
+		defer closer.Close()
+	}
+
+	if s.RateLimit > 0 {
+		w = &throttledResponseWriter{ResponseWriter: w, w: utils.NewThrottledWriter(w, s.RateLimit)}
+	}
+	rec := &responseRecorder{ResponseWriter: w}
+	http.ServeContent(streamWriter(rec, file, fileInfo.Size()), r, fileInfo.Name(), fileInfo.ModTime(), file)
+	s.proxy.RecordHit(rec.bytes)
+}
+
+// clearWriteDeadline lifts the WriteTimeout of the server for a response that may
+// take longer to complete
+func clearWriteDeadline(w http.ResponseWriter) {
+	if err := http.NewResponseController(w).SetWriteDeadline(time.Time{}); err != nil {
+		slog.Debug("failed to clear write deadline", "error", err)
+	}
+}
+
+// throttledResponseWriter writes the response body through a rate limited writer
+type throttledResponseWriter struct {
+	http.ResponseWriter
+	w io.Writer
+}
+
+func (w *throttledResponseWriter) Write(p []byte) (int, error) {
+	return w.w.Write(p)
+}
+
+// largeFileSize is the size from which files that can not be sent with sendfile, like
+// compressed blobs and merged GGUF shards, are copied with large buffers
+const largeFileSize = 64 << 20
+
+// largeCopyBuffers are the buffers of largeFileWriter, much larger than the 32KB
+// net/http copies response bodies with
+var largeCopyBuffers = sync.Pool{
+	New: func() any {
+		buf := make([]byte, 1<<20)
+		return &buf
+	},
+}
+
+// largeFileWriter streams a response body with a buffer from largeCopyBuffers
+type largeFileWriter struct {
+	http.ResponseWriter
+}
+
+func (w largeFileWriter) ReadFrom(src io.Reader) (int64, error) {
+	buf := largeCopyBuffers.Get().(*[]byte)
+	defer largeCopyBuffers.Put(buf)
+	// hide the ReadFrom of the wrapped writer, which would copy with its own buffer
+	return io.CopyBuffer(struct{ io.Writer }{w.ResponseWriter}, src, *buf)
+}
+
+// Unwrap returns the underlying writer for http.ResponseController
+func (w largeFileWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// streamWriter returns the writer content of size bytes is sent through, files are
+// sent with sendfile and other large content with large copy buffers
+func streamWriter(w http.ResponseWriter, content io.Reader, size int64) http.ResponseWriter {
+	if _, ok := content.(*os.File); ok || size < largeFileSize {
+		return w
+	}
+	return largeFileWriter{ResponseWriter: w}
+}
+
+// contentDisposition returns the Content-Disposition of a served file, inline unless
+// the request asks for a download with ?download=true like the Hugging Face hub
+func contentDisposition(r *http.Request, filename string) string {
+	disposition := "inline"
+	if download, _ := strconv.ParseBool(r.URL.Query().Get("download")); download {
+		disposition = "attachment"
+	}
+	return fmt.Sprintf("%s; filename=\"%s\"", disposition, filename)
+}
+
+// setLinkedEtag sets X-Linked-Etag, X-Linked-Size and a Digest header when the etag of
+// a file is the SHA-256 of an LFS blob, so clients can verify the download
+func setLinkedEtag(h http.Header, etag string, size int64) {
+	sum, err := hex.DecodeString(etag)
+	if err != nil || len(sum) != sha256.Size {
+		return
+	}
+	h.Set("X-Linked-Etag", `"`+etag+`"`)
+	h.Set("X-Linked-Size", strconv.FormatInt(size, 10))
+	h.Set("Digest", "sha-256="+base64.StdEncoding.EncodeToString(sum))
+}
+
+// missingRevision returns an error listing the cached revisions when the model is
+// cached but not at revision
+func missingRevision(dist api.Distribution, modelID, revision string) *api.RevisionNotFoundError {
+	lister, ok := dist.(api.RevisionLister)
+	if !ok {
+		return nil
+	}
+	available, err := lister.Revisions(modelID)
+	if err != nil || len(available) == 0 {
+		return nil
+	}
+	for _, candidate := range available {
+		if candidate == revision {
+			return nil
+		}
+	}
+	return &api.RevisionNotFoundError{ModelID: modelID, Revision: revision, Available: available}
+}
+
+// resolveSibling looks up a normalized file name in the index of a model revision,
+// ignoring case, and returns the name of the matching sibling
+func resolveSibling(dist api.Distribution, modelID, version, filename string) (string, bool) {
+	if filename == "" {
+		return "", false
+	}
+	index, err := dist.RepoInfo(modelID, version)
+	if err != nil {
+		return "", false
+	}
+	for _, sibling := range index.Siblings {
+		if strings.EqualFold(utils.NormalizeRepoPath(sibling.RFilename), filename) {
+			return sibling.RFilename, true
+		}
+	}
+	return "", false
+}
+
+// writeDirectoryListing answers a resolve request for a snapshot directory with the
+// entries it contains, in the format of the Hugging Face tree API
+func (s *Server) writeDirectoryListing(w http.ResponseWriter, modelID, sha, dir string) {
+	lister, ok := s.models.route(modelID).dist.(api.TreeLister)
+	if !ok {
+		writeJSONError(w, http.StatusBadRequest, "is_directory", fmt.Sprintf("%s is a directory, request a file inside it", dir))
+		return
+	}
+	entries, err := lister.ListTree(modelID, sha, dir, false)
+	if err != nil {
+		writeStorageError(w, "Failed to list directory", err)
+		return
+	}
+	w.Header().Set("X-Repo-Commit", sha)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(entries)
 }
 
 // Dataset-related handlers removed
@@ -198,20 +677,50 @@ func (s *Server) handleGetModelFile(w http.ResponseWriter, r *http.Request) {
 
 // handleUploadModelFile handles model file upload requests
 func (s *Server) handleUploadModelFile(w http.ResponseWriter, r *http.Request) {
+	if s.rejectInMaintenance(w) {
+		return
+	}
+	if !s.limitUpload(w, r) {
+		return
+	}
 	vars := mux.Vars(r)
 	modelID := vars["model_id"]
 
+	// Web clients post forms, CLI clients send the raw file as the body
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType == "multipart/form-data" {
+		s.uploadMultipart(w, r, modelID)
+		return
+	}
+
 	// Get the filename from the query parameters
 	filename := r.URL.Query().Get("path")
 	if filename == "" {
-		http.Error(w, "Missing path parameter", http.StatusBadRequest)
+		writeJSONError(w, http.StatusBadRequest, "bad_request", "Missing path parameter")
+		return
+	}
+	filename, ok := checkUploadPath(w, modelID, filename)
+	if !ok {
+		return
+	}
+
+	// Resume a partial upload when the client sends a Content-Range
+	if contentRange := r.Header.Get("Content-Range"); contentRange != "" {
+		s.resumeUpload(w, r, modelID, filename, contentRange)
 		return
 	}
 
 	// Store the file in the appropriate storage
-	filePath, err := s.distribution.StoreFile(modelID, filename, r.Body)
+	dist := withTracing(r.Context(), s.models.route(modelID).dist)
+	filePath, err := dist.StoreFile(modelID, filename, r.Body)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Failed to store file: %v", err), http.StatusInternalServerError)
+		var sizeErr *http.MaxBytesError
+		if uploader, ok := s.models.route(modelID).dist.(api.ResumableUploader); ok && errors.As(err, &sizeErr) {
+			// an upload beyond the limit can never be completed, so it is not kept for resuming
+			if derr := uploader.DiscardUpload(modelID, filename); derr != nil {
+				slog.Warn("failed to discard oversized upload", "model", modelID, "path", filename, "error", derr)
+			}
+		}
+		writeStorageError(w, fmt.Sprintf("Failed to store file: %v", err), err)
 		return
 	}
 
@@ -220,12 +729,213 @@ func (s *Server) handleUploadModelFile(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(map[string]string{"path": filePath})
 }
 
+// checkUploadPath validates the model ID and file name of an upload and returns the
+// normalized file name. It answers 400 when either would resolve outside of the
+// model repository.
+func checkUploadPath(w http.ResponseWriter, modelID, filename string) (string, bool) {
+	if !utils.ValidModelID(modelID) {
+		writeJSONError(w, http.StatusBadRequest, "invalid_path", fmt.Sprintf("Invalid model ID %q", modelID))
+		return "", false
+	}
+	cleaned, err := utils.CleanRepoPath(filename)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, "invalid_path", fmt.Sprintf("Invalid path %q", filename))
+		return "", false
+	}
+	return cleaned, true
+}
+
+// limitUpload bounds the request body to the maximum upload size. It answers 413 and
+// returns false when the announced Content-Length already exceeds it.
+func (s *Server) limitUpload(w http.ResponseWriter, r *http.Request) bool {
+	if s.maxUploadBytes <= 0 {
+		return true
+	}
+	if r.ContentLength > s.maxUploadBytes {
+		writeUploadTooLarge(w, s.maxUploadBytes)
+		return false
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, s.maxUploadBytes)
+	return true
+}
+
+// handleUploadSnapshotFile stores the request body as the file named by the path query
+// parameter in the snapshot of a revision, where it is served by the resolve route.
+// A ref that does not exist yet is created pointing to a new commit.
+func (s *Server) handleUploadSnapshotFile(w http.ResponseWriter, r *http.Request) {
+	if s.rejectInMaintenance(w) || !s.limitUpload(w, r) {
+		return
+	}
+	vars := mux.Vars(r)
+	modelID := vars["model_id"]
+	filename := r.URL.Query().Get("path")
+	if filename == "" {
+		writeJSONError(w, http.StatusBadRequest, "bad_request", "Missing path parameter")
+		return
+	}
+	filename, ok := checkUploadPath(w, modelID, filename)
+	if !ok {
+		return
+	}
+	uploader, ok := s.models.route(modelID).dist.(api.SnapshotUploader)
+	if !ok {
+		writeJSONError(w, http.StatusNotImplemented, "unsupported_operation", "Storage does not support snapshot uploads")
+		return
+	}
+	sha, etag, err := uploader.StoreSnapshotFile(modelID, vars["revision"], filename, r.Body)
+	if err != nil {
+		writeStorageError(w, fmt.Sprintf("Failed to store file: %v", err), err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"commit": sha, "etag": etag, "path": utils.NormalizeRepoPath(filename)})
+}
+
+// uploadMultipart stores the "file" field of a multipart form at its "path" field, the
+// path query parameter is used when the form has no path field
+func (s *Server) uploadMultipart(w http.ResponseWriter, r *http.Request, modelID string) {
+	if err := r.ParseMultipartForm(maxFormMemory); err != nil {
+		var sizeErr *http.MaxBytesError
+		if errors.As(err, &sizeErr) {
+			writeUploadTooLarge(w, sizeErr.Limit)
+			return
+		}
+		writeJSONError(w, http.StatusBadRequest, "bad_request", fmt.Sprintf("Invalid multipart form: %v", err))
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	filename := r.FormValue("path")
+	if filename == "" {
+		writeJSONError(w, http.StatusBadRequest, "bad_request", "Missing path field")
+		return
+	}
+	filename, ok := checkUploadPath(w, modelID, filename)
+	if !ok {
+		return
+	}
+	file, _, err := r.FormFile("file")
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, "bad_request", "Missing file field")
+		return
+	}
+	defer file.Close()
+
+	dist := withTracing(r.Context(), s.models.route(modelID).dist)
+	filePath, err := dist.StoreFile(modelID, filename, file)
+	if err != nil {
+		writeStorageError(w, fmt.Sprintf("Failed to store file: %v", err), err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"path": filePath})
+}
+
+// resumeUpload writes a "bytes start-end/total" chunk of an upload, answering 202 with
+// the new offset until the upload is complete
+func (s *Server) resumeUpload(w http.ResponseWriter, r *http.Request, modelID, filename, contentRange string) {
+	uploader, ok := s.models.route(modelID).dist.(api.ResumableUploader)
+	if !ok {
+		writeJSONError(w, http.StatusNotImplemented, "unsupported_operation", "Storage does not support resumable uploads")
+		return
+	}
+	var start, end, total int64
+	if _, err := fmt.Sscanf(contentRange, "bytes %d-%d/%d", &start, &end, &total); err != nil || start > end || end >= total {
+		writeJSONError(w, http.StatusBadRequest, "bad_request", fmt.Sprintf("Invalid Content-Range %q", contentRange))
+		return
+	}
+	if s.maxUploadBytes > 0 && total > s.maxUploadBytes {
+		if err := uploader.DiscardUpload(modelID, filename); err != nil {
+			slog.Warn("failed to discard oversized upload", "model", modelID, "path", filename, "error", err)
+		}
+		writeUploadTooLarge(w, s.maxUploadBytes)
+		return
+	}
+
+	filePath, complete, err := uploader.StoreFileAt(modelID, filename, start, total, io.LimitReader(r.Body, end-start+1))
+	if errors.Is(err, api.ErrUploadOffsetMismatch) {
+		writeJSONError(w, http.StatusConflict, "offset_mismatch", err.Error())
+		return
+	}
+	if err != nil {
+		writeStorageError(w, fmt.Sprintf("Failed to store file: %v", err), err)
+		return
+	}
+	if !complete {
+		w.Header().Set("Upload-Offset", strconv.FormatInt(end+1, 10))
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(map[string]int64{"offset": end + 1})
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"path": filePath})
+}
+
+// handleGetUploadOffset reports in the Upload-Offset header how many bytes of an
+// interrupted upload have been received, so the client can resume from there
+func (s *Server) handleGetUploadOffset(w http.ResponseWriter, r *http.Request) {
+	modelID := mux.Vars(r)["model_id"]
+	filename, err := utils.CleanRepoPath(r.URL.Query().Get("path"))
+	if err != nil || !utils.ValidModelID(modelID) {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	uploader, ok := s.models.route(modelID).dist.(api.ResumableUploader)
+	if !ok {
+		w.WriteHeader(http.StatusNotImplemented)
+		return
+	}
+	offset, err := uploader.UploadOffset(modelID, filename)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Upload-Offset", strconv.FormatInt(offset, 10))
+	w.WriteHeader(http.StatusOK)
+}
+
 // Dataset upload handler removed
 
-// handleGetModelIndex handles model index information requests
+// handleGetModelTree lists the files of a cached snapshot like the Hugging Face tree
+// API, below an optional path and with recursive=true for the whole subtree
+func (s *Server) handleGetModelTree(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	modelID := vars["model_id"]
+	recursive, _ := strconv.ParseBool(r.URL.Query().Get("recursive"))
+
+	dist := s.models.route(modelID).dist
+	lister, ok := dist.(api.TreeLister)
+	if !ok {
+		writeJSONError(w, http.StatusNotImplemented, "unsupported_operation", "Storage does not support listing files")
+		return
+	}
+	sha := dist.RepoSha(modelID, vars["revision"])
+	entries, err := lister.ListTree(modelID, sha, vars["path"], recursive)
+	if err != nil {
+		if s.EnableProxy || s.FallbackProxy {
+			// without the route vars the proxy handles the tree like any other API
+			// response instead of caching it as the model index
+			s.proxy.HandleAPI(w, mux.SetURLVars(r, nil))
+			return
+		}
+		writeJSONError(w, http.StatusNotFound, "not_found", err.Error())
+		return
+	}
+
+	w.Header().Set("X-Repo-Commit", sha)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(entries)
+}
+
+// handleGetModelIndex handles model index information requests. A HEAD request gets
+// the ETag of the index without its body, so clients can cheaply detect changes.
 func (s *Server) handleGetModelIndex(w http.ResponseWriter, r *http.Request) {
-	log.Printf("handleGetModelIndex called with URL: %s", r.URL.Path)
-	if s.EnableProxy {
+	vars := mux.Vars(r)
+	modelID := vars["model_id"]
+	version := vars["version"]
+
+	route := s.models.route(modelID)
+	if route.proxy {
 		s.proxy.HandleGetModelIndex(w, r)
 		return
 	}
@@ -237,22 +947,504 @@ func (s *Server) handleGetModelIndex(w http.ResponseWriter, r *http.Request) {
 			}
 		}()
 	}
-	vars := mux.Vars(r)
-	log.Printf("handleGetModelIndex vars: %+v", vars)
-	modelID := vars["model_id"]
-	version := vars["version"]
-	log.Printf("handleGetModelIndex: modelID=%s, version=%s", modelID, version)
 
 	// Create the model index information
-	indexInfo, err := s.distribution.RepoInfo(modelID, version)
+	dist := withTracing(r.Context(), route.dist)
+	// a streamed index has no ETag, HEAD requests build it to hash it
+	if streamer, ok := route.dist.(api.IndexStreamer); ok && s.StreamIndex && !s.acl.private(modelID) && r.Method != "HEAD" {
+		err = s.streamModelIndex(w, streamer, modelID, version)
+		return
+	}
+	indexInfo, err := dist.RepoInfo(modelID, version)
 	if err != nil {
 		if !s.FallbackProxy {
-			http.Error(w, fmt.Sprintf("Failed to get model index: %v", err), http.StatusInternalServerError)
+			writeStorageError(w, fmt.Sprintf("Failed to get model index: %v", err), err)
 		}
 		return
 	}
 
+	if s.acl.private(modelID) {
+		indexInfo.Private = true
+	}
+	body, err := json.Marshal(indexInfo)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "internal_error", fmt.Sprintf("Failed to encode model index: %v", err))
+		return
+	}
+	sum := sha256.Sum256(body)
+	etag := `"` + hex.EncodeToString(sum[:]) + `"`
+
 	// Return the model index information
+	w.Header().Set("ETag", etag)
+	if indexInfo.SHA != "" {
+		w.Header().Set("X-Repo-Commit", indexInfo.SHA)
+	}
+	if etagMatches(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	body = append(body, '\n')
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	if r.Method == "HEAD" {
+		return
+	}
+	w.Write(body)
+}
+
+// streamModelIndex writes a model index while it is built. The index is not buffered,
+// so it has no ETag and errors after the first byte can only abort the response. An
+// error is returned only when nothing was written, so the fallback proxy can answer.
+func (s *Server) streamModelIndex(w http.ResponseWriter, streamer api.IndexStreamer, modelID, version string) error {
+	if sha := s.models.route(modelID).dist.RepoSha(modelID, version); sha != "" {
+		w.Header().Set("X-Repo-Commit", sha)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	sw := &startedWriter{ResponseWriter: w}
+	err := streamer.StreamRepoInfo(modelID, version, sw)
+	if err == nil {
+		return nil
+	}
+	if sw.started {
+		slog.Error("failed to stream model index", "model", modelID, "version", version, "error", err)
+		return nil
+	}
+	w.Header().Del("X-Repo-Commit")
+	if !s.FallbackProxy {
+		writeStorageError(w, fmt.Sprintf("Failed to get model index: %v", err), err)
+	}
+	return err
+}
+
+// startedWriter records whether any of the response body was written
+type startedWriter struct {
+	http.ResponseWriter
+	started bool
+}
+
+func (w *startedWriter) Write(p []byte) (int, error) {
+	w.started = true
+	return w.ResponseWriter.Write(p)
+}
+
+// etagMatches reports whether an If-None-Match header value matches etag. The
+// comparison is weak and ignores quotes, as clients echo etags they stored unquoted.
+func etagMatches(ifNoneMatch, etag string) bool {
+	if ifNoneMatch == "" {
+		return false
+	}
+	etag = unquoteEtag(etag)
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || unquoteEtag(candidate) == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// quoteEtag returns etag as the quoted strong entity tag RFC 7232 requires
+func quoteEtag(etag string) string {
+	return `"` + unquoteEtag(etag) + `"`
+}
+
+// unquoteEtag strips the weak prefix and quotes of an entity tag
+func unquoteEtag(etag string) string {
+	return strings.Trim(strings.TrimPrefix(etag, "W/"), `"`)
+}
+
+// notModifiedSince reports whether the If-Modified-Since header of r is not older than
+// modtime. The header is ignored when If-None-Match is sent, which takes precedence.
+func notModifiedSince(r *http.Request, modtime time.Time) bool {
+	if r.Header.Get("If-None-Match") != "" {
+		return false
+	}
+	since, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	if err != nil {
+		return false
+	}
+	// the header has a resolution of one second
+	return !modtime.Truncate(time.Second).After(since)
+}
+
+// handleGetMaintenance reports whether the server is in maintenance (read-only) mode
+func (s *Server) handleGetMaintenance(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]bool{"enabled": s.maintenance.Load()})
+}
+
+// handleSetMaintenance toggles maintenance mode with the enabled query parameter. In
+// maintenance mode existing files are still served but uploads, cache writes and
+// garbage collection are rejected.
+func (s *Server) handleSetMaintenance(w http.ResponseWriter, r *http.Request) {
+	enabled, err := strconv.ParseBool(r.URL.Query().Get("enabled"))
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, "bad_request", "Invalid enabled parameter")
+		return
+	}
+	s.maintenance.Store(enabled)
+	s.proxy.SetReadOnly(enabled)
+	slog.Info("maintenance mode changed", "enabled", enabled)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]bool{"enabled": enabled})
+}
+
+// handleCheckModel verifies the cached snapshot files of a model, with deep=true the
+// blob content is hashed and compared with its etag
+func (s *Server) handleCheckModel(w http.ResponseWriter, r *http.Request) {
+	modelID := mux.Vars(r)["model_id"]
+	deep, _ := strconv.ParseBool(r.URL.Query().Get("deep"))
+
+	checker, ok := s.models.route(modelID).dist.(api.SnapshotChecker)
+	if !ok {
+		writeJSONError(w, http.StatusNotImplemented, "unsupported_operation", "Storage does not support snapshot verification")
+		return
+	}
+	checks, err := checker.CheckModel(modelID, deep)
+	if err != nil {
+		writeJSONError(w, http.StatusNotFound, "model_not_found", err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"id":    modelID,
+		"deep":  deep,
+		"files": checks,
+	})
+}
+
+// handleReindexModel regenerates the model index of a model from its snapshot
+func (s *Server) handleReindexModel(w http.ResponseWriter, r *http.Request) {
+	if s.rejectInMaintenance(w) {
+		return
+	}
+	modelID := mux.Vars(r)["model_id"]
+
+	reindexer, ok := s.models.route(modelID).dist.(api.Reindexer)
+	if !ok {
+		writeJSONError(w, http.StatusNotImplemented, "unsupported_operation", "Storage does not support reindexing models")
+		return
+	}
+	result, err := reindexer.Reindex(modelID)
+	if errors.Is(err, os.ErrNotExist) {
+		writeJSONError(w, http.StatusNotFound, "model_not_found", err.Error())
+		return
+	}
+	if err != nil {
+		writeStorageError(w, "Failed to reindex model", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// handleDeleteModel removes a model from the local cache
+func (s *Server) handleDeleteModel(w http.ResponseWriter, r *http.Request) {
+	if s.rejectInMaintenance(w) {
+		return
+	}
+	modelID := mux.Vars(r)["model_id"]
+
+	deleter, ok := s.models.route(modelID).dist.(api.ModelDeleter)
+	if !ok {
+		writeJSONError(w, http.StatusNotImplemented, "unsupported_operation", "Storage does not support deleting models")
+		return
+	}
+	if err := deleter.DeleteModel(modelID); err != nil {
+		writeStorageError(w, "Failed to delete model", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleCollectGarbage removes cached blobs that no snapshot references anymore
+func (s *Server) handleCollectGarbage(w http.ResponseWriter, r *http.Request) {
+	if s.rejectInMaintenance(w) {
+		return
+	}
+	collector, ok := s.distribution.(api.GarbageCollector)
+	if !ok {
+		writeJSONError(w, http.StatusNotImplemented, "unsupported_operation", "Storage does not support garbage collection")
+		return
+	}
+	result, err := collector.CollectGarbage()
+	if err != nil {
+		writeStorageError(w, fmt.Sprintf("Failed to collect garbage: %v", err), err)
+		return
+	}
+	slog.Info("garbage collection finished", "removed", result.Removed, "bytes", result.Bytes)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// handleGetCacheStats reports the cache hits, misses and transferred bytes since the
+// counters were last reset, and the current size of the cache
+func (s *Server) handleGetCacheStats(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.proxy.Stats())
+}
+
+// handleResetCacheStats resets the cache counters
+func (s *Server) handleResetCacheStats(w http.ResponseWriter, r *http.Request) {
+	s.proxy.ResetStats()
+	slog.Info("cache statistics reset")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleEvictionPreview reports the models that would be evicted to shrink the cache
+// to the target-bytes query parameter, without deleting anything
+func (s *Server) handleEvictionPreview(w http.ResponseWriter, r *http.Request) {
+	targetBytes, err := strconv.ParseInt(r.URL.Query().Get("target-bytes"), 10, 64)
+	if err != nil || targetBytes < 0 {
+		writeJSONError(w, http.StatusBadRequest, "bad_request", "Invalid target-bytes parameter")
+		return
+	}
+	planner, ok := s.distribution.(api.EvictionPlanner)
+	if !ok {
+		writeJSONError(w, http.StatusNotImplemented, "unsupported_operation", "Storage does not support eviction")
+		return
+	}
+	preview, err := planner.EvictionPreview(targetBytes)
+	if err != nil {
+		writeStorageError(w, fmt.Sprintf("Failed to plan eviction: %v", err), err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(preview)
+}
+
+// handleListOpenAIModels lists the cached models in the OpenAI models schema, for
+// serving infrastructure that discovers models from /v1/models
+func (s *Server) handleListOpenAIModels(w http.ResponseWriter, r *http.Request) {
+	lister, ok := s.distribution.(api.ModelLister)
+	if !ok {
+		writeJSONError(w, http.StatusNotImplemented, "unsupported_operation", "Storage does not support listing models")
+		return
+	}
+	models, err := lister.ListModels()
+	if err != nil {
+		writeStorageError(w, fmt.Sprintf("Failed to list models: %v", err), err)
+		return
+	}
+
+	list := model.OpenAIModelList{Object: "list", Data: make([]model.OpenAIModel, 0, len(models))}
+	token := bearerToken(r)
+	for _, m := range models {
+		// private models are only listed to clients that may download them
+		if !s.acl.allowed(m.ID, token) {
+			continue
+		}
+		list.Data = append(list.Data, model.OpenAIModel{
+			ID:      m.ID,
+			Object:  "model",
+			Created: m.LastModified.Unix(),
+			OwnedBy: strings.Split(m.ID, "/")[0],
+		})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(list)
+}
+
+// rejectInMaintenance answers 503 to write operations while in maintenance mode
+func (s *Server) rejectInMaintenance(w http.ResponseWriter) bool {
+	if !s.maintenance.Load() {
+		return false
+	}
+	w.Header().Set("Retry-After", "60")
+	writeJSONError(w, http.StatusServiceUnavailable, "maintenance", "Server is in maintenance mode, write operations are disabled")
+	return true
+}
+
+// handleProxyAPI forwards other Hugging Face API requests to the upstream
+func (s *Server) handleProxyAPI(w http.ResponseWriter, r *http.Request) {
+	if !s.EnableProxy && !s.FallbackProxy {
+		writeJSONError(w, http.StatusNotFound, "not_found", "Not found")
+		return
+	}
+	s.proxy.HandleAPI(w, r)
+}
+
+// handleGetModelRefs lists the cached refs of a model with the commits they point to,
+// models that are not cached are looked up upstream when the proxy is enabled
+func (s *Server) handleGetModelRefs(w http.ResponseWriter, r *http.Request) {
+	modelID := mux.Vars(r)["model_id"]
+
+	dist := s.models.route(modelID).dist
+	lister, ok := dist.(api.RevisionLister)
+	if !ok {
+		s.handleProxyAPI(w, r)
+		return
+	}
+	revisions, err := lister.Revisions(modelID)
+	if err != nil || len(revisions) == 0 {
+		s.handleProxyAPI(w, r)
+		return
+	}
+
+	refs := model.ModelRefs{
+		Branches:  make([]model.GitRef, 0),
+		Tags:      make([]model.GitRef, 0),
+		Snapshots: make([]string, 0),
+	}
+	for _, revision := range revisions {
+		if isCommitSha(revision) {
+			refs.Snapshots = append(refs.Snapshots, revision)
+			continue
+		}
+		refs.Branches = append(refs.Branches, model.GitRef{
+			Name:         revision,
+			Ref:          "refs/heads/" + revision,
+			TargetCommit: dist.RepoSha(modelID, revision),
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(refs)
+}
+
+// isCommitSha reports whether s looks like a full git commit sha
+func isCommitSha(s string) bool {
+	if len(s) != 40 {
+		return false
+	}
+	for _, c := range s {
+		if !strings.ContainsRune("0123456789abcdef", c) {
+			return false
+		}
+	}
+	return true
+}
+
+// handleWarmModel pre-populates the local cache with a model revision from the upstream
+func (s *Server) handleWarmModel(w http.ResponseWriter, r *http.Request) {
+	if s.rejectInMaintenance(w) {
+		return
+	}
+	if !s.EnableProxy && !s.FallbackProxy {
+		writeJSONError(w, http.StatusBadRequest, "proxy_disabled", "Proxy is not enabled")
+		return
+	}
+	modelID := mux.Vars(r)["model_id"]
+	revision := r.URL.Query().Get("revision")
+	if revision == "" {
+		revision = s.defaultRevision
+	}
+
+	// warming downloads whole models, far longer than the WriteTimeout of the server
+	clearWriteDeadline(w)
+	result, err := s.proxy.Warm(r.Context(), modelID, revision)
+	if err != nil {
+		writeJSONError(w, http.StatusBadGateway, "upstream_error", fmt.Sprintf("Failed to warm model: %v", err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// handleGetModelManifest lists every file of a model revision with the URL to download
+// it from, so an external tool can pre-seed a cache. In proxy mode files that are not
+// cached point to the upstream.
+func (s *Server) handleGetModelManifest(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	modelID := vars["model_id"]
+	version := vars["version"]
+	proxied := s.EnableProxy || s.FallbackProxy
+
+	dist := s.models.route(modelID).dist
+	indexInfo, err := dist.RepoInfo(modelID, version)
+	if err != nil && proxied {
+		indexInfo, err = s.proxy.ModelIndex(r.Context(), modelID, version)
+	}
+	if err != nil {
+		writeJSONError(w, http.StatusNotFound, "model_not_found", fmt.Sprintf("Failed to get model index: %v", err))
+		return
+	}
+
+	sha := indexInfo.SHA
+	if sha == "" {
+		sha = dist.RepoSha(modelID, version)
+	}
+	baseURL := requestBaseURL(r)
+	manifest := model.ModelManifest{
+		ID:    modelID,
+		SHA:   sha,
+		Files: make([]model.ManifestEntry, 0, len(indexInfo.Siblings)),
+	}
+	for _, sibling := range indexInfo.Siblings {
+		entry := model.ManifestEntry{
+			Filename: sibling.RFilename,
+			Etag:     sibling.BlobID,
+			Size:     sibling.Size,
+			URL:      fmt.Sprintf("%s/%s/resolve/%s/%s", baseURL, modelID, sha, sibling.RFilename),
+		}
+		if sibling.LFS != nil {
+			entry.Etag = sibling.LFS.SHA256
+			entry.Size = sibling.LFS.Size
+		}
+		if info, exist := dist.FileExists(modelID, sha, sibling.RFilename); exist {
+			entry.Cached = true
+			entry.Size = info.Size()
+			if etag := dist.FileEtag(modelID, sha, sibling.RFilename); etag != "" {
+				entry.Etag = etag
+			}
+		} else if proxied {
+			entry.URL = s.proxy.FileURL(modelID, sha, sibling.RFilename)
+		}
+		manifest.Files = append(manifest.Files, entry)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(manifest)
+}
+
+// requestBaseURL returns the scheme and host a request was sent to
+func requestBaseURL(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	if proto := r.Header.Get("X-Forwarded-Proto"); proto != "" {
+		scheme = proto
+	}
+	return scheme + "://" + r.Host
+}
+
+// handleGetModelStatus reports which files of a model revision are cached locally.
+// Each file is checked independently, so a partially cached model reports a mix of
+// cached and missing files and only the missing ones are proxied on request.
+func (s *Server) handleGetModelStatus(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	modelID := vars["model_id"]
+	version := vars["version"]
+
+	dist := s.models.route(modelID).dist
+	indexInfo, err := dist.RepoInfo(modelID, version)
+	if err != nil {
+		writeJSONError(w, http.StatusNotFound, "model_not_found", fmt.Sprintf("Failed to get model index: %v", err))
+		return
+	}
+
+	sha := dist.RepoSha(modelID, version)
+	status := model.ModelCacheStatus{
+		ID:      modelID,
+		SHA:     sha,
+		Cached:  make([]string, 0),
+		Missing: make([]string, 0),
+	}
+	for _, sibling := range indexInfo.Siblings {
+		if _, exist := dist.FileExists(modelID, sha, sibling.RFilename); exist {
+			status.Cached = append(status.Cached, sibling.RFilename)
+		} else {
+			status.Missing = append(status.Missing, sibling.RFilename)
+		}
+	}
+
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(indexInfo)
+	json.NewEncoder(w).Encode(status)
 }
@@ -0,0 +1,1490 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/lengrongfu/LLMDistribution/pkg/api"
+	"github.com/lengrongfu/LLMDistribution/pkg/api/model"
+	"github.com/lengrongfu/LLMDistribution/pkg/utils"
+)
+
+// testAdminToken is the admin token of the servers created by newTestServer
+const testAdminToken = "admin-secret"
+
+// newTestServer starts a file storage server below a temporary directory, configure
+// adjusts the configuration before the server is created
+func newTestServer(t *testing.T, configure func(*Config)) (*Server, *httptest.Server) {
+	t.Helper()
+	dir := t.TempDir()
+	config := Config{
+		Port:            8081,
+		StorageType:     api.FileStorage,
+		GitBaseDir:      filepath.Join(dir, "git"),
+		FileBaseDir:     filepath.Join(dir, "file"),
+		ProxyBaseURL:    "http://127.0.0.1:1",
+		DefaultRevision: "main",
+		AdminToken:      testAdminToken,
+	}
+	if configure != nil {
+		configure(&config)
+	}
+	s, err := NewServer(config)
+	if err != nil {
+		t.Fatalf("NewServer: %v", err)
+	}
+	ts := httptest.NewServer(s.httpServer.Handler)
+	t.Cleanup(func() {
+		ts.Close()
+		s.Shutdown(context.Background())
+	})
+	return s, ts
+}
+
+// doRequest sends a request to the test server with token as bearer token, it returns
+// the status and body of the response
+func doRequest(t *testing.T, method, url, token string, body io.Reader) (int, string) {
+	t.Helper()
+	req, err := http.NewRequest(method, url, body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(resp.Body)
+	return resp.StatusCode, string(data)
+}
+
+func TestUploadRequiresAdminToken(t *testing.T) {
+	_, ts := newTestServer(t, nil)
+	_, disabled := newTestServer(t, func(c *Config) { c.AdminToken = "" })
+
+	tests := []struct {
+		name   string
+		url    string
+		token  string
+		status int
+	}{
+		{"admin token", ts.URL, testAdminToken, http.StatusOK},
+		{"no token", ts.URL, "", http.StatusUnauthorized},
+		{"wrong token", ts.URL, "guess", http.StatusUnauthorized},
+		{"uploads disabled", disabled.URL, testAdminToken, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, body := doRequest(t, "PUT", tt.url+"/api/models/acme/m?path=config.json", tt.token, strings.NewReader("{}"))
+			if status != tt.status {
+				t.Fatalf("status = %d, want %d: %s", status, tt.status, body)
+			}
+		})
+	}
+}
+
+func TestUploadRejectsTraversal(t *testing.T) {
+	s, ts := newTestServer(t, nil)
+	outside := filepath.Join(filepath.Dir(s.baseDir), "escaped")
+
+	tests := []struct {
+		name string
+		url  string
+	}{
+		{"relative path", "/api/models/acme/m?path=../../../../escaped"},
+		{"absolute path", "/api/models/acme/m?path=" + outside},
+		{"backslashes", "/api/models/acme/m?path=..\\..\\..\\escaped"},
+		{"snapshot upload", "/api/models/acme/m/upload/main?path=../../escaped"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, body := doRequest(t, "PUT", ts.URL+tt.url, testAdminToken, strings.NewReader("pwned"))
+			if status != http.StatusBadRequest {
+				t.Fatalf("status = %d, want 400: %s", status, body)
+			}
+			if _, err := os.Stat(outside); err == nil {
+				t.Fatalf("upload escaped to %s", outside)
+			}
+		})
+	}
+}
+
+func TestResumableUploadRejectsTraversal(t *testing.T) {
+	_, ts := newTestServer(t, nil)
+	tests := []struct {
+		name    string
+		method  string
+		headers map[string]string
+	}{
+		{"upload offset", "HEAD", nil},
+		{"resumed chunk", "PUT", map[string]string{"Content-Range": "bytes 0-3/8"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest(tt.method, ts.URL+"/api/models/acme/m?path=../../../victim", strings.NewReader("1234"))
+			req.Header.Set("Authorization", "Bearer "+testAdminToken)
+			for key, value := range tt.headers {
+				req.Header.Set(key, value)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusBadRequest {
+				t.Fatalf("status = %d, want 400", resp.StatusCode)
+			}
+		})
+	}
+}
+
+func TestMultipartUploadRejectsTraversal(t *testing.T) {
+	s, ts := newTestServer(t, nil)
+	outside := filepath.Join(filepath.Dir(s.baseDir), "escaped")
+	tests := []struct {
+		name   string
+		path   string
+		status int
+	}{
+		{"file name", "config.json", http.StatusOK},
+		{"relative path", "../../../../escaped", http.StatusBadRequest},
+		{"absolute path", outside, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var body strings.Builder
+			form := multipart.NewWriter(&body)
+			form.WriteField("path", tt.path)
+			part, _ := form.CreateFormFile("file", "config.json")
+			part.Write([]byte("{}"))
+			form.Close()
+
+			req, _ := http.NewRequest("POST", ts.URL+"/api/models/acme/m", strings.NewReader(body.String()))
+			req.Header.Set("Content-Type", form.FormDataContentType())
+			req.Header.Set("Authorization", "Bearer "+testAdminToken)
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != tt.status {
+				t.Fatalf("status = %d, want %d", resp.StatusCode, tt.status)
+			}
+			if _, err := os.Stat(outside); err == nil {
+				t.Fatalf("upload escaped to %s", outside)
+			}
+		})
+	}
+}
+
+func TestDeleteModelRequiresAdminToken(t *testing.T) {
+	_, ts := newTestServer(t, nil)
+	tests := []struct {
+		name   string
+		model  string
+		token  string
+		status int
+	}{
+		{"no token", "org/m", "", http.StatusUnauthorized},
+		{"organization", "org", testAdminToken, http.StatusBadRequest},
+		{"admin token", "org/m", testAdminToken, http.StatusNoContent},
+	}
+	status, body := doRequest(t, "PUT", ts.URL+"/api/models/org/m/upload/main?path=config.json", testAdminToken, strings.NewReader("{}"))
+	if status != http.StatusOK {
+		t.Fatalf("upload: %d %s", status, body)
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, body := doRequest(t, "DELETE", ts.URL+"/api/models/"+tt.model, tt.token, nil)
+			if status != tt.status {
+				t.Fatalf("status = %d, want %d: %s", status, tt.status, body)
+			}
+		})
+	}
+}
+
+func TestModelTreeFallbackKeepsIndex(t *testing.T) {
+	const tree = `[{"type":"file","path":"config.json","size":2}]`
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, tree)
+	}))
+	defer upstream.Close()
+	var fileDir string
+	_, ts := newTestServer(t, func(c *Config) {
+		c.ProxyBaseURL = upstream.URL
+		c.FallbackProxy = true
+		fileDir = c.FileBaseDir
+	})
+
+	tests := []struct {
+		name string
+		path string
+	}{
+		{"revision", "/api/models/org/m/tree/main"},
+		{"path", "/api/models/org/m/tree/main/sub"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, body := doRequest(t, "GET", ts.URL+tt.path, "", nil)
+			if status != http.StatusOK || body != tree {
+				t.Fatalf("status %d: %s", status, body)
+			}
+			indexes, _ := filepath.Glob(filepath.Join(fileDir, "*", "*", ".modeindex"))
+			if len(indexes) != 0 {
+				t.Fatalf("tree response cached as model index: %v", indexes)
+			}
+		})
+	}
+}
+
+// startWithWriteTimeout serves s with the given WriteTimeout, as httptest servers
+// have none
+func startWithWriteTimeout(t *testing.T, s *Server, timeout time.Duration) string {
+	t.Helper()
+	ts := httptest.NewUnstartedServer(s.httpServer.Handler)
+	ts.Config.WriteTimeout = timeout
+	ts.Start()
+	t.Cleanup(ts.Close)
+	return ts.URL
+}
+
+// testCommit is the commit of the models served by slowUpstream
+const testCommit = "0123456789abcdef0123456789abcdef01234567"
+
+// slowUpstream serves org/m with a single config.json holding content, taking delay
+// to send the file
+func slowUpstream(t *testing.T, content string, delay time.Duration) *httptest.Server {
+	t.Helper()
+	etag := fmt.Sprintf("%x", sha256.Sum256([]byte(content)))
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/api/models/") {
+			fmt.Fprintf(w, `{"id":"org/m","sha":%q,"siblings":[{"rfilename":"config.json"}]}`, testCommit)
+			return
+		}
+		w.Header().Set("X-Repo-Commit", testCommit)
+		w.Header().Set("ETag", `"`+etag+`"`)
+		w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+		if r.Method == "GET" {
+			time.Sleep(delay)
+			io.WriteString(w, content)
+		}
+	}))
+	t.Cleanup(upstream.Close)
+	return upstream
+}
+
+func TestWarmOutlivesWriteTimeout(t *testing.T) {
+	upstream := slowUpstream(t, `{"model_type":"opt"}`, 300*time.Millisecond)
+	s, _ := newTestServer(t, func(c *Config) {
+		c.ProxyBaseURL = upstream.URL
+		c.FallbackProxy = true
+	})
+	url := startWithWriteTimeout(t, s, 100*time.Millisecond)
+
+	status, body := doRequest(t, "POST", url+"/api/models/org/m/warm", testAdminToken, nil)
+	if status != http.StatusOK || !strings.Contains(body, `"downloaded":["config.json"]`) {
+		t.Fatalf("status %d: %s", status, body)
+	}
+}
+
+func TestWarmModel(t *testing.T) {
+	files := map[string]string{
+		"config.json":       `{"model_type":"opt"}`,
+		"model.safetensors": strings.Repeat("w", 1024),
+	}
+	var downloads atomic.Int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/api/models/") {
+			fmt.Fprintf(w, `{"id":"org/m","sha":%q,"siblings":[{"rfilename":"config.json"},{"rfilename":"model.safetensors"}]}`, testCommit)
+			return
+		}
+		content, ok := files[filepath.Base(r.URL.Path)]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("X-Repo-Commit", testCommit)
+		w.Header().Set("ETag", fmt.Sprintf(`"%x"`, sha256.Sum256([]byte(content))))
+		w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+		if r.Method == "GET" {
+			downloads.Add(1)
+			io.WriteString(w, content)
+		}
+	}))
+	t.Cleanup(upstream.Close)
+	_, ts := newTestServer(t, func(c *Config) {
+		c.ProxyBaseURL = upstream.URL
+		c.FallbackProxy = true
+	})
+
+	if status, body := doRequest(t, "POST", ts.URL+"/api/models/org/m/warm", "", nil); status != http.StatusUnauthorized {
+		t.Fatalf("warm without token: %d %s", status, body)
+	}
+	if n := downloads.Load(); n != 0 {
+		t.Fatalf("unauthorized warm downloaded %d files", n)
+	}
+
+	status, body := doRequest(t, "POST", ts.URL+"/api/models/org/m/warm", testAdminToken, nil)
+	if status != http.StatusOK || !strings.Contains(body, `"downloaded":["config.json","model.safetensors"]`) {
+		t.Fatalf("warm: %d %s", status, body)
+	}
+	status, body = doRequest(t, "GET", ts.URL+"/api/models/org/m/status/main", "", nil)
+	if status != http.StatusOK || !strings.Contains(body, `"cached":["config.json","model.safetensors"],"missing":[]`) {
+		t.Fatalf("status after warm: %d %s", status, body)
+	}
+
+	// warming a cached model downloads nothing
+	status, body = doRequest(t, "POST", ts.URL+"/api/models/org/m/warm", testAdminToken, nil)
+	if status != http.StatusOK || !strings.Contains(body, `"downloaded":[],"skipped":["config.json","model.safetensors"]`) {
+		t.Fatalf("second warm: %d %s", status, body)
+	}
+	if n := downloads.Load(); n != 2 {
+		t.Errorf("upstream downloads = %d, want 2", n)
+	}
+}
+
+func TestRedirectOnMiss(t *testing.T) {
+	content := `{"model_type":"opt"}`
+	upstream := slowUpstream(t, content, 0)
+	_, ts := newTestServer(t, func(c *Config) {
+		c.ProxyBaseURL = upstream.URL
+		c.FallbackProxy = true
+		c.RedirectOnMiss = true
+	})
+	noRedirect := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	get := func() (*http.Response, string) {
+		t.Helper()
+		resp, err := noRedirect.Get(ts.URL + "/org/m/resolve/main/config.json")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return resp, string(body)
+	}
+
+	resp, _ := get()
+	if resp.StatusCode != http.StatusTemporaryRedirect {
+		t.Fatalf("miss status = %d, want %d", resp.StatusCode, http.StatusTemporaryRedirect)
+	}
+	if want := upstream.URL + "/org/m/resolve/main/config.json"; resp.Header.Get("Location") != want {
+		t.Errorf("Location = %q, want %q", resp.Header.Get("Location"), want)
+	}
+
+	// the background fill caches the file for the next requests
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		resp, body := get()
+		if resp.StatusCode == http.StatusOK {
+			if body != content {
+				t.Errorf("body = %q, want %q", body, content)
+			}
+			break
+		}
+		if resp.StatusCode != http.StatusTemporaryRedirect || time.Now().After(deadline) {
+			t.Fatalf("status = %d, want the cached file", resp.StatusCode)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestThrottledDownloadOutlivesWriteTimeout(t *testing.T) {
+	content := strings.Repeat("x", 4096)
+	tests := []struct {
+		name      string
+		configure func(*Config)
+		path      string
+	}{
+		{"cached file", func(c *Config) {}, "/org/m/resolve/main/config.json"},
+		{"proxied file", func(c *Config) {
+			c.ProxyBaseURL = slowUpstream(t, content, 300*time.Millisecond).URL
+			c.FallbackProxy = true
+		}, "/org/other/resolve/main/config.json"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, ts := newTestServer(t, func(c *Config) {
+				c.RateLimit = 8192
+				tt.configure(c)
+			})
+			status, body := doRequest(t, "PUT", ts.URL+"/api/models/org/m/upload/main?path=config.json", testAdminToken, strings.NewReader(content))
+			if status != http.StatusOK {
+				t.Fatalf("upload: status %d: %s", status, body)
+			}
+			url := startWithWriteTimeout(t, s, 100*time.Millisecond)
+
+			status, body = doRequest(t, "GET", url+tt.path, "", nil)
+			if status != http.StatusOK || body != content {
+				t.Fatalf("status %d, %d bytes", status, len(body))
+			}
+		})
+	}
+}
+
+func TestResetCacheStatsRequiresAdmin(t *testing.T) {
+	tests := []struct {
+		name       string
+		adminToken string
+		token      string
+		want       int
+	}{
+		{"admin token not configured", "", testAdminToken, http.StatusForbidden},
+		{"no token", testAdminToken, "", http.StatusUnauthorized},
+		{"wrong token", testAdminToken, "wrong", http.StatusUnauthorized},
+		{"admin token", testAdminToken, testAdminToken, http.StatusNoContent},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, ts := newTestServer(t, func(c *Config) { c.AdminToken = tt.adminToken })
+			status, body := doRequest(t, "DELETE", ts.URL+"/api/cache/stats", tt.token, nil)
+			if status != tt.want {
+				t.Errorf("status %d, want %d: %s", status, tt.want, body)
+			}
+		})
+	}
+}
+
+func TestModelStatusReportsMissingFiles(t *testing.T) {
+	upstream := slowUpstream(t, "{}", 0)
+	_, ts := newTestServer(t, func(c *Config) {
+		c.ProxyBaseURL = upstream.URL
+		c.FallbackProxy = true
+	})
+	status, body := doRequest(t, "GET", ts.URL+"/api/models/org/m/revision/main", "", nil)
+	if status != http.StatusOK {
+		t.Fatalf("index: %d %s", status, body)
+	}
+
+	tests := []struct {
+		name  string
+		fetch string
+		want  string
+	}{
+		{"index only", "", `"cached":[],"missing":["config.json"]`},
+		{"file fetched", "/org/m/resolve/main/config.json", `"cached":["config.json"],"missing":[]`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.fetch != "" {
+				if status, body := doRequest(t, "GET", ts.URL+tt.fetch, "", nil); status != http.StatusOK {
+					t.Fatalf("fetch: %d %s", status, body)
+				}
+			}
+			status, body := doRequest(t, "GET", ts.URL+"/api/models/org/m/status/main", "", nil)
+			if status != http.StatusOK || !strings.Contains(body, tt.want) {
+				t.Errorf("status %d: %s, want %s", status, body, tt.want)
+			}
+		})
+	}
+}
+
+func TestConditionalGetIfModifiedSince(t *testing.T) {
+	_, ts := newTestServer(t, nil)
+	status, body := doRequest(t, "PUT", ts.URL+"/api/models/org/m/upload/main?path=config.json", testAdminToken, strings.NewReader("{}"))
+	if status != http.StatusOK {
+		t.Fatalf("upload: %d %s", status, body)
+	}
+	resp, err := http.Get(ts.URL + "/org/m/resolve/main/config.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	lastModified, err := http.ParseTime(resp.Header.Get("Last-Modified"))
+	if err != nil {
+		t.Fatalf("Last-Modified %q: %v", resp.Header.Get("Last-Modified"), err)
+	}
+
+	tests := []struct {
+		name        string
+		method      string
+		since       time.Time
+		ifNoneMatch string
+		want        int
+	}{
+		{"modified since", "GET", lastModified.Add(-time.Hour), "", http.StatusOK},
+		{"not modified since", "GET", lastModified, "", http.StatusNotModified},
+		{"if-none-match takes precedence", "GET", lastModified, `"other"`, http.StatusOK},
+		{"HEAD modified since", "HEAD", lastModified.Add(-time.Hour), "", http.StatusOK},
+		{"HEAD not modified since", "HEAD", lastModified.Add(time.Hour), "", http.StatusNotModified},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest(tt.method, ts.URL+"/org/m/resolve/main/config.json", nil)
+			req.Header.Set("If-Modified-Since", tt.since.UTC().Format(http.TimeFormat))
+			if tt.ifNoneMatch != "" {
+				req.Header.Set("If-None-Match", tt.ifNoneMatch)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != tt.want {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.want)
+			}
+		})
+	}
+}
+
+func TestMaintenanceMode(t *testing.T) {
+	_, ts := newTestServer(t, nil)
+	status, body := doRequest(t, "PUT", ts.URL+"/api/models/org/m/upload/main?path=config.json", testAdminToken, strings.NewReader("{}"))
+	if status != http.StatusOK {
+		t.Fatalf("upload: %d %s", status, body)
+	}
+	if status, body := doRequest(t, "POST", ts.URL+"/api/admin/maintenance?enabled=true", "", nil); status != http.StatusUnauthorized {
+		t.Fatalf("toggle without token: %d %s", status, body)
+	}
+	if status, body := doRequest(t, "POST", ts.URL+"/api/admin/maintenance?enabled=true", testAdminToken, nil); status != http.StatusOK {
+		t.Fatalf("toggle: %d %s", status, body)
+	}
+
+	tests := []struct {
+		name     string
+		method   string
+		path     string
+		want     int
+		wantBody string
+	}{
+		{"state", "GET", "/api/admin/maintenance", http.StatusOK, `"enabled":true`},
+		{"download", "GET", "/org/m/resolve/main/config.json", http.StatusOK, "{}"},
+		{"upload", "PUT", "/api/models/org/m/upload/main?path=other.json", http.StatusServiceUnavailable, `"code":"maintenance"`},
+		{"garbage collection", "POST", "/api/maintenance/gc", http.StatusServiceUnavailable, `"code":"maintenance"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, body := doRequest(t, tt.method, ts.URL+tt.path, testAdminToken, strings.NewReader("{}"))
+			if status != tt.want || !strings.Contains(body, tt.wantBody) {
+				t.Errorf("status %d: %s, want %d with %s", status, body, tt.want, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestModelIndexETag(t *testing.T) {
+	_, ts := newTestServer(t, nil)
+	status, body := doRequest(t, "PUT", ts.URL+"/api/models/org/m/upload/main?path=config.json", testAdminToken, strings.NewReader("{}"))
+	if status != http.StatusOK {
+		t.Fatalf("upload: %d %s", status, body)
+	}
+	indexURL := ts.URL + "/api/models/org/m/revision/main"
+	resp, err := http.Get(indexURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	etag := resp.Header.Get("ETag")
+	if !strings.HasPrefix(etag, `"`) || resp.Header.Get("X-Repo-Commit") == "" {
+		t.Fatalf("ETag %q, X-Repo-Commit %q", etag, resp.Header.Get("X-Repo-Commit"))
+	}
+
+	tests := []struct {
+		name        string
+		ifNoneMatch string
+		want        int
+	}{
+		{"matching etag", etag, http.StatusNotModified},
+		{"weak etag", "W/" + etag, http.StatusNotModified},
+		{"etag list", `"other", ` + etag, http.StatusNotModified},
+		{"other etag", `"other"`, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest("GET", indexURL, nil)
+			req.Header.Set("If-None-Match", tt.ifNoneMatch)
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != tt.want {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.want)
+			}
+			if got := resp.Header.Get("ETag"); got != etag {
+				t.Errorf("ETag = %q, want %q", got, etag)
+			}
+		})
+	}
+}
+
+func TestModelIndexHead(t *testing.T) {
+	tests := []struct {
+		name   string
+		stream bool
+	}{
+		{"built index", false},
+		{"streamed index", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, ts := newTestServer(t, func(c *Config) { c.StreamIndex = tt.stream })
+			status, body := doRequest(t, "PUT", ts.URL+"/api/models/org/m/upload/main?path=config.json", testAdminToken, strings.NewReader("{}"))
+			if status != http.StatusOK {
+				t.Fatalf("upload: %d %s", status, body)
+			}
+			indexURL := ts.URL + "/api/models/org/m/revision/main"
+			status, index := doRequest(t, "GET", indexURL, "", nil)
+			if status != http.StatusOK {
+				t.Fatalf("GET: %d %s", status, index)
+			}
+
+			resp, err := http.Head(indexURL)
+			if err != nil {
+				t.Fatal(err)
+			}
+			data, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			etag := resp.Header.Get("ETag")
+			if resp.StatusCode != http.StatusOK || len(data) != 0 || etag == "" {
+				t.Fatalf("HEAD = %d with %d bytes and ETag %q, want 200 with an ETag and no body", resp.StatusCode, len(data), etag)
+			}
+			if !tt.stream && resp.ContentLength != int64(len(index)) {
+				t.Errorf("Content-Length = %d, want the %d bytes of the index", resp.ContentLength, len(index))
+			}
+
+			req, _ := http.NewRequest("HEAD", indexURL, nil)
+			req.Header.Set("If-None-Match", etag)
+			resp, err = http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusNotModified {
+				t.Errorf("HEAD with the ETag = %d, want 304", resp.StatusCode)
+			}
+		})
+	}
+}
+
+func TestResolveDirectoryListing(t *testing.T) {
+	_, ts := newTestServer(t, nil)
+	for _, name := range []string{"config.json", "sub/a.json"} {
+		status, body := doRequest(t, "PUT", ts.URL+"/api/models/org/m/upload/main?path="+name, testAdminToken, strings.NewReader("{}"))
+		if status != http.StatusOK {
+			t.Fatalf("upload %s: %d %s", name, status, body)
+		}
+	}
+	tests := []struct {
+		name string
+		path string
+		want string
+	}{
+		{"directory", "/org/m/resolve/main/sub", `"path":"sub/a.json"`},
+		{"snapshot root", "/org/m/resolve/main", `"path":"config.json"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, body := doRequest(t, "GET", ts.URL+tt.path, "", nil)
+			if status != http.StatusOK || !strings.Contains(body, tt.want) {
+				t.Errorf("status %d: %s, want %s", status, body, tt.want)
+			}
+		})
+	}
+}
+
+func TestCollectGarbageRequiresAdmin(t *testing.T) {
+	_, ts := newTestServer(t, nil)
+	tests := []struct {
+		name  string
+		token string
+		want  int
+	}{
+		{"no token", "", http.StatusUnauthorized},
+		{"wrong token", "wrong", http.StatusUnauthorized},
+		{"admin token", testAdminToken, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, body := doRequest(t, "POST", ts.URL+"/api/maintenance/gc", tt.token, nil)
+			if status != tt.want {
+				t.Errorf("status %d: %s, want %d", status, body, tt.want)
+			}
+			if tt.want == http.StatusOK && !strings.Contains(body, `"removed":0`) {
+				t.Errorf("body = %s", body)
+			}
+		})
+	}
+}
+
+func TestResolvePathForms(t *testing.T) {
+	_, ts := newTestServer(t, nil)
+	content := `{"model_type":"opt"}`
+	for _, name := range []string{"config.json", "sub/Tokenizer.json"} {
+		status, body := doRequest(t, "PUT", ts.URL+"/api/models/org/m/upload/main?path="+name, testAdminToken, strings.NewReader(content))
+		if status != http.StatusOK {
+			t.Fatalf("upload %s: %d %s", name, status, body)
+		}
+	}
+
+	tests := []struct {
+		name string
+		path string
+	}{
+		{"plain", "config.json"},
+		{"dot prefix", "./config.json"},
+		{"other case", "CONFIG.json"},
+		{"backslash", "sub%5CTokenizer.json"},
+		{"nested other case", "sub/tokenizer.JSON"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, body := doRequest(t, "GET", ts.URL+"/org/m/resolve/main/"+tt.path, "", nil)
+			if status != http.StatusOK || body != content {
+				t.Errorf("status %d: %q, want %d %q", status, body, http.StatusOK, content)
+			}
+		})
+	}
+}
+
+func TestLinkedEtagHeaders(t *testing.T) {
+	_, ts := newTestServer(t, nil)
+	content := "safetensors weights"
+	status, body := doRequest(t, "PUT", ts.URL+"/api/models/org/m/upload/main?path=model.safetensors", testAdminToken, strings.NewReader(content))
+	if status != http.StatusOK {
+		t.Fatalf("upload: %d %s", status, body)
+	}
+	sum := sha256.Sum256([]byte(content))
+	resp, err := http.Head(ts.URL + "/org/m/resolve/main/model.safetensors")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	want := map[string]string{
+		"X-Linked-Etag": `"` + hex.EncodeToString(sum[:]) + `"`,
+		"X-Linked-Size": strconv.Itoa(len(content)),
+		"Digest":        "sha-256=" + base64.StdEncoding.EncodeToString(sum[:]),
+	}
+	for header, value := range want {
+		if got := resp.Header.Get(header); got != value {
+			t.Errorf("%s = %q, want %q", header, got, value)
+		}
+	}
+}
+
+func TestSetLinkedEtag(t *testing.T) {
+	tests := []struct {
+		name       string
+		etag       string
+		wantLinked bool
+	}{
+		{"sha256", strings.Repeat("ab", sha256.Size), true},
+		{"git blob id", utils.EmptyBlobEtag, false},
+		{"not hex", strings.Repeat("zz", sha256.Size), false},
+		{"empty", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := http.Header{}
+			setLinkedEtag(h, tt.etag, 42)
+			if linked := h.Get("X-Linked-Etag") != "" && h.Get("Digest") != ""; linked != tt.wantLinked {
+				t.Errorf("linked headers set = %v, want %v: %v", linked, tt.wantLinked, h)
+			}
+		})
+	}
+}
+
+func TestModelManifestPartiallyCached(t *testing.T) {
+	content := `{"model_type":"opt"}`
+	weightsSHA := strings.Repeat("ab", sha256.Size)
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/api/models/") {
+			fmt.Fprintf(w, `{"id":"org/m","sha":%q,"siblings":[{"rfilename":"config.json"},{"rfilename":"model.safetensors","lfs":{"sha256":%q,"size":1024}}]}`, testCommit, weightsSHA)
+			return
+		}
+		w.Header().Set("X-Repo-Commit", testCommit)
+		w.Header().Set("ETag", fmt.Sprintf(`"%x"`, sha256.Sum256([]byte(content))))
+		w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+		io.WriteString(w, content)
+	}))
+	defer upstream.Close()
+	_, ts := newTestServer(t, func(c *Config) {
+		c.ProxyBaseURL = upstream.URL
+		c.FallbackProxy = true
+	})
+	for _, path := range []string{"/api/models/org/m/revision/main", "/org/m/resolve/main/config.json"} {
+		if status, body := doRequest(t, "GET", ts.URL+path, "", nil); status != http.StatusOK {
+			t.Fatalf("fetch %s: %d %s", path, status, body)
+		}
+	}
+
+	status, body := doRequest(t, "GET", ts.URL+"/api/models/org/m/manifest/main", "", nil)
+	if status != http.StatusOK {
+		t.Fatalf("manifest: %d %s", status, body)
+	}
+	var manifest model.ModelManifest
+	if err := json.Unmarshal([]byte(body), &manifest); err != nil {
+		t.Fatal(err)
+	}
+	files := make(map[string]model.ManifestEntry)
+	for _, entry := range manifest.Files {
+		files[entry.Filename] = entry
+	}
+
+	tests := []struct {
+		filename   string
+		wantCached bool
+		wantURL    string
+		wantSize   int64
+		wantEtag   string
+	}{
+		{"config.json", true, ts.URL + "/org/m/resolve/" + testCommit + "/config.json", int64(len(content)), ""},
+		{"model.safetensors", false, upstream.URL + "/org/m/resolve/" + testCommit + "/model.safetensors", 1024, weightsSHA},
+	}
+	for _, tt := range tests {
+		t.Run(tt.filename, func(t *testing.T) {
+			entry, ok := files[tt.filename]
+			if !ok {
+				t.Fatalf("%s missing from manifest %s", tt.filename, body)
+			}
+			if entry.Cached != tt.wantCached || entry.URL != tt.wantURL || entry.Size != tt.wantSize {
+				t.Errorf("entry = %+v, want cached %v, url %s, size %d", entry, tt.wantCached, tt.wantURL, tt.wantSize)
+			}
+			if tt.wantEtag != "" && entry.Etag != tt.wantEtag {
+				t.Errorf("etag = %q, want %q", entry.Etag, tt.wantEtag)
+			}
+		})
+	}
+}
+
+func TestZeroByteFile(t *testing.T) {
+	var fetches atomic.Int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/api/models/") {
+			fmt.Fprintf(w, `{"id":"org/m","sha":%q,"siblings":[{"rfilename":"__init__.py"}]}`, testCommit)
+			return
+		}
+		if r.Method == "GET" {
+			fetches.Add(1)
+		}
+		// like the hub, no etag is sent for the empty file
+		w.Header().Set("X-Repo-Commit", testCommit)
+		w.Header().Set("Content-Length", "0")
+	}))
+	defer upstream.Close()
+	_, ts := newTestServer(t, func(c *Config) {
+		c.ProxyBaseURL = upstream.URL
+		c.FallbackProxy = true
+	})
+
+	// the rows run in order, the first fetches the file through the proxy
+	tests := []struct {
+		name        string
+		method      string
+		wantFetches int32
+	}{
+		{"via proxy", "GET", 1},
+		{"from cache", "GET", 1},
+		{"HEAD from cache", "HEAD", 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest(tt.method, ts.URL+"/org/m/resolve/main/__init__.py", nil)
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			body, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusOK || len(body) != 0 || resp.Header.Get("Content-Length") != "0" {
+				t.Errorf("status %d, Content-Length %q, body %q", resp.StatusCode, resp.Header.Get("Content-Length"), body)
+			}
+			if got := fetches.Load(); got != tt.wantFetches {
+				t.Errorf("upstream fetches = %d, want %d", got, tt.wantFetches)
+			}
+		})
+	}
+}
+
+func TestHealthCheckProbesStorage(t *testing.T) {
+	tests := []struct {
+		name     string
+		breakDir func(t *testing.T, dir string)
+		want     int
+	}{
+		{"healthy", func(t *testing.T, dir string) {}, http.StatusOK},
+		{"not writable", func(t *testing.T, dir string) {
+			if os.Geteuid() == 0 {
+				t.Skip("root can write to read-only directories")
+			}
+			os.Chmod(dir, 0555)
+			t.Cleanup(func() { os.Chmod(dir, 0755) })
+		}, http.StatusServiceUnavailable},
+		{"missing", func(t *testing.T, dir string) { os.RemoveAll(dir) }, http.StatusServiceUnavailable},
+		{"not a directory", func(t *testing.T, dir string) {
+			os.RemoveAll(dir)
+			os.WriteFile(dir, nil, 0644)
+		}, http.StatusServiceUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var dir string
+			_, ts := newTestServer(t, func(c *Config) { dir = c.FileBaseDir })
+			tt.breakDir(t, dir)
+			status, body := doRequest(t, "GET", ts.URL+"/health", "", nil)
+			if status != tt.want {
+				t.Errorf("status %d: %s, want %d", status, body, tt.want)
+			}
+			if tt.want != http.StatusOK && !strings.Contains(body, `"status":"unhealthy"`) {
+				t.Errorf("body = %s", body)
+			}
+		})
+	}
+}
+
+func TestLivenessAndReadiness(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer upstream.Close()
+	tests := []struct {
+		name      string
+		configure func(*Config)
+		wantReady int
+	}{
+		{"no proxy", nil, http.StatusOK},
+		{"upstream reachable", func(c *Config) {
+			c.EnableProxy = true
+			c.ProxyBaseURL = upstream.URL
+		}, http.StatusOK},
+		// newTestServer points the proxy at a closed port
+		{"upstream unreachable", func(c *Config) { c.EnableProxy = true }, http.StatusServiceUnavailable},
+		{"fallback upstream unreachable", func(c *Config) { c.FallbackProxy = true }, http.StatusServiceUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, ts := newTestServer(t, tt.configure)
+			if status, body := doRequest(t, "GET", ts.URL+"/healthz", "", nil); status != http.StatusOK {
+				t.Errorf("/healthz status %d: %s", status, body)
+			}
+			status, body := doRequest(t, "GET", ts.URL+"/readyz", "", nil)
+			if status != tt.wantReady {
+				t.Errorf("/readyz status %d: %s, want %d", status, body, tt.wantReady)
+			}
+			if tt.wantReady != http.StatusOK && !strings.Contains(body, `"upstream":"upstream`) {
+				t.Errorf("/readyz body = %s", body)
+			}
+		})
+	}
+}
+
+func TestMultipartUpload(t *testing.T) {
+	_, ts := newTestServer(t, nil)
+	tests := []struct {
+		name      string
+		query     string
+		pathField string
+		noFile    bool
+		want      int
+		wantPath  string
+	}{
+		{name: "path field", pathField: "sub/config.json", want: http.StatusOK, wantPath: "sub/config.json"},
+		{name: "path query parameter", query: "?path=query.json", want: http.StatusOK, wantPath: "query.json"},
+		{name: "missing path", want: http.StatusBadRequest},
+		{name: "missing file", pathField: "config.json", noFile: true, want: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var body strings.Builder
+			form := multipart.NewWriter(&body)
+			if tt.pathField != "" {
+				form.WriteField("path", tt.pathField)
+			}
+			if !tt.noFile {
+				part, _ := form.CreateFormFile("file", "upload.json")
+				part.Write([]byte(`{"form":true}`))
+			}
+			form.Close()
+
+			req, _ := http.NewRequest("POST", ts.URL+"/api/models/acme/m"+tt.query, strings.NewReader(body.String()))
+			req.Header.Set("Content-Type", form.FormDataContentType())
+			req.Header.Set("Authorization", "Bearer "+testAdminToken)
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode != tt.want {
+				t.Fatalf("status = %d, want %d", resp.StatusCode, tt.want)
+			}
+			if tt.want != http.StatusOK {
+				return
+			}
+			var stored struct {
+				Path string `json:"path"`
+			}
+			if err := json.NewDecoder(resp.Body).Decode(&stored); err != nil {
+				t.Fatal(err)
+			}
+			if !strings.HasSuffix(filepath.ToSlash(stored.Path), "/"+tt.wantPath) {
+				t.Errorf("stored at %s, want a path ending in %s", stored.Path, tt.wantPath)
+			}
+			if data, err := os.ReadFile(stored.Path); err != nil || string(data) != `{"form":true}` {
+				t.Errorf("stored file = %q, %v", data, err)
+			}
+		})
+	}
+}
+
+func TestHeadAdvertisesRanges(t *testing.T) {
+	_, ts := newTestServer(t, nil)
+	content := "0123456789"
+	status, body := doRequest(t, "PUT", ts.URL+"/api/models/org/m/upload/main?path=model.bin", testAdminToken, strings.NewReader(content))
+	if status != http.StatusOK {
+		t.Fatalf("upload: %d %s", status, body)
+	}
+	tests := []struct {
+		method     string
+		rangeValue string
+		wantStatus int
+		wantLength string
+	}{
+		{"HEAD", "", http.StatusOK, "10"},
+		{"GET", "", http.StatusOK, "10"},
+		{"GET", "bytes=2-5", http.StatusPartialContent, "4"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.rangeValue, func(t *testing.T) {
+			req, _ := http.NewRequest(tt.method, ts.URL+"/org/m/resolve/main/model.bin", nil)
+			if tt.rangeValue != "" {
+				req.Header.Set("Range", tt.rangeValue)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != tt.wantStatus {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+			if got := resp.Header.Get("Accept-Ranges"); got != "bytes" {
+				t.Errorf("Accept-Ranges = %q, want bytes", got)
+			}
+			if got := resp.Header.Get("Content-Length"); got != tt.wantLength {
+				t.Errorf("Content-Length = %q, want %q", got, tt.wantLength)
+			}
+		})
+	}
+}
+
+func TestFileETagQuoting(t *testing.T) {
+	_, ts := newTestServer(t, nil)
+	content := "weights"
+	status, body := doRequest(t, "PUT", ts.URL+"/api/models/org/m/upload/main?path=model.bin", testAdminToken, strings.NewReader(content))
+	if status != http.StatusOK {
+		t.Fatalf("upload: %d %s", status, body)
+	}
+	sum := sha256.Sum256([]byte(content))
+	bare := hex.EncodeToString(sum[:])
+	fileURL := ts.URL + "/org/m/resolve/main/model.bin"
+
+	tests := []struct {
+		name        string
+		ifNoneMatch string
+		want        int
+	}{
+		{"no condition", "", http.StatusOK},
+		{"quoted etag", `"` + bare + `"`, http.StatusNotModified},
+		{"unquoted etag", bare, http.StatusNotModified},
+		{"weak etag", `W/"` + bare + `"`, http.StatusNotModified},
+		{"etag list", `"other", ` + bare, http.StatusNotModified},
+		{"wildcard", "*", http.StatusNotModified},
+		{"other etag", `"other"`, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest("GET", fileURL, nil)
+			if tt.ifNoneMatch != "" {
+				req.Header.Set("If-None-Match", tt.ifNoneMatch)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != tt.want {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.want)
+			}
+			if got := resp.Header.Get("ETag"); got != `"`+bare+`"` {
+				t.Errorf("ETag = %q, want the quoted sha256", got)
+			}
+		})
+	}
+}
+
+func TestQuoteEtag(t *testing.T) {
+	tests := []struct {
+		etag string
+		want string
+	}{
+		{"abc", `"abc"`},
+		{`"abc"`, `"abc"`},
+		{`W/"abc"`, `"abc"`},
+	}
+	for _, tt := range tests {
+		if got := quoteEtag(tt.etag); got != tt.want {
+			t.Errorf("quoteEtag(%q) = %q, want %q", tt.etag, got, tt.want)
+		}
+	}
+}
+
+func TestUploadSnapshotFile(t *testing.T) {
+	_, ts := newTestServer(t, nil)
+	type uploadResult struct {
+		Commit string `json:"commit"`
+		Etag   string `json:"etag"`
+		Path   string `json:"path"`
+	}
+	// the rows run in order, later rows upload into the snapshot of the first
+	var first uploadResult
+	tests := []struct {
+		name     string
+		revision func() string
+		path     string
+		token    string
+		content  string
+		want     int
+	}{
+		{"new ref", func() string { return "main" }, "config.json", testAdminToken, `{"a":1}`, http.StatusOK},
+		{"same ref", func() string { return "main" }, "sub/model.bin", testAdminToken, "weights", http.StatusOK},
+		{"commit", func() string { return first.Commit }, "tokenizer.json", testAdminToken, "{}", http.StatusOK},
+		{"no admin token", func() string { return "main" }, "x.json", "", "{}", http.StatusUnauthorized},
+		{"missing path", func() string { return "main" }, "", testAdminToken, "{}", http.StatusBadRequest},
+		{"traversal", func() string { return "main" }, "../escaped", testAdminToken, "{}", http.StatusBadRequest},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			url := ts.URL + "/api/models/org/m/upload/" + tt.revision()
+			if tt.path != "" {
+				url += "?path=" + tt.path
+			}
+			status, body := doRequest(t, "PUT", url, tt.token, strings.NewReader(tt.content))
+			if status != tt.want {
+				t.Fatalf("status %d: %s, want %d", status, body, tt.want)
+			}
+			if status != http.StatusOK {
+				return
+			}
+			var result uploadResult
+			if err := json.Unmarshal([]byte(body), &result); err != nil {
+				t.Fatal(err)
+			}
+			if i == 0 {
+				first = result
+			}
+			etag, err := utils.ComputeEtag(tt.path, strings.NewReader(tt.content), int64(len(tt.content)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.Commit != first.Commit || result.Etag != etag || result.Path != tt.path {
+				t.Errorf("result = %+v, want commit %s and etag %s", result, first.Commit, etag)
+			}
+			status, body = doRequest(t, "GET", ts.URL+"/org/m/resolve/"+result.Commit+"/"+tt.path, "", nil)
+			if status != http.StatusOK || body != tt.content {
+				t.Errorf("served %d %q, want %q", status, body, tt.content)
+			}
+		})
+	}
+}
+
+// countFiles counts the regular files and links below dir
+func countFiles(t *testing.T, dir string) int {
+	t.Helper()
+	n := 0
+	err := filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if !d.IsDir() {
+			n++
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func TestUploadSizeLimit(t *testing.T) {
+	const limit = 16
+	s, ts := newTestServer(t, func(c *Config) { c.MaxUploadBytes = limit })
+	small := strings.Repeat("s", limit)
+	large := strings.Repeat("l", limit+1)
+	tests := []struct {
+		name    string
+		path    string
+		content string
+		// chunked hides the length of the body, so the limit is hit while it is read
+		chunked bool
+		headers map[string]string
+		want    int
+	}{
+		{"snapshot upload within limit", "/api/models/org/m/upload/main?path=small.bin", small, false, nil, http.StatusOK},
+		{"snapshot upload announced too large", "/api/models/org/m/upload/main?path=large.bin", large, false, nil, http.StatusRequestEntityTooLarge},
+		{"snapshot upload streamed too large", "/api/models/org/m/upload/main?path=large.bin", large, true, nil, http.StatusRequestEntityTooLarge},
+		{"raw upload streamed too large", "/api/models/org/m?path=large.bin", large, true, nil, http.StatusRequestEntityTooLarge},
+		{"resumed upload too large", "/api/models/org/m?path=large.bin", small[:4], false, map[string]string{"Content-Range": fmt.Sprintf("bytes 0-3/%d", limit+1)}, http.StatusRequestEntityTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := countFiles(t, s.baseDir)
+			var body io.Reader = strings.NewReader(tt.content)
+			if tt.chunked {
+				body = io.MultiReader(body)
+			}
+			req, _ := http.NewRequest("PUT", ts.URL+tt.path, body)
+			req.Header.Set("Authorization", "Bearer "+testAdminToken)
+			for key, value := range tt.headers {
+				req.Header.Set(key, value)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			respBody, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			if resp.StatusCode != tt.want {
+				t.Fatalf("status %d: %s, want %d", resp.StatusCode, respBody, tt.want)
+			}
+			if tt.want != http.StatusRequestEntityTooLarge {
+				return
+			}
+			if !strings.Contains(string(respBody), `"code":"payload_too_large"`) {
+				t.Errorf("body = %s", respBody)
+			}
+			if after := countFiles(t, s.baseDir); after != before {
+				t.Errorf("rejected upload left %d files behind", after-before)
+			}
+		})
+	}
+}
+
+func TestReindexRoute(t *testing.T) {
+	_, ts := newTestServer(t, nil)
+	status, body := doRequest(t, "PUT", ts.URL+"/api/models/org/m/upload/main?path=config.json", testAdminToken, strings.NewReader("{}"))
+	if status != http.StatusOK {
+		t.Fatalf("upload: %d %s", status, body)
+	}
+	tests := []struct {
+		name     string
+		modelID  string
+		token    string
+		want     int
+		wantBody string
+	}{
+		{"no token", "org/m", "", http.StatusUnauthorized, `"code":"unauthorized"`},
+		{"cached model", "org/m", testAdminToken, http.StatusOK, `"files":1`},
+		{"unknown model", "org/missing", testAdminToken, http.StatusNotFound, `"code":"model_not_found"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, body := doRequest(t, "POST", ts.URL+"/api/models/"+tt.modelID+"/reindex", tt.token, nil)
+			if status != tt.want || !strings.Contains(body, tt.wantBody) {
+				t.Errorf("status %d: %s, want %d with %s", status, body, tt.want, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestCheckModelRoute(t *testing.T) {
+	_, ts := newTestServer(t, nil)
+	status, body := doRequest(t, "PUT", ts.URL+"/api/models/org/m/upload/main?path=config.json", testAdminToken, strings.NewReader("{}"))
+	if status != http.StatusOK {
+		t.Fatalf("upload: %d %s", status, body)
+	}
+	tests := []struct {
+		name     string
+		modelID  string
+		token    string
+		want     int
+		wantBody string
+	}{
+		{"no token", "org/m", "", http.StatusUnauthorized, `"code":"unauthorized"`},
+		{"wrong token", "org/m", "wrong", http.StatusUnauthorized, `"code":"unauthorized"`},
+		{"cached model", "org/m", testAdminToken, http.StatusOK, `"status":"ok"`},
+		{"unknown model", "org/missing", testAdminToken, http.StatusNotFound, `"code":"model_not_found"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, body := doRequest(t, "POST", ts.URL+"/api/admin/models/"+tt.modelID+"/check?deep=true", tt.token, nil)
+			if status != tt.want || !strings.Contains(body, tt.wantBody) {
+				t.Errorf("status %d: %s, want %d with %s", status, body, tt.want, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestContentDisposition(t *testing.T) {
+	_, ts := newTestServer(t, nil)
+	status, body := doRequest(t, "PUT", ts.URL+"/api/models/org/m/upload/main?path=sub/config.json", testAdminToken, strings.NewReader("{}"))
+	if status != http.StatusOK {
+		t.Fatalf("upload: %d %s", status, body)
+	}
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"", `inline; filename="config.json"`},
+		{"?download=true", `attachment; filename="config.json"`},
+		{"?download=1", `attachment; filename="config.json"`},
+		{"?download=false", `inline; filename="config.json"`},
+		{"?download=yes", `inline; filename="config.json"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			resp, err := http.Get(ts.URL + "/org/m/resolve/main/sub/config.json" + tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if got := resp.Header.Get("Content-Disposition"); got != tt.want {
+				t.Errorf("Content-Disposition = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStreamWriter(t *testing.T) {
+	f, err := os.CreateTemp(t.TempDir(), "blob")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	tests := []struct {
+		name      string
+		content   io.Reader
+		size      int64
+		wantLarge bool
+	}{
+		{"small content", strings.NewReader("x"), 1, false},
+		{"large file", f, largeFileSize, false},
+		{"large content", strings.NewReader("x"), largeFileSize, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			w := streamWriter(rec, tt.content, tt.size)
+			if _, large := w.(largeFileWriter); large != tt.wantLarge {
+				t.Fatalf("large copy buffers = %v, want %v", large, tt.wantLarge)
+			}
+			if http.NewResponseController(w).Flush() != nil {
+				t.Fatal("the writer does not unwrap to the response writer")
+			}
+		})
+	}
+}
+
+func TestLargeFileWriterReadFrom(t *testing.T) {
+	content := strings.Repeat("0123456789", 300<<10)
+	rec := httptest.NewRecorder()
+	n, err := largeFileWriter{ResponseWriter: rec}.ReadFrom(strings.NewReader(content))
+	if err != nil {
+		t.Fatalf("ReadFrom: %v", err)
+	}
+	if n != int64(len(content)) || rec.Body.String() != content {
+		t.Fatalf("copied %d bytes, want %d", n, len(content))
+	}
+}
+
+// discardResponseWriter is a ResponseWriter dropping the body, like a fast client
+type discardResponseWriter struct {
+	header http.Header
+}
+
+func (w *discardResponseWriter) Header() http.Header         { return w.header }
+func (w *discardResponseWriter) Write(p []byte) (int, error) { return len(p), nil }
+func (w *discardResponseWriter) WriteHeader(int)             {}
+
+// benchmarkServeLargeContent serves content that can not be sent with sendfile, like
+// a compressed blob, through the writer streamWriter picks or the plain writer
+func benchmarkServeLargeContent(b *testing.B, large bool) {
+	content := bytes.Repeat([]byte("0123456789abcdef"), largeFileSize/16)
+	req := httptest.NewRequest("GET", "/org/m/resolve/main/model.safetensors", nil)
+	b.SetBytes(int64(len(content)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		// hide the WriteTo of the reader so the body is copied through the writer
+		body := struct{ io.ReadSeeker }{bytes.NewReader(content)}
+		var w http.ResponseWriter = &discardResponseWriter{header: make(http.Header)}
+		if large {
+			w = streamWriter(w, body, int64(len(content)))
+		}
+		http.ServeContent(w, req, "model.safetensors", time.Time{}, body)
+	}
+}
+
+func BenchmarkServeLargeContentDefaultBuffer(b *testing.B) { benchmarkServeLargeContent(b, false) }
+
+func BenchmarkServeLargeContentLargeBuffer(b *testing.B) { benchmarkServeLargeContent(b, true) }
+
+func TestGitStorageServesCommits(t *testing.T) {
+	// the server stores the git models with Git LFS
+	for _, tool := range []string{"git", "git-lfs"} {
+		if _, err := exec.LookPath(tool); err != nil {
+			t.Skipf("%s is not installed", tool)
+		}
+	}
+	_, ts := newTestServer(t, func(c *Config) { c.StorageType = api.GitStorage })
+	// upload stores content as a new commit of main and returns that commit
+	upload := func(content string) string {
+		t.Helper()
+		status, body := doRequest(t, "PUT", ts.URL+"/api/models/org/m?path=config.json", testAdminToken, strings.NewReader(content))
+		if status != http.StatusOK {
+			t.Fatalf("upload: %d %s", status, body)
+		}
+		resp, err := http.Head(ts.URL + "/org/m/resolve/main/config.json")
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.Header.Get("X-Repo-Commit")
+	}
+	first := upload("v1")
+	second := upload("v2")
+	if first == "" || first == second {
+		t.Fatalf("commits %q and %q", first, second)
+	}
+
+	tests := []struct {
+		name     string
+		revision string
+		want     string
+	}{
+		{"branch", "main", "v2"},
+		{"old commit", first, "v1"},
+		{"new commit", second, "v2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, body := doRequest(t, "GET", ts.URL+"/org/m/resolve/"+tt.revision+"/config.json", "", nil)
+			if status != http.StatusOK || body != tt.want {
+				t.Fatalf("status %d: %q, want %q", status, body, tt.want)
+			}
+		})
+	}
+}
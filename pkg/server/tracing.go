@@ -0,0 +1,153 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+
+	"github.com/gorilla/mux"
+	"github.com/lengrongfu/LLMDistribution/pkg/api"
+	"github.com/lengrongfu/LLMDistribution/pkg/api/model"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "github.com/lengrongfu/LLMDistribution/pkg/server"
+
+// setupTracing exports spans to the OTLP/HTTP collector at endpoint and returns a
+// function flushing and stopping the exporter
+func setupTracing(endpoint string) (func(context.Context) error, error) {
+	exporter, err := otlptracehttp.New(context.Background(), otlptracehttp.WithEndpointURL(endpoint))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create OTLP exporter: %w", err)
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewSchemaless(semconv.ServiceName("llmdistribution"))),
+	)
+	otel.SetTracerProvider(provider)
+	return provider.Shutdown, nil
+}
+
+func init() {
+	// Always propagate incoming traceparent headers, even when no exporter is configured
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+}
+
+// tracingMiddleware starts a server span for each request, continuing the trace of
+// an incoming traceparent header
+func tracingMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		name := r.Method
+		if route := mux.CurrentRoute(r); route != nil {
+			if tpl, err := route.GetPathTemplate(); err == nil {
+				name += " " + tpl
+			}
+		}
+		ctx, span := otel.Tracer(tracerName).Start(ctx, name,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				attribute.String("http.request.method", r.Method),
+				attribute.String("url.path", r.URL.Path),
+			),
+		)
+		defer span.End()
+		if modelID := mux.Vars(r)["model_id"]; modelID != "" {
+			span.SetAttributes(attribute.String("model.id", modelID))
+		}
+
+		rec := &responseRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r.WithContext(ctx))
+		status := rec.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		span.SetAttributes(
+			attribute.Int("http.response.status_code", status),
+			attribute.Int64("http.response.body.size", rec.bytes),
+		)
+		if status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(status))
+		}
+	})
+}
+
+// tracedDistribution records a span for each Distribution call of a request
+type tracedDistribution struct {
+	api.Distribution
+	ctx context.Context
+}
+
+// withTracing returns a Distribution whose calls are traced as children of ctx
+func withTracing(ctx context.Context, d api.Distribution) api.Distribution {
+	return &tracedDistribution{Distribution: d, ctx: ctx}
+}
+
+func (t *tracedDistribution) start(name string, attrs ...attribute.KeyValue) trace.Span {
+	_, span := otel.Tracer(tracerName).Start(t.ctx, "distribution."+name, trace.WithAttributes(attrs...))
+	return span
+}
+
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+func (t *tracedDistribution) FileExists(modelID, sha, filename string) (os.FileInfo, bool) {
+	span := t.start("FileExists", attribute.String("model.id", modelID), attribute.String("model.sha", sha), attribute.String("file.name", filename))
+	defer span.End()
+	info, ok := t.Distribution.FileExists(modelID, sha, filename)
+	span.SetAttributes(attribute.Bool("file.exists", ok))
+	if ok {
+		span.SetAttributes(attribute.Int64("file.size", info.Size()))
+	}
+	return info, ok
+}
+
+func (t *tracedDistribution) GetFile(modelID, sha, filename string) (io.ReadSeeker, error) {
+	span := t.start("GetFile", attribute.String("model.id", modelID), attribute.String("model.sha", sha), attribute.String("file.name", filename))
+	file, err := t.Distribution.GetFile(modelID, sha, filename)
+	endSpan(span, err)
+	return file, err
+}
+
+func (t *tracedDistribution) FileEtag(modelID, sha, filename string) string {
+	span := t.start("FileEtag", attribute.String("model.id", modelID), attribute.String("model.sha", sha), attribute.String("file.name", filename))
+	defer span.End()
+	return t.Distribution.FileEtag(modelID, sha, filename)
+}
+
+func (t *tracedDistribution) RepoInfo(modelID, version string) (model.ModelIndexInfo, error) {
+	span := t.start("RepoInfo", attribute.String("model.id", modelID), attribute.String("model.version", version))
+	info, err := t.Distribution.RepoInfo(modelID, version)
+	endSpan(span, err)
+	return info, err
+}
+
+func (t *tracedDistribution) RepoSha(modelID, version string) string {
+	span := t.start("RepoSha", attribute.String("model.id", modelID), attribute.String("model.version", version))
+	defer span.End()
+	sha := t.Distribution.RepoSha(modelID, version)
+	span.SetAttributes(attribute.String("model.sha", sha))
+	return sha
+}
+
+func (t *tracedDistribution) StoreFile(modelID, filename string, content io.Reader) (string, error) {
+	span := t.start("StoreFile", attribute.String("model.id", modelID), attribute.String("file.name", filename))
+	path, err := t.Distribution.StoreFile(modelID, filename, content)
+	endSpan(span, err)
+	return path, err
+}
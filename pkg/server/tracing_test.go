@@ -0,0 +1,77 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestTracingResolveRequest(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(provider)
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+
+	s, ts := newTestServer(t, nil)
+	status, body := doRequest(t, "PUT", ts.URL+"/api/models/org/m/upload/main?path=config.json", testAdminToken, strings.NewReader("{}"))
+	if status != http.StatusOK {
+		t.Fatalf("upload: %d %s", status, body)
+	}
+
+	rec := httptest.NewRecorder()
+	s.router.ServeHTTP(rec, httptest.NewRequest("GET", "/org/m/resolve/main/config.json", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+	}
+	sha := rec.Header().Get("X-Repo-Commit")
+	if sha == "" {
+		t.Fatal("response has no X-Repo-Commit")
+	}
+
+	var server sdktrace.ReadOnlySpan
+	for _, span := range recorder.Ended() {
+		if span.Name() == "GET /{model_id:.+}/resolve/{sha}/{filename:.+}" {
+			server = span
+		}
+	}
+	if server == nil {
+		t.Fatal("no server span for the resolve request")
+	}
+	attrs := spanAttributes(server)
+	if attrs["model.id"] != "org/m" || attrs["http.response.status_code"] != "200" {
+		t.Errorf("server span attributes = %v", attrs)
+	}
+
+	// the storage calls are children of the request span
+	calls := make(map[string]map[string]string)
+	for _, span := range recorder.Ended() {
+		if span.Parent().SpanID() == server.SpanContext().SpanID() {
+			calls[span.Name()] = spanAttributes(span)
+		}
+	}
+	for _, name := range []string{"distribution.FileExists", "distribution.GetFile"} {
+		attrs, ok := calls[name]
+		if !ok {
+			t.Errorf("no %s span, got %v", name, calls)
+			continue
+		}
+		if attrs["model.id"] != "org/m" || attrs["model.sha"] != sha || attrs["file.name"] != "config.json" {
+			t.Errorf("%s attributes = %v, want org/m at %s", name, attrs, sha)
+		}
+	}
+}
+
+// spanAttributes returns the attributes of a span as strings
+func spanAttributes(span sdktrace.ReadOnlySpan) map[string]string {
+	attrs := make(map[string]string)
+	for _, attr := range span.Attributes() {
+		attrs[string(attr.Key)] = attr.Value.Emit()
+	}
+	return attrs
+}
@@ -0,0 +1,395 @@
+package server
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"io"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/net/webdav"
+
+	"github.com/lengrongfu/LLMDistribution/pkg/api"
+	"github.com/lengrongfu/LLMDistribution/pkg/api/model"
+)
+
+// davTokenKey is the context key of the token presented by a WebDAV client
+type davTokenKey struct{}
+
+// newDAVHandler serves the models of the storage over WebDAV, laid out as
+// /dav/<model id>/<file> at the default revision. Methods other than reads require
+// writeToken, the mount is read-only when it is empty.
+func (s *Server) newDAVHandler(writeToken string) http.Handler {
+	dav := &webdav.Handler{
+		Prefix:     "/dav",
+		FileSystem: &davFS{server: s},
+		LockSystem: webdav.NewMemLS(),
+		Logger: func(r *http.Request, err error) {
+			if err != nil {
+				slog.Debug("webdav request failed", "method", r.Method, "path", r.URL.Path, "error", err)
+			}
+		},
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := davToken(r)
+		switch r.Method {
+		case "GET":
+			// files are copied whole, which takes longer than the WriteTimeout
+			clearWriteDeadline(w)
+		case "HEAD", "OPTIONS", "PROPFIND":
+		default:
+			if writeToken == "" {
+				writeJSONError(w, http.StatusForbidden, "forbidden", "The WebDAV mount is read-only")
+				return
+			}
+			if subtle.ConstantTimeCompare([]byte(token), []byte(writeToken)) != 1 {
+				w.Header().Set("WWW-Authenticate", `Basic realm="llmdistribution"`)
+				writeJSONError(w, http.StatusUnauthorized, "unauthorized", "A write token is required to modify files over WebDAV")
+				return
+			}
+			if s.rejectInMaintenance(w) {
+				return
+			}
+			if r.Method == "PUT" && !s.limitUpload(w, r) {
+				return
+			}
+		}
+		dav.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), davTokenKey{}, token)))
+	})
+}
+
+// davToken returns the bearer token of a request, or the password of its basic
+// authentication as file managers can not send bearer tokens
+func davToken(r *http.Request) string {
+	if token := bearerToken(r); token != "" {
+		return token
+	}
+	_, password, _ := r.BasicAuth()
+	return password
+}
+
+// davFS exposes the models of the storage as a webdav.FileSystem. Directories above
+// the models are derived from the model IDs, private models are only visible to
+// clients presenting one of their tokens.
+type davFS struct {
+	server *Server
+}
+
+// models lists the IDs of the models visible to the client
+func (f *davFS) models(ctx context.Context) []string {
+	lister, ok := f.server.distribution.(api.ModelLister)
+	if !ok {
+		return nil
+	}
+	models, err := lister.ListModels()
+	if err != nil {
+		return nil
+	}
+	ids := make([]string, 0, len(models))
+	for _, m := range models {
+		if f.allowed(ctx, m.ID) {
+			ids = append(ids, m.ID)
+		}
+	}
+	return ids
+}
+
+// allowed reports whether the client may access modelID, applying the ACL of the
+// HTTP routes to the token of the WebDAV client
+func (f *davFS) allowed(ctx context.Context, modelID string) bool {
+	token, _ := ctx.Value(davTokenKey{}).(string)
+	return f.server.acl.allowed(modelID, token)
+}
+
+// locate splits name into the model it lies in and the path of the file in the
+// model. The model ID is empty for the directories above the models. Models the
+// client may not access do not exist for it.
+func (f *davFS) locate(ctx context.Context, name string) (modelID, filename string, err error) {
+	name = strings.Trim(path.Clean("/"+name), "/")
+	ids := f.models(ctx)
+	for _, id := range ids {
+		if name == id || strings.HasPrefix(name, id+"/") {
+			if !f.allowed(ctx, id) {
+				return "", "", fs.ErrNotExist
+			}
+			return id, strings.TrimPrefix(strings.TrimPrefix(name, id), "/"), nil
+		}
+	}
+	if name == "" {
+		return "", "", nil
+	}
+	for _, id := range ids {
+		if strings.HasPrefix(id, name+"/") {
+			return "", name, nil
+		}
+	}
+	return "", "", fs.ErrNotExist
+}
+
+// revision returns the storage of a model and the commit served for it
+func (f *davFS) revision(modelID string) (api.Distribution, string) {
+	dist := f.server.models.route(modelID).dist
+	return dist, dist.RepoSha(modelID, f.server.defaultRevision)
+}
+
+func (f *davFS) Stat(ctx context.Context, name string) (os.FileInfo, error) {
+	modelID, filename, err := f.locate(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	if modelID == "" || filename == "" {
+		return davDirInfo(name), nil
+	}
+	dist, sha := f.revision(modelID)
+	if info, ok := dist.FileExists(modelID, sha, filename); ok {
+		return info, nil
+	}
+	// storages without directory entries only know the files below a directory
+	if entries, err := f.readDir(ctx, name); err == nil && len(entries) > 0 {
+		return davDirInfo(name), nil
+	}
+	return nil, fs.ErrNotExist
+}
+
+// readDir lists the direct children of the directory name
+func (f *davFS) readDir(ctx context.Context, name string) ([]fs.FileInfo, error) {
+	modelID, dir, err := f.locate(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	if modelID == "" {
+		// the next segment of the model IDs below dir
+		seen := make(map[string]bool)
+		var entries []fs.FileInfo
+		for _, id := range f.models(ctx) {
+			rest := id
+			if dir != "" {
+				var ok bool
+				if rest, ok = strings.CutPrefix(id, dir+"/"); !ok {
+					continue
+				}
+			}
+			child, _, _ := strings.Cut(rest, "/")
+			if !seen[child] {
+				seen[child] = true
+				entries = append(entries, davDirInfo(child))
+			}
+		}
+		return entries, nil
+	}
+
+	dist, sha := f.revision(modelID)
+	if lister, ok := dist.(api.TreeLister); ok {
+		tree, err := lister.ListTree(modelID, sha, dir, false)
+		if err != nil {
+			return nil, fs.ErrNotExist
+		}
+		entries := make([]fs.FileInfo, 0, len(tree))
+		for _, entry := range tree {
+			if entry.Type == model.TreeEntryDirectory {
+				entries = append(entries, davDirInfo(entry.Path))
+			} else if info, ok := dist.FileExists(modelID, sha, entry.Path); ok {
+				entries = append(entries, info)
+			}
+		}
+		return entries, nil
+	}
+
+	files, err := dist.ListFiles(modelID)
+	if err != nil {
+		return nil, fs.ErrNotExist
+	}
+	seen := make(map[string]bool)
+	var entries []fs.FileInfo
+	for _, file := range files {
+		rest := file
+		if dir != "" {
+			var ok bool
+			if rest, ok = strings.CutPrefix(file, dir+"/"); !ok {
+				continue
+			}
+		}
+		child, _, nested := strings.Cut(rest, "/")
+		if seen[child] {
+			continue
+		}
+		seen[child] = true
+		if nested {
+			entries = append(entries, davDirInfo(child))
+		} else if info, ok := dist.FileExists(modelID, sha, file); ok {
+			entries = append(entries, info)
+		}
+	}
+	return entries, nil
+}
+
+func (f *davFS) OpenFile(ctx context.Context, name string, flag int, perm os.FileMode) (webdav.File, error) {
+	if flag&(os.O_WRONLY|os.O_RDWR|os.O_CREATE|os.O_TRUNC|os.O_APPEND) != 0 {
+		return f.create(ctx, name)
+	}
+	info, err := f.Stat(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		entries, err := f.readDir(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+		sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+		return &davDir{info: info, entries: entries}, nil
+	}
+	modelID, filename, _ := f.locate(ctx, name)
+	dist, sha := f.revision(modelID)
+	content, err := dist.GetFile(modelID, sha, filename)
+	if err != nil {
+		return nil, err
+	}
+	return &davFile{ReadSeeker: content, info: info}, nil
+}
+
+// create buffers an upload in a temporary file and stores it when the file is
+// closed. A file below no existing model creates the model named by the first two
+// segments of its path, like "org/model/config.json".
+func (f *davFS) create(ctx context.Context, name string) (webdav.File, error) {
+	modelID, filename, err := f.locate(ctx, name)
+	if errors.Is(err, fs.ErrNotExist) || (err == nil && modelID == "") {
+		parts := strings.SplitN(strings.Trim(path.Clean("/"+name), "/"), "/", 3)
+		if len(parts) < 3 {
+			return nil, fs.ErrPermission
+		}
+		modelID, filename, err = parts[0]+"/"+parts[1], parts[2], nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if filename == "" {
+		return nil, fs.ErrPermission
+	}
+	if !f.allowed(ctx, modelID) {
+		return nil, fs.ErrPermission
+	}
+	tmp, err := os.CreateTemp("", "webdav-upload-*")
+	if err != nil {
+		return nil, err
+	}
+	dist := f.server.models.route(modelID).dist
+	return &davUpload{File: tmp, store: func(content io.Reader) error {
+		// store the file where the reads of the mount find it
+		if uploader, ok := dist.(api.SnapshotUploader); ok {
+			_, _, err := uploader.StoreSnapshotFile(modelID, f.server.defaultRevision, filename, content)
+			return err
+		}
+		_, err := dist.StoreFile(modelID, filename, content)
+		return err
+	}}, nil
+}
+
+// Mkdir accepts any directory, directories only exist through the files below them
+func (f *davFS) Mkdir(ctx context.Context, name string, perm os.FileMode) error {
+	return nil
+}
+
+// RemoveAll deletes a whole model, single files can not be removed from a snapshot
+func (f *davFS) RemoveAll(ctx context.Context, name string) error {
+	modelID, filename, err := f.locate(ctx, name)
+	if err != nil {
+		return err
+	}
+	deleter, ok := f.server.models.route(modelID).dist.(api.ModelDeleter)
+	if modelID == "" || filename != "" || !ok || !f.allowed(ctx, modelID) {
+		return fs.ErrPermission
+	}
+	return deleter.DeleteModel(modelID)
+}
+
+func (f *davFS) Rename(ctx context.Context, oldName, newName string) error {
+	return fs.ErrPermission
+}
+
+// davDirInfo describes a directory of the WebDAV mount
+type davDirInfo string
+
+func (d davDirInfo) Name() string       { return path.Base("/" + string(d)) }
+func (d davDirInfo) Size() int64        { return 0 }
+func (d davDirInfo) Mode() fs.FileMode  { return fs.ModeDir | 0555 }
+func (d davDirInfo) ModTime() time.Time { return time.Time{} }
+func (d davDirInfo) IsDir() bool        { return true }
+func (d davDirInfo) Sys() any           { return nil }
+
+// davDir is an open directory of the WebDAV mount
+type davDir struct {
+	info    fs.FileInfo
+	entries []fs.FileInfo
+}
+
+func (d *davDir) Close() error                   { return nil }
+func (d *davDir) Read([]byte) (int, error)       { return 0, fs.ErrInvalid }
+func (d *davDir) Seek(int64, int) (int64, error) { return 0, fs.ErrInvalid }
+func (d *davDir) Write([]byte) (int, error)      { return 0, fs.ErrPermission }
+func (d *davDir) Stat() (fs.FileInfo, error)     { return d.info, nil }
+func (d *davDir) Readdir(count int) ([]fs.FileInfo, error) {
+	if count <= 0 {
+		entries := d.entries
+		d.entries = nil
+		return entries, nil
+	}
+	if len(d.entries) == 0 {
+		return nil, io.EOF
+	}
+	n := min(count, len(d.entries))
+	entries := d.entries[:n]
+	d.entries = d.entries[n:]
+	return entries, nil
+}
+
+// davFile is a file of the storage opened for reading
+type davFile struct {
+	io.ReadSeeker
+	info fs.FileInfo
+}
+
+func (f *davFile) Write([]byte) (int, error)          { return 0, fs.ErrPermission }
+func (f *davFile) Stat() (fs.FileInfo, error)         { return f.info, nil }
+func (f *davFile) Readdir(int) ([]fs.FileInfo, error) { return nil, fs.ErrInvalid }
+func (f *davFile) Close() error {
+	if closer, ok := f.ReadSeeker.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// davUpload buffers an uploaded file until it is closed. A file whose upload failed,
+// e.g. because it exceeded the maximum upload size, is not stored.
+type davUpload struct {
+	*os.File
+	store func(io.Reader) error
+	err   error
+}
+
+func (u *davUpload) ReadFrom(r io.Reader) (int64, error) {
+	n, err := u.File.ReadFrom(r)
+	if err != nil {
+		u.err = err
+	}
+	return n, err
+}
+
+func (u *davUpload) Close() error {
+	defer os.Remove(u.File.Name())
+	defer u.File.Close()
+	if u.err != nil {
+		return u.err
+	}
+	if _, err := u.File.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	return u.store(u.File)
+}
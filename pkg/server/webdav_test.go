@@ -0,0 +1,99 @@
+package server
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestWebDAVAppliesACL(t *testing.T) {
+	_, url := newACLTestServer(t, func(c *Config) { c.WebDAV = true })
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		token  string
+		basic  bool
+		status int
+		hidden bool
+	}{
+		{"public file", "GET", "/dav/public/m/config.json", "", false, http.StatusOK, false},
+		{"private file anonymous", "GET", "/dav/org-private/m/config.json", "", false, http.StatusNotFound, false},
+		{"private file bearer", "GET", "/dav/org-private/m/config.json", privateToken, false, http.StatusOK, false},
+		{"private file basic auth", "GET", "/dav/org-private/m/config.json", privateToken, true, http.StatusOK, false},
+		{"listing anonymous", "PROPFIND", "/dav", "", false, http.StatusMultiStatus, true},
+		{"listing private token", "PROPFIND", "/dav", privateToken, false, http.StatusMultiStatus, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest(tt.method, url+tt.path, nil)
+			req.Header.Set("Depth", "1")
+			if tt.basic {
+				req.SetBasicAuth("user", tt.token)
+			} else if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			var body strings.Builder
+			if _, err := io.Copy(&body, resp.Body); err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != tt.status {
+				t.Fatalf("status = %d, want %d", resp.StatusCode, tt.status)
+			}
+			if tt.method == "PROPFIND" && strings.Contains(body.String(), "org-private") == tt.hidden {
+				t.Fatalf("org-private listed = %v, want %v", !tt.hidden, !tt.hidden)
+			}
+		})
+	}
+}
+
+func TestWebDAVWrites(t *testing.T) {
+	const writeToken = "dav-secret"
+	tests := []struct {
+		name       string
+		writeToken string
+		method     string
+		path       string
+		token      string
+		body       string
+		status     int
+		wantBody   string
+	}{
+		{name: "read-only mount", method: "PUT", path: "/dav/org/m/config.json", token: writeToken, body: "{}", status: http.StatusForbidden},
+		{name: "missing token", writeToken: writeToken, method: "PUT", path: "/dav/org/m/config.json", body: "{}", status: http.StatusUnauthorized},
+		{name: "wrong token", writeToken: writeToken, method: "PUT", path: "/dav/org/m/config.json", token: "wrong", body: "{}", status: http.StatusUnauthorized},
+		{name: "upload", writeToken: writeToken, method: "PUT", path: "/dav/org/m/config.json", token: writeToken, body: `{"a":1}`, status: http.StatusCreated},
+		{name: "read upload", writeToken: writeToken, method: "GET", path: "/dav/org/m/config.json", status: http.StatusOK, wantBody: `{"a":1}`},
+		// x/net/webdav answers every failure to create a file with 404
+		{name: "upload above models", writeToken: writeToken, method: "PUT", path: "/dav/org/config.json", token: writeToken, body: "{}", status: http.StatusNotFound},
+		{name: "delete model", writeToken: writeToken, method: "DELETE", path: "/dav/org/m", token: writeToken, status: http.StatusNoContent},
+		{name: "read deleted", writeToken: writeToken, method: "GET", path: "/dav/org/m/config.json", status: http.StatusNotFound},
+	}
+	// the rows share a server per write token and run in order
+	servers := map[string]string{}
+	for _, token := range []string{"", writeToken} {
+		_, ts := newTestServer(t, func(c *Config) {
+			c.WebDAV = true
+			c.WebDAVWriteToken = token
+		})
+		servers[token] = ts.URL
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, body := doRequest(t, tt.method, servers[tt.writeToken]+tt.path, tt.token, strings.NewReader(tt.body))
+			if status != tt.status {
+				t.Fatalf("status = %d, want %d: %s", status, tt.status, body)
+			}
+			if tt.wantBody != "" && body != tt.wantBody {
+				t.Errorf("body = %q, want %q", body, tt.wantBody)
+			}
+		})
+	}
+}
@@ -0,0 +1,145 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// DownloadEvent is posted to the download webhook for each completed download
+type DownloadEvent struct {
+	ModelID   string    `json:"model_id"`
+	Revision  string    `json:"revision"`
+	Filename  string    `json:"filename"`
+	Status    int       `json:"status"`
+	Bytes     int64     `json:"bytes"`
+	ClientIP  string    `json:"client_ip"`
+	UserAgent string    `json:"user_agent"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+const (
+	// webhookQueueSize is the number of events buffered before new events are dropped
+	webhookQueueSize = 1024
+	// webhookAttempts is how often delivering an event is tried
+	webhookAttempts = 3
+)
+
+// downloadWebhook posts download events to a URL from a background worker, so a slow
+// or failing receiver never blocks serving files
+type downloadWebhook struct {
+	url     string
+	client  *http.Client
+	events  chan DownloadEvent
+	backoff time.Duration
+	done    chan struct{}
+	once    sync.Once
+}
+
+// newDownloadWebhook starts a dispatcher posting to url, an empty url disables it
+func newDownloadWebhook(url string) *downloadWebhook {
+	h := &downloadWebhook{url: url}
+	if url == "" {
+		return h
+	}
+	h.client = &http.Client{Timeout: 10 * time.Second}
+	h.events = make(chan DownloadEvent, webhookQueueSize)
+	h.backoff = time.Second
+	h.done = make(chan struct{})
+	go h.run()
+	return h
+}
+
+// run delivers queued events until the dispatcher is closed
+func (h *downloadWebhook) run() {
+	defer close(h.done)
+	for event := range h.events {
+		if err := h.deliver(event); err != nil {
+			slog.Warn("failed to deliver download event", "model", event.ModelID, "file", event.Filename, "error", err)
+		}
+	}
+}
+
+// deliver posts an event, retrying with exponential backoff
+func (h *downloadWebhook) deliver(event DownloadEvent) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	backoff := h.backoff
+	for attempt := 1; ; attempt++ {
+		err = h.post(body)
+		if err == nil || attempt == webhookAttempts {
+			return err
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+func (h *downloadWebhook) post(body []byte) error {
+	resp, err := h.client.Post(h.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook answered %s", resp.Status)
+	}
+	return nil
+}
+
+// publish queues an event, dropping it when the queue is full
+func (h *downloadWebhook) publish(event DownloadEvent) {
+	select {
+	case h.events <- event:
+	default:
+		slog.Warn("download webhook queue full, dropping event", "model", event.ModelID, "file", event.Filename)
+	}
+}
+
+// middleware publishes an event for every successful GET of a model file
+func (h *downloadWebhook) middleware(next http.Handler) http.Handler {
+	if h.url == "" {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rec := &responseRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r)
+		if r.Method != http.MethodGet || (rec.status != http.StatusOK && rec.status != http.StatusPartialContent) {
+			return
+		}
+		vars := mux.Vars(r)
+		h.publish(DownloadEvent{
+			ModelID:   vars["model_id"],
+			Revision:  vars["sha"],
+			Filename:  vars["filename"],
+			Status:    rec.status,
+			Bytes:     rec.bytes,
+			ClientIP:  clientIP(r),
+			UserAgent: r.UserAgent(),
+			Timestamp: time.Now().UTC(),
+		})
+	})
+}
+
+// Close stops accepting events and waits until the queued ones are delivered or ctx ends
+func (h *downloadWebhook) Close(ctx context.Context) error {
+	if h.url == "" {
+		return nil
+	}
+	h.once.Do(func() { close(h.events) })
+	select {
+	case <-h.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
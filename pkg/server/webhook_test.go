@@ -0,0 +1,96 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// webhookReceiver answers the first failures posts with 500 and sends the events it
+// accepts to the returned channel
+func webhookReceiver(t *testing.T, failures int32) (*httptest.Server, <-chan DownloadEvent) {
+	t.Helper()
+	events := make(chan DownloadEvent, 16)
+	var posts atomic.Int32
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if posts.Add(1) <= failures {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		var event DownloadEvent
+		if err := json.NewDecoder(r.Body).Decode(&event); err != nil {
+			t.Errorf("decode event: %v", err)
+		}
+		events <- event
+	}))
+	t.Cleanup(receiver.Close)
+	return receiver, events
+}
+
+func TestDownloadWebhook(t *testing.T) {
+	receiver, events := webhookReceiver(t, 0)
+	_, ts := newTestServer(t, func(c *Config) { c.DownloadWebhook = receiver.URL })
+	content := `{"model_type":"opt"}`
+	if status, body := doRequest(t, "PUT", ts.URL+"/api/models/org/m/upload/main?path=config.json", testAdminToken, strings.NewReader(content)); status != http.StatusOK {
+		t.Fatalf("upload status %d: %s", status, body)
+	}
+
+	tests := []struct {
+		method    string
+		filename  string
+		wantEvent bool
+	}{
+		{"HEAD", "config.json", false},
+		{"GET", "missing.json", false},
+		{"GET", "config.json", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.filename, func(t *testing.T) {
+			doRequest(t, tt.method, ts.URL+"/org/m/resolve/main/"+tt.filename, "", nil)
+			select {
+			case event := <-events:
+				if !tt.wantEvent {
+					t.Fatalf("unexpected event %+v", event)
+				}
+				if event.ModelID != "org/m" || event.Filename != tt.filename || event.Bytes != int64(len(content)) || event.Status != http.StatusOK {
+					t.Errorf("event = %+v", event)
+				}
+			case <-time.After(200 * time.Millisecond):
+				if tt.wantEvent {
+					t.Fatal("no event delivered")
+				}
+			}
+		})
+	}
+}
+
+func TestDownloadWebhookRetries(t *testing.T) {
+	tests := []struct {
+		name          string
+		failures      int32
+		wantDelivered bool
+	}{
+		{"first attempt", 0, true},
+		{"last attempt", webhookAttempts - 1, true},
+		{"all attempts fail", webhookAttempts, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			receiver, events := webhookReceiver(t, tt.failures)
+			h := newDownloadWebhook(receiver.URL)
+			h.backoff = time.Millisecond
+			h.publish(DownloadEvent{ModelID: "org/m", Filename: "config.json"})
+			if err := h.Close(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+			if delivered := len(events) == 1; delivered != tt.wantDelivered {
+				t.Errorf("delivered = %v, want %v", delivered, tt.wantDelivered)
+			}
+		})
+	}
+}
@@ -0,0 +1,272 @@
+package utils
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// CompressedSuffix is appended to the name of a blob stored zstd-compressed, the
+// snapshot links of the blob point to the compressed file
+const CompressedSuffix = ".zst"
+
+// compressedFrameSize is the content size of each zstd frame of a compressed blob. The
+// frames are compressed independently, so a read at an offset only decompresses the
+// frame holding it.
+const compressedFrameSize = 4 << 20
+
+const (
+	// skippableFrameMagic starts the skippable frame holding the seek table, decoders
+	// not aware of it skip the frame
+	skippableFrameMagic = 0x184D2A5E
+	// seekTableMagic ends the seek table of the zstd seekable format
+	seekTableMagic = 0x8F92EAB1
+	// seekTableFooterSize is the size of the frame count, descriptor and magic
+	seekTableFooterSize = 9
+	// seekTableChecksumFlag marks seek table entries with a checksum
+	seekTableChecksumFlag = 0x80
+)
+
+// compressedFrame is a zstd frame of a compressed blob
+type compressedFrame struct {
+	// offset is the position of the frame in the compressed blob, start the position
+	// of its content in the blob content
+	offset int64
+	start  int64
+}
+
+// CompressBlob writes the compressed copy of a blob next to it and returns its size.
+// The copy uses the zstd seekable format: the content is split into frames of
+// compressedFrameSize followed by a seek table listing their sizes.
+func CompressBlob(blob string) (int64, error) {
+	src, err := os.Open(blob)
+	if err != nil {
+		return 0, err
+	}
+	defer src.Close()
+
+	tmp := blob + CompressedSuffix + ".incomplete"
+	dst, err := os.Create(tmp)
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(tmp)
+	defer dst.Close()
+
+	encoder, err := zstd.NewWriter(nil, zstd.WithEncoderConcurrency(1))
+	if err != nil {
+		return 0, err
+	}
+	defer encoder.Close()
+	buf := make([]byte, compressedFrameSize)
+	var frame, table []byte
+	var frames uint32
+	for {
+		n, err := io.ReadFull(src, buf)
+		if n > 0 {
+			frame = encoder.EncodeAll(buf[:n], frame[:0])
+			if _, err := dst.Write(frame); err != nil {
+				return 0, err
+			}
+			table = binary.LittleEndian.AppendUint32(table, uint32(len(frame)))
+			table = binary.LittleEndian.AppendUint32(table, uint32(n))
+			frames++
+		}
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			break
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+	seekTable := binary.LittleEndian.AppendUint32(nil, skippableFrameMagic)
+	seekTable = binary.LittleEndian.AppendUint32(seekTable, uint32(len(table)+seekTableFooterSize))
+	seekTable = append(seekTable, table...)
+	seekTable = binary.LittleEndian.AppendUint32(seekTable, frames)
+	seekTable = append(seekTable, 0)
+	seekTable = binary.LittleEndian.AppendUint32(seekTable, seekTableMagic)
+	if _, err := dst.Write(seekTable); err != nil {
+		return 0, err
+	}
+	if err := dst.Sync(); err != nil {
+		return 0, err
+	}
+	info, err := dst.Stat()
+	if err != nil {
+		return 0, err
+	}
+	if err := os.Rename(tmp, blob+CompressedSuffix); err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
+
+// CompressedSize returns the content size of a compressed blob without decompressing it
+func CompressedSize(path string) (int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	_, size, err := compressedFrames(f)
+	return size, err
+}
+
+// compressedFrames reads the frames and content size of a compressed blob from its
+// seek table. Blobs compressed before the seekable format are a single frame with the
+// content size in its header.
+func compressedFrames(f *os.File) ([]compressedFrame, int64, error) {
+	info, err := f.Stat()
+	if err != nil {
+		return nil, 0, err
+	}
+	frames, size, ok, err := readSeekTable(f, info.Size())
+	if err != nil || ok {
+		return frames, size, err
+	}
+
+	header := make([]byte, zstd.HeaderMaxSize)
+	n, err := f.ReadAt(header, 0)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, 0, err
+	}
+	var h zstd.Header
+	if err := h.Decode(header[:n]); err != nil {
+		return nil, 0, err
+	}
+	if !h.HasFCS {
+		return nil, 0, fmt.Errorf("compressed blob %s has no content size", f.Name())
+	}
+	return []compressedFrame{{}}, int64(h.FrameContentSize), nil
+}
+
+// readSeekTable reads the seek table at the end of a compressed blob of fileSize
+// bytes, it reports false when the blob has none
+func readSeekTable(f *os.File, fileSize int64) ([]compressedFrame, int64, bool, error) {
+	if fileSize < 8+seekTableFooterSize {
+		return nil, 0, false, nil
+	}
+	footer := make([]byte, seekTableFooterSize)
+	if _, err := f.ReadAt(footer, fileSize-seekTableFooterSize); err != nil {
+		return nil, 0, false, err
+	}
+	if binary.LittleEndian.Uint32(footer[5:]) != seekTableMagic {
+		return nil, 0, false, nil
+	}
+	count := int64(binary.LittleEndian.Uint32(footer))
+	entrySize := int64(8)
+	if footer[4]&seekTableChecksumFlag != 0 {
+		entrySize += 4
+	}
+	tableStart := fileSize - seekTableFooterSize - count*entrySize - 8
+	if tableStart < 0 {
+		return nil, 0, false, fmt.Errorf("compressed blob %s has a truncated seek table", f.Name())
+	}
+	table := make([]byte, 8+count*entrySize)
+	if _, err := f.ReadAt(table, tableStart); err != nil {
+		return nil, 0, false, err
+	}
+	if binary.LittleEndian.Uint32(table) != skippableFrameMagic {
+		return nil, 0, false, fmt.Errorf("compressed blob %s has an invalid seek table", f.Name())
+	}
+
+	frames := make([]compressedFrame, 0, count)
+	var offset, start int64
+	for entry := table[8:]; len(entry) >= int(entrySize); entry = entry[entrySize:] {
+		frames = append(frames, compressedFrame{offset: offset, start: start})
+		offset += int64(binary.LittleEndian.Uint32(entry))
+		start += int64(binary.LittleEndian.Uint32(entry[4:]))
+	}
+	if offset != tableStart {
+		return nil, 0, false, fmt.Errorf("compressed blob %s has a seek table not matching its frames", f.Name())
+	}
+	return frames, start, true, nil
+}
+
+// compressedReader streams the content of a compressed blob. Seeking only moves the
+// read position, the next read starts decompressing at the frame holding it and
+// discards the content of the frame before it.
+type compressedReader struct {
+	file    *os.File
+	decoder *zstd.Decoder
+	frames  []compressedFrame
+	size    int64
+	// offset is the position of the decoder in the content, pos the read position
+	offset int64
+	pos    int64
+}
+
+// OpenCompressed opens a compressed blob for reading its content
+func OpenCompressed(path string) (io.ReadSeekCloser, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	frames, size, err := compressedFrames(file)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	decoder, err := zstd.NewReader(file, zstd.WithDecoderConcurrency(1))
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return &compressedReader{file: file, decoder: decoder, frames: frames, size: size}, nil
+}
+
+// frame returns the index of the frame holding the content at pos
+func (b *compressedReader) frame(pos int64) int {
+	return sort.Search(len(b.frames), func(i int) bool { return b.frames[i].start > pos }) - 1
+}
+
+func (b *compressedReader) Read(p []byte) (int, error) {
+	if b.pos >= b.size {
+		return 0, io.EOF
+	}
+	if b.pos < b.offset || b.frame(b.pos) != b.frame(b.offset) {
+		frame := b.frames[b.frame(b.pos)]
+		if _, err := b.file.Seek(frame.offset, io.SeekStart); err != nil {
+			return 0, err
+		}
+		if err := b.decoder.Reset(b.file); err != nil {
+			return 0, err
+		}
+		b.offset = frame.start
+	}
+	if b.pos > b.offset {
+		n, err := io.CopyN(io.Discard, b.decoder, b.pos-b.offset)
+		b.offset += n
+		if err != nil {
+			return 0, err
+		}
+	}
+	n, err := b.decoder.Read(p)
+	b.offset += int64(n)
+	b.pos = b.offset
+	return n, err
+}
+
+func (b *compressedReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += b.pos
+	case io.SeekEnd:
+		offset += b.size
+	}
+	if offset < 0 {
+		return 0, fmt.Errorf("seek to negative position %d", offset)
+	}
+	b.pos = offset
+	return offset, nil
+}
+
+func (b *compressedReader) Close() error {
+	b.decoder.Close()
+	return b.file.Close()
+}
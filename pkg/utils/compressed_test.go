@@ -0,0 +1,142 @@
+package utils
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// testContent returns size bytes of compressible content in which every offset is
+// distinguishable
+func testContent(size int) []byte {
+	var buf bytes.Buffer
+	for i := 0; buf.Len() < size; i++ {
+		fmt.Fprintf(&buf, "%08d\n", i)
+	}
+	return buf.Bytes()[:size]
+}
+
+// legacyCompress writes blob as a single zstd frame, the format of blobs compressed
+// before the seekable format
+func legacyCompress(t *testing.T, blob string, content []byte) {
+	t.Helper()
+	f, err := os.Create(blob + CompressedSuffix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	encoder, _ := zstd.NewWriter(nil)
+	encoder.ResetContentSize(f, int64(len(content)))
+	if _, err := encoder.Write(content); err != nil {
+		t.Fatal(err)
+	}
+	if err := encoder.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCompressedBlob(t *testing.T) {
+	tests := []struct {
+		name     string
+		size     int
+		seekable bool
+	}{
+		{"single frame", 100 << 10, true},
+		{"several frames", 2*compressedFrameSize + 12345, true},
+		{"legacy", 100 << 10, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			content := testContent(tt.size)
+			blob := filepath.Join(t.TempDir(), "blob")
+			if tt.seekable {
+				if err := os.WriteFile(blob, content, 0644); err != nil {
+					t.Fatal(err)
+				}
+				if _, err := CompressBlob(blob); err != nil {
+					t.Fatalf("CompressBlob: %v", err)
+				}
+			} else {
+				legacyCompress(t, blob, content)
+			}
+
+			size, err := CompressedSize(blob + CompressedSuffix)
+			if err != nil || size != int64(len(content)) {
+				t.Fatalf("CompressedSize = %d, %v, want %d", size, err, len(content))
+			}
+			r, err := OpenCompressed(blob + CompressedSuffix)
+			if err != nil {
+				t.Fatalf("OpenCompressed: %v", err)
+			}
+			defer r.Close()
+			// backwards, across frames and at the end
+			for _, offset := range []int64{size - 10, 5, size / 2, compressedFrameSize - 3, 0} {
+				if offset < 0 || offset >= size {
+					continue
+				}
+				if _, err := r.Seek(offset, io.SeekStart); err != nil {
+					t.Fatal(err)
+				}
+				got := make([]byte, min(10, size-offset))
+				if _, err := io.ReadFull(r, got); err != nil {
+					t.Fatalf("read at %d: %v", offset, err)
+				}
+				if want := content[offset : offset+int64(len(got))]; !bytes.Equal(got, want) {
+					t.Fatalf("read at %d = %q, want %q", offset, got, want)
+				}
+			}
+
+			// decoders unaware of the seek table still read the whole content
+			data, err := os.ReadFile(blob + CompressedSuffix)
+			if err != nil {
+				t.Fatal(err)
+			}
+			decoder, _ := zstd.NewReader(nil)
+			defer decoder.Close()
+			whole, err := decoder.DecodeAll(data, nil)
+			if err != nil || !bytes.Equal(whole, content) {
+				t.Fatalf("DecodeAll: %d bytes, %v", len(whole), err)
+			}
+		})
+	}
+}
+
+// TestCompressedBlobSeeksToFrame reads the last frame of a blob whose first frame is
+// corrupt, which only succeeds when the frames before the read are not decompressed
+func TestCompressedBlobSeeksToFrame(t *testing.T) {
+	content := testContent(2*compressedFrameSize + 100)
+	blob := filepath.Join(t.TempDir(), "blob")
+	if err := os.WriteFile(blob, content, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := CompressBlob(blob); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.OpenFile(blob+CompressedSuffix, os.O_RDWR, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.WriteAt(bytes.Repeat([]byte{0xff}, 64), 100); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	r, err := OpenCompressed(blob + CompressedSuffix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	offset := int64(len(content) - 50)
+	if _, err := r.Seek(offset, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	got, err := io.ReadAll(r)
+	if err != nil || !bytes.Equal(got, content[offset:]) {
+		t.Fatalf("read %q, %v", got, err)
+	}
+}
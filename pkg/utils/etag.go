@@ -0,0 +1,87 @@
+package utils
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"path"
+	"strings"
+)
+
+// LFSSizeThreshold is the size from which the hub stores any file with Git LFS
+const LFSSizeThreshold = 10 << 20
+
+// lfsPatterns are the patterns of the .gitattributes the hub creates repositories
+// with, files matching them are stored with Git LFS regardless of their size
+var lfsPatterns = []string{
+	"*.7z", "*.arrow", "*.bin", "*.bz2", "*.ckpt", "*.ftz", "*.gguf", "*.gz", "*.h5",
+	"*.joblib", "*.lfs.*", "*.mlmodel", "*.model", "*.msgpack", "*.npy", "*.npz",
+	"*.onnx", "*.ot", "*.parquet", "*.pb", "*.pickle", "*.pkl", "*.pt", "*.pth",
+	"*.rar", "*.safetensors", "*.tar", "*.tar.*", "*.tflite", "*.tgz", "*.wasm",
+	"*.xz", "*.zip", "*.zst", "*tfevents*",
+}
+
+// IsLFSFile reports whether the hub stores filename of size bytes with Git LFS, its
+// etag is then the SHA-256 of the content instead of the git blob SHA-1
+func IsLFSFile(filename string, size int64) bool {
+	if size >= LFSSizeThreshold {
+		return true
+	}
+	name := strings.ToLower(path.Base(NormalizeRepoPath(filename)))
+	for _, pattern := range lfsPatterns {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// EtagHash returns the hash an etag of content of size bytes was computed with:
+// SHA-256 for the 64 character etags of LFS files and the git blob SHA-1 otherwise
+func EtagHash(etag string, size int64) hash.Hash {
+	if len(etag) == sha256.Size*2 {
+		return sha256.New()
+	}
+	return newGitBlobHash(size)
+}
+
+// newGitBlobHash returns a SHA-1 primed with the git blob header of content of size bytes
+func newGitBlobHash(size int64) hash.Hash {
+	h := sha1.New()
+	fmt.Fprintf(h, "blob %d\x00", size)
+	return h
+}
+
+// GitBlobSHA1 returns the git blob SHA-1 of content of size bytes, the object id
+// `git hash-object` prints for it
+func GitBlobSHA1(content io.Reader, size int64) (string, error) {
+	h := newGitBlobHash(size)
+	n, err := io.Copy(h, content)
+	if err != nil {
+		return "", err
+	}
+	if n != size {
+		return "", fmt.Errorf("content has %d bytes instead of %d", n, size)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// ComputeEtag returns the etag the hub reports for filename with content of size
+// bytes: the SHA-256 of LFS files and the git blob SHA-1 of regular files
+func ComputeEtag(filename string, content io.Reader, size int64) (string, error) {
+	if !IsLFSFile(filename, size) {
+		return GitBlobSHA1(content, size)
+	}
+	h := sha256.New()
+	n, err := io.Copy(h, content)
+	if err != nil {
+		return "", err
+	}
+	if n != size {
+		return "", fmt.Errorf("content has %d bytes instead of %d", n, size)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,82 @@
+package utils
+
+import (
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+func TestIsLFSFile(t *testing.T) {
+	tests := []struct {
+		filename string
+		size     int64
+		want     bool
+	}{
+		{"config.json", 100, false},
+		{"README.md", 0, false},
+		{"model.safetensors", 1, true},
+		{"sub/Model.BIN", 1, true},
+		{"weights.tar.gz", 1, true},
+		{"events.out.tfevents.123", 1, true},
+		{"tokenizer.json", LFSSizeThreshold - 1, false},
+		{"tokenizer.json", LFSSizeThreshold, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.filename, func(t *testing.T) {
+			if got := IsLFSFile(tt.filename, tt.size); got != tt.want {
+				t.Errorf("IsLFSFile(%q, %d) = %v, want %v", tt.filename, tt.size, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestComputeEtag(t *testing.T) {
+	tests := []struct {
+		name     string
+		filename string
+		content  string
+		size     int64
+		want     string
+		wantErr  bool
+	}{
+		// the object ids `git hash-object` prints
+		{"git blob", "config.json", "hello\n", 6, "ce013625030ba8dba906f756967f9e9ca394464a", false},
+		{"empty git blob", "README.md", "", 0, "e69de29bb2d1d6434b8b29ae775ad8c2e48c5391", false},
+		{"lfs file", "model.bin", "hello\n", 6, "5891b5b522d5df086d0ff0b110fbd9d21bb4fc7163af34d08286a2e846f6be03", false},
+		{"short git blob", "config.json", "hello\n", 7, "", true},
+		{"short lfs file", "model.bin", "hello\n", 7, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ComputeEtag(tt.filename, strings.NewReader(tt.content), tt.size)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ComputeEtag error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Fatalf("ComputeEtag = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEtagHash(t *testing.T) {
+	tests := []struct {
+		filename string
+	}{
+		{"config.json"},
+		{"model.bin"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.filename, func(t *testing.T) {
+			etag, err := ComputeEtag(tt.filename, strings.NewReader("hello\n"), 6)
+			if err != nil {
+				t.Fatal(err)
+			}
+			h := EtagHash(etag, 6)
+			h.Write([]byte("hello\n"))
+			if got := hex.EncodeToString(h.Sum(nil)); got != etag {
+				t.Errorf("EtagHash(%s) hashed the content to %s", etag, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,193 @@
+package utils
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// LayoutStrategy names how the files of a model are arranged in the cache
+type LayoutStrategy string
+
+const (
+	// LayoutHF is the Hugging Face cache layout, a models--org--name directory per model
+	LayoutHF LayoutStrategy = "hf"
+	// LayoutFlat stores each model in an org/name directory named like the model ID
+	LayoutFlat LayoutStrategy = "flat"
+)
+
+// ParseLayoutStrategy parses the name of a layout strategy, "" is the Hugging Face layout
+func ParseLayoutStrategy(name string) (LayoutStrategy, error) {
+	switch LayoutStrategy(name) {
+	case "", LayoutHF:
+		return LayoutHF, nil
+	case LayoutFlat:
+		return LayoutFlat, nil
+	}
+	return "", fmt.Errorf("invalid layout %q, must be one of hf, flat", name)
+}
+
+// Layout builds the paths of the files of the models below a cache directory. Every
+// model directory holds blobs/, snapshots/<sha>/, refs/ and the .modeindex file, the
+// strategy decides where the model directory is. The repository type names the model
+// directories, models--org--name for models and datasets--org--name for datasets.
+// With a blob directory the blobs/ of every model, and the shared blobs, are kept
+// below it instead.
+type Layout struct {
+	baseDir  string
+	strategy LayoutStrategy
+	repoType RepoType
+	blobDir  string
+}
+
+// NewLayout returns the layout of the models below baseDir
+func NewLayout(baseDir string, strategy LayoutStrategy) Layout {
+	if strategy == "" {
+		strategy = LayoutHF
+	}
+	return Layout{baseDir: baseDir, strategy: strategy, repoType: RepoModel}
+}
+
+// WithRepoType returns the layout of the repositories of repoType. The flat layout
+// keeps repositories other than models below a datasets/ or spaces/ directory, so
+// they can share a base directory with the models.
+func (l Layout) WithRepoType(repoType RepoType) Layout {
+	if repoType == "" {
+		repoType = RepoModel
+	}
+	l.repoType = repoType
+	return l
+}
+
+// RepoType is the type of the repositories of the layout
+func (l Layout) RepoType() RepoType {
+	return l.repoType
+}
+
+// WithBlobDir returns the layout keeping the blobs below dir, separate from the
+// snapshots. An empty dir keeps the blobs in the model directories.
+func (l Layout) WithBlobDir(dir string) Layout {
+	l.blobDir = dir
+	return l
+}
+
+// BaseDir is the directory holding the models
+func (l Layout) BaseDir() string {
+	return l.baseDir
+}
+
+// ModelDir is the directory of a model
+func (l Layout) ModelDir(modelID string) string {
+	return filepath.Join(l.baseDir, l.modelDirName(modelID))
+}
+
+// modelDirName is the path of the directory of a model relative to the base directory
+func (l Layout) modelDirName(modelID string) string {
+	if l.strategy == LayoutFlat {
+		return filepath.Join(l.flatDir(), filepath.FromSlash(modelID))
+	}
+	return ConvertRepoIDToHFPath(l.repoType, modelID)
+}
+
+// flatDir is the directory of the flat layout the repositories are kept in relative to
+// the base directory, the base directory itself for models
+func (l Layout) flatDir() string {
+	if l.repoType == RepoModel {
+		return ""
+	}
+	return string(l.repoType) + "s"
+}
+
+// ModelDirPattern is a filepath.Glob pattern matching every model directory
+func (l Layout) ModelDirPattern() string {
+	return l.modelDirPattern(l.baseDir)
+}
+
+func (l Layout) modelDirPattern(dir string) string {
+	if l.strategy == LayoutFlat {
+		return filepath.Join(dir, l.flatDir(), "*", "*")
+	}
+	return filepath.Join(dir, l.repoType.Prefix()+"*")
+}
+
+// BlobDirPattern is a filepath.Glob pattern matching the blobs directory of every model
+func (l Layout) BlobDirPattern() string {
+	return filepath.Join(l.modelDirPattern(l.blobRoot()), "blobs")
+}
+
+// blobRoot is the directory below which the blobs are kept
+func (l Layout) blobRoot() string {
+	if l.blobDir != "" {
+		return l.blobDir
+	}
+	return l.baseDir
+}
+
+// ModelID returns the model ID of a model directory matched by ModelDirPattern
+func (l Layout) ModelID(modelDir string) (string, bool) {
+	rel, err := filepath.Rel(l.baseDir, modelDir)
+	if err != nil {
+		return "", false
+	}
+	rel = filepath.ToSlash(rel)
+	if strings.HasPrefix(rel, SharedBlobsDir+"/") || rel == SharedBlobsDir {
+		return "", false
+	}
+	if l.strategy == LayoutFlat {
+		if dir := l.flatDir(); dir != "" {
+			var ok bool
+			if rel, ok = strings.CutPrefix(rel, dir+"/"); !ok {
+				return "", false
+			}
+		} else if org, _, _ := strings.Cut(rel, "/"); org == "datasets" || org == "spaces" {
+			// the directories of the datasets and spaces are not models
+			return "", false
+		}
+		return rel, strings.Count(rel, "/") == 1
+	}
+	repoType, repoID, ok := ConvertHFPathToModelID(rel)
+	if !ok || repoType != l.repoType {
+		return "", false
+	}
+	return repoID, true
+}
+
+// SnapshotPath is the path of filename in the snapshot sha of a model, the snapshot
+// directory when filename is empty and the snapshots directory when sha is empty too
+func (l Layout) SnapshotPath(modelID, sha, filename string) string {
+	return filepath.Join(l.ModelDir(modelID), "snapshots", sha, filepath.FromSlash(filename))
+}
+
+// BlobPath is the path of the blob etag of a model, the blobs directory when etag is empty
+func (l Layout) BlobPath(modelID, etag string) string {
+	return filepath.Join(l.blobRoot(), l.modelDirName(modelID), "blobs", etag)
+}
+
+// SharedBlobPath is the path of the blob etag shared by several models, the shared
+// blobs directory when etag is empty
+func (l Layout) SharedBlobPath(etag string) string {
+	return filepath.Join(l.blobRoot(), SharedBlobsDir, etag)
+}
+
+// SparsePath is the path of the partially cached blob etag of a model, of which only
+// the fetched ranges hold data. It is next to the blobs so a completed sparse blob can
+// be renamed into them.
+func (l Layout) SparsePath(modelID, etag string) string {
+	return filepath.Join(l.blobRoot(), l.modelDirName(modelID), "sparse", etag)
+}
+
+// SnapshotMetaPath is the path of the metadata file of the snapshot sha of a model,
+// kept outside the snapshots so it is never served as a file
+func (l Layout) SnapshotMetaPath(modelID, sha string) string {
+	return filepath.Join(l.ModelDir(modelID), ".snapshots-meta", sha+".json")
+}
+
+// RefPath is the path of the ref of a model, the refs directory when ref is empty
+func (l Layout) RefPath(modelID, ref string) string {
+	return filepath.Join(l.ModelDir(modelID), "refs", filepath.FromSlash(ref))
+}
+
+// IndexPath is the path of the .modeindex file of a model
+func (l Layout) IndexPath(modelID string) string {
+	return filepath.Join(l.ModelDir(modelID), ".modeindex")
+}
@@ -0,0 +1,81 @@
+package utils
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestLayoutPaths(t *testing.T) {
+	base := filepath.FromSlash("/cache/hub")
+	tests := []struct {
+		strategy     LayoutStrategy
+		repoType     RepoType
+		wantModelDir string
+	}{
+		{LayoutHF, RepoModel, "/cache/hub/models--org--m"},
+		{LayoutHF, RepoDataset, "/cache/hub/datasets--org--m"},
+		{LayoutFlat, RepoModel, "/cache/hub/org/m"},
+		{LayoutFlat, RepoDataset, "/cache/hub/datasets/org/m"},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.strategy)+" "+string(tt.repoType), func(t *testing.T) {
+			l := NewLayout(base, tt.strategy).WithRepoType(tt.repoType)
+			modelDir := filepath.FromSlash(tt.wantModelDir)
+			paths := map[string][2]string{
+				"ModelDir":     {l.ModelDir("org/m"), modelDir},
+				"SnapshotPath": {l.SnapshotPath("org/m", "abc", "sub/config.json"), filepath.Join(modelDir, "snapshots", "abc", "sub", "config.json")},
+				"BlobPath":     {l.BlobPath("org/m", "etag"), filepath.Join(modelDir, "blobs", "etag")},
+				"RefPath":      {l.RefPath("org/m", "refs/pr/1"), filepath.Join(modelDir, "refs", "refs", "pr", "1")},
+				"IndexPath":    {l.IndexPath("org/m"), filepath.Join(modelDir, ".modeindex")},
+			}
+			for name, got := range paths {
+				if got[0] != got[1] {
+					t.Errorf("%s = %s, want %s", name, got[0], got[1])
+				}
+			}
+			matches, err := filepath.Match(l.ModelDirPattern(), modelDir)
+			if err != nil || !matches {
+				t.Errorf("ModelDirPattern %s does not match %s", l.ModelDirPattern(), modelDir)
+			}
+			if id, ok := l.ModelID(modelDir); !ok || id != "org/m" {
+				t.Errorf("ModelID(%s) = %q, %v, want org/m", modelDir, id, ok)
+			}
+		})
+	}
+}
+
+func TestLayoutModelIDSkipsOtherDirectories(t *testing.T) {
+	base := filepath.FromSlash("/cache/hub")
+	tests := []struct {
+		name     string
+		strategy LayoutStrategy
+		dir      string
+	}{
+		{"hf shared blobs", LayoutHF, SharedBlobsDir},
+		{"hf dataset in model layout", LayoutHF, "datasets--org--m"},
+		{"flat shared blobs", LayoutFlat, SharedBlobsDir + "/x"},
+		{"flat datasets directory", LayoutFlat, "datasets/org"},
+		{"flat too shallow", LayoutFlat, "org"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := NewLayout(base, tt.strategy)
+			if id, ok := l.ModelID(filepath.Join(base, filepath.FromSlash(tt.dir))); ok {
+				t.Errorf("ModelID(%s) = %q, want no model", tt.dir, id)
+			}
+		})
+	}
+}
+
+func TestLayoutBlobDir(t *testing.T) {
+	l := NewLayout(filepath.FromSlash("/cache/hub"), LayoutHF).WithBlobDir(filepath.FromSlash("/blobs"))
+	if got, want := l.BlobPath("org/m", "etag"), filepath.FromSlash("/blobs/models--org--m/blobs/etag"); got != want {
+		t.Errorf("BlobPath = %s, want %s", got, want)
+	}
+	if got, want := l.SharedBlobPath("etag"), filepath.Join(filepath.FromSlash("/blobs"), SharedBlobsDir, "etag"); got != want {
+		t.Errorf("SharedBlobPath = %s, want %s", got, want)
+	}
+	if got, want := l.SnapshotPath("org/m", "abc", "config.json"), filepath.FromSlash("/cache/hub/models--org--m/snapshots/abc/config.json"); got != want {
+		t.Errorf("SnapshotPath = %s, want %s", got, want)
+	}
+}
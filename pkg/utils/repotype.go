@@ -0,0 +1,59 @@
+package utils
+
+import (
+	"fmt"
+	"strings"
+)
+
+// RepoType is the kind of a Hugging Face repository, it names the cache directories of
+// its repositories like models--org--name and datasets--org--name
+type RepoType string
+
+const (
+	RepoModel   RepoType = "model"
+	RepoDataset RepoType = "dataset"
+	RepoSpace   RepoType = "space"
+)
+
+// repoIDSeparator replaces the slash of a repository ID in its cache directory name
+const repoIDSeparator = "--"
+
+// ParseRepoType parses the name of a repository type, "" is a model repository
+func ParseRepoType(name string) (RepoType, error) {
+	switch RepoType(name) {
+	case "", RepoModel:
+		return RepoModel, nil
+	case RepoDataset, RepoSpace:
+		return RepoType(name), nil
+	}
+	return "", fmt.Errorf("invalid repo type %q, must be one of model, dataset, space", name)
+}
+
+// Prefix is the prefix of the cache directory names of the repositories of the type,
+// like "models--"
+func (t RepoType) Prefix() string {
+	if t == "" {
+		t = RepoModel
+	}
+	return string(t) + "s" + repoIDSeparator
+}
+
+// ConvertRepoIDToHFPath converts a repository ID like "Qwen/Qwen2-0.5B-Instruct" to the
+// Hugging Face cache directory name of the repository type, like
+// "datasets--Qwen--Qwen2-0.5B-Instruct" for a dataset
+func ConvertRepoIDToHFPath(repoType RepoType, repoID string) string {
+	return repoType.Prefix() + strings.ReplaceAll(repoID, "/", repoIDSeparator)
+}
+
+// ConvertHFPathToModelID is the inverse of ConvertRepoIDToHFPath and
+// ConvertModelIDToHFPath, it returns the repository type and ID of a Hugging Face cache
+// directory name
+func ConvertHFPathToModelID(name string) (RepoType, string, bool) {
+	for _, repoType := range []RepoType{RepoModel, RepoDataset, RepoSpace} {
+		id, ok := strings.CutPrefix(name, repoType.Prefix())
+		if ok && id != "" && !strings.Contains(id, "/") {
+			return repoType, strings.ReplaceAll(id, repoIDSeparator, "/"), true
+		}
+	}
+	return "", "", false
+}
@@ -0,0 +1,51 @@
+package utils
+
+import "testing"
+
+func TestParseRepoType(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    RepoType
+		wantErr bool
+	}{
+		{"", RepoModel, false},
+		{"model", RepoModel, false},
+		{"dataset", RepoDataset, false},
+		{"space", RepoSpace, false},
+		{"datasets", "", true},
+	}
+	for _, tt := range tests {
+		got, err := ParseRepoType(tt.name)
+		if got != tt.want || (err != nil) != tt.wantErr {
+			t.Errorf("ParseRepoType(%q) = %q, %v, want %q, error %v", tt.name, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestHFPath(t *testing.T) {
+	tests := []struct {
+		repoType RepoType
+		repoID   string
+		path     string
+	}{
+		{RepoModel, "Qwen/Qwen2-0.5B-Instruct", "models--Qwen--Qwen2-0.5B-Instruct"},
+		{RepoDataset, "org/data", "datasets--org--data"},
+		{RepoSpace, "org/app", "spaces--org--app"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			if got := ConvertRepoIDToHFPath(tt.repoType, tt.repoID); got != tt.path {
+				t.Errorf("ConvertRepoIDToHFPath = %q, want %q", got, tt.path)
+			}
+			repoType, repoID, ok := ConvertHFPathToModelID(tt.path)
+			if !ok || repoType != tt.repoType || repoID != tt.repoID {
+				t.Errorf("ConvertHFPathToModelID = %q, %q, %v", repoType, repoID, ok)
+			}
+		})
+	}
+	for _, name := range []string{"models--", "blobs", "datasets-org-data"} {
+		if _, _, ok := ConvertHFPathToModelID(name); ok {
+			t.Errorf("ConvertHFPathToModelID(%q) parsed a repository", name)
+		}
+	}
+}
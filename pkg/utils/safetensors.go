@@ -0,0 +1,55 @@
+package utils
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/lengrongfu/LLMDistribution/pkg/api/model"
+)
+
+// MaxSafetensorsHeader bounds the JSON header read from a safetensors file
+const MaxSafetensorsHeader = 100 << 20
+
+// ParseSafetensorsHeader reads the header of a safetensors file, a little-endian 8 byte
+// length followed by JSON describing the dtype and shape of every tensor, and counts the
+// parameters by dtype. The data of the tensors is not read.
+func ParseSafetensorsHeader(r io.Reader) (model.SafetensorsInfo, error) {
+	info := model.SafetensorsInfo{Parameters: make(map[string]int64)}
+	var size uint64
+	if err := binary.Read(r, binary.LittleEndian, &size); err != nil {
+		return info, fmt.Errorf("failed to read safetensors header length: %w", err)
+	}
+	if size > MaxSafetensorsHeader {
+		return info, fmt.Errorf("safetensors header is too large: %d bytes", size)
+	}
+	header := make([]byte, size)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return info, fmt.Errorf("failed to read safetensors header: %w", err)
+	}
+	var tensors map[string]json.RawMessage
+	if err := json.Unmarshal(header, &tensors); err != nil {
+		return info, fmt.Errorf("failed to parse safetensors header: %w", err)
+	}
+	for name, raw := range tensors {
+		if name == "__metadata__" {
+			continue
+		}
+		var tensor struct {
+			Dtype string  `json:"dtype"`
+			Shape []int64 `json:"shape"`
+		}
+		if err := json.Unmarshal(raw, &tensor); err != nil {
+			return info, fmt.Errorf("failed to parse tensor %s: %w", name, err)
+		}
+		n := int64(1)
+		for _, dim := range tensor.Shape {
+			n *= dim
+		}
+		info.Parameters[strings.ToUpper(tensor.Dtype)] += n
+		info.Total += n
+	}
+	return info, nil
+}
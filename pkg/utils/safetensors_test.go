@@ -0,0 +1,55 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+	"testing"
+)
+
+func TestParseSafetensorsHeader(t *testing.T) {
+	header := func(size uint64, json string) []byte {
+		var buf bytes.Buffer
+		binary.Write(&buf, binary.LittleEndian, size)
+		buf.WriteString(json)
+		return buf.Bytes()
+	}
+	tensors := `{"__metadata__":{"format":"pt"},"w":{"dtype":"bf16","shape":[2,3]},"b":{"dtype":"F32","shape":[3]},"s":{"dtype":"F32","shape":[]}}`
+	tests := []struct {
+		name       string
+		data       []byte
+		wantTotal  int64
+		wantParams map[string]int64
+		wantErr    string
+	}{
+		{"tensors", header(uint64(len(tensors)), tensors), 10, map[string]int64{"BF16": 6, "F32": 4}, ""},
+		{"no tensors", header(2, "{}"), 0, map[string]int64{}, ""},
+		{"truncated length", []byte{1, 2}, 0, nil, "header length"},
+		{"oversized header", header(MaxSafetensorsHeader+1, ""), 0, nil, "too large"},
+		{"truncated header", header(100, "{}"), 0, nil, "failed to read"},
+		{"invalid json", header(1, "{"), 0, nil, "failed to parse"},
+		{"invalid tensor", header(11, `{"w":"bad"}`), 0, nil, "tensor w"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			info, err := ParseSafetensorsHeader(bytes.NewReader(tt.data))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error = %v, want it to mention %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if info.Total != tt.wantTotal || len(info.Parameters) != len(tt.wantParams) {
+				t.Fatalf("info = %+v, want total %d and %v", info, tt.wantTotal, tt.wantParams)
+			}
+			for dtype, n := range tt.wantParams {
+				if info.Parameters[dtype] != n {
+					t.Errorf("%s parameters = %d, want %d", dtype, info.Parameters[dtype], n)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,116 @@
+package utils
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SnapshotFileMeta is the etag, size and modification time of a file of a snapshot.
+// They are recorded in a metadata file per snapshot when the file is linked, so
+// serving the file does not need to resolve and stat its link.
+type SnapshotFileMeta struct {
+	Etag    string    `json:"etag"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mtime"`
+}
+
+// snapshotMetaMu serializes the updates of snapshot metadata files, which the storage
+// and the proxy both record files in
+var snapshotMetaMu sync.Mutex
+
+// ReadSnapshotMeta reads the metadata file of a snapshot, keyed by the slash separated
+// name of each recorded file
+func ReadSnapshotMeta(path string) (map[string]SnapshotFileMeta, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	files := make(map[string]SnapshotFileMeta)
+	if err := json.Unmarshal(data, &files); err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+// RecordSnapshotFile adds filename to the metadata file of a snapshot at path, the
+// file is replaced atomically
+func RecordSnapshotFile(path, filename string, meta SnapshotFileMeta) error {
+	snapshotMetaMu.Lock()
+	defer snapshotMetaMu.Unlock()
+
+	files, err := ReadSnapshotMeta(path)
+	if err != nil {
+		// a missing or corrupt metadata file starts over, unrecorded files fall back
+		// to their links
+		files = make(map[string]SnapshotFileMeta)
+	}
+	files[NormalizeRepoPath(filename)] = meta
+	return writeSnapshotMeta(path, files)
+}
+
+// ForgetSnapshotFile removes filename from the metadata file of a snapshot at path,
+// so the file is looked up through its link again
+func ForgetSnapshotFile(path, filename string) error {
+	snapshotMetaMu.Lock()
+	defer snapshotMetaMu.Unlock()
+
+	files, err := ReadSnapshotMeta(path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	name := NormalizeRepoPath(filename)
+	if _, ok := files[name]; !ok {
+		return nil
+	}
+	delete(files, name)
+	return writeSnapshotMeta(path, files)
+}
+
+// writeSnapshotMeta replaces the metadata file of a snapshot at path with files
+func writeSnapshotMeta(path string, files map[string]SnapshotFileMeta) error {
+	data, err := json.Marshal(files)
+	if err != nil {
+		return err
+	}
+
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(dir, ".meta-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	_, err = f.Write(data)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+// RecordSnapshotBlob records filename, linked to the blob at blobPath, in the metadata
+// file of a snapshot with the size and modification time of the blob
+func RecordSnapshotBlob(path, filename, etag, blobPath string) error {
+	info, err := os.Stat(blobPath)
+	if err != nil {
+		return err
+	}
+	size := info.Size()
+	if strings.HasSuffix(blobPath, CompressedSuffix) {
+		// the size of a compressed blob is that of its content
+		if size, err = CompressedSize(blobPath); err != nil {
+			return err
+		}
+	}
+	return RecordSnapshotFile(path, filename, SnapshotFileMeta{Etag: etag, Size: size, ModTime: info.ModTime()})
+}
@@ -0,0 +1,168 @@
+package utils
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRecordSnapshotFile(t *testing.T) {
+	mtime := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	tests := []struct {
+		name     string
+		existing string
+		filename string
+		want     []string
+	}{
+		{"new metadata file", "", "config.json", []string{"config.json"}},
+		{"added to recorded files", `{"a.txt":{"etag":"x","size":1}}`, "config.json", []string{"a.txt", "config.json"}},
+		{"corrupt metadata file", `{`, "config.json", []string{"config.json"}},
+		{"normalized name", "", "./sub\\config.json", []string{"sub/config.json"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "snapshots", "meta.json")
+			if tt.existing != "" {
+				os.MkdirAll(filepath.Dir(path), 0755)
+				if err := os.WriteFile(path, []byte(tt.existing), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			meta := SnapshotFileMeta{Etag: "abc", Size: 2, ModTime: mtime}
+			if err := RecordSnapshotFile(path, tt.filename, meta); err != nil {
+				t.Fatalf("RecordSnapshotFile: %v", err)
+			}
+			files, err := ReadSnapshotMeta(path)
+			if err != nil {
+				t.Fatalf("ReadSnapshotMeta: %v", err)
+			}
+			if len(files) != len(tt.want) {
+				t.Fatalf("recorded %v, want %v", files, tt.want)
+			}
+			for _, name := range tt.want {
+				if _, ok := files[name]; !ok {
+					t.Fatalf("%s not recorded in %v", name, files)
+				}
+			}
+			if got := files[tt.want[len(tt.want)-1]]; got.Etag != "abc" || got.Size != 2 || !got.ModTime.Equal(mtime) {
+				t.Fatalf("recorded %+v, want %+v", got, meta)
+			}
+			// the temporary file of the atomic write is not left behind
+			entries, _ := os.ReadDir(filepath.Dir(path))
+			if len(entries) != 1 {
+				t.Fatalf("snapshot directory holds %d files, want only the metadata file", len(entries))
+			}
+		})
+	}
+}
+
+func TestForgetSnapshotFile(t *testing.T) {
+	tests := []struct {
+		name     string
+		existing string
+		filename string
+		want     []string
+	}{
+		{"recorded file", `{"a.txt":{"etag":"x","size":1},"config.json":{"etag":"y","size":2}}`, "config.json", []string{"a.txt"}},
+		{"normalized name", `{"sub/config.json":{"etag":"y","size":2}}`, "./sub\\config.json", []string{}},
+		{"unrecorded file", `{"a.txt":{"etag":"x","size":1}}`, "config.json", []string{"a.txt"}},
+		{"missing metadata file", "", "config.json", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "meta.json")
+			if tt.existing != "" {
+				if err := os.WriteFile(path, []byte(tt.existing), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := ForgetSnapshotFile(path, tt.filename); err != nil {
+				t.Fatalf("ForgetSnapshotFile: %v", err)
+			}
+			files, err := ReadSnapshotMeta(path)
+			if tt.want == nil {
+				if !os.IsNotExist(err) {
+					t.Fatalf("ReadSnapshotMeta = %v, %v, want no metadata file", files, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ReadSnapshotMeta: %v", err)
+			}
+			if len(files) != len(tt.want) {
+				t.Fatalf("recorded %v, want %v", files, tt.want)
+			}
+			for _, name := range tt.want {
+				if _, ok := files[name]; !ok {
+					t.Fatalf("%s not recorded in %v", name, files)
+				}
+			}
+		})
+	}
+}
+
+func TestRecordSnapshotFileConcurrent(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "meta.json")
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if err := RecordSnapshotFile(path, fmt.Sprintf("f%d", i), SnapshotFileMeta{Size: int64(i)}); err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	files, err := ReadSnapshotMeta(path)
+	if err != nil {
+		t.Fatalf("ReadSnapshotMeta: %v", err)
+	}
+	if len(files) != 20 {
+		t.Fatalf("recorded %d files, want 20", len(files))
+	}
+}
+
+func TestRecordSnapshotBlob(t *testing.T) {
+	content := testContent(100 << 10)
+	tests := []struct {
+		name     string
+		compress bool
+	}{
+		{"blob", false},
+		{"compressed blob", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			blob := filepath.Join(dir, "blob")
+			if err := os.WriteFile(blob, content, 0644); err != nil {
+				t.Fatal(err)
+			}
+			if tt.compress {
+				if _, err := CompressBlob(blob); err != nil {
+					t.Fatalf("CompressBlob: %v", err)
+				}
+				blob += CompressedSuffix
+			}
+			path := filepath.Join(dir, "meta.json")
+			if err := RecordSnapshotBlob(path, "model.bin", "etag", blob); err != nil {
+				t.Fatalf("RecordSnapshotBlob: %v", err)
+			}
+			files, err := ReadSnapshotMeta(path)
+			if err != nil {
+				t.Fatalf("ReadSnapshotMeta: %v", err)
+			}
+			if got := files["model.bin"]; got.Etag != "etag" || got.Size != int64(len(content)) {
+				t.Fatalf("recorded %+v, want etag of %d bytes", got, len(content))
+			}
+		})
+	}
+
+	if err := RecordSnapshotBlob(filepath.Join(t.TempDir(), "meta.json"), "x", "etag", "/nonexistent/blob"); err == nil {
+		t.Fatal("RecordSnapshotBlob of a missing blob succeeded")
+	}
+}
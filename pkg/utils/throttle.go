@@ -0,0 +1,90 @@
+package utils
+
+import (
+	"io"
+	"time"
+)
+
+// throttle paces a transfer to a fixed number of bytes per second
+type throttle struct {
+	rate  int64
+	start time.Time
+	sent  int64
+}
+
+// chunk is the largest amount transferred between two waits, a tenth of a second
+// worth of bytes, so the rate holds over short periods too
+func (t *throttle) chunk() int {
+	if n := t.rate / 10; n > 0 {
+		return int(n)
+	}
+	return 1
+}
+
+// wait records n transferred bytes and sleeps until the transfer is back at the rate
+func (t *throttle) wait(n int) {
+	if t.start.IsZero() {
+		t.start = time.Now()
+	}
+	t.sent += int64(n)
+	due := t.start.Add(time.Duration(float64(t.sent) / float64(t.rate) * float64(time.Second)))
+	if d := time.Until(due); d > 0 {
+		time.Sleep(d)
+	}
+}
+
+// throttledWriter limits the rate data is written to the underlying writer
+type throttledWriter struct {
+	w io.Writer
+	t throttle
+}
+
+// NewThrottledWriter returns a writer that writes to w at no more than bytesPerSec.
+// A rate <= 0 returns w unchanged.
+func NewThrottledWriter(w io.Writer, bytesPerSec int64) io.Writer {
+	if bytesPerSec <= 0 {
+		return w
+	}
+	return &throttledWriter{w: w, t: throttle{rate: bytesPerSec}}
+}
+
+func (w *throttledWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		n := min(len(p), w.t.chunk())
+		n, err := w.w.Write(p[:n])
+		written += n
+		if err != nil {
+			return written, err
+		}
+		w.t.wait(n)
+		p = p[n:]
+	}
+	return written, nil
+}
+
+// throttledReader limits the rate data is read from the underlying reader
+type throttledReader struct {
+	r io.Reader
+	t throttle
+}
+
+// NewThrottledReader returns a reader that reads from r at no more than bytesPerSec.
+// A rate <= 0 returns r unchanged.
+func NewThrottledReader(r io.Reader, bytesPerSec int64) io.Reader {
+	if bytesPerSec <= 0 {
+		return r
+	}
+	return &throttledReader{r: r, t: throttle{rate: bytesPerSec}}
+}
+
+func (r *throttledReader) Read(p []byte) (int, error) {
+	if len(p) > r.t.chunk() {
+		p = p[:r.t.chunk()]
+	}
+	n, err := r.r.Read(p)
+	if n > 0 {
+		r.t.wait(n)
+	}
+	return n, err
+}
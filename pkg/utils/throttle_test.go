@@ -0,0 +1,48 @@
+package utils
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestThrottle(t *testing.T) {
+	const size = 2000
+	tests := []struct {
+		name    string
+		rate    int64
+		minTime time.Duration
+		maxTime time.Duration
+	}{
+		{"unlimited", 0, 0, 100 * time.Millisecond},
+		// 2000 bytes at 10000 bytes per second take 0.2s
+		{"limited", 10000, 150 * time.Millisecond, time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name+" reader", func(t *testing.T) {
+			start := time.Now()
+			data, err := io.ReadAll(NewThrottledReader(strings.NewReader(strings.Repeat("x", size)), tt.rate))
+			elapsed := time.Since(start)
+			if err != nil || len(data) != size {
+				t.Fatalf("read %d bytes, %v", len(data), err)
+			}
+			if elapsed < tt.minTime || elapsed > tt.maxTime {
+				t.Errorf("took %v, want between %v and %v", elapsed, tt.minTime, tt.maxTime)
+			}
+		})
+		t.Run(tt.name+" writer", func(t *testing.T) {
+			var buf bytes.Buffer
+			start := time.Now()
+			n, err := NewThrottledWriter(&buf, tt.rate).Write([]byte(strings.Repeat("x", size)))
+			elapsed := time.Since(start)
+			if err != nil || n != size || buf.Len() != size {
+				t.Fatalf("wrote %d bytes, %v", n, err)
+			}
+			if elapsed < tt.minTime || elapsed > tt.maxTime {
+				t.Errorf("took %v, want between %v and %v", elapsed, tt.minTime, tt.maxTime)
+			}
+		})
+	}
+}
@@ -1,10 +1,129 @@
 package utils
 
-import "strings"
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
 
-// convertModelIDToHFPath converts a model ID like "Qwen/Qwen2-0.5B-Instruct" to the
+// SharedBlobsDir is the directory under hub holding blobs shared by several models
+const SharedBlobsDir = "_shared_blobs"
+
+// EmptyBlobEtag is the git blob id of a zero-byte file, the etag the Hugging Face hub
+// reports for empty files such as a blank __init__.py
+const EmptyBlobEtag = "e69de29bb2d1d6434b8b29ae775ad8c2e48c5391"
+
+// ConvertModelIDToHFPath converts a model ID like "Qwen/Qwen2-0.5B-Instruct" to the
 // Hugging Face cache path format like "models--Qwen--Qwen2-0.5B-Instruct"
 func ConvertModelIDToHFPath(modelID string) string {
-	// Replace slashes with double dashes
-	return "models--" + strings.ReplaceAll(modelID, "/", "--")
+	return ConvertRepoIDToHFPath(RepoModel, modelID)
+}
+
+// NormalizeRepoPath converts a file name referenced by a client, like "./config.json"
+// or "sub\\file", to the slash separated form used in a model index. The name is
+// cleaned as if rooted at the repository, so ".." can not leave the repository.
+func NormalizeRepoPath(name string) string {
+	name = strings.ReplaceAll(name, "\\", "/")
+	return strings.TrimPrefix(path.Clean("/"+name), "/")
+}
+
+// ErrInvalidPath is returned for a file name or model ID sent by a client that would
+// resolve outside of its repository
+var ErrInvalidPath = errors.New("invalid path")
+
+// CleanRepoPath validates a file name sent by a client and returns it in the form
+// of NormalizeRepoPath. Unlike NormalizeRepoPath it rejects absolute names and names
+// with ".." segments instead of cleaning them, they never name a repository file.
+func CleanRepoPath(name string) (string, error) {
+	slashed := strings.ReplaceAll(name, "\\", "/")
+	if strings.HasPrefix(slashed, "/") || strings.ContainsRune(slashed, 0) {
+		return "", fmt.Errorf("%w: %q", ErrInvalidPath, name)
+	}
+	for _, segment := range strings.Split(slashed, "/") {
+		if segment == ".." {
+			return "", fmt.Errorf("%w: %q", ErrInvalidPath, name)
+		}
+	}
+	cleaned := NormalizeRepoPath(slashed)
+	if cleaned == "" || !filepath.IsLocal(filepath.FromSlash(cleaned)) {
+		return "", fmt.Errorf("%w: %q", ErrInvalidPath, name)
+	}
+	return cleaned, nil
+}
+
+// ValidModelID reports whether modelID names a repository, "name" or "org/name",
+// without path components like "." or ".." that would leave the storage directory
+func ValidModelID(modelID string) bool {
+	segments := strings.Split(modelID, "/")
+	if len(segments) > 2 {
+		return false
+	}
+	for _, segment := range segments {
+		if segment == "" || segment == "." || segment == ".." || strings.ContainsAny(segment, "\\\x00") {
+			return false
+		}
+	}
+	return true
+}
+
+// WithinDir reports whether path is dir or below it, both are cleaned first
+func WithinDir(dir, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && filepath.IsLocal(rel)
+}
+
+// CheckWritableDir verifies that dir exists, is a directory and accepts new files
+func CheckWritableDir(dir string) error {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%s is not a directory", dir)
+	}
+	f, err := os.CreateTemp(dir, ".health-*")
+	if err != nil {
+		return fmt.Errorf("%s is not writable: %w", dir, err)
+	}
+	f.Close()
+	return os.Remove(f.Name())
+}
+
+// ReadRef returns the commit a ref file like refs/main points to. Surrounding
+// whitespace, like a trailing newline of a hand-written ref, is ignored.
+func ReadRef(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// WriteRef points the ref file at path to commit. The file is replaced with a rename,
+// so a ref that moves to another commit is never read empty or partially written.
+func WriteRef(path, commit string) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	// refs can not start with a dot, so the temporary file is never taken for a ref
+	f, err := os.CreateTemp(dir, ".ref-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	_, err = f.WriteString(commit)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	if err := os.Chmod(f.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
 }
@@ -0,0 +1,147 @@
+package utils
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCleanRepoPath(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    string
+		invalid bool
+	}{
+		{name: "config.json", want: "config.json"},
+		{name: "./sub/model.safetensors", want: "sub/model.safetensors"},
+		{name: "sub\\tokenizer.json", want: "sub/tokenizer.json"},
+		{name: "a//b", want: "a/b"},
+		{name: "", invalid: true},
+		{name: ".", invalid: true},
+		{name: "/etc/passwd", invalid: true},
+		{name: "\\etc\\passwd", invalid: true},
+		{name: "../../../../etc/cron.d/x", invalid: true},
+		{name: "sub/../../x", invalid: true},
+		{name: "..\\x", invalid: true},
+		{name: "a\x00b", invalid: true},
+	}
+	for _, tt := range tests {
+		got, err := CleanRepoPath(tt.name)
+		if tt.invalid {
+			if !errors.Is(err, ErrInvalidPath) {
+				t.Errorf("CleanRepoPath(%q) = %q, %v, want ErrInvalidPath", tt.name, got, err)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("CleanRepoPath(%q) = %q, %v, want %q", tt.name, got, err, tt.want)
+		}
+	}
+}
+
+func TestValidModelID(t *testing.T) {
+	tests := []struct {
+		modelID string
+		want    bool
+	}{
+		{"Qwen/Qwen2-0.5B-Instruct", true},
+		{"gpt2", true},
+		{"", false},
+		{"org/", false},
+		{"../etc", false},
+		{"org/..", false},
+		{"./name", false},
+		{"a/b/c", false},
+		{"org\\name", false},
+	}
+	for _, tt := range tests {
+		if got := ValidModelID(tt.modelID); got != tt.want {
+			t.Errorf("ValidModelID(%q) = %v, want %v", tt.modelID, got, tt.want)
+		}
+	}
+}
+
+func TestWithinDir(t *testing.T) {
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{"/data/models/a", true},
+		{"/data/models", true},
+		{"/data/models/../x", false},
+		{"/data/modelsx", false},
+		{"/etc", false},
+	}
+	for _, tt := range tests {
+		if got := WithinDir("/data/models", tt.path); got != tt.want {
+			t.Errorf("WithinDir(%q) = %v, want %v", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestNormalizeRepoPath(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"config.json", "config.json"},
+		{"./config.json", "config.json"},
+		{"/config.json", "config.json"},
+		{"sub\\tokenizer.json", "sub/tokenizer.json"},
+		{"sub//./tokenizer.json", "sub/tokenizer.json"},
+		{"../../config.json", "config.json"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := NormalizeRepoPath(tt.name); got != tt.want {
+			t.Errorf("NormalizeRepoPath(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestWriteRef(t *testing.T) {
+	const (
+		first  = "0123456789abcdef0123456789abcdef01234567"
+		second = "fedcba9876543210fedcba9876543210fedcba98"
+	)
+	tests := []struct {
+		name    string
+		initial string
+		commit  string
+	}{
+		{"new ref", "", first},
+		{"moved ref", first, second},
+		{"ref written by git with a newline", first + "\n", second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "refs", "pr", "1")
+			if tt.initial != "" {
+				if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(path, []byte(tt.initial), 0644); err != nil {
+					t.Fatal(err)
+				}
+				if got, err := ReadRef(path); err != nil || got != strings.TrimSpace(tt.initial) {
+					t.Fatalf("ReadRef = %q, %v before the move", got, err)
+				}
+			}
+			if err := WriteRef(path, tt.commit); err != nil {
+				t.Fatal(err)
+			}
+			if got, err := ReadRef(path); err != nil || got != tt.commit {
+				t.Errorf("ReadRef = %q, %v, want %q", got, err, tt.commit)
+			}
+			entries, err := os.ReadDir(filepath.Dir(path))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(entries) != 1 {
+				t.Errorf("refs directory holds %d entries, want only the ref", len(entries))
+			}
+		})
+	}
+}